@@ -0,0 +1,177 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package access
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"thumbai/app/models"
+
+	"aahframe.work"
+	"aahframe.work/ahttp"
+)
+
+// ValidateIPAccess method validates the given IP access configuration and
+// returns the field errors if any.
+func ValidateIPAccess(a *models.ProxyAccess) map[string]string {
+	errs := map[string]string{}
+	if _, err := ParseIPList(a.Allow); err != nil {
+		errs["aclAllow"] = err.Error()
+	}
+	if _, err := ParseIPList(a.Deny); err != nil {
+		errs["aclDeny"] = err.Error()
+	}
+	return errs
+}
+
+// ClientIP method returns the client IP address of the request. Headers
+// `X-Forwarded-For` and `X-Real-Ip` are honored only when the request comes
+// from trusted proxies, the right most untrusted address is the client.
+func ClientIP(req *http.Request) string {
+	remote := req.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	if !TrustedProxies.Contains(remote) {
+		return remote
+	}
+	if xff := req.Header.Get(ahttp.HeaderXForwardedFor); len(xff) > 0 {
+		ips := strings.Split(xff, ",")
+		for i := len(ips) - 1; i >= 0; i-- {
+			ip := strings.TrimSpace(ips[i])
+			if i == 0 || !TrustedProxies.Contains(ip) {
+				return ip
+			}
+		}
+	}
+	if xrip := strings.TrimSpace(req.Header.Get(ahttp.HeaderXRealIP)); len(xrip) > 0 {
+		return xrip
+	}
+	return remote
+}
+
+// Forbidden method replies `403 Forbidden` with given body, configured
+// forbidden page is used if body is empty.
+func Forbidden(ctx *aah.Context, body string) {
+	if len(body) == 0 {
+		body = ForbiddenPage
+	}
+	if len(body) == 0 {
+		ctx.Reply().Forbidden().Text("403 Forbidden")
+		return
+	}
+	ctx.Reply().Forbidden().Bytes(http.DetectContentType([]byte(body)), []byte(body))
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// IP list and filter types and its methods
+//______________________________________________________________________________
+
+// IPList is the list of IP networks, single IP address is a network with
+// full mask.
+type IPList []*net.IPNet
+
+// ParseIPList method parses the given IP addresses and CIDR values.
+func ParseIPList(values []string) (IPList, error) {
+	var list IPList
+	for _, v := range values {
+		v = strings.Trim(strings.TrimSpace(v), "[]")
+		if len(v) == 0 {
+			continue
+		}
+		if strings.IndexByte(v, '/') == -1 {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address '%s'", v)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			list = append(list, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipnet, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR '%s'", v)
+		}
+		list = append(list, ipnet)
+	}
+	return list, nil
+}
+
+// Contains method returns true if given IP address belongs to any of the
+// networks.
+func (l IPList) Contains(ip string) bool {
+	if len(l) == 0 {
+		return false
+	}
+	addr := net.ParseIP(strings.Trim(ip, "[]"))
+	if addr == nil {
+		return false
+	}
+	for _, n := range l {
+		if n.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// IPFilter holds the allow and deny lists. Deny list takes precedence,
+// empty allow list allows all.
+type IPFilter struct {
+	Allow         IPList
+	Deny          IPList
+	ForbiddenBody string
+}
+
+// NewIPFilter method creates the IP filter for the given configuration.
+func NewIPFilter(a *models.ProxyAccess) (*IPFilter, error) {
+	f := &IPFilter{ForbiddenBody: a.ForbiddenBody}
+	var err error
+	if f.Allow, err = ParseIPList(a.Allow); err != nil {
+		return nil, err
+	}
+	if f.Deny, err = ParseIPList(a.Deny); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Allowed method returns true if given IP address is allowed. Nil filter
+// allows all.
+func (f *IPFilter) Allowed(ip string) bool {
+	if f == nil {
+		return true
+	}
+	if f.Deny.Contains(ip) {
+		return false
+	}
+	return len(f.Allow) == 0 || f.Allow.Contains(ip)
+}
+
+// Check method replies `403 Forbidden` and returns false if request client
+// IP is not allowed.
+func (f *IPFilter) Check(ctx *aah.Context) bool {
+	if f == nil || f.Allowed(ClientIP(ctx.Req.Unwrap())) {
+		return true
+	}
+	Forbidden(ctx, f.ForbiddenBody)
+	return false
+}
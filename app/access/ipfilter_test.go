@@ -0,0 +1,69 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package access
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"thumbai/app/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIPFilter(t *testing.T) {
+	f, err := NewIPFilter(&models.ProxyAccess{
+		Allow: []string{"10.0.0.0/8", "192.168.1.10", "2001:db8::/32"},
+		Deny:  []string{"10.0.10.0/24"},
+	})
+	assert.Nil(t, err)
+	assert.True(t, f.Allowed("10.1.2.3"))
+	assert.True(t, f.Allowed("192.168.1.10"))
+	assert.True(t, f.Allowed("[2001:db8::1]"))
+	assert.False(t, f.Allowed("10.0.10.5"))
+	assert.False(t, f.Allowed("192.168.1.11"))
+	assert.False(t, f.Allowed("invalid"))
+
+	f, _ = NewIPFilter(&models.ProxyAccess{Deny: []string{"::1"}})
+	assert.True(t, f.Allowed("127.0.0.1"))
+	assert.False(t, f.Allowed("::1"))
+
+	var nilFilter *IPFilter
+	assert.True(t, nilFilter.Allowed("127.0.0.1"))
+
+	errs := ValidateIPAccess(&models.ProxyAccess{Allow: []string{"10.0.0.0/33"}, Deny: []string{"abc"}})
+	assert.Equal(t, 2, len(errs))
+}
+
+func TestClientIP(t *testing.T) {
+	defer func() { TrustedProxies = nil }()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.1:4567"
+	req.Header.Set("X-Forwarded-For", "1.1.1.1, 2.2.2.2, 10.0.0.2")
+
+	// untrusted remote, headers are ignored
+	assert.Equal(t, "10.0.0.1", ClientIP(req))
+
+	TrustedProxies, _ = ParseIPList([]string{"10.0.0.0/8"})
+	assert.Equal(t, "2.2.2.2", ClientIP(req))
+
+	req.Header.Set("X-Forwarded-For", "10.0.0.3")
+	assert.Equal(t, "10.0.0.3", ClientIP(req))
+
+	req.Header.Del("X-Forwarded-For")
+	req.Header.Set("X-Real-Ip", "3.3.3.3")
+	assert.Equal(t, "3.3.3.3", ClientIP(req))
+}
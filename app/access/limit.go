@@ -15,16 +15,20 @@
 package access
 
 import (
+	"io/ioutil"
+
 	"aahframe.work"
 	"aahframe.work/essentials"
 )
 
 // Values
 var (
-	AdminHost     string
-	AllowedIPs    []string
-	UserStore     = map[string]User{}
-	GoModDisabled bool
+	AdminHost      string
+	AdminIPFilter  *IPFilter
+	TrustedProxies IPList
+	ForbiddenPage  string
+	UserStore      = map[string]User{}
+	GoModDisabled  bool
 )
 
 // Load method configures the thumbai access limits.
@@ -34,10 +38,31 @@ func Load(_ *aah.Event) {
 	AdminHost = cfg.StringDefault("thumbai.admin.host", "")
 	GoModDisabled = cfg.BoolDefault("thumbai.admin.disable.gomod_repo", false)
 
-	var found bool
-	AllowedIPs, found = cfg.StringList("thumbai.admin.allow_only")
+	var err error
+	trusted, _ := cfg.StringList("thumbai.trusted_proxies")
+	if TrustedProxies, err = ParseIPList(trusted); err != nil {
+		app.Log().Fatalf("'thumbai.trusted_proxies' configuration: %v", err)
+	}
+
+	allowed, found := cfg.StringList("thumbai.admin.allow_only")
 	if found {
-		AllowedIPs = append(AllowedIPs, "127.0.0.1", "::1", "[::1]")
+		allowed = append(allowed, "127.0.0.1", "::1")
+	}
+	denied, _ := cfg.StringList("thumbai.admin.deny")
+	AdminIPFilter = &IPFilter{}
+	if AdminIPFilter.Allow, err = ParseIPList(allowed); err != nil {
+		app.Log().Fatalf("'thumbai.admin.allow_only' configuration: %v", err)
+	}
+	if AdminIPFilter.Deny, err = ParseIPList(denied); err != nil {
+		app.Log().Fatalf("'thumbai.admin.deny' configuration: %v", err)
+	}
+
+	if page := cfg.StringDefault("thumbai.forbidden_page", ""); len(page) > 0 {
+		b, err := ioutil.ReadFile(page)
+		if err != nil {
+			app.Log().Errorf("'thumbai.forbidden_page' configuration: %v", err)
+		}
+		ForbiddenPage = string(b)
 	}
 
 	if !cfg.IsExists("thumbai.user_datastore") {
@@ -66,15 +91,7 @@ func Load(_ *aah.Event) {
 
 // IsAllowedFromIP method is used to check IP address allowed to admin interface.
 func IsAllowedFromIP(ip string) bool {
-	if len(AllowedIPs) == 0 {
-		return true
-	}
-	for _, ap := range AllowedIPs {
-		if ap == ip {
-			return true
-		}
-	}
-	return false
+	return AdminIPFilter.Allowed(ip)
 }
 
 // User struct represents the THUMBAI application user.
@@ -0,0 +1,197 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package access
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"thumbai/app/models"
+
+	"aahframe.work"
+	"aahframe.work/ahttp"
+)
+
+// Rate limit keys, header key is `header:<Header-Name>`.
+const (
+	RateLimitKeyClientIP = "client-ip"
+	RateLimitKeyUser     = "user"
+	rateLimitKeyHeader   = "header:"
+)
+
+// KeyAuthUser is the context key of the authenticated user name, it's used
+// by rate limit key `user`.
+const KeyAuthUser = "thumbai.auth.user"
+
+// idle buckets are swept at this interval
+const rateLimitSweepInterval = time.Minute
+
+// ValidateRateLimit method validates the given rate limit configuration and
+// returns the field errors if any.
+func ValidateRateLimit(rl *models.RateLimit) map[string]string {
+	errs := map[string]string{}
+	if rl.Rate <= 0 {
+		errs["rlRate"] = "Must be greater than zero"
+	}
+	if len(rl.Per) > 0 {
+		if d, err := time.ParseDuration(rl.Per); err != nil || d <= 0 {
+			errs["rlPer"] = "Invalid duration value, e.g. 1s, 1m"
+		}
+	}
+	if rl.Burst < 0 {
+		errs["rlBurst"] = "Must be a positive number"
+	}
+	switch {
+	case len(rl.Key) == 0, rl.Key == RateLimitKeyClientIP, rl.Key == RateLimitKeyUser:
+	case strings.HasPrefix(rl.Key, rateLimitKeyHeader) && len(strings.TrimSpace(rl.Key[len(rateLimitKeyHeader):])) > 0:
+	default:
+		errs["rlKey"] = "Supported keys are client-ip, user and header:<Header-Name>"
+	}
+	return errs
+}
+
+// Limit method checks the request against the given rate limiter, it
+// replies `429 Too Many Requests` with header `Retry-After` and returns true
+// if limit is exceeded. Nil limiter allows all.
+func Limit(ctx *aah.Context, l *RateLimiter) bool {
+	exceeded, wait := Exceeded(ctx, l)
+	if !exceeded {
+		return false
+	}
+	ctx.Reply().
+		Header(ahttp.HeaderRetryAfter, RetryAfter(wait)).
+		Status(http.StatusTooManyRequests).
+		Text("429 Too Many Requests")
+	return true
+}
+
+// Exceeded method checks the request against the given rate limiter and
+// returns true with the wait duration if limit is exceeded. Nil limiter
+// allows all.
+func Exceeded(ctx *aah.Context, l *RateLimiter) (bool, time.Duration) {
+	if l == nil {
+		return false, 0
+	}
+	user, _ := ctx.Get(KeyAuthUser).(string)
+	allowed, wait := l.Allow(l.Key(ctx.Req.Unwrap(), user))
+	return !allowed, wait
+}
+
+// RetryAfter method returns the `Retry-After` header value of given wait
+// duration in seconds.
+func RetryAfter(wait time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(wait.Seconds())))
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// Rate limiter type and its methods
+//______________________________________________________________________________
+
+// RateLimiter implements token bucket rate limit per key.
+type RateLimiter struct {
+	sync.Mutex
+	KeyOn     string
+	rate      float64 // tokens per second
+	burst     float64
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter method creates the rate limiter for the given
+// configuration. Per defaults to `1s`, burst defaults to rate.
+func NewRateLimiter(rl *models.RateLimit) (*RateLimiter, error) {
+	if errs := ValidateRateLimit(rl); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid rate limit config: %v", errs)
+	}
+	per := time.Second
+	if len(rl.Per) > 0 {
+		per, _ = time.ParseDuration(rl.Per)
+	}
+	l := &RateLimiter{
+		KeyOn:   rl.Key,
+		rate:    float64(rl.Rate) / per.Seconds(),
+		burst:   float64(rl.Burst),
+		buckets: make(map[string]*tokenBucket),
+		now:     time.Now,
+	}
+	if l.burst == 0 {
+		l.burst = float64(rl.Rate)
+	}
+	if len(l.KeyOn) == 0 {
+		l.KeyOn = RateLimitKeyClientIP
+	}
+	l.lastSweep = l.now()
+	return l, nil
+}
+
+// Allow method takes a token from the bucket of the given key. It returns
+// false and the wait duration for next token if bucket is empty.
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	l.Lock()
+	defer l.Unlock()
+	now := l.now()
+	l.sweep(now)
+	b, found := l.buckets[key]
+	if !found {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// Key method returns the rate limit key of the request. Requests without
+// header value or user are limited by client IP.
+func (l *RateLimiter) Key(req *http.Request, user string) string {
+	switch {
+	case l.KeyOn == RateLimitKeyUser && len(user) > 0:
+		return "user:" + user
+	case strings.HasPrefix(l.KeyOn, rateLimitKeyHeader):
+		if v := req.Header.Get(strings.TrimSpace(l.KeyOn[len(rateLimitKeyHeader):])); len(v) > 0 {
+			return "header:" + v
+		}
+	}
+	return "ip:" + ClientIP(req)
+}
+
+// sweep method removes the buckets which are refilled to burst, they are
+// same as new bucket.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for k, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, k)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package access
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"thumbai/app/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	l, err := NewRateLimiter(&models.RateLimit{Rate: 2, Per: "1s", Burst: 3})
+	assert.Nil(t, err)
+	now := time.Now()
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		ok, _ := l.Allow("a")
+		assert.True(t, ok)
+	}
+	ok, wait := l.Allow("a")
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	// other keys have own bucket
+	ok, _ = l.Allow("b")
+	assert.True(t, ok)
+
+	now = now.Add(500 * time.Millisecond)
+	ok, _ = l.Allow("a")
+	assert.True(t, ok)
+	ok, _ = l.Allow("a")
+	assert.False(t, ok)
+
+	// refilled buckets are swept
+	now = now.Add(2 * time.Minute)
+	_, _ = l.Allow("c")
+	assert.Equal(t, 1, len(l.buckets))
+}
+
+func TestRateLimiterKey(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.1:4567"
+	req.Header.Set("X-Api-Key", "k1")
+
+	l, _ := NewRateLimiter(&models.RateLimit{Rate: 1, Key: "header:X-Api-Key"})
+	assert.Equal(t, "header:k1", l.Key(req, ""))
+	req.Header.Del("X-Api-Key")
+	assert.Equal(t, "ip:10.0.0.1", l.Key(req, ""))
+
+	l, _ = NewRateLimiter(&models.RateLimit{Rate: 1, Key: "user"})
+	assert.Equal(t, "user:jeeva", l.Key(req, "jeeva"))
+	assert.Equal(t, "ip:10.0.0.1", l.Key(req, ""))
+
+	l, _ = NewRateLimiter(&models.RateLimit{Rate: 1})
+	assert.Equal(t, RateLimitKeyClientIP, l.KeyOn)
+}
+
+func TestValidateRateLimit(t *testing.T) {
+	errs := ValidateRateLimit(&models.RateLimit{Rate: 0, Per: "abc", Burst: -1, Key: "cookie:a"})
+	assert.Equal(t, 4, len(errs))
+	errs = ValidateRateLimit(&models.RateLimit{Rate: 10, Per: "1m", Key: "header:X-Api-Key"})
+	assert.Equal(t, 0, len(errs))
+	_, err := NewRateLimiter(&models.RateLimit{})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,271 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package accesslog implements the THUMBAI access log of all the traffic it
+// serves, in JSON or combined log format with file rotation.
+package accesslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"thumbai/app/access"
+	"thumbai/app/tracing"
+
+	"aahframe.work"
+	"aahframe.work/ahttp"
+)
+
+// Access log formats
+const (
+	FormatJSON     = "json"
+	FormatCombined = "combined"
+)
+
+// KeyInfo is the context key of the proxy request info.
+const KeyInfo = "thumbai.accesslog.info"
+
+const (
+	defaultMaxSize    = 100 // MB
+	defaultMaxBackups = 10
+)
+
+var std struct {
+	sync.RWMutex
+	logger *logger
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// Package methods
+//______________________________________________________________________________
+
+// Load method configures the access log on app startup using config
+// `thumbai.access_log`.
+func Load(_ *aah.Event) {
+	app := aah.App()
+	cfg := app.Config()
+	if !cfg.BoolDefault("thumbai.access_log.enable", false) {
+		return
+	}
+	format := cfg.StringDefault("thumbai.access_log.format", FormatJSON)
+	if format != FormatJSON && format != FormatCombined {
+		app.Log().Errorf("'thumbai.access_log.format' unsupported value '%s', supported values are json and combined", format)
+		return
+	}
+
+	var w io.Writer = os.Stdout
+	file := cfg.StringDefault("thumbai.access_log.file", "thumbai-access.log")
+	if file != "stdout" {
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(app.BaseDir(), file)
+		}
+		rw, err := newRotateWriter(file,
+			int64(cfg.IntDefault("thumbai.access_log.rotate.max_size", defaultMaxSize))<<20,
+			cfg.IntDefault("thumbai.access_log.rotate.max_backups", defaultMaxBackups))
+		if err != nil {
+			app.Log().Errorf("'thumbai.access_log.file' configuration: %v", err)
+			return
+		}
+		w = rw
+	}
+	std.Lock()
+	std.logger = &logger{format: format, w: w}
+	std.Unlock()
+	app.Log().Infof("Access log is enabled, format: %s, file: %s", format, file)
+}
+
+// Close method closes the access log file.
+func Close(_ *aah.Event) {
+	std.Lock()
+	defer std.Unlock()
+	if std.logger != nil {
+		if c, ok := std.logger.w.(io.Closer); ok {
+			_ = c.Close()
+		}
+		std.logger = nil
+	}
+}
+
+// Middleware method logs the request after it's processed, it has to be
+// the first middleware to account the complete latency.
+func Middleware(ctx *aah.Context, m *aah.Middleware) {
+	std.RLock()
+	l := std.logger
+	std.RUnlock()
+	if l == nil {
+		m.Next(ctx)
+		return
+	}
+
+	start := time.Now()
+	m.Next(ctx)
+	info, _ := ctx.Get(KeyInfo).(*Info)
+	status := ctx.Res.Status()
+	if status == 0 {
+		status = ctx.Reply().Code
+	}
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if !info.sampled(status) {
+		return
+	}
+
+	req := ctx.Req.Unwrap()
+	user, _ := ctx.Get(access.KeyAuthUser).(string)
+	e := &Entry{
+		Time:      start,
+		Host:      req.Host,
+		Method:    req.Method,
+		URI:       req.RequestURI,
+		Proto:     req.Proto,
+		Status:    status,
+		Bytes:     ctx.Res.BytesWritten(),
+		Latency:   millis(time.Since(start)),
+		ClientIP:  access.ClientIP(req),
+		User:      user,
+		RequestID: req.Header.Get(ahttp.HeaderXRequestID),
+		Referer:   req.Referer(),
+		UserAgent: req.UserAgent(),
+	}
+	if span := tracing.FromContext(ctx); span != nil {
+		e.TraceID = span.TraceID
+	}
+	if info != nil {
+		e.Rule = info.Rule
+		e.Upstream = info.Upstream
+		e.UpstreamLatency = millis(info.UpstreamLatency)
+	}
+	l.Log(e)
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// Info and Entry type
+//______________________________________________________________________________
+
+// Info holds the proxy details of the request, proxy sets it on the
+// context. Sample is the percentage of requests to be logged, zero means
+// all; `5xx` responses are always logged unless disabled.
+type Info struct {
+	Rule            string
+	Upstream        string
+	UpstreamLatency time.Duration
+	Disabled        bool
+	Sample          int
+}
+
+func (i *Info) sampled(status int) bool {
+	switch {
+	case i == nil:
+		return true
+	case i.Disabled:
+		return false
+	case i.Sample <= 0 || i.Sample >= 100 || status >= http.StatusInternalServerError:
+		return true
+	}
+	return rand.Intn(100) < i.Sample
+}
+
+// Entry represents the single access log entry, latencies are in
+// milliseconds.
+type Entry struct {
+	Time            time.Time `json:"time"`
+	Host            string    `json:"host"`
+	Method          string    `json:"method"`
+	URI             string    `json:"uri"`
+	Proto           string    `json:"proto"`
+	Status          int       `json:"status"`
+	Bytes           int       `json:"bytes"`
+	Latency         float64   `json:"latency_ms"`
+	Rule            string    `json:"rule,omitempty"`
+	Upstream        string    `json:"upstream,omitempty"`
+	UpstreamLatency float64   `json:"upstream_latency_ms,omitempty"`
+	ClientIP        string    `json:"client_ip"`
+	User            string    `json:"user,omitempty"`
+	RequestID       string    `json:"request_id,omitempty"`
+	TraceID         string    `json:"trace_id,omitempty"`
+	Referer         string    `json:"referer,omitempty"`
+	UserAgent       string    `json:"user_agent,omitempty"`
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// Logger type and its methods
+//______________________________________________________________________________
+
+type logger struct {
+	sync.Mutex
+	format string
+	w      io.Writer
+}
+
+// Log method writes the entry in the configured format.
+func (l *logger) Log(e *Entry) {
+	var line []byte
+	if l.format == FormatCombined {
+		line = []byte(combined(e))
+	} else {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return
+		}
+		line = append(b, '\n')
+	}
+	l.Lock()
+	_, _ = l.w.Write(line)
+	l.Unlock()
+}
+
+// combined method formats the entry in the Apache combined log format,
+// THUMBAI fields are appended as `key=value`.
+func combined(e *Entry) string {
+	user, bytes := "-", "-"
+	if len(e.User) > 0 {
+		user = e.User
+	}
+	if e.Bytes > 0 {
+		bytes = strconv.Itoa(e.Bytes)
+	}
+	return fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %s \"%s\" \"%s\" host=\"%s\" rule=\"%s\" upstream=\"%s\" latency_ms=%s upstream_latency_ms=%s request_id=\"%s\" trace_id=\"%s\"\n",
+		e.ClientIP, user, e.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		e.Method, escape(e.URI), e.Proto, e.Status, bytes,
+		escape(e.Referer), escape(e.UserAgent), escape(e.Host),
+		escape(e.Rule), escape(e.Upstream), formatFloat(e.Latency),
+		formatFloat(e.UpstreamLatency), escape(e.RequestID), escape(e.TraceID))
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escape(s string) string {
+	if len(s) == 0 {
+		return "-"
+	}
+	return escaper.Replace(s)
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
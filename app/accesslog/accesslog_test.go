@@ -0,0 +1,95 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testEntry() *Entry {
+	return &Entry{
+		Time:            time.Date(2026, 10, 17, 7, 8, 43, 0, time.UTC),
+		Host:            "example.com",
+		Method:          "GET",
+		URI:             "/docs?q=\"a\"",
+		Proto:           "HTTP/1.1",
+		Status:          200,
+		Bytes:           1234,
+		Latency:         12.5,
+		Rule:            "http://localhost:8080",
+		Upstream:        "http://10.0.0.1:8080",
+		UpstreamLatency: 10.25,
+		ClientIP:        "192.168.1.10",
+		RequestID:       "abc123",
+		TraceID:         "4bf92f3577b34da6a3ce929d0e0e4736",
+		UserAgent:       "curl/7.64.1",
+	}
+}
+
+func TestLogCombined(t *testing.T) {
+	buf := new(bytes.Buffer)
+	l := &logger{format: FormatCombined, w: buf}
+	l.Log(testEntry())
+	assert.Equal(t, `192.168.1.10 - - [17/Oct/2026:07:08:43 +0000] "GET /docs?q=\"a\" HTTP/1.1" 200 1234 "-" "curl/7.64.1" host="example.com" rule="http://localhost:8080" upstream="http://10.0.0.1:8080" latency_ms=12.5 upstream_latency_ms=10.25 request_id="abc123" trace_id="4bf92f3577b34da6a3ce929d0e0e4736"`+"\n", buf.String())
+
+	buf.Reset()
+	e := &Entry{Time: testEntry().Time, Host: "example.com", Method: "GET", URI: "/", Proto: "HTTP/1.1", Status: 304, ClientIP: "::1", User: "jeeva"}
+	l.Log(e)
+	assert.Equal(t, `::1 - jeeva [17/Oct/2026:07:08:43 +0000] "GET / HTTP/1.1" 304 - "-" "-" host="example.com" rule="-" upstream="-" latency_ms=0 upstream_latency_ms=0 request_id="-" trace_id="-"`+"\n", buf.String())
+}
+
+func TestLogJSON(t *testing.T) {
+	buf := new(bytes.Buffer)
+	l := &logger{format: FormatJSON, w: buf}
+	l.Log(testEntry())
+	assert.Equal(t, byte('\n'), buf.Bytes()[buf.Len()-1])
+
+	var m map[string]interface{}
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &m))
+	assert.Equal(t, "example.com", m["host"])
+	assert.Equal(t, "http://localhost:8080", m["rule"])
+	assert.Equal(t, "http://10.0.0.1:8080", m["upstream"])
+	assert.Equal(t, float64(200), m["status"])
+	assert.Equal(t, float64(1234), m["bytes"])
+	assert.Equal(t, 12.5, m["latency_ms"])
+	assert.Equal(t, 10.25, m["upstream_latency_ms"])
+	assert.Equal(t, "192.168.1.10", m["client_ip"])
+	assert.Equal(t, "abc123", m["request_id"])
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", m["trace_id"])
+	_, found := m["user"]
+	assert.False(t, found)
+}
+
+func TestInfoSampled(t *testing.T) {
+	var info *Info
+	assert.True(t, info.sampled(200))
+	assert.False(t, (&Info{Disabled: true}).sampled(500))
+	assert.True(t, (&Info{Sample: 100}).sampled(200))
+
+	info = &Info{Sample: 10}
+	logged := 0
+	for i := 0; i < 1000; i++ {
+		if info.sampled(200) {
+			logged++
+		}
+		assert.True(t, info.sampled(502))
+	}
+	assert.True(t, logged > 30 && logged < 200, "logged %d", logged)
+}
@@ -0,0 +1,122 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accesslog
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const backupTimeFormat = "20060102-150405.000"
+
+// rotateWriter writes to the file and rotates it once max size is reached.
+// Rotated file is renamed with timestamp suffix and backups beyond max
+// backups are removed, oldest first.
+type rotateWriter struct {
+	sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+	now        func() time.Time
+}
+
+func newRotateWriter(path string, maxSize int64, maxBackups int) (*rotateWriter, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	w := &rotateWriter{path: path, maxSize: maxSize, maxBackups: maxBackups, now: time.Now}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write method writes the given bytes, the file is rotated prior to write
+// if it exceeds the max size.
+func (w *rotateWriter) Write(p []byte) (int, error) {
+	w.Lock()
+	defer w.Unlock()
+	if w.file == nil {
+		return 0, os.ErrClosed
+	}
+	if w.maxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.maxSize {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Close method closes the current file.
+func (w *rotateWriter) Close() error {
+	w.Lock()
+	defer w.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+func (w *rotateWriter) open() error {
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	w.file, w.size = f, fi.Size()
+	return nil
+}
+
+func (w *rotateWriter) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	w.file = nil
+	if err := os.Rename(w.path, w.path+"."+w.now().Format(backupTimeFormat)); err != nil {
+		return err
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+	w.prune()
+	return nil
+}
+
+func (w *rotateWriter) prune() {
+	if w.maxBackups <= 0 {
+		return
+	}
+	backups, _ := filepath.Glob(w.path + ".*")
+	if len(backups) <= w.maxBackups {
+		return
+	}
+	sort.Strings(backups)
+	for _, b := range backups[:len(backups)-w.maxBackups] {
+		_ = os.Remove(b)
+	}
+}
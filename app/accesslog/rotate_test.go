@@ -0,0 +1,67 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accesslog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotateWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "accesslog")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "logs", "access.log")
+	w, err := newRotateWriter(path, 10, 2)
+	assert.Nil(t, err)
+	now := time.Date(2026, 10, 17, 7, 8, 43, 0, time.UTC)
+	w.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+
+	for _, line := range []string{"line 1\n", "line 2\n", "line 3\n", "line 4\n"} {
+		_, err = w.Write([]byte(line))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, w.Close())
+
+	b, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "line 4\n", string(b))
+	backups, _ := filepath.Glob(path + ".*")
+	assert.Equal(t, []string{
+		path + ".20261017-070845.000",
+		path + ".20261017-070846.000",
+	}, backups)
+	b, _ = ioutil.ReadFile(backups[1])
+	assert.Equal(t, "line 3\n", string(b))
+
+	// reopen appends to existing file
+	w, err = newRotateWriter(path, 100, 2)
+	assert.Nil(t, err)
+	_, _ = w.Write([]byte("line 5\n"))
+	assert.Nil(t, w.Close())
+	b, _ = ioutil.ReadFile(path)
+	assert.Equal(t, "line 4\nline 5\n", string(b))
+
+	_, err = w.Write([]byte("closed\n"))
+	assert.Equal(t, os.ErrClosed, err)
+}
@@ -15,7 +15,10 @@
 package admin
 
 import (
+	"strings"
+
 	"thumbai/app/access"
+	"thumbai/app/models"
 
 	"aahframe.work"
 )
@@ -28,10 +31,48 @@ type BaseController struct {
 
 // Before method is an interceptor for admin path.
 func (c *BaseController) Before() {
-	if c.Req.Host != access.AdminHost || !access.IsAllowedFromIP(c.Req.ClientIP()) {
-		c.Reply().Forbidden().Text("403 Forbidden")
+	if c.Req.Host != access.AdminHost || !access.IsAllowedFromIP(access.ClientIP(c.Req.Unwrap())) {
+		access.Forbidden(c.Context, "")
 		c.Abort()
 		return
 	}
 	c.AddViewArg("IsPackaged", aah.App().IsPackaged())
 }
+
+// rateLimit method returns the rate limit of given form, nil if it's not
+// enabled. It replies field errors and returns false if form is invalid.
+func (c *BaseController) rateLimit(info *models.FormRateLimit) (*models.RateLimit, bool) {
+	errs := map[string]string{}
+	if info.MaxInFlight < 0 {
+		errs["rlMaxInFlight"] = "Must be a positive number"
+	}
+	var rl *models.RateLimit
+	if info.Enabled {
+		rl = &models.RateLimit{
+			Rate:  info.Rate,
+			Per:   strings.TrimSpace(info.Per),
+			Burst: info.Burst,
+			Key:   strings.TrimSpace(info.Key),
+		}
+		for name, msg := range access.ValidateRateLimit(rl) {
+			errs[name] = msg
+		}
+	}
+	if len(errs) > 0 {
+		c.replyFieldErrors(errs)
+		return nil, false
+	}
+	return rl, true
+}
+
+// replyFieldErrors method replies bad request with given field errors.
+func (c *BaseController) replyFieldErrors(errs map[string]string) {
+	var fieldErrors []*models.FieldError
+	for name, msg := range errs {
+		fieldErrors = append(fieldErrors, &models.FieldError{Name: name, Message: msg})
+	}
+	c.Reply().BadRequest().JSON(aah.Data{
+		"message": "failed",
+		"errors":  fieldErrors,
+	})
+}
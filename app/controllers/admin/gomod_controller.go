@@ -15,6 +15,7 @@
 package admin
 
 import (
+	"fmt"
 	"os"
 	"strings"
 
@@ -34,10 +35,13 @@ type GoModController struct {
 // Index method display the Go modules settings page.
 func (c *GoModController) Index() {
 	data := aah.Data{
-		"IsGoModules":   true,
-		"Stats":         gomod.Settings.Stats,
-		"Settings":      gomod.Settings,
-		"GoModDisabled": access.GoModDisabled,
+		"IsGoModules":    true,
+		"Stats":          gomod.Settings.Stats,
+		"Settings":       gomod.Settings,
+		"RateLimit":      gomod.GetSettings().RateLimit,
+		"UpstreamRoutes": upstreamRoutes(gomod.Settings.Upstreams),
+		"Credentials":    gomod.Credentials(),
+		"GoModDisabled":  access.GoModDisabled,
 	}
 	if adminEmail := aah.App().Config().StringDefault("thumbai.admin.contact_email", ""); len(adminEmail) > 0 {
 		data["AdminContactEmail"] = adminEmail
@@ -48,9 +52,16 @@ func (c *GoModController) Index() {
 // SaveSettings method saves user settings into data store.
 func (c *GoModController) SaveSettings(settings *models.ModuleSettings) {
 	var fieldErrors []*models.FieldError
+	native := settings.Fetcher == gomod.FetcherNative
+	if !native && settings.Fetcher != gomod.FetcherGo {
+		fieldErrors = append(fieldErrors, &models.FieldError{
+			Name:    "fetcher",
+			Message: "Module fetcher must be 'go' or 'native'",
+		})
+	}
 
 	// Existence check
-	if !ess.IsFileExists(settings.GoBinary) {
+	if !native && !ess.IsFileExists(settings.GoBinary) {
 		fieldErrors = append(fieldErrors, &models.FieldError{
 			Name:    "goBinary",
 			Message: "Go binary does not exists on the server",
@@ -82,12 +93,14 @@ func (c *GoModController) SaveSettings(settings *models.ModuleSettings) {
 		})
 	}
 	// Validate Go version
-	ver := gomod.GoVersion(settings.GoBinary)
-	if ver == "0.0.0" || !gomod.InferGo111AndAbove(ver) {
-		fieldErrors = append(fieldErrors, &models.FieldError{
-			Name:    "goBinary",
-			Message: "Requires go1.11 or above",
-		})
+	if !native {
+		ver := gomod.GoVersion(settings.GoBinary)
+		if ver == "0.0.0" || !gomod.InferGo111AndAbove(ver) {
+			fieldErrors = append(fieldErrors, &models.FieldError{
+				Name:    "goBinary",
+				Message: "Requires go1.11 or above",
+			})
+		}
 	}
 	if len(fieldErrors) > 0 {
 		c.Reply().BadRequest().JSON(aah.Data{"errors": fieldErrors})
@@ -97,7 +110,7 @@ func (c *GoModController) SaveSettings(settings *models.ModuleSettings) {
 	es := gomod.GetSettings()
 	es.GoBinary = settings.GoBinary
 	es.GoPath = settings.GoPath
-	es.GoProxy = settings.GoProxy
+	es.Fetcher = settings.Fetcher
 	if err := gomod.SaveSettings(es); err != nil {
 		c.Log().Error(err)
 		c.Reply().InternalServerError().JSON(aah.Data{
@@ -111,6 +124,149 @@ func (c *GoModController) SaveSettings(settings *models.ModuleSettings) {
 	})
 }
 
+// SaveRateLimit method saves the rate limit of go mod repository endpoint.
+func (c *GoModController) SaveRateLimit(info *models.FormRateLimit) {
+	rl, ok := c.rateLimit(info)
+	if !ok {
+		return
+	}
+	if err := gomod.SaveRateLimit(rl); err != nil {
+		c.Log().Error(err)
+		c.Reply().InternalServerError().JSON(aah.Data{
+			"message": "error occurred while saving rate limit",
+		})
+		return
+	}
+	c.Reply().JSON(aah.Data{
+		"message": "success",
+	})
+}
+
+// SaveUpstreams method saves the GOPROXY list, GOSUMDB and per-module
+// routing rules of upstreams.
+func (c *GoModController) SaveUpstreams(info *models.FormGoModUpstreams) {
+	goProxy, goSumDB := strings.TrimSpace(info.GoProxy), strings.TrimSpace(info.GoSumDB)
+	var routes []*models.ModuleUpstream
+	errs := make(map[string]string)
+	for _, ln := range strings.Split(info.Routes, "\n") {
+		fields := strings.Fields(ln)
+		switch len(fields) {
+		case 0:
+			continue
+		case 2:
+			routes = append(routes, &models.ModuleUpstream{Pattern: fields[0], Proxy: fields[1]})
+		default:
+			errs["upstreamRoutes"] = fmt.Sprintf("Route '%s' is not in the format 'pattern goproxy-list'", strings.TrimSpace(ln))
+		}
+	}
+	if len(errs) == 0 {
+		errs = gomod.ValidateUpstreams(goProxy, goSumDB, routes)
+	}
+	if len(errs) > 0 {
+		c.replyFieldErrors(errs)
+		return
+	}
+	if err := gomod.SaveUpstreams(goProxy, goSumDB, routes); err != nil {
+		c.Log().Error(err)
+		c.Reply().InternalServerError().JSON(aah.Data{
+			"message": "error occurred while saving upstreams",
+		})
+		return
+	}
+	c.Reply().JSON(aah.Data{
+		"message": "success",
+	})
+}
+
+// SavePrivate method saves the private and no checksum database module
+// patterns.
+func (c *GoModController) SavePrivate(info *models.FormGoModPrivate) {
+	private, noSumDB := strings.TrimSpace(info.Private), strings.TrimSpace(info.NoSumDB)
+	if errs := gomod.ValidatePrivate(private, noSumDB); len(errs) > 0 {
+		c.replyFieldErrors(errs)
+		return
+	}
+	if err := gomod.SavePrivate(private, noSumDB); err != nil {
+		c.Log().Error(err)
+		c.Reply().InternalServerError().JSON(aah.Data{
+			"message": "error occurred while saving private modules",
+		})
+		return
+	}
+	c.Reply().JSON(aah.Data{
+		"message": "success",
+	})
+}
+
+// AddCredential method adds the credential of private modules host, existing
+// credential of the host is replaced.
+func (c *GoModController) AddCredential(cred *models.ModuleCredential) {
+	cred.Host = strings.ToLower(strings.TrimSpace(cred.Host))
+	cred.Username = strings.TrimSpace(cred.Username)
+	cred.Token = strings.TrimSpace(cred.Token)
+	cred.SSHKey = strings.TrimSpace(cred.SSHKey)
+	if errs := gomod.ValidateCredential(cred); len(errs) > 0 {
+		c.replyFieldErrors(errs)
+		return
+	}
+	if err := gomod.SaveCredential(cred); err != nil {
+		c.Log().Error(err)
+		c.Reply().InternalServerError().JSON(aah.Data{
+			"message": "error occurred while saving credential",
+		})
+		return
+	}
+	c.Reply().JSON(aah.Data{
+		"message": "success",
+	})
+}
+
+// DelCredential method deletes the credential of private modules host.
+func (c *GoModController) DelCredential(hostName string) {
+	if err := gomod.DelCredential(hostName); err != nil {
+		c.Log().Error(err)
+		c.Reply().InternalServerError().JSON(aah.Data{
+			"message": "failed",
+		})
+		return
+	}
+	c.Reply().NoContent()
+}
+
+// Policies method display the module policies page of go mod repository.
+func (c *GoModController) Policies() {
+	gomod.Settings.RLock()
+	policies := gomod.Settings.Policies
+	gomod.Settings.RUnlock()
+	c.Reply().HTML(aah.Data{
+		"IsGoModules": true,
+		"Policies":    gomod.PolicyLines(policies),
+		"Audits":      gomod.PolicyAudits(),
+	})
+}
+
+// SavePolicies method saves the module policies of go mod repository.
+func (c *GoModController) SavePolicies(info *models.FormGoModPolicies) {
+	policies, err := gomod.ParsePolicies(info.Policies)
+	if err != nil {
+		c.Reply().BadRequest().JSON(aah.Data{
+			"message": "failed",
+			"errors":  []*models.FieldError{{Name: "policies", Message: err.Error()}},
+		})
+		return
+	}
+	if err = gomod.SavePolicies(policies); err != nil {
+		c.Log().Error(err)
+		c.Reply().InternalServerError().JSON(aah.Data{
+			"message": "error occurred while saving policies",
+		})
+		return
+	}
+	c.Reply().JSON(aah.Data{
+		"message": "success",
+	})
+}
+
 // Publish method go modules into repository.
 //
 // Supported formats:
@@ -135,6 +291,30 @@ func (c *GoModController) Publish(pubReq *models.PublishRequest) {
 		return
 	}
 
+	clientIP := access.ClientIP(c.Req.Unwrap())
+	user := c.Subject().PrimaryPrincipal().Value
+	var blocked []string
+	status := 0
+	for _, m := range pubReq.Modules {
+		parts := strings.Split(m, "@")
+		if ess.IsStrEmpty(m) || len(parts) != 2 {
+			continue
+		}
+		if err := gomod.CheckModulePolicy(&gomod.Module{Path: parts[0], Version: parts[1]}); err != nil {
+			gomod.AuditPolicy(err, "publish", clientIP, user)
+			blocked = append(blocked, err.Error())
+			if status == 0 {
+				status = gomod.ErrorStatus(err)
+			}
+		}
+	}
+	if len(blocked) > 0 {
+		c.Reply().Status(status).JSON(aah.Data{
+			"message": strings.Join(blocked, "; "),
+		})
+		return
+	}
+
 	go func() {
 		for _, m := range pubReq.Modules {
 			if ess.IsStrEmpty(m) {
@@ -149,7 +329,10 @@ func (c *GoModController) Publish(pubReq *models.PublishRequest) {
 				aah.App().Log().Errorf("Publish: invalid module path '%s'", m)
 				continue
 			}
-			if _, err := gomod.Download(&gomod.Module{Path: parts[0], Version: parts[1]}); err != nil {
+			_, err := gomod.Download(&gomod.Module{Path: parts[0], Version: parts[1]})
+			if _, ok := err.(*gomod.PolicyError); ok {
+				gomod.AuditPolicy(err, "publish", clientIP, user)
+			} else if err != nil {
 				aah.App().Log().Error(err)
 			}
 		}
@@ -159,3 +342,11 @@ func (c *GoModController) Publish(pubReq *models.PublishRequest) {
 		"message": "go module(s) publish request accepted",
 	})
 }
+
+func upstreamRoutes(routes []*models.ModuleUpstream) string {
+	var lines []string
+	for _, r := range routes {
+		lines = append(lines, r.Pattern+" "+r.Proxy)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -15,7 +15,9 @@
 package admin
 
 import (
+	"strconv"
 	"strings"
+	"thumbai/app/access"
 	"thumbai/app/datastore"
 	"thumbai/app/models"
 	"thumbai/app/proxy"
@@ -46,9 +48,14 @@ func (c *ProxyController) List() {
 func (c *ProxyController) Show(hostName string) {
 	proxyRules := proxy.Get(hostName)
 	c.Reply().HTML(aah.Data{
-		"IsProxy":       true,
-		"ProxyHostName": hostName,
-		"ProxyRules":    proxyRules,
+		"IsProxy":         true,
+		"ProxyHostName":   hostName,
+		"ProxyRules":      proxyRules,
+		"HostSettings":    proxy.GetHostSettings(hostName),
+		"UpstreamsStatus": proxy.UpstreamsStatus(hostName),
+		"SplitStatus":     proxy.SplitStatus(hostName),
+		"MirrorStatus":    proxy.MirrorStatus(hostName),
+		"ErrorPageCodes":  proxy.ErrorPageCodes,
 	})
 }
 
@@ -86,12 +93,24 @@ func (c *ProxyController) Host(hostName string) {
 	rules := proxy.Get(hostName)
 	c.Reply().JSON(aah.Data{
 		"proxy_rules": rules,
+		"settings":    proxy.GetHostSettings(hostName),
 	})
 }
 
 // AddHost method adds the new proxy host into proxy store.
 func (c *ProxyController) AddHost(proxyInfo *models.FormTargetURL) {
 	var fieldErrors []*models.FieldError
+	if err := proxy.ValidateHostName(strings.TrimSpace(proxyInfo.Host)); err != nil {
+		fieldErrors = append(fieldErrors, &models.FieldError{
+			Name:    "hostName",
+			Message: err.Error(),
+		})
+		c.Reply().BadRequest().JSON(aah.Data{
+			"message": "failed",
+			"errors":  fieldErrors,
+		})
+		return
+	}
 	if err := proxy.AddHost(proxyInfo); err != nil {
 		switch {
 		case err == datastore.ErrRecordAlreadyExists:
@@ -125,6 +144,9 @@ func (c *ProxyController) DelHost(hostName string) {
 		})
 		return
 	}
+	if err := proxy.DelHostSettings(hostName); err != nil && err != datastore.ErrRecordNotFound {
+		c.Log().Error(err)
+	}
 	c.Reply().NoContent()
 	go proxy.Thumbai.DelHost(hostName)
 }
@@ -138,14 +160,66 @@ func (c *ProxyController) DelProxyRule(hostName, targetURL string) {
 	c.Reply().NoContent()
 }
 
-// EditTargetURL method handles values of TargetURL, LastRule and SkipTLSVerify.
+// PurgeCache method purges the cached responses of the host. Query param
+// `path` is a path prefix or `{regex}`, empty value purges all.
+func (c *ProxyController) PurgeCache(hostName string) {
+	cnt, err := proxy.PurgeCache(hostName, strings.TrimSpace(c.Req.QueryValue("path")))
+	if err != nil {
+		c.Reply().BadRequest().JSON(aah.Data{
+			"message": err.Error(),
+		})
+		return
+	}
+	c.Reply().JSON(aah.Data{
+		"message": "success",
+		"purged":  cnt,
+	})
+}
+
+// EditTargetURL method handles values of TargetURL, LastRule, SkipTLSVerify,
+// upstream targets and load balancer.
 func (c *ProxyController) EditTargetURL(info *models.FormTargetURL) {
+	targets, errs := util.Lines2Targets(info.Targets)
+	if len(errs) > 0 {
+		c.Log().Errorf("Proxy targets have errors on values %s", strings.Join(errs, ", "))
+		fieldErrors := append([]*models.FieldError{}, &models.FieldError{
+			Name:    "targets",
+			Message: "Targets has invalid values: \n" + strings.Join(errs, "\n"),
+		})
+		c.Reply().BadRequest().JSON(aah.Data{
+			"message": "failed",
+			"errors":  fieldErrors,
+		})
+		return
+	}
+
+	var loadBalancer *models.ProxyLoadBalancer
+	if len(info.LBStrategy) > 0 || len(info.LBHashOn) > 0 {
+		if !proxy.IsSupportedStrategy(info.LBStrategy) {
+			fieldErrors := append([]*models.FieldError{}, &models.FieldError{
+				Name:    "lbStrategy",
+				Message: "Unsupported load balancer strategy",
+			})
+			c.Reply().BadRequest().JSON(aah.Data{
+				"message": "failed",
+				"errors":  fieldErrors,
+			})
+			return
+		}
+		loadBalancer = &models.ProxyLoadBalancer{
+			Strategy: info.LBStrategy,
+			HashOn:   strings.TrimSpace(info.LBHashOn),
+		}
+	}
+
 	if ess.IsStrEmpty(info.OldTargetURL) {
 		if err := proxy.AddRule(&models.ProxyRule{
 			Host:          info.Host,
 			TargetURL:     info.TargetURL,
 			Last:          info.Last,
 			SkipTLSVerify: info.SkipTLSVerify,
+			Targets:       targets,
+			LoadBalancer:  loadBalancer,
 		}); err != nil {
 			c.Log().Errorf("Unable to added new proxy rule '%s' for %#v", err, info)
 			c.Reply().InternalServerError().JSON(aah.Data{
@@ -170,6 +244,8 @@ func (c *ProxyController) EditTargetURL(info *models.FormTargetURL) {
 	rule.TargetURL = info.TargetURL
 	rule.Last = info.Last
 	rule.SkipTLSVerify = info.SkipTLSVerify
+	rule.Targets = targets
+	rule.LoadBalancer = loadBalancer
 	c.updateRule("EditTargetURL", info.OldTargetURL, rule)
 }
 
@@ -188,40 +264,95 @@ func (c *ProxyController) EditConditions(info *models.FormConditions) {
 	if len(path) > 0 {
 		rule.Path = path
 	}
+	rule.Priority = info.Priority
 
 	var fieldErrors []*models.FieldError
+	var methods []string
+	for _, m := range util.Str2Values(info.Methods) {
+		m = strings.ToUpper(m)
+		if !util.IsHTTPMethod(m) {
+			fieldErrors = append(fieldErrors, &models.FieldError{
+				Name:    "methods",
+				Message: "Unsupported HTTP method: " + m,
+			})
+			continue
+		}
+		methods = append(methods, m)
+	}
+	rule.Methods = methods
+
 	queryParams, errs := util.Lines2MapString(info.QueryParams, "=", false)
+	errs = append(errs, proxy.ValidateMatchValues(queryParams)...)
 	if len(errs) > 0 {
 		c.Log().Errorf("Proxy conditions error on Query Param values %s", strings.Join(errs, ", "))
 		fieldErrors = append(fieldErrors, &models.FieldError{
 			Name:    "queryParams",
 			Message: "Query params has invalid values: \n" + strings.Join(errs, "\n"),
 		})
-		c.Reply().BadRequest().JSON(aah.Data{
-			"message": "failed",
-			"errors":  fieldErrors,
-		})
-		return
 	}
 	rule.QueryParams = queryParams
 
 	headers, errs := util.Lines2MapString(info.Headers, "=", true)
+	errs = append(errs, proxy.ValidateMatchValues(headers)...)
 	if len(errs) > 0 {
 		c.Log().Errorf("Proxy conditions error on Header values %s", strings.Join(errs, ", "))
 		fieldErrors = append(fieldErrors, &models.FieldError{
 			Name:    "headers",
 			Message: "Headers has invalid values: \n" + strings.Join(errs, "\n"),
 		})
+	}
+	rule.Headers = headers
+
+	cookies, errs := util.Lines2MapString(info.Cookies, "=", false)
+	errs = append(errs, proxy.ValidateMatchValues(cookies)...)
+	if len(errs) > 0 {
+		c.Log().Errorf("Proxy conditions error on Cookie values %s", strings.Join(errs, ", "))
+		fieldErrors = append(fieldErrors, &models.FieldError{
+			Name:    "cookies",
+			Message: "Cookies has invalid values: \n" + strings.Join(errs, "\n"),
+		})
+	}
+	rule.Cookies = cookies
+
+	if len(fieldErrors) > 0 {
 		c.Reply().BadRequest().JSON(aah.Data{
 			"message": "failed",
 			"errors":  fieldErrors,
 		})
 		return
 	}
-	rule.Headers = headers
 	c.updateRule("EditConditions", info.TargetURL, rule)
 }
 
+// MoveRule method moves the proxy rule one position up or down in the
+// evaluation order of the host, direction is `up` or `down`.
+func (c *ProxyController) MoveRule(hostName, targetURL, direction string) {
+	if direction != "up" && direction != "down" {
+		c.Reply().BadRequest().JSON(aah.Data{
+			"message": "Direction must be up or down",
+		})
+		return
+	}
+	rules, err := proxy.MoveRule(hostName, targetURL, direction == "up")
+	if err != nil {
+		if err == datastore.ErrRecordNotFound {
+			c.Reply().BadRequest().JSON(aah.Data{
+				"message": "Proxy rule not found",
+			})
+			return
+		}
+		c.Log().Errorf("MoveRule: Unable to move proxy rule %s", err)
+		c.Reply().InternalServerError().JSON(aah.Data{
+			"message": "Unable to move proxy rule",
+		})
+		return
+	}
+	proxy.Thumbai.ReorderRules(hostName, rules)
+	c.Reply().JSON(aah.Data{
+		"message": "success",
+	})
+}
+
 // EditRedirects method handles proxy redirects configurations.
 func (c *ProxyController) EditRedirects(info *models.FormRedirects) {
 	rule := proxy.GetRule(info.Host, info.TargetURL)
@@ -250,6 +381,34 @@ func (c *ProxyController) EditRedirects(info *models.FormRedirects) {
 	c.updateRule("EditRedirects", info.TargetURL, rule)
 }
 
+// EditRewrites method handles the upstream request path and query rewrites.
+func (c *ProxyController) EditRewrites(info *models.FormRewrites) {
+	rule := proxy.GetRule(info.Host, info.TargetURL)
+	if rule == nil {
+		c.Log().Errorf("Proxy rule not found for %#v", info)
+		c.Reply().BadRequest().JSON(aah.Data{
+			"message": "Proxy rule not found",
+		})
+		return
+	}
+
+	rewrites, errs := util.Lines2Rewrites(info.Rewrites)
+	if len(errs) > 0 {
+		c.Log().Errorf("Proxy rewrites have errors on values %s", strings.Join(errs, ", "))
+		fieldErrors := append([]*models.FieldError{}, &models.FieldError{
+			Name:    "rewrites",
+			Message: "Rewrites has invalid values: \n" + strings.Join(errs, "\n"),
+		})
+		c.Reply().BadRequest().JSON(aah.Data{
+			"message": "failed",
+			"errors":  fieldErrors,
+		})
+		return
+	}
+	rule.Rewrites = rewrites
+	c.updateRule("EditRewrites", info.TargetURL, rule)
+}
+
 // EditRestricts method handles the file restricts by extension and regex.
 func (c *ProxyController) EditRestricts(info *models.FormRestricts) {
 	rule := proxy.GetRule(info.Host, info.TargetURL)
@@ -435,7 +594,635 @@ func (c *ProxyController) EditResponseHeaders(info *models.FormResponseHeaders)
 	c.updateRule("EditResponseHeaders", info.TargetURL, rule)
 }
 
+// EditHealthCheck method handles the active health check configuration of
+// proxy rule targets. Empty path, interval and timeout values disables it.
+func (c *ProxyController) EditHealthCheck(info *models.FormHealthCheck) {
+	rule := proxy.GetRule(info.Host, info.TargetURL)
+	if rule == nil {
+		c.Log().Errorf("Proxy rule not found for %#v", info)
+		c.Reply().BadRequest().JSON(aah.Data{
+			"message": "Proxy rule not found",
+		})
+		return
+	}
+
+	hc := &models.ProxyHealthCheck{
+		Path:               strings.TrimSpace(info.Path),
+		Interval:           strings.TrimSpace(info.Interval),
+		Timeout:            strings.TrimSpace(info.Timeout),
+		ExpectedStatus:     strings.TrimSpace(info.ExpectedStatus),
+		HealthyThreshold:   info.HealthyThreshold,
+		UnhealthyThreshold: info.UnhealthyThreshold,
+	}
+	if len(hc.Path) == 0 && len(hc.Interval) == 0 && len(hc.Timeout) == 0 {
+		rule.HealthCheck = nil
+		c.updateRule("EditHealthCheck", info.TargetURL, rule)
+		return
+	}
+
+	if errs := proxy.ValidateHealthCheck(hc); len(errs) > 0 {
+		c.replyFieldErrors(errs)
+		return
+	}
+
+	rule.HealthCheck = hc
+	c.updateRule("EditHealthCheck", info.TargetURL, rule)
+}
+
+// EditCircuitBreaker method handles the circuit breaker configuration of
+// proxy rule targets. Zero consecutive failures and error rate disables it.
+func (c *ProxyController) EditCircuitBreaker(info *models.FormCircuitBreaker) {
+	rule := proxy.GetRule(info.Host, info.TargetURL)
+	if rule == nil {
+		c.Log().Errorf("Proxy rule not found for %#v", info)
+		c.Reply().BadRequest().JSON(aah.Data{
+			"message": "Proxy rule not found",
+		})
+		return
+	}
+
+	if info.ConsecutiveFailures == 0 && info.ErrorRate == 0 {
+		rule.CircuitBreaker = nil
+		c.updateRule("EditCircuitBreaker", info.TargetURL, rule)
+		return
+	}
+
+	cb := &models.ProxyCircuitBreaker{
+		ConsecutiveFailures: info.ConsecutiveFailures,
+		ErrorRate:           info.ErrorRate,
+		Window:              strings.TrimSpace(info.Window),
+		MinRequests:         info.MinRequests,
+		OpenTimeout:         strings.TrimSpace(info.OpenTimeout),
+		HalfOpenRequests:    info.HalfOpenRequests,
+		ResponseStatus:      info.ResponseStatus,
+		ResponseBody:        strings.TrimSpace(info.ResponseBody),
+	}
+	if errs := proxy.ValidateCircuitBreaker(cb); len(errs) > 0 {
+		c.replyFieldErrors(errs)
+		return
+	}
+
+	rule.CircuitBreaker = cb
+	c.updateRule("EditCircuitBreaker", info.TargetURL, rule)
+}
+
+// EditRetry method handles the retry policy configuration of proxy rule.
+// Zero max attempts disables it.
+func (c *ProxyController) EditRetry(info *models.FormRetry) {
+	rule := proxy.GetRule(info.Host, info.TargetURL)
+	if rule == nil {
+		c.Log().Errorf("Proxy rule not found for %#v", info)
+		c.Reply().BadRequest().JSON(aah.Data{
+			"message": "Proxy rule not found",
+		})
+		return
+	}
+
+	if info.MaxAttempts == 0 {
+		rule.Retry = nil
+		c.updateRule("EditRetry", info.TargetURL, rule)
+		return
+	}
+
+	var fieldErrors []*models.FieldError
+	statuses, errs := util.Str2Ints(info.Statuses)
+	if len(errs) > 0 {
+		fieldErrors = append(fieldErrors, &models.FieldError{
+			Name:    "retryStatuses",
+			Message: strings.Join(errs, ", "),
+		})
+	}
+	rp := &models.ProxyRetry{
+		MaxAttempts:        info.MaxAttempts,
+		OnConnectError:     info.OnConnectError,
+		Statuses:           statuses,
+		AllowNonIdempotent: info.AllowNonIdempotent,
+		Backoff:            strings.TrimSpace(info.Backoff),
+		MaxBodySize:        info.MaxBodySize,
+	}
+	if len(fieldErrors) == 0 {
+		for name, msg := range proxy.ValidateRetry(rp) {
+			fieldErrors = append(fieldErrors, &models.FieldError{Name: name, Message: msg})
+		}
+	}
+	if len(fieldErrors) > 0 {
+		c.Reply().BadRequest().JSON(aah.Data{
+			"message": "failed",
+			"errors":  fieldErrors,
+		})
+		return
+	}
+
+	rule.Retry = rp
+	c.updateRule("EditRetry", info.TargetURL, rule)
+}
+
+// EditTransport method handles the upstream transport settings of proxy rule.
+// All the empty values resets it to defaults.
+func (c *ProxyController) EditTransport(info *models.FormTransport) {
+	rule := proxy.GetRule(info.Host, info.TargetURL)
+	if rule == nil {
+		c.Log().Errorf("Proxy rule not found for %#v", info)
+		c.Reply().BadRequest().JSON(aah.Data{
+			"message": "Proxy rule not found",
+		})
+		return
+	}
+
+	t := &models.ProxyTransport{
+		DialTimeout:           strings.TrimSpace(info.DialTimeout),
+		TLSHandshakeTimeout:   strings.TrimSpace(info.TLSHandshakeTimeout),
+		ResponseHeaderTimeout: strings.TrimSpace(info.ResponseHeaderTimeout),
+		IdleConnTimeout:       strings.TrimSpace(info.IdleConnTimeout),
+		MaxIdleConnsPerHost:   info.MaxIdleConnsPerHost,
+		DisableHTTP2:          info.DisableHTTP2,
+		DisableKeepAlives:     info.DisableKeepAlives,
+		CAFile:                strings.TrimSpace(info.CAFile),
+		CertFile:              strings.TrimSpace(info.CertFile),
+		KeyFile:               strings.TrimSpace(info.KeyFile),
+		ServerName:            strings.TrimSpace(info.ServerName),
+	}
+	if *t == (models.ProxyTransport{}) {
+		rule.Transport = nil
+		c.updateRule("EditTransport", info.TargetURL, rule)
+		return
+	}
+
+	if errs := proxy.ValidateTransport(t); len(errs) > 0 {
+		c.replyFieldErrors(errs)
+		return
+	}
+
+	rule.Transport = t
+	c.updateRule("EditTransport", info.TargetURL, rule)
+}
+
+// EditUpgrade method handles the `Connection: Upgrade` (WebSocket, h2c)
+// configuration of proxy rule. All the empty values allows every upgrade
+// protocol without limits.
+func (c *ProxyController) EditUpgrade(info *models.FormUpgrade) {
+	rule := proxy.GetRule(info.Host, info.TargetURL)
+	if rule == nil {
+		c.Log().Errorf("Proxy rule not found for %#v", info)
+		c.Reply().BadRequest().JSON(aah.Data{
+			"message": "Proxy rule not found",
+		})
+		return
+	}
+
+	u := &models.ProxyUpgrade{
+		Disabled:    info.Disabled,
+		IdleTimeout: strings.TrimSpace(info.IdleTimeout),
+		MaxConns:    info.MaxConns,
+	}
+	for _, p := range strings.Split(info.Protocols, ",") {
+		if p = strings.ToLower(strings.TrimSpace(p)); len(p) > 0 {
+			u.Protocols = append(u.Protocols, p)
+		}
+	}
+	if !u.Disabled && len(u.Protocols) == 0 && len(u.IdleTimeout) == 0 && u.MaxConns == 0 {
+		rule.Upgrade = nil
+		c.updateRule("EditUpgrade", info.TargetURL, rule)
+		return
+	}
+
+	if errs := proxy.ValidateUpgrade(u); len(errs) > 0 {
+		c.replyFieldErrors(errs)
+		return
+	}
+
+	rule.Upgrade = u
+	c.updateRule("EditUpgrade", info.TargetURL, rule)
+}
+
+// EditCache method handles the response cache configuration of proxy rule.
+func (c *ProxyController) EditCache(info *models.FormCache) {
+	rule := proxy.GetRule(info.Host, info.TargetURL)
+	if rule == nil {
+		c.Log().Errorf("Proxy rule not found for %#v", info)
+		c.Reply().BadRequest().JSON(aah.Data{
+			"message": "Proxy rule not found",
+		})
+		return
+	}
+
+	if !info.Enabled {
+		rule.Cache = nil
+		c.updateRule("EditCache", info.TargetURL, rule)
+		return
+	}
+
+	pc := &models.ProxyCache{
+		Storage:              strings.TrimSpace(info.Storage),
+		Dir:                  strings.TrimSpace(info.Dir),
+		MaxSize:              info.MaxSize,
+		MaxEntrySize:         info.MaxEntrySize,
+		StaleWhileRevalidate: strings.TrimSpace(info.StaleWhileRevalidate),
+		StaleIfError:         strings.TrimSpace(info.StaleIfError),
+	}
+	if errs := proxy.ValidateCache(pc); len(errs) > 0 {
+		c.replyFieldErrors(errs)
+		return
+	}
+
+	rule.Cache = pc
+	c.updateRule("EditCache", info.TargetURL, rule)
+}
+
+// EditCompress method handles the response compression configuration of
+// proxy rule.
+func (c *ProxyController) EditCompress(info *models.FormCompress) {
+	rule := proxy.GetRule(info.Host, info.TargetURL)
+	if rule == nil {
+		c.Log().Errorf("Proxy rule not found for %#v", info)
+		c.Reply().BadRequest().JSON(aah.Data{
+			"message": "Proxy rule not found",
+		})
+		return
+	}
+
+	if !info.Enabled {
+		rule.Compress = nil
+		c.updateRule("EditCompress", info.TargetURL, rule)
+		return
+	}
+
+	pc := &models.ProxyCompress{MinSize: info.MinSize}
+	for _, e := range strings.Split(info.Encodings, ",") {
+		if e = strings.ToLower(strings.TrimSpace(e)); len(e) > 0 {
+			pc.Encodings = append(pc.Encodings, e)
+		}
+	}
+	for _, t := range strings.Split(info.Types, ",") {
+		if t = strings.ToLower(strings.TrimSpace(t)); len(t) > 0 {
+			pc.Types = append(pc.Types, t)
+		}
+	}
+	if errs := proxy.ValidateCompress(pc); len(errs) > 0 {
+		c.replyFieldErrors(errs)
+		return
+	}
+
+	rule.Compress = pc
+	c.updateRule("EditCompress", info.TargetURL, rule)
+}
+
+// EditRateLimit method handles the rate limit and max in-flight requests
+// per upstream of the proxy rule.
+func (c *ProxyController) EditRateLimit(info *models.FormRateLimit) {
+	rule := proxy.GetRule(info.Host, info.TargetURL)
+	if rule == nil {
+		c.Log().Errorf("Proxy rule not found for %#v", info)
+		c.Reply().BadRequest().JSON(aah.Data{
+			"message": "Proxy rule not found",
+		})
+		return
+	}
+
+	rl, ok := c.rateLimit(info)
+	if !ok {
+		return
+	}
+	rule.RateLimit = rl
+	rule.MaxInFlight = info.MaxInFlight
+	c.updateRule("EditRateLimit", info.TargetURL, rule)
+}
+
+// EditHostRateLimit method handles the host level rate limit.
+func (c *ProxyController) EditHostRateLimit(info *models.FormRateLimit) {
+	if len(proxy.Get(info.Host)) == 0 {
+		c.Reply().BadRequest().JSON(aah.Data{
+			"message": "Proxy host not found",
+		})
+		return
+	}
+
+	rl, ok := c.rateLimit(info)
+	if !ok {
+		return
+	}
+	settings := proxy.GetHostSettings(info.Host)
+	settings.RateLimit = rl
+	c.saveHostSettings("EditHostRateLimit", info.Host, settings)
+}
+
+// EditAccess method handles the client IP allow and deny lists of the proxy
+// rule.
+func (c *ProxyController) EditAccess(info *models.FormAccess) {
+	rule := proxy.GetRule(info.Host, info.TargetURL)
+	if rule == nil {
+		c.Log().Errorf("Proxy rule not found for %#v", info)
+		c.Reply().BadRequest().JSON(aah.Data{
+			"message": "Proxy rule not found",
+		})
+		return
+	}
+
+	pa, ok := c.ipAccess(info)
+	if !ok {
+		return
+	}
+	rule.Access = pa
+	c.updateRule("EditAccess", info.TargetURL, rule)
+}
+
+// EditHostAccess method handles the host level client IP allow and deny
+// lists.
+func (c *ProxyController) EditHostAccess(info *models.FormAccess) {
+	if len(proxy.Get(info.Host)) == 0 {
+		c.Reply().BadRequest().JSON(aah.Data{
+			"message": "Proxy host not found",
+		})
+		return
+	}
+
+	pa, ok := c.ipAccess(info)
+	if !ok {
+		return
+	}
+	settings := proxy.GetHostSettings(info.Host)
+	settings.Access = pa
+	c.saveHostSettings("EditHostAccess", info.Host, settings)
+}
+
+// EditHostErrorPages method handles the error page templates of the host.
+func (c *ProxyController) EditHostErrorPages(info *models.FormErrorPages) {
+	if len(proxy.Get(info.Host)) == 0 {
+		c.Reply().BadRequest().JSON(aah.Data{
+			"message": "Proxy host not found",
+		})
+		return
+	}
+
+	pages := map[string]string{}
+	for code, page := range map[string]string{
+		"403": info.Page403, "404": info.Page404, "429": info.Page429,
+		"502": info.Page502, "503": info.Page503, "504": info.Page504,
+	} {
+		if page = strings.TrimSpace(page); len(page) > 0 {
+			pages[code] = page
+		}
+	}
+	if errs := proxy.ValidateErrorPages(pages); len(errs) > 0 {
+		c.replyFieldErrors(errs)
+		return
+	}
+	settings := proxy.GetHostSettings(info.Host)
+	settings.ErrorPages = pages
+	c.saveHostSettings("EditHostErrorPages", info.Host, settings)
+}
+
+// EditHostMaintenance method handles the maintenance mode of the host,
+// config is kept when maintenance is disabled.
+func (c *ProxyController) EditHostMaintenance(info *models.FormMaintenance) {
+	if len(proxy.Get(info.Host)) == 0 {
+		c.Reply().BadRequest().JSON(aah.Data{
+			"message": "Proxy host not found",
+		})
+		return
+	}
+
+	m := &models.ProxyMaintenance{
+		Enabled:    info.Enabled,
+		Allow:      util.Str2Values(info.Allow),
+		Page:       strings.TrimSpace(info.Page),
+		RetryAfter: info.RetryAfter,
+	}
+	if errs := proxy.ValidateMaintenance(m); len(errs) > 0 {
+		c.replyFieldErrors(errs)
+		return
+	}
+	settings := proxy.GetHostSettings(info.Host)
+	settings.Maintenance = m
+	if !m.Enabled && len(m.Allow) == 0 && len(m.Page) == 0 && m.RetryAfter == 0 {
+		settings.Maintenance = nil
+	}
+	c.saveHostSettings("EditHostMaintenance", info.Host, settings)
+}
+
+// EditHostAccessLog method handles the access log settings of the host.
+func (c *ProxyController) EditHostAccessLog(info *models.FormAccessLog) {
+	if len(proxy.Get(info.Host)) == 0 {
+		c.Reply().BadRequest().JSON(aah.Data{
+			"message": "Proxy host not found",
+		})
+		return
+	}
+
+	al := &models.ProxyAccessLog{Disabled: !info.Enabled, Sample: info.Sample}
+	if errs := proxy.ValidateAccessLog(al); len(errs) > 0 {
+		c.replyFieldErrors(errs)
+		return
+	}
+	if al.Sample == 100 {
+		al.Sample = 0
+	}
+	settings := proxy.GetHostSettings(info.Host)
+	settings.AccessLog = al
+	if !al.Disabled && al.Sample == 0 {
+		settings.AccessLog = nil
+	}
+	c.saveHostSettings("EditHostAccessLog", info.Host, settings)
+}
+
+// EditAuth method handles the authentication config of the proxy rule.
+// Passwords and API keys are hashed before they are stored.
+func (c *ProxyController) EditAuth(info *models.FormAuth) {
+	rule := proxy.GetRule(info.Host, info.TargetURL)
+	if rule == nil {
+		c.Log().Errorf("Proxy rule not found for %#v", info)
+		c.Reply().BadRequest().JSON(aah.Data{
+			"message": "Proxy rule not found",
+		})
+		return
+	}
+
+	if len(strings.TrimSpace(info.Mode)) == 0 {
+		rule.Auth = nil
+		c.updateRule("EditAuth", info.TargetURL, rule)
+		return
+	}
+
+	existing := rule.Auth
+	if existing == nil {
+		existing = &models.ProxyAuth{}
+	}
+	pa := &models.ProxyAuth{
+		Mode:           strings.ToLower(strings.TrimSpace(info.Mode)),
+		Realm:          strings.TrimSpace(info.Realm),
+		APIKeyHeader:   strings.TrimSpace(info.APIKeyHeader),
+		ForwardURL:     strings.TrimSpace(info.ForwardURL),
+		ForwardTimeout: strings.TrimSpace(info.ForwardTimeout),
+		ForwardHeaders: util.Str2Values(info.ForwardHeaders),
+		UserHeader:     strings.TrimSpace(info.UserHeader),
+	}
+	errs := map[string]string{}
+	for _, line := range strings.Split(info.Users, "\n") {
+		if line = strings.TrimSpace(line); len(line) == 0 {
+			continue
+		}
+		if pa.Users == nil {
+			pa.Users = make(map[string]string)
+		}
+		name, password := line, ""
+		if idx := strings.IndexByte(line, ':'); idx > 0 {
+			name, password = line[:idx], line[idx+1:]
+		}
+		if len(password) == 0 {
+			if h, found := existing.Users[name]; found {
+				pa.Users[name] = h
+				continue
+			}
+			errs["authUsers"] = "Password is required for new user: " + name
+			continue
+		}
+		h, err := proxy.HashPassword(password)
+		if err != nil {
+			errs["authUsers"] = "Unable to hash password for user: " + name
+			continue
+		}
+		pa.Users[name] = h
+	}
+	for _, line := range strings.Split(info.APIKeys, "\n") {
+		if line = strings.TrimSpace(line); len(line) == 0 {
+			continue
+		}
+		if pa.APIKeys == nil {
+			pa.APIKeys = make(map[string]string)
+		}
+		name, key := line, ""
+		if idx := strings.IndexByte(line, '='); idx > 0 {
+			name, key = line[:idx], line[idx+1:]
+		}
+		if len(key) == 0 {
+			if h, found := existing.APIKeys[name]; found {
+				pa.APIKeys[name] = h
+				continue
+			}
+			errs["authAPIKeys"] = "Key is required for new API key: " + name
+			continue
+		}
+		pa.APIKeys[name] = proxy.HashAPIKey(key)
+	}
+	if len(errs) == 0 {
+		errs = proxy.ValidateAuth(pa)
+	}
+	if len(errs) > 0 {
+		c.replyFieldErrors(errs)
+		return
+	}
+
+	rule.Auth = pa
+	c.updateRule("EditAuth", info.TargetURL, rule)
+}
+
+// EditSplit method handles the traffic split of the proxy rule, it's applied
+// live and variant counts are kept across the updates.
+func (c *ProxyController) EditSplit(info *models.FormSplit) {
+	rule := proxy.GetRule(info.Host, info.TargetURL)
+	if rule == nil {
+		c.Log().Errorf("Proxy rule not found for %#v", info)
+		c.Reply().BadRequest().JSON(aah.Data{
+			"message": "Proxy rule not found",
+		})
+		return
+	}
+
+	if !info.Enabled {
+		rule.Split = nil
+		c.updateRule("EditSplit", info.TargetURL, rule)
+		return
+	}
+
+	variants, lineErrs := util.Lines2SplitVariants(info.Variants)
+	ps := &models.ProxySplit{
+		Variants:     variants,
+		StickyOn:     strings.TrimSpace(info.StickyOn),
+		AssignCookie: strings.TrimSpace(info.AssignCookie),
+	}
+	errs := proxy.ValidateSplit(ps)
+	if len(lineErrs) > 0 {
+		errs["splitVariants"] = "Variants has invalid values: \n" + strings.Join(lineErrs, "\n")
+	}
+	if len(errs) > 0 {
+		c.replyFieldErrors(errs)
+		return
+	}
+
+	rule.Split = ps
+	c.updateRule("EditSplit", info.TargetURL, rule)
+}
+
+// EditMirror method handles the traffic mirror of the proxy rule.
+func (c *ProxyController) EditMirror(info *models.FormMirror) {
+	rule := proxy.GetRule(info.Host, info.TargetURL)
+	if rule == nil {
+		c.Log().Errorf("Proxy rule not found for %#v", info)
+		c.Reply().BadRequest().JSON(aah.Data{
+			"message": "Proxy rule not found",
+		})
+		return
+	}
+
+	if !info.Enabled {
+		rule.Mirror = nil
+		c.updateRule("EditMirror", info.TargetURL, rule)
+		return
+	}
+
+	headers, lineErrs := util.Lines2MapString(info.Headers, "=", true)
+	pm := &models.ProxyMirror{
+		TargetURL:   strings.TrimSpace(info.ShadowURL),
+		Percent:     100, // all requests if empty, zero disables the mirror
+		MaxBodySize: info.MaxBodySize,
+		Headers:     headers,
+		Timeout:     strings.TrimSpace(info.Timeout),
+	}
+	var percentErr error
+	if p := strings.TrimSpace(info.Percent); len(p) > 0 {
+		pm.Percent, percentErr = strconv.Atoi(p)
+	}
+	errs := proxy.ValidateMirror(pm)
+	if percentErr != nil {
+		errs["mirrorPercent"] = "Must be in the range of 0-100"
+	}
+	if len(lineErrs) > 0 {
+		errs["mirrorHeaders"] = "Headers has invalid values: \n" + strings.Join(lineErrs, "\n")
+	}
+	if len(errs) > 0 {
+		c.replyFieldErrors(errs)
+		return
+	}
+
+	rule.Mirror = pm
+	c.updateRule("EditMirror", info.TargetURL, rule)
+}
+
+// SplitStatus method returns the traffic split variants of the proxy rule
+// with request and error counts.
+func (c *ProxyController) SplitStatus(hostName, targetURL string) {
+	c.Reply().JSON(aah.Data{
+		"variants": proxy.SplitStatus(hostName)[targetURL],
+	})
+}
+
+// ResetSplitStats method resets the request and error counts of the proxy
+// rule traffic split variants.
+func (c *ProxyController) ResetSplitStats(hostName, targetURL string) {
+	proxy.ResetSplitStats(hostName, targetURL)
+	c.Reply().NoContent()
+}
+
 func (c *ProxyController) updateRule(from, targetURL string, rule *models.ProxyRule) {
+	// rule is built before it's persisted, so invalid rule never gets into
+	// the data store
+	if err := proxy.Thumbai.UpdateRule(targetURL, rule); err != nil {
+		c.Log().Errorf("%s: Unable to apply proxy rule %s", from, err)
+		c.Reply().BadRequest().JSON(aah.Data{
+			"message": "Unable to apply proxy rule: " + err.Error(),
+		})
+		return
+	}
 	if err := proxy.UpdateRule(targetURL, rule); err != nil {
 		c.Log().Errorf("%s: Unable to update proxy rule %s", from, err)
 		c.Reply().InternalServerError().JSON(aah.Data{
@@ -443,8 +1230,38 @@ func (c *ProxyController) updateRule(from, targetURL string, rule *models.ProxyR
 		})
 		return
 	}
-	_ = proxy.Thumbai.UpdateRule(targetURL, rule)
 	c.Reply().JSON(aah.Data{
 		"message": "success",
 	})
 }
+
+func (c *ProxyController) saveHostSettings(from, hostName string, settings *models.ProxyHostSettings) {
+	if err := proxy.SaveHostSettings(hostName, settings); err != nil {
+		c.Log().Errorf("%s: Unable to update proxy host settings %s", from, err)
+		c.Reply().InternalServerError().JSON(aah.Data{
+			"message": "Unable to update proxy host settings",
+		})
+		return
+	}
+	c.Reply().JSON(aah.Data{
+		"message": "success",
+	})
+}
+
+// ipAccess method returns the IP access of given form, nil if it's empty.
+// It replies field errors and returns false if form is invalid.
+func (c *ProxyController) ipAccess(info *models.FormAccess) (*models.ProxyAccess, bool) {
+	pa := &models.ProxyAccess{
+		Allow:         util.Str2Values(info.Allow),
+		Deny:          util.Str2Values(info.Deny),
+		ForbiddenBody: strings.TrimSpace(info.ForbiddenBody),
+	}
+	if len(pa.Allow) == 0 && len(pa.Deny) == 0 && len(pa.ForbiddenBody) == 0 {
+		return nil, true
+	}
+	if errs := access.ValidateIPAccess(pa); len(errs) > 0 {
+		c.replyFieldErrors(errs)
+		return nil, false
+	}
+	return pa, true
+}
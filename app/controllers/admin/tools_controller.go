@@ -15,6 +15,7 @@
 package admin
 
 import (
+	"thumbai/app/gomod"
 	"thumbai/app/models"
 	"thumbai/app/proxy"
 	"thumbai/app/vanity"
@@ -37,14 +38,16 @@ func (c *ToolsController) Index() {
 
 // Export method implements THUMBAI configuration dats such as vanity, proxies, etc.
 //
-// NOTE: It does not export Go modules configuration, since inferred based on target
-// environment.
+// NOTE: It does not export Go modules configuration except rate limit, since
+// inferred based on target environment.
 func (c *ToolsController) Export() {
 	c.Reply().
 		Header(ahttp.HeaderContentDisposition, "attachment; filename=thumbai-configurations.json").
 		JSON(models.Configuration{
-			Vanities: vanity.All(),
-			Proxies:  proxy.All(),
+			Vanities:       vanity.All(),
+			Proxies:        proxy.All(),
+			ProxyHosts:     proxy.AllHostSettings(),
+			GoModRateLimit: gomod.GetSettings().RateLimit,
 		})
 }
 
@@ -58,5 +61,13 @@ func (c *ToolsController) Import(config *models.Configuration) {
 	if len(config.Proxies) > 0 {
 		proxy.Import(config.Proxies)
 	}
+	if len(config.ProxyHosts) > 0 {
+		proxy.ImportHostSettings(config.ProxyHosts)
+	}
+	if config.GoModRateLimit != nil {
+		if err := gomod.SaveRateLimit(config.GoModRateLimit); err != nil {
+			c.Log().Error(err)
+		}
+	}
 	c.Reply().NoContent()
 }
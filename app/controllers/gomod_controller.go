@@ -17,12 +17,29 @@ package controllers
 import (
 	"net/http"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"thumbai/app/access"
 	"thumbai/app/gomod"
+	"thumbai/app/metrics"
+	"thumbai/app/tracing"
 
 	"aahframe.work"
 	"aahframe.work/ahttp"
+	"aahframe.work/essentials"
+)
+
+// Go mod metrics
+var (
+	goModRequestsTotal = metrics.NewCounter("thumbai_gomod_requests_total",
+		"Total go mod requests by action list, info, mod, zip, latest and sumdb, action is 'invalid' for bad requests.", "action")
+	goModCacheTotal = metrics.NewCounter("thumbai_gomod_cache_total",
+		"Total go mod requests by result, 'hit' is served from repository and 'download' is fetched from origin.", "result")
+	goModDownloadDuration = metrics.NewHistogram("thumbai_gomod_download_duration_seconds",
+		"Go module download duration in seconds.", []float64{1, 2.5, 5, 10, 30, 60, 120, 300})
+	goModDownloadFailures = metrics.NewCounter("thumbai_gomod_download_failures_total",
+		"Total go module download failures.")
 )
 
 // GoModController handles `go mod` requests, this is gonna be future package management way.
@@ -30,8 +47,11 @@ type GoModController struct {
 	*aah.Context
 }
 
-// Handle method handles the go mode requests {list, info, mod, zip}
+// Handle method handles the go mode requests {list, info, mod, zip, latest}
+// as per GOPROXY protocol.
 func (c *GoModController) Handle(modPath string) {
+	span := tracing.FromContext(c.Context)
+	span.SetName("gomod")
 	if !gomod.Settings.Enabled {
 		c.Reply().ServiceUnavailable().Text("Go Proxy Server unavailable due to prerequisites not met on server, please check thumbai logs")
 		return
@@ -42,36 +62,94 @@ func (c *GoModController) Handle(modPath string) {
 		return
 	}
 
+	gomod.Settings.RLock()
+	limiter := gomod.Settings.RateLimit
+	gomod.Settings.RUnlock()
+	if access.Limit(c.Context, limiter) {
+		return
+	}
+
 	c.Log().Debug("Requested Go Mod URI: ", modPath)
+	if strings.HasPrefix(modPath, "/sumdb/") {
+		goModRequestsTotal.Inc("sumdb")
+		span.SetAttribute("thumbai.gomod.action", "sumdb")
+		c.handleSumDB(modPath)
+		return
+	}
 	mod, err := gomod.InferRequest(modPath)
 	if err != nil && err != gomod.ErrGoModNotExist {
+		goModRequestsTotal.Inc("invalid")
 		c.Log().Warn(err)
 		c.Reply().BadRequest().Text("%v", err)
 		return
 	}
+	goModRequestsTotal.Inc(goModAction(mod.Action))
+	span.SetAttribute("thumbai.gomod.action", goModAction(mod.Action))
+	span.SetAttribute("thumbai.gomod.module", mod.Path)
+	span.SetAttribute("thumbai.gomod.version", mod.Version)
+	if perr := gomod.CheckModulePolicy(mod); perr != nil {
+		c.replyPolicy(perr)
+		return
+	}
+
+	switch mod.Action {
+	case "list":
+		versions, err := gomod.List(mod)
+		if err != nil {
+			c.replyError(err)
+			return
+		}
+		versions = gomod.FilterVersions(mod, versions)
+		var body string
+		if len(versions) > 0 {
+			body = strings.Join(versions, "\n") + "\n"
+		}
+		c.Reply().Text("%s", body)
+		return
+	case "latest":
+		info, err := gomod.Latest(mod)
+		if err != nil {
+			c.replyError(err)
+			return
+		}
+		if perr := gomod.CheckPolicy(mod.DecodedPath, info.Version); perr != nil {
+			c.replyPolicy(perr)
+			return
+		}
+		c.Reply().JSON(info)
+		return
+	}
 
 	if err == gomod.ErrGoModNotExist {
+		goModCacheTotal.Inc("download")
+		span.SetAttribute("thumbai.gomod.cache", "download")
 		c.Log().Infof("Requested module or version [%s] does not exists in repository, "+
 			"let's download it", modPath)
+		start := time.Now()
 		result, err := gomod.Download(mod)
+		goModDownloadDuration.ObserveSince(start)
+		if _, ok := err.(*gomod.PolicyError); ok {
+			c.replyPolicy(err)
+			return
+		}
 		if err != nil {
-			c.Log().Error(err)
-			c.Reply().InternalServerError().Text("%v %s",
-				http.StatusInternalServerError,
-				http.StatusText(http.StatusInternalServerError))
+			goModDownloadFailures.Inc()
+			c.replyError(err)
 			return
 		}
-		mod = result
+		if result != nil { // nil if download is already in-progress
+			mod = result
+		}
+	} else {
+		goModCacheTotal.Inc("hit")
+		span.SetAttribute("thumbai.gomod.cache", "hit")
 	}
 
-	if mod.Action == "list" {
-		c.Reply().
-			ContentType(ahttp.ContentTypePlainText.String()).
-			File(filepath.Join(gomod.Settings.ModCachePath, modPath))
+	targetFile := filepath.Join(gomod.Settings.ModCachePath, mod.Path, "@v", mod.Version+"."+mod.Action)
+	if !ess.IsFileExists(targetFile) {
+		c.replyError(gomod.ErrGoModNotExist)
 		return
 	}
-
-	targetFile := filepath.Join(gomod.Settings.ModCachePath, mod.Path, "@v", mod.Version+"."+mod.Action)
 	switch mod.Action {
 	case "info":
 		c.Reply().ContentType(ahttp.ContentTypeJSON.String()).File(targetFile)
@@ -83,3 +161,48 @@ func (c *GoModController) Handle(modPath string) {
 		c.Reply().BadRequest().Text("invaild go mod request")
 	}
 }
+
+// handleSumDB method proxies the checksum database requests, see
+// https://golang.org/ref/mod#checksum-database
+func (c *GoModController) handleSumDB(reqPath string) {
+	b, err := gomod.SumDB(reqPath)
+	if err != nil {
+		c.replyError(err)
+		return
+	}
+	if strings.Contains(reqPath, "/tile/") {
+		c.Reply().Bytes(ahttp.ContentTypeOctetStream.String(), b)
+		return
+	}
+	c.Reply().Bytes(ahttp.ContentTypePlainText.String(), b)
+}
+
+// replyError method replies the go mod error, module not found errors are
+// replied with `404` or `410` so that go command falls back to next proxy.
+func (c *GoModController) replyError(err error) {
+	status := gomod.ErrorStatus(err)
+	if status == http.StatusInternalServerError {
+		c.Log().Error(err)
+		c.Reply().InternalServerError().Text("%v %s",
+			http.StatusInternalServerError,
+			http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	c.Reply().Status(status).Text("%v", err)
+}
+
+// replyPolicy method audits the request blocked by module policy and replies
+// it with `403` or `410`.
+func (c *GoModController) replyPolicy(err error) {
+	user, _ := c.Get(access.KeyAuthUser).(string)
+	gomod.AuditPolicy(err, "repo", access.ClientIP(c.Req.Unwrap()), user)
+	c.replyError(err)
+}
+
+func goModAction(action string) string {
+	switch action {
+	case "list", "info", "mod", "zip", "latest", "sumdb":
+		return action
+	}
+	return "invalid"
+}
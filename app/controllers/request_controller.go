@@ -15,12 +15,15 @@
 package controllers
 
 import (
+	"bytes"
 	"net/http"
 	"thumbai/app/access"
 	"thumbai/app/gomod"
+	"thumbai/app/metrics"
 	"thumbai/app/models"
 	"thumbai/app/proxy"
 	"thumbai/app/settings"
+	"thumbai/app/tracing"
 	"thumbai/app/vanity"
 
 	"aahframe.work"
@@ -45,6 +48,10 @@ func (c *RequestController) Handle() {
 		return
 	}
 
+	span := tracing.FromContext(c.Context)
+	span.SetName("vanity")
+	span.SetAttribute("thumbai.vanity.package", pkg.Path)
+
 	c.Reply().HTMLl("goget.html", aah.Data{
 		"Vanity":    pkg,
 		"GoDocHost": settings.GoDocHost,
@@ -69,3 +76,21 @@ func (c *RequestController) Health() {
 	}
 	c.Reply().JSON(result)
 }
+
+// Metrics method returns the proxy, vanity and go mod metrics in the
+// Prometheus text format, it's allowed only from admin allowed IP addresses.
+func (c *RequestController) Metrics() {
+	if !access.IsAllowedFromIP(access.ClientIP(c.Req.Unwrap())) {
+		access.Forbidden(c.Context, "")
+		return
+	}
+	buf := new(bytes.Buffer)
+	if err := metrics.Write(buf); err != nil {
+		c.Log().Error(err)
+		c.Reply().InternalServerError().Text("%v %s",
+			http.StatusInternalServerError,
+			http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	c.Reply().Bytes(metrics.ContentType, buf.Bytes())
+}
@@ -0,0 +1,129 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"aahframe.work"
+	"aahframe.work/essentials"
+)
+
+// Encryption Errors
+var (
+	ErrNoEncryptionKey = errors.New("db: encryption key is not loaded")
+	ErrInvalidCipher   = errors.New("db: invalid encrypted value")
+)
+
+const encryptedPrefix = "enc1:"
+
+var secretCipher cipher.AEAD
+
+// loadEncryptionKey method loads the AES-256 key of secrets from config
+// `thumbai.admin.data_store.encryption_key` (base64 encoded), otherwise from
+// the key file in the data store directory, it's created if not exists.
+func loadEncryptionKey(storeBasePath string) error {
+	app := aah.App()
+	encoded := app.Config().StringDefault("thumbai.admin.data_store.encryption_key", "")
+	if len(encoded) == 0 {
+		keyFile := filepath.Join(storeBasePath, "thumbai.key")
+		if !ess.IsFileExists(keyFile) {
+			key := make([]byte, 32)
+			if _, err := io.ReadFull(rand.Reader, key); err != nil {
+				return err
+			}
+			if err := ioutil.WriteFile(keyFile, []byte(base64.StdEncoding.EncodeToString(key)), 0600); err != nil {
+				return err
+			}
+			app.Log().Warnf("Generated data store encryption key at %s, back it up along with the data store "+
+				"or configure 'thumbai.admin.data_store.encryption_key'", keyFile)
+		}
+		b, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			return err
+		}
+		encoded = string(b)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return fmt.Errorf("db: invalid encryption key: %v", err)
+	}
+	return setEncryptionKey(key)
+}
+
+func setEncryptionKey(key []byte) error {
+	if len(key) != 32 {
+		return fmt.Errorf("db: encryption key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	secretCipher = gcm
+	return nil
+}
+
+// Encrypt method encrypts the secret value using AES-GCM to store it in the
+// data store. Empty value stays empty.
+func Encrypt(value string) (string, error) {
+	if len(value) == 0 {
+		return "", nil
+	}
+	if secretCipher == nil {
+		return "", ErrNoEncryptionKey
+	}
+	nonce := make([]byte, secretCipher.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := secretCipher.Seal(nonce, nonce, []byte(value), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt method decrypts the value encrypted by method `Encrypt`.
+func Decrypt(value string) (string, error) {
+	if len(value) == 0 {
+		return "", nil
+	}
+	if secretCipher == nil {
+		return "", ErrNoEncryptionKey
+	}
+	if !strings.HasPrefix(value, encryptedPrefix) {
+		return "", ErrInvalidCipher
+	}
+	sealed, err := base64.StdEncoding.DecodeString(value[len(encryptedPrefix):])
+	if err != nil || len(sealed) < secretCipher.NonceSize() {
+		return "", ErrInvalidCipher
+	}
+	n := secretCipher.NonceSize()
+	plain, err := secretCipher.Open(nil, sealed[:n], sealed[n:], nil)
+	if err != nil {
+		return "", ErrInvalidCipher
+	}
+	return string(plain), nil
+}
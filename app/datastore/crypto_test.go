@@ -0,0 +1,57 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	defer func() { secretCipher = nil }()
+	_, err := Encrypt("secret")
+	assert.Equal(t, ErrNoEncryptionKey, err)
+
+	assert.NotNil(t, setEncryptionKey([]byte("short")))
+	assert.Nil(t, setEncryptionKey(bytes.Repeat([]byte{1}, 32)))
+
+	v, err := Encrypt("secret")
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(v, encryptedPrefix))
+	assert.NotContains(t, v, "secret")
+	v2, _ := Encrypt("secret")
+	assert.NotEqual(t, v, v2)
+
+	plain, err := Decrypt(v)
+	assert.Nil(t, err)
+	assert.Equal(t, "secret", plain)
+
+	empty, err := Encrypt("")
+	assert.Nil(t, err)
+	assert.Equal(t, "", empty)
+
+	_, err = Decrypt("secret")
+	assert.Equal(t, ErrInvalidCipher, err)
+	_, err = Decrypt(v[:len(v)-4] + "AAA=")
+	assert.Equal(t, ErrInvalidCipher, err)
+
+	// other key can't decrypt
+	assert.Nil(t, setEncryptionKey(bytes.Repeat([]byte{2}, 32)))
+	_, err = Decrypt(v)
+	assert.Equal(t, ErrInvalidCipher, err)
+}
@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"encoding/gob"
 	"errors"
+	"fmt"
 	"path/filepath"
 	"time"
 
@@ -40,6 +41,9 @@ var (
 	BucketGoModules  = "gomodules"
 	BucketGoVanities = "govanities"
 	BucketProxies    = "proxies"
+	BucketProxyHosts = "proxyhosts"
+
+	BucketPolicyAudits = "policyaudits"
 )
 
 //‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
@@ -56,6 +60,9 @@ func Connect(_ *aah.Event) {
 			app.Log().Fatal(err)
 		}
 	}
+	if err = loadEncryptionKey(storeBasePath); err != nil {
+		app.Log().Fatal(err)
+	}
 	storePath := filepath.Join(storeBasePath, "thumbai.db")
 	thumbaiDB, err = bolt.Open(storePath, 0644, &bolt.Options{Timeout: 100 * time.Millisecond})
 	if err != nil {
@@ -69,7 +76,13 @@ func Connect(_ *aah.Event) {
 		if _, err = tx.CreateBucketIfNotExists([]byte(BucketGoVanities)); err != nil {
 			return err
 		}
-		_, err = tx.CreateBucketIfNotExists([]byte(BucketProxies))
+		if _, err = tx.CreateBucketIfNotExists([]byte(BucketProxies)); err != nil {
+			return err
+		}
+		if _, err = tx.CreateBucketIfNotExists([]byte(BucketProxyHosts)); err != nil {
+			return err
+		}
+		_, err = tx.CreateBucketIfNotExists([]byte(BucketPolicyAudits))
 		return err
 	}); err != nil {
 		app.Log().Fatal(err)
@@ -117,6 +130,42 @@ func Put(bucketName, key string, value interface{}) error {
 	})
 }
 
+// Append method puts the values on the given bucket with sequence keys in a
+// single transaction, then deletes the oldest keys beyond the max count.
+func Append(bucketName string, values []interface{}, max int) error {
+	encoded := make([][]byte, 0, len(values))
+	for _, v := range values {
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+			return err
+		}
+		encoded = append(encoded, buf.Bytes())
+	}
+	return thumbaiDB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucketName))
+		for _, v := range encoded {
+			seq, err := b.NextSequence()
+			if err != nil {
+				return err
+			}
+			if err = b.Put([]byte(fmt.Sprintf("%020d", seq)), v); err != nil {
+				return err
+			}
+		}
+		var keys [][]byte
+		c := b.Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			keys = append(keys, append([]byte(nil), k...))
+		}
+		for i := 0; i < len(keys)-max; i++ {
+			if err := b.Delete(keys[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 // Del method deletes the value from given bucket for the given key.
 func Del(bucketName, key string) error {
 	return thumbaiDB.Update(func(tx *bolt.Tx) error {
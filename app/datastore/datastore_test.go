@@ -0,0 +1,54 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestAppend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "datastore")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	thumbaiDB, err = bolt.Open(filepath.Join(dir, "thumbai.db"), 0644, nil)
+	assert.Nil(t, err)
+	defer func() {
+		_ = thumbaiDB.Close()
+		thumbaiDB = nil
+	}()
+	assert.Nil(t, thumbaiDB.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(BucketPolicyAudits))
+		return err
+	}))
+
+	assert.Nil(t, Append(BucketPolicyAudits, []interface{}{"a", "b", "c"}, 4))
+	assert.Nil(t, Append(BucketPolicyAudits, []interface{}{"d", "e"}, 4))
+
+	// oldest keys beyond max count are deleted, keys are in the append order
+	keys := BucketKeys(BucketPolicyAudits)
+	var values []string
+	for _, k := range keys {
+		var v string
+		assert.Nil(t, Get(BucketPolicyAudits, k, &v))
+		values = append(values, v)
+	}
+	assert.Equal(t, []string{"b", "c", "d", "e"}, values)
+}
@@ -0,0 +1,481 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gomod
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"aahframe.work"
+	"aahframe.work/essentials"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+	"golang.org/x/mod/sumdb/dirhash"
+	modzip "golang.org/x/mod/zip"
+)
+
+// Module fetchers
+const (
+	FetcherGo     = "go"
+	FetcherNative = "native"
+)
+
+// nativeFetcher resolves and downloads the modules from its git repository
+// in-process, without the go command. It produces the `.info`, `.mod` and
+// `.zip` files in the mod cache as the `go mod download` does.
+type nativeFetcher struct{}
+
+func (nativeFetcher) Versions(modPath string) ([]string, error) {
+	cr, err := newCodeRepo(modPath)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = cr.repo.fetch(false); err != nil {
+		return nil, err
+	}
+	return cr.versions()
+}
+
+func (nativeFetcher) Latest(modPath string) (*Info, error) {
+	cr, err := newCodeRepo(modPath)
+	if err != nil {
+		return nil, err
+	}
+	rv, err := cr.resolve("latest")
+	if err != nil {
+		return nil, err
+	}
+	return rv.Info, nil
+}
+
+// Download method resolves the module version and writes its files into
+// mod cache.
+func (nativeFetcher) Download(mod *Module) (*Module, error) {
+	cr, err := newCodeRepo(mod.DecodedPath)
+	if err != nil {
+		return nil, err
+	}
+	query, err := module.UnescapeVersion(mod.Version)
+	if err != nil {
+		query = mod.Version
+	}
+	rv, err := cr.resolve(query)
+	if err != nil {
+		return nil, err
+	}
+	return saveModule(mod, rv.Info, rv.GoMod, func(w io.Writer) error {
+		return cr.writeZip(rv, w)
+	})
+}
+
+// saveModule method writes the `.info`, `.mod`, `.zip` and `.ziphash` files
+// of the module version into mod cache. Zip file is written by the given
+// func, and it's verified as per module zip format before it's saved.
+func saveModule(mod *Module, info *Info, goMod []byte, writeZip func(w io.Writer) error) (*Module, error) {
+	version, err := module.EscapeVersion(info.Version)
+	if err != nil {
+		return nil, err
+	}
+	result := &Module{
+		Path:        mod.Path,
+		DecodedPath: mod.DecodedPath,
+		Version:     version,
+		Action:      mod.Action,
+	}
+	dir := filepath.Join(Settings.ModCachePath, mod.Path, "@v")
+	result.Info = filepath.Join(dir, version+".info")
+	result.GoMod = filepath.Join(dir, version+".mod")
+	result.Zip = filepath.Join(dir, version+".zip")
+	if ess.IsFileExists(result.Zip) {
+		return result, nil
+	}
+	if err = ess.MkDirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	f, err := ioutil.TempFile(dir, "tmp-zip")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		ess.CloseQuietly(f)
+		_ = os.Remove(f.Name())
+	}()
+	if err = writeZip(f); err != nil {
+		return nil, err
+	}
+	if err = f.Close(); err != nil {
+		return nil, err
+	}
+	if _, err = modzip.CheckZip(module.Version{Path: mod.DecodedPath, Version: info.Version}, f.Name()); err != nil {
+		return nil, err
+	}
+	if err = os.Chmod(f.Name(), tempFilePerm); err != nil {
+		return nil, err
+	}
+	aah.App().Log().Debug("Creating ", result.Zip)
+	if err = os.Rename(f.Name(), result.Zip); err != nil {
+		return nil, err
+	}
+
+	ziphash, err := dirhash.HashZip(result.Zip, dirhash.Hash1)
+	if err != nil {
+		return nil, err
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, version+".ziphash"), []byte(ziphash), tempFilePerm); err != nil {
+		return nil, err
+	}
+	if err = ioutil.WriteFile(result.GoMod, goMod, tempFilePerm); err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+	if err = ioutil.WriteFile(result.Info, b, tempFilePerm); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// codeRepo type and its methods
+//______________________________________________________________________________
+
+// codeRepo maps the module path into the directory of git repository.
+type codeRepo struct {
+	modPath   string
+	pathMajor string
+	codeDir   string
+	tagPrefix string
+	repo      *gitRepo
+}
+
+// revVersion is the resolved version of the module.
+type revVersion struct {
+	Info   *Info
+	Commit string
+	Dir    string
+	GoMod  []byte
+}
+
+func newCodeRepo(modPath string) (*codeRepo, error) {
+	if err := module.CheckPath(modPath); err != nil {
+		return nil, &ModuleError{Status: http.StatusNotFound, Msg: "malformed module path: " + err.Error()}
+	}
+	prefix, pathMajor, _ := module.SplitPathVersion(modPath)
+	rr, err := lookupRepoRoot(modPath)
+	if err != nil {
+		return nil, err
+	}
+	if rr.VCS != "git" {
+		return nil, &ModuleError{Status: http.StatusNotFound,
+			Msg: fmt.Sprintf("module %s: unsupported VCS %q", modPath, rr.VCS)}
+	}
+
+	cr := &codeRepo{modPath: modPath, pathMajor: pathMajor, repo: openGitRepo(rr.Repo)}
+	switch {
+	case modPath == rr.Root:
+	case prefix == rr.Root || strings.HasPrefix(prefix, rr.Root+"/"):
+		cr.codeDir = strings.TrimPrefix(strings.TrimPrefix(prefix, rr.Root), "/")
+	case strings.HasPrefix(modPath, rr.Root+"/"):
+		cr.codeDir = strings.TrimPrefix(modPath, rr.Root+"/")
+	default:
+		return nil, &ModuleError{Status: http.StatusNotFound,
+			Msg: fmt.Sprintf("module %s: repository root %s does not match", modPath, rr.Root)}
+	}
+	if len(cr.codeDir) > 0 {
+		cr.tagPrefix = cr.codeDir + "/"
+	}
+	return cr, nil
+}
+
+// versions method returns the tagged versions of the module.
+func (cr *codeRepo) versions() ([]string, error) {
+	tags, err := cr.repo.tags(cr.tagPrefix, "")
+	if err != nil {
+		return nil, err
+	}
+	var versions []string
+	for _, tag := range tags {
+		if v, ok := cr.tagVersion(tag); ok {
+			versions = append(versions, v)
+		}
+	}
+	return releaseVersions(versions), nil
+}
+
+// resolve method resolves the query into the module version, query is
+// `latest`, semantic version, pseudo-version, branch name or commit hash.
+func (cr *codeRepo) resolve(query string) (*revVersion, error) {
+	fetched, err := cr.repo.fetch(false)
+	if err != nil {
+		return nil, err
+	}
+	rv, err := cr.resolveQuery(query)
+	if err == errRevNotExist && !fetched {
+		if _, err = cr.repo.fetch(true); err != nil {
+			return nil, err
+		}
+		rv, err = cr.resolveQuery(query)
+	}
+	if err == errRevNotExist {
+		return nil, &ModuleError{Status: http.StatusGone,
+			Msg: fmt.Sprintf("%s@%s: invalid version: unknown revision %s", cr.modPath, query, query)}
+	}
+	return rv, err
+}
+
+func (cr *codeRepo) resolveQuery(query string) (*revVersion, error) {
+	if query == "" || query == "latest" {
+		return cr.latest()
+	}
+	if module.CanonicalVersion(query) == query {
+		if module.IsPseudoVersion(query) {
+			return cr.pseudoVersion(query)
+		}
+		commit, t, err := cr.repo.stat("refs/tags/" + cr.tagPrefix + strings.TrimSuffix(query, "+incompatible"))
+		if err != nil {
+			return nil, err
+		}
+		return cr.revVersion(query, commit, t)
+	}
+
+	commit, t, err := cr.repo.stat(query)
+	if err != nil {
+		return nil, err
+	}
+	return cr.commitVersion(commit, t)
+}
+
+// latest method returns the highest release version, otherwise highest
+// pre-release version, otherwise the pseudo-version of default branch.
+func (cr *codeRepo) latest() (*revVersion, error) {
+	versions, err := cr.versions()
+	if err != nil {
+		return nil, err
+	}
+	var latest string
+	for _, v := range versions {
+		if len(latest) == 0 || latestPrecedes(latest, v) {
+			latest = v
+		}
+	}
+	if len(latest) > 0 {
+		return cr.resolveQuery(latest)
+	}
+	commit, t, err := cr.repo.stat("HEAD")
+	if err != nil {
+		return nil, err
+	}
+	return cr.commitVersion(commit, t)
+}
+
+// commitVersion method returns the tagged version of the commit if exists
+// otherwise its pseudo-version.
+func (cr *codeRepo) commitVersion(commit string, t time.Time) (*revVersion, error) {
+	tags, err := cr.repo.pointsAt(cr.tagPrefix, commit)
+	if err != nil {
+		return nil, err
+	}
+	var tagged string
+	for _, tag := range tags {
+		if v, ok := cr.tagVersion(tag); ok && (len(tagged) == 0 || semver.Compare(tagged, v) < 0) {
+			tagged = v
+		}
+	}
+	if len(tagged) > 0 {
+		return cr.revVersion(tagged, commit, t)
+	}
+
+	tags, err = cr.repo.tags(cr.tagPrefix, commit)
+	if err != nil {
+		return nil, err
+	}
+	var older string
+	for _, tag := range tags {
+		if v, ok := cr.tagVersion(tag); ok && (len(older) == 0 || semver.Compare(older, v) < 0) {
+			older = v
+		}
+	}
+	major := module.PathMajorPrefix(cr.pathMajor)
+	return cr.revVersion(module.PseudoVersion(major, older, t, shortHash(commit)), commit, t)
+}
+
+func (cr *codeRepo) pseudoVersion(v string) (*revVersion, error) {
+	rev, err := module.PseudoVersionRev(v)
+	if err != nil {
+		return nil, errRevNotExist
+	}
+	commit, t, err := cr.repo.stat(rev)
+	if err != nil || !strings.HasPrefix(commit, rev) {
+		return nil, errRevNotExist
+	}
+	if pt, err := module.PseudoVersionTime(v); err != nil || !pt.Equal(t) {
+		return nil, &ModuleError{Status: http.StatusGone,
+			Msg: fmt.Sprintf("%s@%s: invalid pseudo-version: does not match version-control timestamp (expected %s)",
+				cr.modPath, v, t.Format(modVersionTimeFormat))}
+	}
+	return cr.revVersion(v, commit, t)
+}
+
+// revVersion method validates the version against the module path and
+// go.mod file at the commit.
+func (cr *codeRepo) revVersion(v, commit string, t time.Time) (*revVersion, error) {
+	invalid := func(format string, args ...interface{}) error {
+		return &ModuleError{Status: http.StatusGone,
+			Msg: fmt.Sprintf("%s@%s: invalid version: ", cr.modPath, v) + fmt.Sprintf(format, args...)}
+	}
+	if err := module.CheckPathMajor(v, cr.pathMajor); err != nil {
+		return nil, invalid("%v", err.(*module.InvalidVersionError).Err)
+	}
+
+	dir := cr.codeDir
+	gomod, found := []byte(nil), false
+	if strings.HasPrefix(cr.pathMajor, "/") {
+		// major version subdirectory
+		majorDir := path.Join(cr.codeDir, cr.pathMajor[1:])
+		if gomod, found = cr.goMod(commit, majorDir); found {
+			dir = majorDir
+		}
+	}
+	if !found {
+		gomod, found = cr.goMod(commit, dir)
+	}
+	if found {
+		if mp := modfile.ModulePath(gomod); mp != cr.modPath {
+			return nil, invalid("go.mod has non-%s module path %q", cr.modPath, mp)
+		}
+		if semver.Build(v) == "+incompatible" {
+			return nil, invalid("+incompatible suffix not allowed: module contains a go.mod file")
+		}
+	} else {
+		if len(cr.pathMajor) == 0 && semver.Major(v) != "v0" && semver.Major(v) != "v1" &&
+			semver.Build(v) != "+incompatible" {
+			return nil, invalid("should be v0 or v1, not %s", semver.Major(v))
+		}
+		gomod = []byte(fmt.Sprintf("module %s\n", modfile.AutoQuote(cr.modPath)))
+	}
+	return &revVersion{Info: &Info{Version: v, Time: t}, Commit: commit, Dir: dir, GoMod: gomod}, nil
+}
+
+// tagVersion method returns the module version of the tag if it's valid for
+// the module path.
+func (cr *codeRepo) tagVersion(tag string) (string, bool) {
+	v := strings.TrimPrefix(tag, cr.tagPrefix)
+	if !strings.HasPrefix(tag, cr.tagPrefix) || v != semver.Canonical(v) || module.IsPseudoVersion(v) {
+		return "", false
+	}
+	if module.CheckPathMajor(v, cr.pathMajor) == nil {
+		return v, true
+	}
+	if len(cr.pathMajor) == 0 {
+		// v2+ tags are +incompatible versions if there is no go.mod file
+		if _, found := cr.goMod("refs/tags/"+tag, cr.codeDir); !found {
+			return v + "+incompatible", true
+		}
+	}
+	return "", false
+}
+
+func (cr *codeRepo) goMod(commit, dir string) ([]byte, bool) {
+	b := cr.repo.readFile(commit, path.Join(dir, "go.mod"))
+	return b, b != nil
+}
+
+// writeZip method writes the module zip file from the directory of the
+// commit, as per the module zip format.
+func (cr *codeRepo) writeZip(rv *revVersion, w io.Writer) error {
+	b, err := cr.repo.archive(rv.Commit, rv.Dir)
+	if err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return err
+	}
+	var files []modzip.File
+	haveLicense := false
+	prefix := ""
+	if len(rv.Dir) > 0 {
+		prefix = rv.Dir + "/"
+	}
+	for _, zf := range zr.File {
+		if !strings.HasPrefix(zf.Name, prefix) || strings.HasSuffix(zf.Name, "/") {
+			continue
+		}
+		name := strings.TrimPrefix(zf.Name, prefix)
+		files = append(files, archiveFile{name: name, f: zf})
+		haveLicense = haveLicense || name == "LICENSE"
+	}
+	if !haveLicense && len(rv.Dir) > 0 {
+		if license := cr.repo.readFile(rv.Commit, "LICENSE"); license != nil {
+			files = append(files, dataFile{name: "LICENSE", data: license})
+		}
+	}
+
+	return modzip.Create(w, module.Version{Path: cr.modPath, Version: rv.Info.Version}, files)
+}
+
+func shortHash(commit string) string {
+	if len(commit) > 12 {
+		return commit[:12]
+	}
+	return commit
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// Module zip files
+//______________________________________________________________________________
+
+type archiveFile struct {
+	name string
+	f    *zip.File
+}
+
+func (a archiveFile) Path() string                 { return a.name }
+func (a archiveFile) Lstat() (os.FileInfo, error)  { return a.f.FileInfo(), nil }
+func (a archiveFile) Open() (io.ReadCloser, error) { return a.f.Open() }
+
+type dataFile struct {
+	name string
+	data []byte
+}
+
+func (d dataFile) Path() string                { return d.name }
+func (d dataFile) Lstat() (os.FileInfo, error) { return dataFileInfo{d}, nil }
+func (d dataFile) Open() (io.ReadCloser, error) {
+	return ioutil.NopCloser(bytes.NewReader(d.data)), nil
+}
+
+type dataFileInfo struct{ d dataFile }
+
+func (fi dataFileInfo) Name() string       { return path.Base(fi.d.name) }
+func (fi dataFileInfo) Size() int64        { return int64(len(fi.d.data)) }
+func (fi dataFileInfo) Mode() os.FileMode  { return 0644 }
+func (fi dataFileInfo) ModTime() time.Time { return time.Time{} }
+func (fi dataFileInfo) IsDir() bool        { return false }
+func (fi dataFileInfo) Sys() interface{}   { return nil }
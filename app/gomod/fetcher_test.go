@@ -0,0 +1,254 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gomod
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/mod/module"
+	modzip "golang.org/x/mod/zip"
+)
+
+type testGitRepo struct {
+	t   *testing.T
+	dir string
+	now time.Time
+}
+
+func (r *testGitRepo) git(args ...string) string {
+	cmd := exec.Command("git", append([]string{"-c", "user.name=thumbai", "-c", "user.email=thumbai@localhost"}, args...)...)
+	cmd.Dir = r.dir
+	date := r.now.Format(time.RFC3339)
+	cmd.Env = append(os.Environ(), "GIT_AUTHOR_DATE="+date, "GIT_COMMITTER_DATE="+date)
+	out, err := cmd.CombinedOutput()
+	assert.Nil(r.t, err, string(out))
+	return strings.TrimSpace(string(out))
+}
+
+func (r *testGitRepo) commit(files map[string]string, tags ...string) string {
+	for name, content := range files {
+		fname := filepath.Join(r.dir, filepath.FromSlash(name))
+		assert.Nil(r.t, os.MkdirAll(filepath.Dir(fname), 0755))
+		assert.Nil(r.t, ioutil.WriteFile(fname, []byte(content), 0644))
+	}
+	r.now = r.now.Add(time.Hour)
+	r.git("add", "-A")
+	r.git("commit", "-q", "-m", "commit")
+	for _, tag := range tags {
+		r.git("tag", tag)
+	}
+	return r.git("rev-parse", "HEAD")
+}
+
+func setupNativeFetcher(t *testing.T) (*testGitRepo, func()) {
+	cleanup := setupModCache(t, &testOrigin{})
+	dir, err := ioutil.TempDir("", "gitrepo")
+	assert.Nil(t, err)
+	prevVCSPath, prevLookup, prevProtocol := Settings.VCSCachePath, lookupRepoRoot, gitAllowProtocol
+	gitAllowProtocol = "file"
+	Settings.VCSCachePath = filepath.Join(Settings.ModCachePath, "..", filepath.Base(Settings.ModCachePath)+"-vcs")
+	gitRepos.Lock()
+	gitRepos.m = make(map[string]*gitRepo)
+	gitRepos.Unlock()
+
+	repos := map[string]string{"example.com/mod": filepath.Join(dir, "mod"), "example.com/legacy": filepath.Join(dir, "legacy")}
+	lookupRepoRoot = func(modPath string) (*repoRoot, error) {
+		for root, repo := range repos {
+			if modPath == root || strings.HasPrefix(modPath, root+"/") {
+				return &repoRoot{Root: root, VCS: "git", Repo: repo}, nil
+			}
+		}
+		return nil, &ModuleError{Status: http.StatusNotFound, Msg: "unrecognized import path " + modPath}
+	}
+
+	r := &testGitRepo{t: t, dir: repos["example.com/mod"], now: time.Date(2019, 6, 1, 10, 0, 0, 0, time.UTC)}
+	assert.Nil(t, os.MkdirAll(r.dir, 0755))
+	r.git("init", "-q", "-b", "master")
+	return r, func() {
+		_ = os.RemoveAll(Settings.VCSCachePath)
+		_ = os.RemoveAll(dir)
+		Settings.VCSCachePath, lookupRepoRoot, gitAllowProtocol = prevVCSPath, prevLookup, prevProtocol
+		cleanup()
+	}
+}
+
+func zipFileNames(t *testing.T, name string) []string {
+	zr, err := zip.OpenReader(name)
+	assert.Nil(t, err)
+	defer zr.Close()
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestNativeFetcher(t *testing.T) {
+	r, cleanup := setupNativeFetcher(t)
+	defer cleanup()
+
+	r.commit(map[string]string{
+		"go.mod":        "module example.com/mod\n",
+		"mod.go":        "package mod\n",
+		"LICENSE":       "license\n",
+		"sub/go.mod":    "module example.com/mod/sub\n",
+		"sub/sub.go":    "package sub\n",
+		"vendor/x/x.go": "package x\n",
+	}, "v1.0.0")
+	r.commit(map[string]string{"mod.go": "package mod // v1.1.0\n"}, "v1.1.0", "sub/v0.1.0")
+	r.commit(map[string]string{"mod.go": "package mod // v1.2.0-beta.1\n"}, "v1.2.0-beta.1")
+	head := r.commit(map[string]string{"mod.go": "package mod // master\n"})
+	r.git("checkout", "-q", "-b", "v2")
+	r.commit(map[string]string{"go.mod": "module example.com/mod/v2\n"}, "v2.0.0")
+	r.git("checkout", "-q", "master")
+
+	f := nativeFetcher{}
+	versions, err := f.Versions("example.com/mod")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"v1.0.0", "v1.1.0", "v1.2.0-beta.1"}, versions)
+	versions, _ = f.Versions("example.com/mod/v2")
+	assert.Equal(t, []string{"v2.0.0"}, versions)
+	versions, _ = f.Versions("example.com/mod/sub")
+	assert.Equal(t, []string{"v0.1.0"}, versions)
+
+	info, err := f.Latest("example.com/mod")
+	assert.Nil(t, err)
+	assert.Equal(t, "v1.1.0", info.Version)
+	assert.Equal(t, time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC), info.Time)
+
+	// tagged version
+	mod, err := nativeFetcher{}.Download(&Module{Path: "example.com/mod", DecodedPath: "example.com/mod", Version: "v1.0.0", Action: "zip"})
+	assert.Nil(t, err)
+	assert.Equal(t, "v1.0.0", mod.Version)
+	b, _ := ioutil.ReadFile(mod.Info)
+	assert.Equal(t, `{"Version":"v1.0.0","Time":"2019-06-01T11:00:00Z"}`, string(b))
+	b, _ = ioutil.ReadFile(mod.GoMod)
+	assert.Equal(t, "module example.com/mod\n", string(b))
+	_, err = modzip.CheckZip(module.Version{Path: "example.com/mod", Version: "v1.0.0"}, mod.Zip)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"example.com/mod@v1.0.0/LICENSE", "example.com/mod@v1.0.0/go.mod", "example.com/mod@v1.0.0/mod.go"},
+		zipFileNames(t, mod.Zip))
+	b, _ = ioutil.ReadFile(filepath.Join(Settings.ModCachePath, "example.com/mod/@v/v1.0.0.ziphash"))
+	assert.True(t, strings.HasPrefix(string(b), "h1:"))
+
+	// branch name resolves into pseudo-version
+	mod, err = nativeFetcher{}.Download(&Module{Path: "example.com/mod", DecodedPath: "example.com/mod", Version: "master", Action: "info"})
+	assert.Nil(t, err)
+	pseudo := "v1.2.0-beta.1.0.20190601140000-" + head[:12]
+	assert.Equal(t, pseudo, mod.Version)
+	_, err = os.Stat(mod.Zip)
+	assert.Nil(t, err)
+
+	// commit hash and pseudo-version
+	mod, err = nativeFetcher{}.Download(&Module{Path: "example.com/mod", DecodedPath: "example.com/mod", Version: head[:7]})
+	assert.Nil(t, err)
+	assert.Equal(t, pseudo, mod.Version)
+	mod, err = nativeFetcher{}.Download(&Module{Path: "example.com/mod", DecodedPath: "example.com/mod", Version: pseudo})
+	assert.Nil(t, err)
+	assert.Equal(t, pseudo, mod.Version)
+	_, err = nativeFetcher{}.Download(&Module{Path: "example.com/mod", DecodedPath: "example.com/mod", Version: "v1.2.0-beta.1.0.20190601150000-" + head[:12]})
+	assert.Equal(t, http.StatusGone, ErrorStatus(err))
+
+	// sub module in the repository
+	mod, err = nativeFetcher{}.Download(&Module{Path: "example.com/mod/sub", DecodedPath: "example.com/mod/sub", Version: "v0.1.0"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"example.com/mod/sub@v0.1.0/LICENSE", "example.com/mod/sub@v0.1.0/go.mod", "example.com/mod/sub@v0.1.0/sub.go"},
+		zipFileNames(t, mod.Zip))
+
+	// major version
+	mod, err = nativeFetcher{}.Download(&Module{Path: "example.com/mod/v2", DecodedPath: "example.com/mod/v2", Version: "v2.0.0"})
+	assert.Nil(t, err)
+	b, _ = ioutil.ReadFile(mod.GoMod)
+	assert.Equal(t, "module example.com/mod/v2\n", string(b))
+
+	// invalid versions and unknown modules
+	_, err = nativeFetcher{}.Download(&Module{Path: "example.com/mod", DecodedPath: "example.com/mod", Version: "v9.9.9"})
+	assert.Equal(t, http.StatusGone, ErrorStatus(err))
+	_, err = nativeFetcher{}.Download(&Module{Path: "example.com/mod", DecodedPath: "example.com/mod", Version: "v2"})
+	assert.Equal(t, http.StatusGone, ErrorStatus(err))
+	_, err = nativeFetcher{}.Download(&Module{Path: "example.com/mod/v2", DecodedPath: "example.com/mod/v2", Version: "v1.0.0"})
+	assert.Equal(t, http.StatusGone, ErrorStatus(err))
+	_, err = f.Versions("example.com/unknown")
+	assert.Equal(t, http.StatusNotFound, ErrorStatus(err))
+}
+
+func TestNativeFetcherIncompatible(t *testing.T) {
+	r, cleanup := setupNativeFetcher(t)
+	defer cleanup()
+	r.dir = filepath.Join(filepath.Dir(r.dir), "legacy")
+	assert.Nil(t, os.MkdirAll(r.dir, 0755))
+	r.git("init", "-q", "-b", "main")
+
+	f := nativeFetcher{}
+	r.commit(map[string]string{"legacy.go": "package legacy\n"})
+	info, err := f.Latest("example.com/legacy")
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(info.Version, "v0.0.0-20190601110000-"))
+
+	r.commit(map[string]string{"legacy.go": "package legacy // v1\n"}, "v1.0.0")
+	r.commit(map[string]string{"legacy.go": "package legacy // v2\n"}, "v2.0.0")
+	openGitRepo(r.dir).fetched = time.Time{} // expire the mirror
+	versions, err := f.Versions("example.com/legacy")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"v1.0.0", "v2.0.0+incompatible"}, versions)
+
+	mod, err := nativeFetcher{}.Download(&Module{Path: "example.com/legacy", DecodedPath: "example.com/legacy", Version: "v2.0.0+incompatible"})
+	assert.Nil(t, err)
+	b, _ := ioutil.ReadFile(mod.GoMod)
+	assert.Equal(t, "module example.com/legacy\n", string(b))
+	_, err = nativeFetcher{}.Download(&Module{Path: "example.com/legacy", DecodedPath: "example.com/legacy", Version: "v2.0.0"})
+	assert.Equal(t, http.StatusGone, ErrorStatus(err))
+}
+
+func TestParseMetaGoImports(t *testing.T) {
+	imports, err := parseMetaGoImports(strings.NewReader(`<!DOCTYPE html>
+<html>
+<head>
+<meta http-equiv="Content-Type" content="text/html; charset=utf-8">
+<meta name="go-import" content="aahframe.work git https://github.com/go-aah/aah.git">
+<meta name="go-import" content="aahframe.work mod https://proxy.example.com">
+<meta name="go-source" content="aahframe.work https://github.com/go-aah/aah">
+</head>
+<body>
+<meta name="go-import" content="ignored git https://example.com/ignored.git">
+</body>
+</html>`))
+	assert.Nil(t, err)
+	assert.Len(t, imports, 2)
+
+	rr, err := matchGoImport(imports, "aahframe.work/ws")
+	assert.Nil(t, err)
+	assert.Equal(t, &repoRoot{Root: "aahframe.work", VCS: "git", Repo: "https://github.com/go-aah/aah.git"}, rr)
+
+	_, err = matchGoImport(imports, "aahframe.workspace")
+	assert.Equal(t, http.StatusNotFound, ErrorStatus(err))
+
+	for _, repo := range []string{"file:///var/lib/thumbai/repo", "http://example.com/repo.git",
+		"ssh://git@example.com/repo.git", "/var/lib/thumbai/repo", "ext::sh -c touch% /tmp/pwned"} {
+		_, err = matchGoImport([]*repoRoot{{Root: "example.com/repo", VCS: "git", Repo: repo}}, "example.com/repo")
+		assert.Equal(t, http.StatusNotFound, ErrorStatus(err), repo)
+	}
+}
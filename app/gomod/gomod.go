@@ -30,11 +30,15 @@ import (
 	"strings"
 	"sync"
 	"syscall"
-	"thumbai/app/models"
 	"time"
 
+	"thumbai/app/access"
+	"thumbai/app/metrics"
+	"thumbai/app/models"
+
 	"aahframe.work"
 	"aahframe.work/essentials"
+	"golang.org/x/mod/module"
 )
 
 // errors
@@ -49,6 +53,15 @@ var (
 	Settings = &settings{RWMutex: sync.RWMutex{}, GoVersion: "NA"}
 
 	semverPrefixRegex = regexp.MustCompile(`(^v[0-9]+\.)`)
+
+	_ = metrics.NewGaugeFunc("thumbai_gomod_modules", "Current count of go modules in the repository.", func() float64 {
+		Settings.RLock()
+		defer Settings.RUnlock()
+		if Settings.Stats == nil {
+			return 0
+		}
+		return float64(Settings.Stats.TotalCount)
+	})
 )
 
 type settings struct {
@@ -59,9 +72,21 @@ type settings struct {
 	GoPath        string
 	GoCache       string
 	GoProxy       string
+	GoSumDB       string
+	Upstreams     []*models.ModuleUpstream
+	Private       string
+	NoSumDB       string
+	Policies      []*models.ModulePolicy
+	Fetcher       string
 	ModCachePath  string
+	VCSCachePath  string
+	RateLimit     *access.RateLimiter
 	Stats         *models.ModuleStats
 	storeSettings *models.ModuleSettings
+	proxies       []*proxyEntry
+	routes        []*upstreamRoute
+	credentials   []*credential
+	sumDB         *checksumDB
 }
 
 //‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
@@ -75,27 +100,67 @@ func Infer(_ *aah.Event) {
 	Settings.storeSettings = GetSettings()
 	Settings.Stats = &models.ModuleStats{}
 	var err error
-	Settings.GoBinary, err = inferGoBinary(Settings.storeSettings.GoBinary)
-	if err != nil {
-		aah.App().Log().Errorf("Go modules proxy server would unavailable: %v", err)
-		return
-	}
-
-	Settings.GoVersion = GoVersion(Settings.GoBinary)
-	if !InferGo111AndAbove(Settings.GoVersion) {
-		aah.App().Log().Errorf("Go version found: %s. Minimum go1.11 & above is required to use go modules proxy server")
-		return
+	if Settings.storeSettings.RateLimit != nil {
+		if Settings.RateLimit, err = access.NewRateLimiter(Settings.storeSettings.RateLimit); err != nil {
+			aah.App().Log().Errorf("Go modules rate limit config error: %v", err)
+		}
 	}
-
 	Settings.GoPath = inferGopath(Settings.storeSettings.GoPath)
-	Settings.GoCache = inferGoCache()
 	Settings.ModCachePath = filepath.Join(Settings.GoPath, "pkg", "mod", "cache", "download")
+	Settings.VCSCachePath = filepath.Join(Settings.GoPath, "pkg", "mod", "cache", "thumbai-vcs")
 
-	if ess.IsStrEmpty(Settings.storeSettings.GoProxy) {
-		Settings.GoProxy = os.Getenv("GOPROXY")
+	Settings.GoBinary, err = inferGoBinary(Settings.storeSettings.GoBinary)
+	if err == nil {
+		Settings.GoVersion = GoVersion(Settings.GoBinary)
+		if !InferGo111AndAbove(Settings.GoVersion) {
+			err = fmt.Errorf("go version found: %s. Minimum go1.11 & above is required", Settings.GoVersion)
+		}
+	}
+	Settings.Fetcher = Settings.storeSettings.Fetcher
+	if Settings.Fetcher != FetcherNative {
+		if err != nil {
+			aah.App().Log().Warnf("Go binary is unusable, falling back to native module fetcher: %v", err)
+			Settings.Fetcher = FetcherNative
+		} else {
+			Settings.Fetcher = FetcherGo
+		}
+	}
+
+	if Settings.Fetcher == FetcherNative {
+		if _, err = exec.LookPath("git"); err != nil {
+			aah.App().Log().Errorf("Go modules proxy server would unavailable, native module fetcher requires git: %v", err)
+			return
+		}
+		direct = nativeFetcher{}
 	} else {
-		Settings.GoProxy = Settings.storeSettings.GoProxy
+		Settings.GoCache = inferGoCache()
+		direct = goCommand{}
+	}
+
+	goProxy := Settings.storeSettings.GoProxy
+	if ess.IsStrEmpty(goProxy) {
+		if goProxy = os.Getenv("GOPROXY"); ess.IsStrEmpty(goProxy) {
+			goProxy = defaultGoProxy
+		}
+	}
+	if err = applyUpstreams(goProxy, Settings.storeSettings.Upstreams); err != nil {
+		aah.App().Log().Errorf("Go modules upstreams config error, fetching modules directly: %v", err)
+		_ = applyUpstreams("direct", nil)
 	}
+	goSumDB := Settings.storeSettings.GoSumDB
+	if ess.IsStrEmpty(goSumDB) {
+		if goSumDB = os.Getenv("GOSUMDB"); ess.IsStrEmpty(goSumDB) {
+			goSumDB = defaultGoSumDB
+		}
+	}
+	if err = applyGoSumDB(goSumDB); err != nil {
+		aah.App().Log().Errorf("Go modules GOSUMDB config error, using %s: %v", defaultGoSumDB, err)
+		_ = applyGoSumDB(defaultGoSumDB)
+	}
+	if err = applyPrivate(Settings.storeSettings); err != nil {
+		aah.App().Log().Errorf("Go modules private config error: %v", err)
+	}
+	applyPolicies(Settings.storeSettings)
 
 	Settings.Enabled = true
 	go countGoMods()
@@ -104,6 +169,8 @@ func Infer(_ *aah.Event) {
 // FSPathDelimiter is used for mod cache operations.
 const FSPathDelimiter = "/@v/"
 
+const latestSuffix = "/@latest"
+
 // Module struct to parse JSON output of command `go mod` plus THUMBAI needs.
 type Module struct {
 	Path        string
@@ -117,7 +184,8 @@ type Module struct {
 	Action      string
 }
 
-// InferRequest method parse the go mod request into Request object.
+// InferRequest method parse the go mod request into Request object. Module
+// path and version are in the case-encoded form of the mod cache.
 //
 // {module}/@v/list fetches a list of all known versions, one per line.
 //
@@ -126,18 +194,28 @@ type Module struct {
 // {module}/@v/{version}.mod fetches the go.mod file for that version.
 //
 // {module}/@v/{version}.zip fetches the zip file for that version.
+//
+// {module}/@latest fetches JSON-formatted metadata about the latest version.
 func InferRequest(modReqPath string) (*Module, error) {
+	modReqPath = strings.TrimPrefix(modReqPath, "/")
+	if strings.HasSuffix(modReqPath, latestSuffix) {
+		mod := &Module{Path: strings.TrimSuffix(modReqPath, latestSuffix), Action: "latest"}
+		if !validModPath(mod.Path) {
+			return nil, ErrInvalidGoModPath
+		}
+		mod.DecodedPath, _ = DecodePath(mod.Path)
+		return mod, nil
+	}
+
 	parts := strings.Split(modReqPath, FSPathDelimiter)
-	if len(parts) != 2 {
+	if len(parts) != 2 || !validModPath(parts[0]) {
 		return nil, ErrInvalidGoModPath
 	}
 
 	mod := &Module{Path: parts[0]}
+	mod.DecodedPath, _ = DecodePath(mod.Path)
 	if parts[1] == "list" {
 		mod.Action = parts[1]
-		if !ess.IsFileExists(filepath.Join(Settings.ModCachePath, modReqPath)) {
-			return mod, ErrGoModNotExist
-		}
 		return mod, nil
 	}
 
@@ -147,6 +225,14 @@ func InferRequest(modReqPath string) (*Module, error) {
 	}
 	mod.Version = parts[1][:i]
 	mod.Action = parts[1][i+1:]
+	switch mod.Action {
+	case "info", "mod", "zip":
+	default:
+		return nil, ErrInvalidGoModPath
+	}
+	if !validModVersion(mod.Version) {
+		return nil, ErrInvalidGoModPath
+	}
 	if !ess.IsFileExists(filepath.Join(Settings.ModCachePath, modReqPath)) {
 		if err := checkAndCreateInfoFile(mod); err == nil {
 			return mod, nil // good to go
@@ -173,8 +259,8 @@ const tempFilePerm = os.FileMode(0644)
 
 var modMutex = map[string]bool{}
 
-// Download method downloads the requested go module path using 'go mod' or 'go get'
-// which populates the mod cache.
+// Download method downloads the requested go module path from the upstreams
+// as per routing rules, which populates the mod cache.
 func Download(mod *Module) (*Module, error) {
 	defer countGoMods()
 	app := aah.App()
@@ -199,6 +285,33 @@ func Download(mod *Module) (*Module, error) {
 		return nil, err
 	}
 
+	resultMod, err := origin.Download(mod)
+	if err != nil {
+		return nil, err
+	}
+	version, err := module.UnescapeVersion(resultMod.Version)
+	if err != nil {
+		version = resultMod.Version
+	}
+	if len(version) > 0 {
+		// queries like @latest and commit hash are resolved by now
+		if err = CheckPolicy(mod.DecodedPath, version); err == nil {
+			err = verifyModule(mod.DecodedPath, version)
+		}
+		if err != nil {
+			escPath, _ := module.EscapePath(mod.DecodedPath)
+			escVersion, _ := module.EscapeVersion(version)
+			removeModule(escPath, escVersion)
+			return nil, err
+		}
+	}
+	app.Log().Infof("Module [%s@%s] downloaded successfully into repository", resultMod.Path, resultMod.Version)
+	return resultMod, nil
+}
+
+// Download method downloads the module using 'go mod download' or 'go get'.
+func (goCommand) Download(mod *Module) (*Module, error) {
+	app := aah.App()
 	dirPath, err := createTempProject()
 	if err != nil {
 		return nil, err
@@ -222,10 +335,11 @@ func Download(mod *Module) (*Module, error) {
 		args = append(args, "get", decodedModPath(mod))
 	}
 
-	env := os.Environ()
-	env = append(env, fmt.Sprintf("GOPATH=%s", Settings.GoPath))
-	env = append(env, fmt.Sprintf("GOCACHE=%s", Settings.GoCache))
-
+	env, cleanup, err := goEnv()
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
 	cmd := exec.Command(Settings.GoBinary, args...)
 	cmd.Env = env
 	cmd.Dir = dirPath
@@ -237,6 +351,9 @@ func Download(mod *Module) (*Module, error) {
 	if status != 0 {
 		app.Log().Error(strings.TrimSpace(stdErr.String()))
 		app.Log().Error(errInfo)
+		if err = downloadError(stdOut.Bytes(), stdErr.String()); err != nil {
+			return nil, err
+		}
 		return nil, ErrExecFailure
 	}
 
@@ -278,7 +395,6 @@ func Download(mod *Module) (*Module, error) {
 		_ = checkAndCreateInfoFile(resultMod)
 	}
 
-	app.Log().Infof("Module [%s@%s] downloaded successfully into repository", resultMod.Path, resultMod.Version)
 	return resultMod, nil
 }
 
@@ -327,6 +443,38 @@ func InferGo111AndAbove(ver string) bool {
 // Package Unexported methods
 //______________________________________________________________________________
 
+// goEnv method returns the environment of go command with credentials of
+// private modules, caller must call cleanup func once command finishes. It
+// fetches modules directly from origin since upstream proxies are chained by
+// THUMBAI.
+func goEnv() ([]string, func(), error) {
+	credEnv, cleanup, err := credentialEnv()
+	if err != nil {
+		return nil, nil, err
+	}
+	Settings.RLock()
+	noSumDB := strings.Trim(Settings.Private+","+Settings.NoSumDB, ",")
+	env := append(os.Environ(),
+		fmt.Sprintf("GOPATH=%s", Settings.GoPath),
+		fmt.Sprintf("GOCACHE=%s", Settings.GoCache),
+		"GOPROXY=direct",
+		fmt.Sprintf("GOSUMDB=%s", Settings.GoSumDB),
+		fmt.Sprintf("GOPRIVATE=%s", Settings.Private),
+		fmt.Sprintf("GONOSUMDB=%s", noSumDB))
+	Settings.RUnlock()
+	return append(env, credEnv...), cleanup, nil
+}
+
+// downloadError method returns the `ModuleError` of failed `go mod download
+// -json` or `go get` if the module or version does not exist.
+func downloadError(stdOut []byte, stdErr string) error {
+	var result struct{ Error string }
+	if err := json.Unmarshal(stdOut, &result); err == nil && len(result.Error) > 0 {
+		return originError(result.Error)
+	}
+	return originError(stdErr)
+}
+
 func inferExitStatus(cmd *exec.Cmd, err error) (int, string) {
 	if err == nil {
 		ws := cmd.ProcessState.Sys().(syscall.WaitStatus)
@@ -470,5 +618,5 @@ func inferGoCache() string {
 	if err != nil {
 		return filepath.Join(Settings.GoPath, "pkg", "go-build-cache")
 	}
-	return string(b)
+	return strings.TrimSpace(string(b))
 }
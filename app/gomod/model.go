@@ -15,6 +15,9 @@
 package gomod
 
 import (
+	"strings"
+
+	"thumbai/app/access"
 	"thumbai/app/datastore"
 	"thumbai/app/models"
 
@@ -54,3 +57,138 @@ func GetSettings() *models.ModuleSettings {
 func SaveSettings(settings *models.ModuleSettings) error {
 	return datastore.Put(datastore.BucketGoModules, "settings", settings)
 }
+
+// SaveRateLimit method saves the given rate limit of go mod repository into
+// data store and applies it, nil value removes the rate limit.
+func SaveRateLimit(rl *models.RateLimit) error {
+	var limiter *access.RateLimiter
+	if rl != nil {
+		var err error
+		if limiter, err = access.NewRateLimiter(rl); err != nil {
+			return err
+		}
+	}
+	settings := GetSettings()
+	settings.RateLimit = rl
+	if err := SaveSettings(settings); err != nil {
+		return err
+	}
+	Settings.Lock()
+	Settings.RateLimit = limiter
+	Settings.Unlock()
+	return nil
+}
+
+// SaveUpstreams method saves the given GOPROXY list, GOSUMDB and routing
+// rules of upstreams into data store and applies it.
+func SaveUpstreams(goProxy, goSumDB string, routes []*models.ModuleUpstream) error {
+	if _, _, err := parseUpstreams(goProxy, routes); err != nil {
+		return err
+	}
+	if _, err := parseGoSumDB(goSumDB); err != nil {
+		return err
+	}
+	settings := GetSettings()
+	settings.GoProxy = goProxy
+	settings.GoSumDB = goSumDB
+	settings.Upstreams = routes
+	if err := SaveSettings(settings); err != nil {
+		return err
+	}
+	Settings.Lock()
+	defer Settings.Unlock()
+	if err := applyGoSumDB(goSumDB); err != nil {
+		return err
+	}
+	return applyUpstreams(goProxy, routes)
+}
+
+// SavePrivate method saves the given private and no checksum database module
+// patterns into data store and applies it.
+func SavePrivate(private, noSumDB string) error {
+	if err := validPatterns(private); err != nil {
+		return err
+	}
+	if err := validPatterns(noSumDB); err != nil {
+		return err
+	}
+	settings := GetSettings()
+	settings.Private = private
+	settings.NoSumDB = noSumDB
+	return saveAndApplyPrivate(settings)
+}
+
+// Credentials method returns the configured module credentials with its
+// secrets masked.
+func Credentials() []*models.ModuleCredential {
+	var creds []*models.ModuleCredential
+	for _, c := range GetSettings().Credentials {
+		mc := &models.ModuleCredential{Host: c.Host, Username: c.Username}
+		if len(c.Token) > 0 {
+			mc.Token = "********"
+		}
+		if len(c.SSHKey) > 0 {
+			mc.SSHKey = "********"
+		}
+		creds = append(creds, mc)
+	}
+	return creds
+}
+
+// SaveCredential method encrypts the secrets of given module credential and
+// saves it into data store, existing credential of the host is replaced.
+func SaveCredential(c *models.ModuleCredential) error {
+	token, err := datastore.Encrypt(c.Token)
+	if err != nil {
+		return err
+	}
+	sshKey, err := datastore.Encrypt(c.SSHKey)
+	if err != nil {
+		return err
+	}
+	settings := GetSettings()
+	settings.Credentials = append(removeCredential(settings.Credentials, c.Host),
+		&models.ModuleCredential{Host: c.Host, Username: c.Username, Token: token, SSHKey: sshKey})
+	return saveAndApplyPrivate(settings)
+}
+
+// DelCredential method deletes the module credential of the host from data
+// store.
+func DelCredential(host string) error {
+	settings := GetSettings()
+	settings.Credentials = removeCredential(settings.Credentials, host)
+	return saveAndApplyPrivate(settings)
+}
+
+func removeCredential(creds []*models.ModuleCredential, host string) []*models.ModuleCredential {
+	var result []*models.ModuleCredential
+	for _, c := range creds {
+		if !strings.EqualFold(c.Host, host) {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+func saveAndApplyPrivate(settings *models.ModuleSettings) error {
+	if err := SaveSettings(settings); err != nil {
+		return err
+	}
+	Settings.Lock()
+	defer Settings.Unlock()
+	return applyPrivate(settings)
+}
+
+// SavePolicies method saves the module policies of go mod repository and
+// applies it.
+func SavePolicies(policies []*models.ModulePolicy) error {
+	settings := GetSettings()
+	settings.Policies = policies
+	if err := SaveSettings(settings); err != nil {
+		return err
+	}
+	Settings.Lock()
+	defer Settings.Unlock()
+	applyPolicies(settings)
+	return nil
+}
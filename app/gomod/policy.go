@@ -0,0 +1,402 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gomod
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"thumbai/app/datastore"
+	"thumbai/app/metrics"
+	"thumbai/app/models"
+
+	"aahframe.work"
+	"aahframe.work/essentials"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// Policy actions
+const (
+	PolicyAllow = "allow"
+	PolicyBlock = "block"
+)
+
+// maxPolicyAudits is the count of recent policy audit entries kept in the
+// data store.
+const maxPolicyAudits = 500
+
+// policyAuditFlush is the interval of buffered policy audit entries are
+// written into data store. Repeated requests of the same module from the
+// client within the interval are coalesced into one entry.
+const policyAuditFlush = 5 * time.Second
+
+// retractionTTL is the duration of module retractions are served from
+// memory after it's resolved from the latest version go.mod, failed
+// resolution is retried after `listTTL`.
+const retractionTTL = 10 * time.Minute
+
+type retractionEntry struct {
+	intervals []modfile.VersionInterval
+	expires   time.Time
+}
+
+var (
+	policyAudits = struct {
+		sync.Mutex
+		pending []*models.PolicyAudit
+	}{}
+
+	retractions = struct {
+		sync.Mutex
+		m map[string]*retractionEntry
+	}{m: make(map[string]*retractionEntry)}
+
+	goModPolicyBlocked = metrics.NewCounter("thumbai_gomod_policy_blocked_total",
+		"Total go mod requests blocked by module policy, source is repo or publish.", "source")
+)
+
+// PolicyError reports the module or version is blocked by policy. It's
+// replied with status `403 Forbidden` for blocked module and `410 Gone` for
+// blocked version.
+type PolicyError struct {
+	Status  int
+	Module  string
+	Version string
+	Msg     string
+}
+
+func (e *PolicyError) Error() string {
+	return "blocked by policy: " + e.Msg
+}
+
+// ParsePolicies method parses the policy rules, a rule per line:
+//
+//	allow <pattern>
+//	block <pattern> [<vX.Y.Z] [pseudo] [retracted] [# reason]
+//
+// If any allow rule exists only the matching modules are allowed.
+func ParsePolicies(rules string) ([]*models.ModulePolicy, error) {
+	var policies []*models.ModulePolicy
+	for _, ln := range strings.Split(rules, "\n") {
+		p := &models.ModulePolicy{}
+		if i := strings.IndexByte(ln, '#'); i >= 0 {
+			p.Reason = strings.TrimSpace(ln[i+1:])
+			ln = ln[:i]
+		}
+		fields := strings.Fields(ln)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 || (fields[0] != PolicyAllow && fields[0] != PolicyBlock) {
+			return nil, fmt.Errorf("policy '%s' is not in the format 'allow|block pattern [constraints]'", strings.TrimSpace(ln))
+		}
+		p.Action, p.Pattern = fields[0], fields[1]
+		if err := validPattern(p.Pattern); err != nil {
+			return nil, err
+		}
+		for _, c := range fields[2:] {
+			switch {
+			case p.Action == PolicyAllow:
+				return nil, fmt.Errorf("policy '%s': version constraints are supported only on block", strings.TrimSpace(ln))
+			case c == "pseudo":
+				p.Pseudo = true
+			case c == "retracted":
+				p.Retracted = true
+			case strings.HasPrefix(c, "<") && semver.IsValid(c[1:]):
+				p.BelowVersion = semver.Canonical(c[1:])
+			default:
+				return nil, fmt.Errorf("policy '%s': unknown constraint '%s', supported are <vX.Y.Z, pseudo and retracted", strings.TrimSpace(ln), c)
+			}
+		}
+		policies = append(policies, p)
+	}
+	return policies, nil
+}
+
+// PolicyLines method returns the policy rules in the line format of method
+// `ParsePolicies`.
+func PolicyLines(policies []*models.ModulePolicy) string {
+	var lines []string
+	for _, p := range policies {
+		ln := p.Action + " " + p.Pattern
+		if len(p.BelowVersion) > 0 {
+			ln += " <" + p.BelowVersion
+		}
+		if p.Pseudo {
+			ln += " pseudo"
+		}
+		if p.Retracted {
+			ln += " retracted"
+		}
+		if len(p.Reason) > 0 {
+			ln += " # " + p.Reason
+		}
+		lines = append(lines, ln)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// CheckModulePolicy method checks the requested module against the policies,
+// version is checked only if it's resolved to canonical version. Module path
+// and version could be either in escaped or as-is form.
+func CheckModulePolicy(mod *Module) error {
+	modPath := mod.DecodedPath
+	if len(modPath) == 0 {
+		var err error
+		if modPath, err = DecodePath(mod.Path); err != nil {
+			modPath = mod.Path
+		}
+	}
+	version, err := module.UnescapeVersion(mod.Version)
+	if err != nil {
+		version = mod.Version
+	}
+	if !semver.IsValid(version) || semver.Canonical(version) != strings.TrimSuffix(version, "+incompatible") {
+		version = ""
+	}
+	return CheckPolicy(modPath, version)
+}
+
+// CheckPolicy method checks the module path and version against the
+// policies, empty version checks the module only. It returns `PolicyError`
+// if blocked.
+func CheckPolicy(modPath, version string) error {
+	Settings.RLock()
+	policies := Settings.Policies
+	Settings.RUnlock()
+
+	allowed, hasAllow := false, false
+	for _, p := range policies {
+		if p.Action == PolicyAllow {
+			hasAllow = true
+			allowed = allowed || module.MatchPrefixPatterns(p.Pattern, modPath)
+		}
+	}
+	if hasAllow && !allowed {
+		return &PolicyError{Status: http.StatusForbidden, Module: modPath, Version: version,
+			Msg: fmt.Sprintf("module %s is not in the allowlist", modPath)}
+	}
+
+	for _, p := range policies {
+		if p.Action != PolicyBlock || !module.MatchPrefixPatterns(p.Pattern, modPath) {
+			continue
+		}
+		if len(p.BelowVersion) == 0 && !p.Pseudo && !p.Retracted {
+			return &PolicyError{Status: http.StatusForbidden, Module: modPath, Version: version,
+				Msg: withReason(fmt.Sprintf("module %s is blocked", modPath), p.Reason)}
+		}
+		if len(version) == 0 {
+			continue
+		}
+		var msg string
+		switch {
+		case len(p.BelowVersion) > 0 && semver.Compare(version, p.BelowVersion) < 0:
+			msg = fmt.Sprintf("%s@%s is below %s", modPath, version, p.BelowVersion)
+		case p.Pseudo && module.IsPseudoVersion(version):
+			msg = fmt.Sprintf("%s@%s is a pseudo-version", modPath, version)
+		case p.Retracted && isRetracted(modPath, version):
+			msg = fmt.Sprintf("%s@%s is retracted", modPath, version)
+		default:
+			continue
+		}
+		return &PolicyError{Status: http.StatusGone, Module: modPath, Version: version, Msg: withReason(msg, p.Reason)}
+	}
+	return nil
+}
+
+// FilterVersions method removes the versions blocked by policies from the
+// version list of the module.
+func FilterVersions(mod *Module, versions []string) []string {
+	var result []string
+	for _, v := range versions {
+		if CheckPolicy(mod.DecodedPath, v) == nil {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// AuditPolicy method records the request blocked by policy into log and
+// buffers it for the data store, it's written in the background.
+func AuditPolicy(err error, source, clientIP, user string) {
+	pe, ok := err.(*PolicyError)
+	if !ok {
+		return
+	}
+	goModPolicyBlocked.Inc(source)
+
+	now := time.Now().UTC()
+	policyAudits.Lock()
+	defer policyAudits.Unlock()
+	for _, a := range policyAudits.pending {
+		if a.Source == source && a.Module == pe.Module && a.Version == pe.Version &&
+			a.ClientIP == clientIP && a.User == user {
+			a.Time = now
+			a.Count++
+			return
+		}
+	}
+	aah.App().Log().Warnf("Policy blocked %s request of '%s' from %s: %s", source, pe.Module, clientIP, pe.Msg)
+	if len(policyAudits.pending) >= maxPolicyAudits {
+		return
+	}
+	if len(policyAudits.pending) == 0 {
+		time.AfterFunc(policyAuditFlush, flushPolicyAudits)
+	}
+	policyAudits.pending = append(policyAudits.pending, &models.PolicyAudit{
+		Time:     now,
+		Source:   source,
+		Module:   pe.Module,
+		Version:  pe.Version,
+		Status:   pe.Status,
+		Message:  pe.Msg,
+		ClientIP: clientIP,
+		User:     user,
+		Count:    1,
+	})
+}
+
+// PolicyAudits method returns the recent policy audit entries, latest first.
+func PolicyAudits() []*models.PolicyAudit {
+	var audits []*models.PolicyAudit
+	policyAudits.Lock()
+	for i := len(policyAudits.pending) - 1; i >= 0; i-- {
+		a := *policyAudits.pending[i]
+		audits = append(audits, &a)
+	}
+	policyAudits.Unlock()
+
+	keys := datastore.BucketKeys(datastore.BucketPolicyAudits)
+	for i := len(keys) - 1; i >= 0 && len(audits) < maxPolicyAudits; i-- {
+		a := &models.PolicyAudit{}
+		if err := datastore.Get(datastore.BucketPolicyAudits, keys[i], a); err != nil {
+			aah.App().Log().Error(err)
+			continue
+		}
+		audits = append(audits, a)
+	}
+	return audits
+}
+
+func flushPolicyAudits() {
+	policyAudits.Lock()
+	pending := policyAudits.pending
+	policyAudits.pending = nil
+	policyAudits.Unlock()
+
+	values := make([]interface{}, 0, len(pending))
+	for _, a := range pending {
+		values = append(values, a)
+	}
+	if err := datastore.Append(datastore.BucketPolicyAudits, values, maxPolicyAudits); err != nil {
+		aah.App().Log().Error(err)
+	}
+}
+
+// applyPolicies method applies the module policies, it has to be called
+// under settings lock.
+func applyPolicies(settings *models.ModuleSettings) {
+	Settings.Policies = settings.Policies
+	retractions.Lock()
+	retractions.m = make(map[string]*retractionEntry)
+	retractions.Unlock()
+}
+
+func withReason(msg, reason string) string {
+	if len(reason) == 0 {
+		return msg
+	}
+	return msg + " (" + reason + ")"
+}
+
+// isRetracted method reports whether the version is retracted by the go.mod
+// of the latest version of the module. Retractions are resolved once per
+// `retractionTTL` for a module, errors are logged and treated as not
+// retracted.
+func isRetracted(modPath, version string) bool {
+	for _, r := range moduleRetractions(modPath) {
+		if semver.Compare(r.Low, version) <= 0 && semver.Compare(version, r.High) <= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func moduleRetractions(modPath string) []modfile.VersionInterval {
+	retractions.Lock()
+	if e, found := retractions.m[modPath]; found && time.Now().Before(e.expires) {
+		retractions.Unlock()
+		return e.intervals
+	}
+	// placeholder till it's resolved, download of the latest version checks
+	// the policies of the same module
+	retractions.m[modPath] = &retractionEntry{expires: time.Now().Add(listTTL)}
+	retractions.Unlock()
+
+	e := &retractionEntry{expires: time.Now().Add(retractionTTL)}
+	var err error
+	if e.intervals, err = resolveRetractions(modPath); err != nil {
+		aah.App().Log().Warnf("Unable to check retractions of '%s': %v", modPath, err)
+		e.expires = time.Now().Add(listTTL)
+	}
+	retractions.Lock()
+	retractions.m[modPath] = e
+	retractions.Unlock()
+	return e.intervals
+}
+
+// resolveRetractions method reads the retract directives of the latest
+// version go.mod, it's downloaded into repository via `Download` if missing,
+// so it's verified and checked against the policies as usual.
+func resolveRetractions(modPath string) ([]modfile.VersionInterval, error) {
+	escPath, err := module.EscapePath(modPath)
+	if err != nil {
+		return nil, err
+	}
+	info, err := Latest(&Module{Path: escPath, DecodedPath: modPath, Action: "latest"})
+	if err != nil {
+		return nil, err
+	}
+	escVersion, err := module.EscapeVersion(info.Version)
+	if err != nil {
+		return nil, err
+	}
+	goModFile := filepath.Join(Settings.ModCachePath, escPath, "@v", escVersion+".mod")
+	if !ess.IsFileExists(goModFile) {
+		if _, err = Download(&Module{Path: escPath, Version: escVersion, Action: "mod"}); err != nil {
+			return nil, err
+		}
+	}
+	b, err := ioutil.ReadFile(goModFile)
+	if err != nil {
+		return nil, err
+	}
+	f, err := modfile.ParseLax(goModFile, b, nil)
+	if err != nil {
+		return nil, err
+	}
+	var intervals []modfile.VersionInterval
+	for _, r := range f.Retract {
+		intervals = append(intervals, r.VersionInterval)
+	}
+	return intervals, nil
+}
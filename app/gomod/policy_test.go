@@ -0,0 +1,114 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gomod
+
+import (
+	"net/http"
+	"testing"
+
+	"thumbai/app/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setPolicies(t *testing.T, rules string) func() {
+	policies, err := ParsePolicies(rules)
+	assert.Nil(t, err)
+	Settings.Lock()
+	prev := Settings.Policies
+	applyPolicies(&models.ModuleSettings{Policies: policies})
+	Settings.Unlock()
+	return func() {
+		Settings.Lock()
+		Settings.Policies = prev
+		Settings.Unlock()
+	}
+}
+
+func policyStatus(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	return ErrorStatus(err)
+}
+
+func TestParsePolicies(t *testing.T) {
+	rules := "allow github.com/*\n\n  # comment only\nblock github.com/example/legacy # deprecated, use v2\nblock github.com/example/lib <v1.4 pseudo retracted"
+	policies, err := ParsePolicies(rules)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(policies))
+	assert.Equal(t, &models.ModulePolicy{Action: PolicyAllow, Pattern: "github.com/*"}, policies[0])
+	assert.Equal(t, &models.ModulePolicy{Action: PolicyBlock, Pattern: "github.com/example/legacy", Reason: "deprecated, use v2"}, policies[1])
+	assert.Equal(t, &models.ModulePolicy{Action: PolicyBlock, Pattern: "github.com/example/lib",
+		BelowVersion: "v1.4.0", Pseudo: true, Retracted: true}, policies[2])
+	assert.Equal(t, "allow github.com/*\nblock github.com/example/legacy # deprecated, use v2\n"+
+		"block github.com/example/lib <v1.4.0 pseudo retracted", PolicyLines(policies))
+
+	for _, r := range []string{"deny github.com/*", "block", "allow github.com/* pseudo", "block github.com/x <1.0.0", "block github.com/x latest", "block [ab"} {
+		_, err = ParsePolicies(r)
+		assert.NotNil(t, err, r)
+	}
+}
+
+func TestCheckPolicy(t *testing.T) {
+	o := &testOrigin{latest: map[string]*Info{
+		"github.com/example/lib": {Version: "v1.5.0"},
+	}}
+	defer setupModCache(t, o)()
+	writeModFile(t, "github.com/example/lib/@v/v1.5.0.mod", "module github.com/example/lib\n\nretract (\n\tv1.4.1\n\t[v1.4.5, v1.4.7]\n)\n")
+
+	// no policies
+	assert.Nil(t, CheckPolicy("example.com/any", "v0.0.1"))
+
+	defer setPolicies(t, "allow github.com/example,golang.org/x/*\n"+
+		"block github.com/example/legacy # deprecated\n"+
+		"block github.com/example/lib <v1.4.0 pseudo retracted")()
+
+	testcases := []struct {
+		modPath, version string
+		status           int
+	}{
+		{"example.com/any", "", http.StatusForbidden},
+		{"example.com/any", "v1.0.0", http.StatusForbidden},
+		{"golang.org/x/mod", "v0.1.0", http.StatusOK},
+		{"github.com/example/legacy", "", http.StatusForbidden},
+		{"github.com/example/legacy/sub", "v1.0.0", http.StatusForbidden},
+		{"github.com/example/lib", "", http.StatusOK},
+		{"github.com/example/lib", "v1.3.9", http.StatusGone},
+		{"github.com/example/lib", "v1.4.0", http.StatusOK},
+		{"github.com/example/lib", "v1.4.1", http.StatusGone},
+		{"github.com/example/lib", "v1.4.6", http.StatusGone},
+		{"github.com/example/lib", "v1.4.8", http.StatusOK},
+		{"github.com/example/lib", "v1.5.1-0.20190601100000-7e312af9202b", http.StatusGone},
+	}
+	for _, tc := range testcases {
+		assert.Equal(t, tc.status, policyStatus(CheckPolicy(tc.modPath, tc.version)), tc.modPath+"@"+tc.version)
+	}
+
+	err := CheckPolicy("github.com/example/legacy", "")
+	assert.Equal(t, "blocked by policy: module github.com/example/legacy is blocked (deprecated)", err.Error())
+
+	// escaped request, non-canonical version is checked at module level
+	assert.Equal(t, http.StatusGone, policyStatus(CheckModulePolicy(&Module{Path: "github.com/example/lib", Version: "v1.3.0"})))
+	assert.Nil(t, CheckModulePolicy(&Module{Path: "github.com/example/lib", Version: "master"}))
+	assert.Equal(t, http.StatusForbidden, policyStatus(CheckModulePolicy(&Module{Path: "github.com/!example/x", Version: "latest"})))
+
+	mod := &Module{Path: "github.com/example/lib", DecodedPath: "github.com/example/lib"}
+	assert.Equal(t, []string{"v1.4.0", "v1.4.8", "v1.5.0"},
+		FilterVersions(mod, []string{"v1.0.0", "v1.4.0", "v1.4.1", "v1.4.6", "v1.4.8", "v1.5.0"}))
+
+	// retractions are resolved from origin once per module
+	assert.Equal(t, 1, o.calls)
+}
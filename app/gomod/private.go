@@ -0,0 +1,207 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gomod
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"thumbai/app/datastore"
+	"thumbai/app/models"
+
+	"aahframe.work"
+	"golang.org/x/mod/module"
+)
+
+// credential is the decrypted module credential of the host.
+type credential struct {
+	Host     string
+	Username string
+	Token    string
+	SSHKey   string
+}
+
+// IsPrivate method reports whether the module path matches the private
+// module patterns (GOPRIVATE). Private modules are always fetched from its
+// origin and never verified against checksum database.
+func IsPrivate(modPath string) bool {
+	Settings.RLock()
+	defer Settings.RUnlock()
+	return isPrivate(modPath)
+}
+
+// NoSumDB method reports whether the module path must not be verified
+// against checksum database (GONOSUMDB), private modules included.
+func NoSumDB(modPath string) bool {
+	Settings.RLock()
+	defer Settings.RUnlock()
+	return isPrivate(modPath) || module.MatchPrefixPatterns(Settings.NoSumDB, modPath)
+}
+
+func isPrivate(modPath string) bool {
+	return module.MatchPrefixPatterns(Settings.Private, modPath)
+}
+
+// ValidatePrivate method validates the private and no checksum database
+// module patterns, it returns the field errors if any.
+func ValidatePrivate(private, noSumDB string) map[string]string {
+	errs := make(map[string]string)
+	if err := validPatterns(private); err != nil {
+		errs["private"] = err.Error()
+	}
+	if err := validPatterns(noSumDB); err != nil {
+		errs["noSumDB"] = err.Error()
+	}
+	return errs
+}
+
+// ValidateCredential method validates the module credential, it returns the
+// field errors if any.
+func ValidateCredential(c *models.ModuleCredential) map[string]string {
+	errs := make(map[string]string)
+	if len(c.Host) == 0 || strings.ContainsAny(c.Host, "/@: \t") {
+		errs["credentialHost"] = "Host name is required, without scheme and path such as 'git.example.com'"
+	}
+	if len(c.Token) == 0 && len(c.SSHKey) == 0 {
+		errs["credentialToken"] = "Either token or SSH private key is required"
+	}
+	if len(c.SSHKey) > 0 && !strings.Contains(c.SSHKey, "PRIVATE KEY-----") {
+		errs["credentialSSHKey"] = "SSH private key must be in PEM or OpenSSH format"
+	}
+	return errs
+}
+
+func validPatterns(patterns string) error {
+	if len(strings.TrimSpace(patterns)) == 0 {
+		return nil
+	}
+	return validPattern(patterns)
+}
+
+// applyPrivate method applies the private module patterns and decrypts the
+// credentials, caller must hold the settings lock.
+func applyPrivate(ms *models.ModuleSettings) error {
+	var creds []*credential
+	for _, c := range ms.Credentials {
+		token, err := datastore.Decrypt(c.Token)
+		if err != nil {
+			return fmt.Errorf("credential of '%s': %v", c.Host, err)
+		}
+		sshKey, err := datastore.Decrypt(c.SSHKey)
+		if err != nil {
+			return fmt.Errorf("credential of '%s': %v", c.Host, err)
+		}
+		creds = append(creds, &credential{Host: c.Host, Username: c.Username, Token: token, SSHKey: sshKey})
+	}
+	Settings.Private = ms.Private
+	Settings.NoSumDB = ms.NoSumDB
+	Settings.credentials = creds
+	return nil
+}
+
+func credentialOf(host string) *credential {
+	Settings.RLock()
+	defer Settings.RUnlock()
+	for _, c := range Settings.credentials {
+		if strings.EqualFold(c.Host, host) {
+			return c
+		}
+	}
+	return nil
+}
+
+// setBasicAuth method sets the token credential of the request host if
+// configured.
+func setBasicAuth(req *http.Request) {
+	if c := credentialOf(req.URL.Hostname()); c != nil && len(c.Token) > 0 {
+		req.SetBasicAuth(c.username(), c.Token)
+	}
+}
+
+func (c *credential) username() string {
+	if len(c.Username) == 0 {
+		return "git"
+	}
+	return c.Username
+}
+
+// credentialEnv method returns the environment to inject the credentials
+// into git and go command. Tokens are sent as HTTP basic authorization of
+// its host and written into netrc file of go command; hosts with SSH key are
+// fetched over SSH. Files are created in the temporary directory, the
+// returned cleanup func removes it.
+func credentialEnv() ([]string, func(), error) {
+	Settings.RLock()
+	creds := Settings.credentials
+	Settings.RUnlock()
+	if len(creds) == 0 {
+		return nil, func() {}, nil
+	}
+
+	dir, err := ioutil.TempDir("", "thumbai-cred-")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup := func() {
+		if err := os.RemoveAll(dir); err != nil {
+			aah.App().Log().Warn(err)
+		}
+	}
+
+	var netrc strings.Builder
+	var gitConfig [][2]string
+	var sshKeys []string
+	for i, c := range creds {
+		if len(c.SSHKey) > 0 {
+			keyFile := filepath.Join(dir, "id_"+strconv.Itoa(i))
+			key := strings.TrimSpace(strings.Replace(c.SSHKey, "\r\n", "\n", -1)) + "\n"
+			if err = ioutil.WriteFile(keyFile, []byte(key), 0600); err != nil {
+				cleanup()
+				return nil, nil, err
+			}
+			sshKeys = append(sshKeys, "-i '"+keyFile+"'")
+			gitConfig = append(gitConfig, [2]string{
+				"url.ssh://" + c.username() + "@" + c.Host + "/.insteadOf", "https://" + c.Host + "/"})
+			continue
+		}
+		fmt.Fprintf(&netrc, "machine %s login %s password %s\n", c.Host, c.username(), c.Token)
+		gitConfig = append(gitConfig, [2]string{"http.https://" + c.Host + "/.extraHeader",
+			"Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte(c.username()+":"+c.Token))})
+	}
+
+	env := []string{"GIT_CONFIG_COUNT=" + strconv.Itoa(len(gitConfig))}
+	for i, kv := range gitConfig {
+		env = append(env, fmt.Sprintf("GIT_CONFIG_KEY_%d=%s", i, kv[0]), fmt.Sprintf("GIT_CONFIG_VALUE_%d=%s", i, kv[1]))
+	}
+	if len(sshKeys) > 0 {
+		env = append(env, "GIT_SSH_COMMAND=ssh -o IdentitiesOnly=yes -o BatchMode=yes "+
+			"-o StrictHostKeyChecking=accept-new "+strings.Join(sshKeys, " "))
+	}
+	if netrc.Len() > 0 {
+		netrcFile := filepath.Join(dir, ".netrc")
+		if err = ioutil.WriteFile(netrcFile, []byte(netrc.String()), 0600); err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+		env = append(env, "NETRC="+netrcFile)
+	}
+	return env, cleanup, nil
+}
@@ -0,0 +1,358 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gomod
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"aahframe.work"
+	"aahframe.work/essentials"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// GOPROXY protocol
+// Doc: https://golang.org/ref/mod#goproxy-protocol
+
+// listTTL is the duration of module version list is served from the mod
+// cache after it's regenerated from origin.
+const listTTL = time.Minute
+
+// fetcher resolves the module versions and downloads them into mod cache.
+type fetcher interface {
+	Versions(modPath string) ([]string, error)
+	Latest(modPath string) (*Info, error)
+	Download(mod *Module) (*Module, error)
+}
+
+// origin is the source of modules, by default upstream proxies as per
+// routing rules.
+var origin fetcher = upstreams{}
+
+var listRefreshed = struct {
+	sync.Mutex
+	m map[string]time.Time
+}{m: make(map[string]time.Time)}
+
+// Info is the JSON-formatted metadata of the module version, it's the
+// response of `{module}/@v/{version}.info` and `{module}/@latest`.
+type Info struct {
+	Version string
+	Time    time.Time
+}
+
+// ModuleError reports the module or version does not exist at origin. It's
+// replied with status `404 Not Found` for unknown module and `410 Gone` for
+// invalid version of the module, so that the go command falls back to the
+// next proxy of `GOPROXY`.
+type ModuleError struct {
+	Status int
+	Msg    string
+}
+
+func (e *ModuleError) Error() string {
+	return "not found: " + e.Msg
+}
+
+// ErrorStatus method returns the HTTP status code of the given go mod
+// error.
+func ErrorStatus(err error) int {
+	switch e := err.(type) {
+	case *ModuleError:
+		return e.Status
+	case *PolicyError:
+		return e.Status
+	}
+	switch err {
+	case ErrInvalidGoModPath:
+		return http.StatusBadRequest
+	case ErrGoModNotExist:
+		return http.StatusNotFound
+	case ErrSumDBPrivate:
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
+
+// List method returns the known release versions of the module in semver
+// order. It's regenerated from origin at most once per `listTTL`, cached
+// versions are served if the origin is unreachable.
+func List(mod *Module) ([]string, error) {
+	listFile := filepath.Join(Settings.ModCachePath, mod.Path, "@v", "list")
+	cached := readVersions(listFile)
+
+	listRefreshed.Lock()
+	refreshed, found := listRefreshed.m[mod.Path]
+	listRefreshed.Unlock()
+	if found && time.Since(refreshed) < listTTL {
+		return cached, nil
+	}
+
+	versions, err := origin.Versions(mod.DecodedPath)
+	if err != nil {
+		if len(cached) > 0 {
+			aah.App().Log().Warnf("Unable to list versions of '%s' from origin, serving from repository: %v", mod.DecodedPath, err)
+			return cached, nil
+		}
+		return nil, err
+	}
+	versions = releaseVersions(append(versions, cached...))
+	if err = writeVersions(listFile, versions); err != nil {
+		aah.App().Log().Errorf("Unable to write versions list of '%s': %v", mod.DecodedPath, err)
+	}
+	listRefreshed.Lock()
+	listRefreshed.m[mod.Path] = time.Now()
+	listRefreshed.Unlock()
+	return versions, nil
+}
+
+// Latest method returns the info of the latest version of the module from
+// origin, highest version from repository is served if the origin is
+// unreachable.
+func Latest(mod *Module) (*Info, error) {
+	info, err := origin.Latest(mod.DecodedPath)
+	if err == nil {
+		return info, nil
+	}
+	if cached := latestCachedInfo(mod.Path); cached != nil {
+		aah.App().Log().Warnf("Unable to resolve latest version of '%s' from origin, serving from repository: %v", mod.DecodedPath, err)
+		return cached, nil
+	}
+	return nil, err
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// go command origin
+//______________________________________________________________________________
+
+type goCommand struct{}
+
+type goListResult struct {
+	Version  string
+	Time     *time.Time
+	Versions []string
+	Error    *struct{ Err string }
+}
+
+func (goCommand) Versions(modPath string) ([]string, error) {
+	r, err := goListModule("-versions", modPath)
+	if err != nil {
+		return nil, err
+	}
+	return r.Versions, nil
+}
+
+func (goCommand) Latest(modPath string) (*Info, error) {
+	r, err := goListModule(modPath + "@latest")
+	if err != nil {
+		return nil, err
+	}
+	info := &Info{Version: r.Version}
+	if r.Time != nil {
+		info.Time = *r.Time
+	}
+	return info, nil
+}
+
+// goListModule method runs `go list -m -e -json` with given args, error
+// reported by go command is returned as `ModuleError` if applicable.
+func goListModule(args ...string) (*goListResult, error) {
+	dirPath, err := createTempProject()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := os.RemoveAll(dirPath); err != nil {
+			aah.App().Log().Warn(err)
+		}
+	}()
+
+	args = append([]string{"list", "-m", "-e", "-json"}, args...)
+	cmd := exec.Command(Settings.GoBinary, args...)
+	env, cleanup, err := goEnv()
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	cmd.Env = env
+	cmd.Dir = dirPath
+	stdOut, stdErr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd.Stdout, cmd.Stderr = stdOut, stdErr
+
+	aah.App().Log().Info("Executing ", Settings.GoBinary, " ", strings.Join(args, " "))
+	if status, errInfo := inferExitStatus(cmd, cmd.Run()); status != 0 {
+		if err := originError(stdErr.String()); err != nil {
+			return nil, err
+		}
+		aah.App().Log().Error(strings.TrimSpace(stdErr.String()))
+		aah.App().Log().Error(errInfo)
+		return nil, ErrExecFailure
+	}
+
+	r := &goListResult{}
+	if err := json.NewDecoder(stdOut).Decode(r); err != nil {
+		return nil, err
+	}
+	if r.Error != nil {
+		if err := originError(r.Error.Err); err != nil {
+			return nil, err
+		}
+		aah.App().Log().Error(r.Error.Err)
+		return nil, ErrExecFailure
+	}
+	return r, nil
+}
+
+// Origin error messages of the go command and git, as reported by `go list`,
+// `go mod download` and git remote operations. HTTP statuses and `not found`
+// are matched only in the forms reported for the module or repository, not
+// anywhere in the message.
+var (
+	goneMessages = []string{
+		"unknown revision", "invalid version", "no matching versions",
+		"invalid pseudo-version", "disallowed version", "retracted",
+	}
+	notFoundMessages = regexp.MustCompile(`(?im)` + strings.Join([]string{
+		`: (404 not found|410 gone)$`,              // go command reading from proxy
+		`server response: not found`,               // go proxy response body
+		`^not found: `,                             // go proxy response body
+		`the requested url returned error: 40[14]`, // git over https
+		`repository ('[^']*' )?not found`,          // git hosting services
+		`repository '[^']*' does not exist`,        // git hosting services
+		`unrecognized import path`, `no such host`, `terminal prompts disabled`,
+		`malformed module path`, `no secure protocol found`,
+		`does not appear to be a git repository`,
+	}, "|"))
+)
+
+// originError method returns the `ModuleError` if the given go command
+// error message reports the module or version does not exist, otherwise
+// nil.
+func originError(msg string) error {
+	msg = strings.TrimSpace(msg)
+	lmsg := strings.ToLower(msg)
+	for _, m := range goneMessages {
+		if strings.Contains(lmsg, m) {
+			return &ModuleError{Status: http.StatusGone, Msg: msg}
+		}
+	}
+	if notFoundMessages.MatchString(msg) {
+		return &ModuleError{Status: http.StatusNotFound, Msg: msg}
+	}
+	return nil
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// Unexported methods
+//______________________________________________________________________________
+
+func validModPath(escaped string) bool {
+	_, err := module.UnescapePath(escaped)
+	return err == nil
+}
+
+func validModVersion(escaped string) bool {
+	v, err := module.UnescapeVersion(escaped)
+	return err == nil && len(v) > 0 && v != "list" && !strings.Contains(v, "/")
+}
+
+// releaseVersions method returns the unique canonical versions in semver
+// order excluding pseudo-versions, as expected by `{module}/@v/list`.
+func releaseVersions(versions []string) []string {
+	seen := make(map[string]bool, len(versions))
+	result := make([]string, 0, len(versions))
+	for _, v := range versions {
+		if !semver.IsValid(v) || (v != semver.Canonical(v) && !strings.HasSuffix(v, "+incompatible")) ||
+			module.IsPseudoVersion(v) || seen[v] {
+			continue
+		}
+		seen[v] = true
+		result = append(result, v)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return semver.Compare(result[i], result[j]) < 0
+	})
+	return result
+}
+
+func readVersions(listFile string) []string {
+	f, err := os.Open(listFile)
+	if err != nil {
+		return []string{}
+	}
+	defer ess.CloseQuietly(f)
+	var versions []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if v := strings.TrimSpace(scanner.Text()); len(v) > 0 {
+			versions = append(versions, v)
+		}
+	}
+	return releaseVersions(versions)
+}
+
+func writeVersions(listFile string, versions []string) error {
+	if err := ess.MkDirAll(filepath.Dir(listFile), 0755); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	for _, v := range versions {
+		buf.WriteString(v + "\n")
+	}
+	return ioutil.WriteFile(listFile, buf.Bytes(), tempFilePerm)
+}
+
+// latestCachedInfo method returns the info of the highest version from
+// the repository, release versions take precedence over pre-release and
+// pseudo-versions.
+func latestCachedInfo(escapedPath string) *Info {
+	files, _ := filepath.Glob(filepath.Join(Settings.ModCachePath, escapedPath, "@v", "*.info"))
+	var latest *Info
+	for _, f := range files {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			continue
+		}
+		info := &Info{}
+		if err = json.Unmarshal(b, info); err != nil || !semver.IsValid(info.Version) {
+			continue
+		}
+		if latest == nil || latestPrecedes(latest.Version, info.Version) {
+			latest = info
+		}
+	}
+	return latest
+}
+
+func latestPrecedes(current, v string) bool {
+	currentRelease := len(semver.Prerelease(current)) == 0 && !module.IsPseudoVersion(current)
+	vRelease := len(semver.Prerelease(v)) == 0 && !module.IsPseudoVersion(v)
+	if currentRelease != vRelease {
+		return vRelease
+	}
+	return semver.Compare(current, v) < 0
+}
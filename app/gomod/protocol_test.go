@@ -0,0 +1,249 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gomod
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testOrigin struct {
+	versions map[string][]string
+	latest   map[string]*Info
+	err      error
+	calls    int
+}
+
+func (o *testOrigin) Versions(modPath string) ([]string, error) {
+	o.calls++
+	if o.err != nil {
+		return nil, o.err
+	}
+	versions, found := o.versions[modPath]
+	if !found {
+		return nil, &ModuleError{Status: http.StatusNotFound, Msg: "module " + modPath + ": not found"}
+	}
+	return versions, nil
+}
+
+func (o *testOrigin) Latest(modPath string) (*Info, error) {
+	o.calls++
+	if o.err != nil {
+		return nil, o.err
+	}
+	info, found := o.latest[modPath]
+	if !found {
+		return nil, &ModuleError{Status: http.StatusNotFound, Msg: "module " + modPath + ": not found"}
+	}
+	return info, nil
+}
+
+func (o *testOrigin) Download(mod *Module) (*Module, error) {
+	o.calls++
+	if o.err != nil {
+		return nil, o.err
+	}
+	if _, found := o.versions[mod.DecodedPath]; !found {
+		return nil, &ModuleError{Status: http.StatusNotFound, Msg: "module " + mod.DecodedPath + ": not found"}
+	}
+	return mod, nil
+}
+
+func setupModCache(t *testing.T, o *testOrigin) func() {
+	dir, err := ioutil.TempDir("", "gomod")
+	assert.Nil(t, err)
+	prevPath, prevOrigin := Settings.ModCachePath, origin
+	Settings.ModCachePath, origin = dir, o
+	listRefreshed.Lock()
+	listRefreshed.m = make(map[string]time.Time)
+	listRefreshed.Unlock()
+	return func() {
+		Settings.ModCachePath, origin = prevPath, prevOrigin
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func writeModFile(t *testing.T, name, content string) {
+	fname := filepath.Join(Settings.ModCachePath, filepath.FromSlash(name))
+	assert.Nil(t, os.MkdirAll(filepath.Dir(fname), 0755))
+	assert.Nil(t, ioutil.WriteFile(fname, []byte(content), 0644))
+}
+
+func TestInferRequest(t *testing.T) {
+	defer setupModCache(t, &testOrigin{})()
+	writeModFile(t, "github.com/!burnt!sushi/toml/@v/v0.3.1.mod", "module github.com/BurntSushi/toml\n")
+
+	testcases := []struct {
+		path, modPath, decoded, version, action string
+		err                                     error
+	}{
+		{"/github.com/!burnt!sushi/toml/@v/list", "github.com/!burnt!sushi/toml", "github.com/BurntSushi/toml", "", "list", nil},
+		{"github.com/!burnt!sushi/toml/@latest", "github.com/!burnt!sushi/toml", "github.com/BurntSushi/toml", "", "latest", nil},
+		{"github.com/!burnt!sushi/toml/@v/v0.3.1.mod", "github.com/!burnt!sushi/toml", "github.com/BurntSushi/toml", "v0.3.1", "mod", nil},
+		{"github.com/!burnt!sushi/toml/@v/v0.3.1.zip", "github.com/!burnt!sushi/toml", "github.com/BurntSushi/toml", "v0.3.1", "zip", ErrGoModNotExist},
+		{"github.com/!burnt!sushi/toml/@v/v0.4.0-!r!c1.info", "github.com/!burnt!sushi/toml", "github.com/BurntSushi/toml", "v0.4.0-!r!c1", "info", ErrGoModNotExist},
+		{"github.com/!burnt!sushi/toml/@v/master.info", "github.com/!burnt!sushi/toml", "github.com/BurntSushi/toml", "master", "info", ErrGoModNotExist},
+	}
+	for _, tc := range testcases {
+		mod, err := InferRequest(tc.path)
+		assert.Equal(t, tc.err, err, tc.path)
+		if assert.NotNil(t, mod, tc.path) {
+			assert.Equal(t, tc.modPath, mod.Path, tc.path)
+			assert.Equal(t, tc.decoded, mod.DecodedPath, tc.path)
+			assert.Equal(t, tc.version, mod.Version, tc.path)
+			assert.Equal(t, tc.action, mod.Action, tc.path)
+		}
+	}
+
+	for _, p := range []string{
+		"github.com/BurntSushi/toml/@v/list",
+		"github.com/!burnt!sushi/toml/@v/v0.3.1.txt",
+		"github.com/!burnt!sushi/toml/@v/v0.3.1",
+		"github.com/!burnt!sushi/toml/@v/.info",
+		"github.com/!burnt!sushi/toml/@v/v0.3.1/x.info",
+		"github.com/!burnt!sushi/toml/@v/V1.0.0.info",
+		"github.com/!burnt!sushi/toml",
+		"/@latest",
+		"github.com/!burnt!sushi/toml/@v/list/@v/list",
+	} {
+		mod, err := InferRequest(p)
+		assert.Nil(t, mod, p)
+		assert.Equal(t, ErrInvalidGoModPath, err, p)
+	}
+}
+
+func TestList(t *testing.T) {
+	o := &testOrigin{versions: map[string][]string{
+		"github.com/BurntSushi/toml": {"v0.3.1", "v0.2.0", "v1.0.0-rc.1", "v0.10.0", "v0.3.1"},
+	}}
+	defer setupModCache(t, o)()
+	writeModFile(t, "github.com/!burnt!sushi/toml/@v/list", "v0.1.0\nv0.0.0-20191109021931-daa7c04131f5\nv0.3.1\n")
+
+	mod, _ := InferRequest("github.com/!burnt!sushi/toml/@v/list")
+	versions, err := List(mod)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"v0.1.0", "v0.2.0", "v0.3.1", "v0.10.0", "v1.0.0-rc.1"}, versions)
+	b, _ := ioutil.ReadFile(filepath.Join(Settings.ModCachePath, "github.com/!burnt!sushi/toml/@v/list"))
+	assert.Equal(t, "v0.1.0\nv0.2.0\nv0.3.1\nv0.10.0\nv1.0.0-rc.1\n", string(b))
+
+	// served from repository within list TTL
+	o.versions["github.com/BurntSushi/toml"] = append(o.versions["github.com/BurntSushi/toml"], "v1.0.0")
+	versions, _ = List(mod)
+	assert.Equal(t, 1, o.calls)
+	assert.Len(t, versions, 5)
+
+	listRefreshed.m[mod.Path] = time.Now().Add(-2 * listTTL)
+	versions, _ = List(mod)
+	assert.Equal(t, 2, o.calls)
+	assert.Equal(t, "v1.0.0", versions[len(versions)-1])
+
+	// origin is unreachable, served from repository
+	o.err = errors.New("dial tcp: connection refused")
+	listRefreshed.m[mod.Path] = time.Time{}
+	versions, err = List(mod)
+	assert.Nil(t, err)
+	assert.Len(t, versions, 6)
+
+	// unknown module
+	o.err = nil
+	mod, _ = InferRequest("example.com/unknown/@v/list")
+	versions, err = List(mod)
+	assert.Nil(t, versions)
+	assert.Equal(t, http.StatusNotFound, ErrorStatus(err))
+	assert.Equal(t, "not found: module example.com/unknown: not found", err.Error())
+
+	// module without release versions
+	o.versions["example.com/pseudo"] = []string{}
+	mod, _ = InferRequest("example.com/pseudo/@v/list")
+	versions, err = List(mod)
+	assert.Nil(t, err)
+	assert.Empty(t, versions)
+}
+
+func TestLatest(t *testing.T) {
+	o := &testOrigin{latest: map[string]*Info{
+		"github.com/BurntSushi/toml": {Version: "v0.3.1", Time: time.Date(2018, 8, 27, 21, 52, 38, 0, time.UTC)},
+	}}
+	defer setupModCache(t, o)()
+
+	mod, _ := InferRequest("github.com/!burnt!sushi/toml/@latest")
+	info, err := Latest(mod)
+	assert.Nil(t, err)
+	assert.Equal(t, "v0.3.1", info.Version)
+
+	mod, _ = InferRequest("example.com/mod/@latest")
+	info, err = Latest(mod)
+	assert.Nil(t, info)
+	assert.Equal(t, http.StatusNotFound, ErrorStatus(err))
+
+	// origin is unreachable, highest release from repository
+	o.err = errors.New("dial tcp: connection refused")
+	writeModFile(t, "example.com/mod/@v/v1.1.0.info", `{"Version":"v1.1.0","Time":"2019-01-02T10:00:00Z"}`)
+	writeModFile(t, "example.com/mod/@v/v1.2.0.info", `{"Version":"v1.2.0","Time":"2019-02-02T10:00:00Z"}`)
+	writeModFile(t, "example.com/mod/@v/v1.3.0-beta.1.info", `{"Version":"v1.3.0-beta.1","Time":"2019-03-02T10:00:00Z"}`)
+	writeModFile(t, "example.com/mod/@v/v1.2.1-0.20190401100000-abcdefabcdef.info", `{"Version":"v1.2.1-0.20190401100000-abcdefabcdef","Time":"2019-04-01T10:00:00Z"}`)
+	info, err = Latest(mod)
+	assert.Nil(t, err)
+	assert.Equal(t, "v1.2.0", info.Version)
+	assert.Equal(t, time.Date(2019, 2, 2, 10, 0, 0, 0, time.UTC), info.Time)
+
+	mod, _ = InferRequest("example.com/unreachable/@latest")
+	_, err = Latest(mod)
+	assert.Equal(t, http.StatusInternalServerError, ErrorStatus(err))
+}
+
+func TestOriginError(t *testing.T) {
+	testcases := []struct {
+		msg    string
+		status int
+	}{
+		{"github.com/x/y@v9.9.9: invalid version: unknown revision v9.9.9", http.StatusGone},
+		{"no matching versions for query \"latest\"", http.StatusGone},
+		{"module example.com/x: reading https://proxy.golang.org/example.com/x/@v/list: 404 Not Found", http.StatusNotFound},
+		{"unrecognized import path \"example.com/x\": https fetch: Get \"https://example.com/x?go-get=1\": dial tcp: lookup example.com: no such host", http.StatusNotFound},
+		{"git ls-remote -q origin: exit status 128: fatal: could not read Username: terminal prompts disabled", http.StatusNotFound},
+		{"module example.com/x: reading https://proxy.example.com/example.com/x/@v/v1.0.0.info: 410 Gone\n\tserver response: not found: unknown revision", http.StatusGone},
+		{"go: example.com/x@v1.0.0: reading https://proxy.example.com/example.com/x/@v/v1.0.0.mod: 410 Gone", http.StatusNotFound},
+		{"fatal: unable to access 'https://git.example.com/x/': The requested URL returned error: 404", http.StatusNotFound},
+		{"remote: Repository not found.\nfatal: repository 'https://github.com/x/y/' not found", http.StatusNotFound},
+	}
+	for _, tc := range testcases {
+		err := originError(tc.msg)
+		assert.Equal(t, tc.status, ErrorStatus(err), tc.msg)
+	}
+	assert.Nil(t, originError("signal: killed"))
+	for _, msg := range []string{
+		"exec: \"git\": executable file not found in $PATH",
+		"git: command not found",
+		"example.com/x404@v1.0.0: verifying module: checksum mismatch",
+		"open /gopath/pkg/mod/cache/download/example.com/x/@v/v1.0.0.lock: file does not exist",
+	} {
+		assert.Nil(t, originError(msg), msg)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, ErrorStatus(ErrInvalidGoModPath))
+	assert.Equal(t, http.StatusNotFound, ErrorStatus(ErrGoModNotExist))
+	assert.Equal(t, http.StatusInternalServerError, ErrorStatus(ErrExecFailure))
+
+	err := downloadError([]byte(`{"Path":"example.com/x","Version":"v1.0.0","Error":"example.com/x@v1.0.0: invalid version: unknown revision v1.0.0"}`), "")
+	assert.Equal(t, http.StatusGone, ErrorStatus(err))
+}
@@ -0,0 +1,332 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gomod
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"aahframe.work"
+	"aahframe.work/essentials"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb"
+	"golang.org/x/mod/sumdb/dirhash"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// Checksum database
+// Doc: https://golang.org/ref/mod#checksum-database
+
+// defaultGoSumDB is the default GOSUMDB of the go command.
+const defaultGoSumDB = "sum.golang.org"
+
+// ErrSumDBPrivate is returned for checksum database lookup of the private
+// module, it's never forwarded to checksum database.
+var ErrSumDBPrivate = errors.New("gomod: checksum database lookup of private module is not allowed")
+
+// knownSumDBs are the checksum databases known to go command by its name.
+var knownSumDBs = map[string]struct{ key, url string }{
+	"sum.golang.org":       {"sum.golang.org+033de0ae+Ac4zctda0e5eza+HJyk9SxEdh+s3Ux18htTTAD8OuAn8", "https://sum.golang.org"},
+	"sum.golang.google.cn": {"sum.golang.org+033de0ae+Ac4zctda0e5eza+HJyk9SxEdh+s3Ux18htTTAD8OuAn8", "https://sum.golang.google.cn"},
+}
+
+// checksumDB is the configured checksum database, it verifies the downloaded
+// modules and backs the `/sumdb/<name>/` proxy endpoints.
+type checksumDB struct {
+	Name   string
+	Key    string
+	URL    string
+	client *sumdb.Client
+	mu     sync.Mutex
+}
+
+// parseGoSumDB method parses the GOSUMDB value `name[+key] [url]`, it
+// returns nil for `off`.
+func parseGoSumDB(goSumDB string) (*checksumDB, error) {
+	f := strings.Fields(goSumDB)
+	if len(f) == 0 || len(f) > 2 {
+		return nil, fmt.Errorf("GOSUMDB '%s' must be 'off' or 'name[+key] [url]'", goSumDB)
+	}
+	if f[0] == "off" && len(f) == 1 {
+		return nil, nil
+	}
+	db := &checksumDB{Key: f[0]}
+	if known, found := knownSumDBs[f[0]]; found {
+		db.Key, db.URL = known.key, known.url
+	} else if !strings.Contains(f[0], "+") {
+		return nil, fmt.Errorf("GOSUMDB '%s' requires the verifier key 'name+hash+key'", f[0])
+	}
+	verifier, err := note.NewVerifier(db.Key)
+	if err != nil {
+		return nil, fmt.Errorf("GOSUMDB '%s': invalid key: %v", f[0], err)
+	}
+	db.Name = verifier.Name()
+	if len(db.URL) == 0 {
+		db.URL = "https://" + db.Name
+	}
+	if len(f) == 2 {
+		u, err := url.Parse(f[1])
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+			return nil, fmt.Errorf("GOSUMDB URL '%s' is not an absolute http(s) URL", f[1])
+		}
+		db.URL = f[1]
+	}
+	db.URL = strings.TrimSuffix(db.URL, "/")
+	db.client = sumdb.NewClient(db)
+	return db, nil
+}
+
+func checksumDatabase() *checksumDB {
+	Settings.RLock()
+	defer Settings.RUnlock()
+	return Settings.sumDB
+}
+
+// SumDB method serves the checksum database proxy request
+// `/sumdb/<name>/{supported,latest,lookup/...,tile/...}`. Lookups and tiles
+// are cached, lookups of private modules are refused.
+func SumDB(reqPath string) ([]byte, error) {
+	db := checksumDatabase()
+	parts := strings.SplitN(strings.TrimPrefix(reqPath, "/sumdb/"), "/", 2)
+	if db == nil || parts[0] != db.Name || len(parts) != 2 {
+		return nil, &ModuleError{Status: http.StatusNotFound, Msg: "unsupported checksum database " + parts[0]}
+	}
+	p := "/" + parts[1]
+	switch {
+	case p == "/supported":
+		return nil, nil
+	case p == "/latest":
+		return db.ReadRemote(p)
+	case strings.HasPrefix(p, "/lookup/"):
+		escaped := strings.TrimPrefix(p, "/lookup/")
+		i := strings.LastIndexByte(escaped, '@')
+		if i <= 0 {
+			return nil, ErrInvalidGoModPath
+		}
+		modPath, err := module.UnescapePath(escaped[:i])
+		if err != nil {
+			return nil, ErrInvalidGoModPath
+		}
+		if _, err = module.UnescapeVersion(escaped[i+1:]); err != nil {
+			return nil, ErrInvalidGoModPath
+		}
+		if NoSumDB(modPath) {
+			return nil, ErrSumDBPrivate
+		}
+	case strings.HasPrefix(p, "/tile/"):
+		if _, err := tlog.ParseTilePath(p[1:]); err != nil {
+			return nil, ErrInvalidGoModPath
+		}
+	default:
+		return nil, &ModuleError{Status: http.StatusNotFound, Msg: "unknown checksum database request " + p}
+	}
+
+	file := db.Name + p
+	if b, err := db.ReadCache(file); err == nil {
+		return b, nil
+	}
+	b, err := db.ReadRemote(p)
+	if err != nil {
+		return nil, err
+	}
+	db.WriteCache(file, b)
+	return b, nil
+}
+
+// verifyModule method verifies the go.mod and zip of the downloaded module
+// version against the checksum database unless it's disabled for the module.
+func verifyModule(modPath, version string) error {
+	db := checksumDatabase()
+	if db == nil || NoSumDB(modPath) {
+		return nil
+	}
+	escPath, err := module.EscapePath(modPath)
+	if err != nil {
+		return err
+	}
+	escVersion, err := module.EscapeVersion(version)
+	if err != nil {
+		return err
+	}
+	base := filepath.Join(Settings.ModCachePath, escPath, "@v", escVersion)
+
+	goMod, err := ioutil.ReadFile(base + ".mod")
+	if err != nil {
+		return err
+	}
+	modHash, err := dirhash.Hash1([]string{"go.mod"}, func(string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(goMod)), nil
+	})
+	if err != nil {
+		return err
+	}
+	if err = db.check(modPath, version+"/go.mod", modHash); err != nil {
+		return err
+	}
+
+	if !ess.IsFileExists(base + ".zip") {
+		return nil
+	}
+	zipHash, err := dirhash.HashZip(base+".zip", dirhash.Hash1)
+	if err != nil {
+		return err
+	}
+	return db.check(modPath, version, zipHash)
+}
+
+func (db *checksumDB) check(modPath, version, hash string) error {
+	lines, err := db.client.Lookup(modPath, version)
+	if err != nil {
+		return fmt.Errorf("verifying %s@%s: %v", modPath, version, err)
+	}
+	want := modPath + " " + version + " " + hash
+	for _, ln := range lines {
+		if ln == want {
+			return nil
+		}
+	}
+	return fmt.Errorf("verifying %s@%s: checksum mismatch\n\tdownloaded: %s\n\t%s: %s\n\n"+
+		"SECURITY ERROR\nThe downloaded module does not match the checksum database, it's refused.",
+		modPath, version, hash, db.Name, strings.Join(lines, ", "))
+}
+
+// removeModule method removes the files of module version from mod cache.
+func removeModule(escPath, escVersion string) {
+	base := filepath.Join(Settings.ModCachePath, escPath, "@v", escVersion)
+	for _, ext := range []string{".zip", ".ziphash", ".mod", ".info"} {
+		if err := os.Remove(base + ext); err != nil && !os.IsNotExist(err) {
+			aah.App().Log().Warn(err)
+		}
+	}
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// checksumDB sumdb.ClientOps methods
+//______________________________________________________________________________
+
+// ReadRemote method reads the checksum database path from the upstream,
+// `404` and `410` are returned as `ModuleError`.
+func (db *checksumDB) ReadRemote(p string) ([]byte, error) {
+	target := db.URL + p
+	res, err := upstreamClient.Get(target)
+	if err != nil {
+		return nil, err
+	}
+	defer ess.CloseQuietly(res.Body)
+	if res.StatusCode == http.StatusOK {
+		return ioutil.ReadAll(res.Body)
+	}
+	body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 4096))
+	switch res.StatusCode {
+	case http.StatusNotFound, http.StatusGone:
+		msg := strings.TrimSpace(string(body))
+		if len(msg) == 0 {
+			msg = fmt.Sprintf("%s: %s", target, res.Status)
+		}
+		return nil, &ModuleError{Status: res.StatusCode, Msg: msg}
+	}
+	return nil, fmt.Errorf("checksum database %s responded with %s", target, res.Status)
+}
+
+// ReadConfig method returns the verifier key or the latest signed tree
+// known to THUMBAI.
+func (db *checksumDB) ReadConfig(file string) ([]byte, error) {
+	if file == "key" {
+		return []byte(db.Key), nil
+	}
+	b, err := ioutil.ReadFile(db.configFile(file))
+	if os.IsNotExist(err) {
+		return []byte{}, nil
+	}
+	return b, err
+}
+
+// WriteConfig method replaces the latest signed tree if it's unchanged since
+// read.
+func (db *checksumDB) WriteConfig(file string, old, new []byte) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	cur, err := db.ReadConfig(file)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(cur, old) {
+		return sumdb.ErrWriteConflict
+	}
+	return writeFileAtomic(db.configFile(file), new)
+}
+
+// ReadCache method reads the lookup or tile from the checksum database cache
+// of mod cache, it's shared with the go command.
+func (db *checksumDB) ReadCache(file string) ([]byte, error) {
+	return ioutil.ReadFile(db.cacheFile(file))
+}
+
+func (db *checksumDB) WriteCache(file string, data []byte) {
+	if err := writeFileAtomic(db.cacheFile(file), data); err != nil {
+		aah.App().Log().Warn(err)
+	}
+}
+
+func (db *checksumDB) Log(msg string) {
+	aah.App().Log().Debug(msg)
+}
+
+func (db *checksumDB) SecurityError(msg string) {
+	aah.App().Log().Error(msg)
+}
+
+func (db *checksumDB) configFile(file string) string {
+	return filepath.Join(Settings.GoPath, "pkg", "mod", "cache", "thumbai-sumdb", filepath.FromSlash(path.Clean(file)))
+}
+
+func (db *checksumDB) cacheFile(file string) string {
+	return filepath.Join(Settings.ModCachePath, "sumdb", filepath.FromSlash(path.Clean(file)))
+}
+
+func writeFileAtomic(name string, data []byte) error {
+	if err := ess.MkDirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(name), filepath.Base(name)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err != nil {
+		ess.CloseQuietly(f)
+		_ = os.Remove(f.Name())
+		return err
+	}
+	if err = f.Close(); err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+	if err = os.Chmod(f.Name(), 0644); err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
@@ -0,0 +1,186 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gomod
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"aahframe.work/essentials"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/mod/sumdb"
+	"golang.org/x/mod/sumdb/dirhash"
+	"golang.org/x/mod/sumdb/note"
+)
+
+func TestParseGoSumDB(t *testing.T) {
+	db, err := parseGoSumDB("sum.golang.org")
+	assert.Nil(t, err)
+	assert.Equal(t, "sum.golang.org", db.Name)
+	assert.Equal(t, "https://sum.golang.org", db.URL)
+
+	db, err = parseGoSumDB("sum.golang.google.cn")
+	assert.Nil(t, err)
+	assert.Equal(t, "sum.golang.org", db.Name)
+	assert.Equal(t, "https://sum.golang.google.cn", db.URL)
+
+	db, err = parseGoSumDB("sum.golang.org+033de0ae+Ac4zctda0e5eza+HJyk9SxEdh+s3Ux18htTTAD8OuAn8 https://sumdb.example.com/")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://sumdb.example.com", db.URL)
+
+	db, err = parseGoSumDB("off")
+	assert.Nil(t, err)
+	assert.Nil(t, db)
+
+	for _, v := range []string{"", "sum.example.com", "sum.example.com+abc+def", "sum.golang.org ftp://sumdb", "a b c"} {
+		_, err = parseGoSumDB(v)
+		assert.NotNil(t, err, v)
+	}
+}
+
+// testSumDB starts the stand-in checksum database which knows the given
+// go.sum lines.
+func testSumDB(t *testing.T, gosum map[string]string) (*httptest.Server, func()) {
+	skey, vkey, err := note.GenerateKey(rand.Reader, "sumdb.example.com")
+	assert.Nil(t, err)
+	server := httptest.NewServer(sumdb.NewServer(sumdb.NewTestServer(skey, func(path, vers string) ([]byte, error) {
+		lines, found := gosum[path+"@"+vers]
+		if !found {
+			return nil, fmt.Errorf("module %s@%s: not found", path, vers)
+		}
+		return []byte(lines), nil
+	})))
+
+	goPath, err := ioutil.TempDir("", "gopath")
+	assert.Nil(t, err)
+	prevGoPath := Settings.GoPath
+	Settings.Lock()
+	Settings.GoPath = goPath
+	assert.Nil(t, applyGoSumDB(vkey+" "+server.URL))
+	Settings.Unlock()
+	return server, func() {
+		server.Close()
+		Settings.Lock()
+		Settings.GoPath = prevGoPath
+		_ = applyGoSumDB("off")
+		Settings.Unlock()
+		_ = os.RemoveAll(goPath)
+	}
+}
+
+func goSumLines(t *testing.T, modPath, version string, goMod, zip []byte) string {
+	modHash, err := dirhash.Hash1([]string{"go.mod"}, func(string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(goMod)), nil
+	})
+	assert.Nil(t, err)
+	f, err := ioutil.TempFile("", "mod*.zip")
+	assert.Nil(t, err)
+	defer func() { _ = os.Remove(f.Name()) }()
+	_, _ = f.Write(zip)
+	ess.CloseQuietly(f)
+	zipHash, err := dirhash.HashZip(f.Name(), dirhash.Hash1)
+	assert.Nil(t, err)
+	return fmt.Sprintf("%s %s %s\n%s %s/go.mod %s\n", modPath, version, zipHash, modPath, version, modHash)
+}
+
+func TestSumDBVerify(t *testing.T) {
+	defer setupModCache(t, &testOrigin{})()
+
+	goodZip := testModZip(t, "example.com/good", "v1.0.0")
+	badZip := testModZip(t, "example.com/bad", "v1.0.0")
+	_, closeSumDB := testSumDB(t, map[string]string{
+		"example.com/good@v1.0.0": goSumLines(t, "example.com/good", "v1.0.0", []byte("module example.com/good\n"), goodZip),
+		"example.com/bad@v1.0.0":  goSumLines(t, "example.com/bad", "v1.0.0", []byte("module example.com/bad\n"), goodZip),
+	})
+	defer closeSumDB()
+
+	files := make(map[string][]byte)
+	for _, m := range []string{"example.com/good", "example.com/bad", "example.com/unknown", "corp.example.com/x"} {
+		files["/"+m+"/@v/v1.0.0.info"] = []byte(`{"Version":"v1.0.0","Time":"2019-06-01T10:00:00Z"}`)
+		files["/"+m+"/@v/v1.0.0.mod"] = []byte("module " + m + "\n")
+		files["/"+m+"/@v/v1.0.0.zip"] = testModZip(t, m, "v1.0.0")
+	}
+	files["/example.com/bad/@v/v1.0.0.zip"] = badZip
+	modProxy := testProxy(t, files)
+	defer modProxy.Close()
+	p := proxyFetcher{url: modProxy.URL}
+	for _, m := range []string{"example.com/good", "example.com/bad", "example.com/unknown", "corp.example.com/x"} {
+		_, err := p.Download(&Module{Path: m, DecodedPath: m, Version: "v1.0.0", Action: "zip"})
+		assert.Nil(t, err)
+	}
+
+	assert.Nil(t, verifyModule("example.com/good", "v1.0.0"))
+
+	err := verifyModule("example.com/bad", "v1.0.0")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "SECURITY ERROR")
+	removeModule("example.com/bad", "v1.0.0")
+	for _, ext := range []string{".zip", ".ziphash", ".mod", ".info"} {
+		assert.False(t, ess.IsFileExists(filepath.Join(Settings.ModCachePath, "example.com/bad/@v/v1.0.0"+ext)))
+	}
+
+	// unknown to checksum database
+	assert.NotNil(t, verifyModule("example.com/unknown", "v1.0.0"))
+
+	// private modules are not verified
+	assert.NotNil(t, verifyModule("corp.example.com/x", "v1.0.0"))
+	defer setPrivate("corp.example.com", "")()
+	assert.Nil(t, verifyModule("corp.example.com/x", "v1.0.0"))
+}
+
+func TestSumDBProxy(t *testing.T) {
+	defer setupModCache(t, &testOrigin{})()
+	server, closeSumDB := testSumDB(t, map[string]string{
+		"example.com/good@v1.0.0": "example.com/good v1.0.0 h1:abc=\nexample.com/good v1.0.0/go.mod h1:def=\n",
+	})
+	defer closeSumDB()
+	defer setPrivate("corp.example.com", "")()
+
+	_, err := SumDB("/sumdb/sum.golang.org/supported")
+	assert.Equal(t, http.StatusNotFound, ErrorStatus(err))
+	b, err := SumDB("/sumdb/sumdb.example.com/supported")
+	assert.Nil(t, err)
+	assert.Empty(t, b)
+
+	b, err = SumDB("/sumdb/sumdb.example.com/lookup/example.com/good@v1.0.0")
+	assert.Nil(t, err)
+	assert.Contains(t, string(b), "example.com/good v1.0.0 h1:abc=")
+	assert.True(t, ess.IsFileExists(filepath.Join(Settings.ModCachePath, "sumdb/sumdb.example.com/lookup/example.com/good@v1.0.0")))
+
+	// served from cache
+	server.Close()
+	b2, err := SumDB("/sumdb/sumdb.example.com/lookup/example.com/good@v1.0.0")
+	assert.Nil(t, err)
+	assert.Equal(t, b, b2)
+
+	_, err = SumDB("/sumdb/sumdb.example.com/lookup/corp.example.com/x@v1.0.0")
+	assert.Equal(t, ErrSumDBPrivate, err)
+	assert.Equal(t, http.StatusForbidden, ErrorStatus(err))
+
+	for _, p := range []string{"lookup/example.com/good", "lookup/../../x@v1.0.0", "tile/8/0/../../x", "unknown"} {
+		_, err = SumDB("/sumdb/sumdb.example.com/" + p)
+		assert.NotNil(t, err, p)
+		assert.False(t, strings.Contains(err.Error(), "connection refused"), p)
+	}
+}
@@ -0,0 +1,375 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gomod
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"thumbai/app/models"
+
+	"aahframe.work"
+	"aahframe.work/essentials"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// defaultGoProxy is the default GOPROXY list of the go command.
+const defaultGoProxy = "https://proxy.golang.org,direct"
+
+// direct fetches the modules from its origin, using go command or native
+// fetcher.
+var direct fetcher = goCommand{}
+
+var upstreamClient = &http.Client{Timeout: 10 * time.Minute}
+
+// proxyEntry is the single entry of GOPROXY list, it's the proxy URL,
+// `direct` or `off`. On failure next entry is tried only if the module is
+// not found (404 or 410), or on any error if entry is followed by `|`.
+type proxyEntry struct {
+	URL             string
+	FallbackOnError bool
+}
+
+// upstreamRoute routes the modules matching the path pattern to the
+// GOPROXY list.
+type upstreamRoute struct {
+	Pattern string
+	Proxies []*proxyEntry
+}
+
+// ValidateUpstreams method validates the GOPROXY list, GOSUMDB and routing
+// rules, it returns the field errors if any.
+func ValidateUpstreams(goProxy, goSumDB string, routes []*models.ModuleUpstream) map[string]string {
+	errs := make(map[string]string)
+	if _, err := parseGoProxy(goProxy); err != nil {
+		errs["goProxy"] = err.Error()
+	}
+	if _, err := parseGoSumDB(goSumDB); err != nil {
+		errs["goSumDB"] = err.Error()
+	}
+	for _, r := range routes {
+		if err := validPattern(r.Pattern); err != nil {
+			errs["upstreamRoutes"] = err.Error()
+		} else if _, err := parseGoProxy(r.Proxy); err != nil {
+			errs["upstreamRoutes"] = fmt.Sprintf("%s: %v", r.Pattern, err)
+		}
+	}
+	return errs
+}
+
+// applyUpstreams method parses and applies the GOPROXY list and routing
+// rules, caller must hold the settings lock.
+func applyUpstreams(goProxy string, routes []*models.ModuleUpstream) error {
+	proxies, upstreamRoutes, err := parseUpstreams(goProxy, routes)
+	if err != nil {
+		return err
+	}
+	Settings.GoProxy = goProxy
+	Settings.Upstreams = routes
+	Settings.proxies = proxies
+	Settings.routes = upstreamRoutes
+	return nil
+}
+
+// applyGoSumDB method parses and applies the checksum database, caller must
+// hold the settings lock.
+func applyGoSumDB(goSumDB string) error {
+	db, err := parseGoSumDB(goSumDB)
+	if err != nil {
+		return err
+	}
+	Settings.GoSumDB = goSumDB
+	Settings.sumDB = db
+	return nil
+}
+
+func parseUpstreams(goProxy string, routes []*models.ModuleUpstream) ([]*proxyEntry, []*upstreamRoute, error) {
+	proxies, err := parseGoProxy(goProxy)
+	if err != nil {
+		return nil, nil, err
+	}
+	var upstreamRoutes []*upstreamRoute
+	for _, r := range routes {
+		if err = validPattern(r.Pattern); err != nil {
+			return nil, nil, err
+		}
+		rp, err := parseGoProxy(r.Proxy)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", r.Pattern, err)
+		}
+		upstreamRoutes = append(upstreamRoutes, &upstreamRoute{Pattern: r.Pattern, Proxies: rp})
+	}
+	return proxies, upstreamRoutes, nil
+}
+
+// parseGoProxy method parses the GOPROXY list, entries are separated by
+// `,` or `|`, empty entries are ignored as the go command does.
+func parseGoProxy(goProxy string) ([]*proxyEntry, error) {
+	var proxies []*proxyEntry
+	for len(goProxy) > 0 {
+		entry, fallbackOnError := goProxy, false
+		if i := strings.IndexAny(goProxy, ",|"); i >= 0 {
+			entry, fallbackOnError = goProxy[:i], goProxy[i] == '|'
+			goProxy = goProxy[i+1:]
+		} else {
+			goProxy = ""
+		}
+		entry = strings.TrimSpace(entry)
+		switch entry {
+		case "":
+			continue
+		case "direct", "off":
+		default:
+			u, err := url.Parse(entry)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+				return nil, fmt.Errorf("GOPROXY entry '%s' is not an absolute http(s) URL, direct or off", entry)
+			}
+		}
+		proxies = append(proxies, &proxyEntry{URL: entry, FallbackOnError: fallbackOnError})
+	}
+	if len(proxies) == 0 {
+		return nil, fmt.Errorf("GOPROXY list is empty")
+	}
+	return proxies, nil
+}
+
+func validPattern(pattern string) error {
+	if len(strings.TrimSpace(pattern)) == 0 {
+		return fmt.Errorf("module path pattern is required")
+	}
+	for _, p := range strings.Split(pattern, ",") {
+		if _, err := path.Match(strings.TrimSpace(p), ""); err != nil {
+			return fmt.Errorf("module path pattern '%s' is invalid", pattern)
+		}
+	}
+	return nil
+}
+
+// upstreamProxies method returns the GOPROXY list of the module path as per
+// routing rules, otherwise the default one. Private modules are never
+// forwarded to the upstream proxies, only `direct` or `off` is applied.
+func upstreamProxies(modPath string) []*proxyEntry {
+	Settings.RLock()
+	defer Settings.RUnlock()
+	proxies := Settings.proxies
+	for _, r := range Settings.routes {
+		if module.MatchPrefixPatterns(r.Pattern, modPath) {
+			proxies = r.Proxies
+			break
+		}
+	}
+	if isPrivate(modPath) {
+		var origins []*proxyEntry
+		for _, pe := range proxies {
+			if pe.URL == "direct" || pe.URL == "off" {
+				origins = append(origins, pe)
+			}
+		}
+		proxies = origins
+	}
+	if len(proxies) == 0 {
+		return []*proxyEntry{{URL: "direct"}}
+	}
+	return proxies
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// upstreams type and its methods
+//______________________________________________________________________________
+
+// upstreams fetches the modules from the GOPROXY list of the module path in
+// the fallback order.
+type upstreams struct{}
+
+func (upstreams) Versions(modPath string) ([]string, error) {
+	var versions []string
+	err := eachUpstream(modPath, func(f fetcher) (err error) {
+		versions, err = f.Versions(modPath)
+		return
+	})
+	return versions, err
+}
+
+func (upstreams) Latest(modPath string) (*Info, error) {
+	var info *Info
+	err := eachUpstream(modPath, func(f fetcher) (err error) {
+		info, err = f.Latest(modPath)
+		return
+	})
+	return info, err
+}
+
+func (upstreams) Download(mod *Module) (*Module, error) {
+	var result *Module
+	err := eachUpstream(mod.DecodedPath, func(f fetcher) (err error) {
+		result, err = f.Download(mod)
+		return
+	})
+	return result, err
+}
+
+func eachUpstream(modPath string, fn func(f fetcher) error) error {
+	var err error
+	for _, pe := range upstreamProxies(modPath) {
+		var f fetcher
+		switch pe.URL {
+		case "off":
+			return &ModuleError{Status: http.StatusNotFound,
+				Msg: fmt.Sprintf("module %s: module lookup disabled by GOPROXY=off", modPath)}
+		case "direct":
+			f = direct
+		default:
+			f = proxyFetcher{url: pe.URL}
+		}
+		if err = fn(f); err == nil {
+			return nil
+		}
+		if status := ErrorStatus(err); !pe.FallbackOnError && status != http.StatusNotFound && status != http.StatusGone {
+			return err
+		}
+		aah.App().Log().Debugf("Upstream %s failed for '%s', trying next: %v", pe.URL, modPath, err)
+	}
+	return err
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// proxyFetcher type and its methods
+//______________________________________________________________________________
+
+// proxyFetcher fetches the module files from upstream proxy over GOPROXY
+// protocol.
+type proxyFetcher struct {
+	url string
+}
+
+func (p proxyFetcher) Versions(modPath string) ([]string, error) {
+	b, err := p.get(modPath, "/@v/list")
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(b)), nil
+}
+
+func (p proxyFetcher) Latest(modPath string) (*Info, error) {
+	b, err := p.get(modPath, "/@latest")
+	if err != nil {
+		return nil, err
+	}
+	return p.decodeInfo(modPath, b)
+}
+
+// Download method resolves the module version query using upstream proxy
+// and saves its files into mod cache.
+func (p proxyFetcher) Download(mod *Module) (*Module, error) {
+	query, err := module.UnescapeVersion(mod.Version)
+	if err != nil {
+		query = mod.Version
+	}
+	var info *Info
+	if query == "" || query == "latest" {
+		info, err = p.Latest(mod.DecodedPath)
+	} else {
+		info, err = p.info(mod.DecodedPath, query)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	version, _ := module.EscapeVersion(info.Version)
+	goMod, err := p.get(mod.DecodedPath, "/@v/"+version+".mod")
+	if err != nil {
+		return nil, err
+	}
+	return saveModule(mod, info, goMod, func(w io.Writer) error {
+		rc, err := p.open(mod.DecodedPath, "/@v/"+version+".zip")
+		if err != nil {
+			return err
+		}
+		defer ess.CloseQuietly(rc)
+		_, err = io.Copy(w, rc)
+		return err
+	})
+}
+
+func (p proxyFetcher) info(modPath, query string) (*Info, error) {
+	v, err := module.EscapeVersion(query)
+	if err != nil {
+		return nil, &ModuleError{Status: http.StatusGone, Msg: fmt.Sprintf("%s@%s: invalid version", modPath, query)}
+	}
+	b, err := p.get(modPath, "/@v/"+v+".info")
+	if err != nil {
+		return nil, err
+	}
+	return p.decodeInfo(modPath, b)
+}
+
+func (p proxyFetcher) decodeInfo(modPath string, b []byte) (*Info, error) {
+	info := &Info{}
+	if err := json.Unmarshal(b, info); err != nil {
+		return nil, fmt.Errorf("upstream %s: invalid info of '%s': %v", p.url, modPath, err)
+	}
+	if !semver.IsValid(info.Version) {
+		return nil, fmt.Errorf("upstream %s: invalid version '%s' of '%s'", p.url, info.Version, modPath)
+	}
+	return info, nil
+}
+
+func (p proxyFetcher) get(modPath, suffix string) ([]byte, error) {
+	rc, err := p.open(modPath, suffix)
+	if err != nil {
+		return nil, err
+	}
+	defer ess.CloseQuietly(rc)
+	return ioutil.ReadAll(rc)
+}
+
+func (p proxyFetcher) open(modPath, suffix string) (io.ReadCloser, error) {
+	escaped, err := module.EscapePath(modPath)
+	if err != nil {
+		return nil, &ModuleError{Status: http.StatusNotFound, Msg: "malformed module path: " + err.Error()}
+	}
+	target := strings.TrimSuffix(p.url, "/") + "/" + escaped + suffix
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	setBasicAuth(req)
+	res, err := upstreamClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusOK {
+		return res.Body, nil
+	}
+	defer ess.CloseQuietly(res.Body)
+	body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 4096))
+	switch res.StatusCode {
+	case http.StatusNotFound, http.StatusGone:
+		msg := strings.TrimPrefix(strings.TrimSpace(string(body)), "not found: ")
+		if len(msg) == 0 {
+			msg = fmt.Sprintf("%s: %s", target, res.Status)
+		}
+		return nil, &ModuleError{Status: res.StatusCode, Msg: msg}
+	}
+	return nil, fmt.Errorf("upstream %s responded with %s", target, res.Status)
+}
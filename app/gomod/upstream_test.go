@@ -0,0 +1,160 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gomod
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"thumbai/app/models"
+
+	"aahframe.work/essentials"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/mod/module"
+	modzip "golang.org/x/mod/zip"
+)
+
+func TestParseGoProxy(t *testing.T) {
+	proxies, err := parseGoProxy("https://proxy.example.com|https://proxy.golang.org, direct")
+	assert.Nil(t, err)
+	assert.Equal(t, []*proxyEntry{
+		{URL: "https://proxy.example.com", FallbackOnError: true},
+		{URL: "https://proxy.golang.org"},
+		{URL: "direct"},
+	}, proxies)
+
+	proxies, err = parseGoProxy("https://proxy.golang.org,,direct,")
+	assert.Nil(t, err)
+	assert.Len(t, proxies, 2)
+
+	for _, v := range []string{"", " , |", "proxy.golang.org", "file:///tmp/proxy", "https://proxy.golang.org,go"} {
+		_, err = parseGoProxy(v)
+		assert.NotNil(t, err, v)
+	}
+
+	errs := ValidateUpstreams("direct", "off", []*models.ModuleUpstream{{Pattern: "corp.example.com/[", Proxy: "direct"}})
+	assert.Contains(t, errs, "upstreamRoutes")
+	errs = ValidateUpstreams("off", defaultGoSumDB, []*models.ModuleUpstream{{Pattern: "corp.example.com/*", Proxy: "direct"}})
+	assert.Empty(t, errs)
+}
+
+// testProxy is the stand-in upstream proxy, it serves the module files
+// from memory.
+func testProxy(t *testing.T, files map[string][]byte) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, found := files[r.URL.Path]
+		if !found {
+			http.Error(w, "not found: "+r.URL.Path, http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(b)
+	}))
+}
+
+func testModZip(t *testing.T, modPath, version string) []byte {
+	var buf bytes.Buffer
+	assert.Nil(t, modzip.Create(&buf, module.Version{Path: modPath, Version: version}, []modzip.File{
+		dataFile{name: "go.mod", data: []byte("module " + modPath + "\n")},
+		dataFile{name: "b.go", data: []byte("package b\n")},
+	}))
+	return buf.Bytes()
+}
+
+func TestUpstreams(t *testing.T) {
+	defer setupModCache(t, &testOrigin{})()
+	d := &testOrigin{versions: map[string][]string{"corp.example.com/x": {"v0.1.0"}}}
+	prevDirect := direct
+	direct = d
+	defer func() { direct = prevDirect }()
+
+	emptyProxy := testProxy(t, map[string][]byte{})
+	defer emptyProxy.Close()
+	failingProxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "upstream unavailable", http.StatusBadGateway)
+	}))
+	defer failingProxy.Close()
+	modProxy := testProxy(t, map[string][]byte{
+		"/example.com/!b/@v/list":        []byte("v1.0.0\nv1.1.0\n"),
+		"/example.com/!b/@latest":        []byte(`{"Version":"v1.1.0","Time":"2019-06-01T10:00:00Z"}`),
+		"/example.com/!b/@v/v1.1.0.info": []byte(`{"Version":"v1.1.0","Time":"2019-06-01T10:00:00Z"}`),
+		"/example.com/!b/@v/main.info":   []byte(`{"Version":"v1.1.0","Time":"2019-06-01T10:00:00Z"}`),
+		"/example.com/!b/@v/v1.1.0.mod":  []byte("module example.com/B\n"),
+		"/example.com/!b/@v/v1.1.0.zip":  testModZip(t, "example.com/B", "v1.1.0"),
+		"/example.com/!b/@v/v1.0.0.info": []byte(`{"Version":"v1.0.0","Time":"2019-05-01T10:00:00Z"}`),
+		"/example.com/!b/@v/v1.0.0.mod":  []byte("module example.com/B\n"),
+		"/example.com/!b/@v/v1.0.0.zip":  testModZip(t, "example.com/B", "v1.1.0"),
+	})
+	defer modProxy.Close()
+
+	Settings.Lock()
+	err := applyUpstreams(emptyProxy.URL+","+modProxy.URL, []*models.ModuleUpstream{
+		{Pattern: "corp.example.com", Proxy: "direct"},
+		{Pattern: "failing.example.com", Proxy: failingProxy.URL + "," + modProxy.URL},
+		{Pattern: "fallback.example.com", Proxy: failingProxy.URL + "|" + modProxy.URL},
+		{Pattern: "*.internal", Proxy: "off"},
+	})
+	Settings.Unlock()
+	assert.Nil(t, err)
+	defer func() {
+		Settings.Lock()
+		_ = applyUpstreams("direct", nil)
+		Settings.Unlock()
+	}()
+
+	u := upstreams{}
+	// not found in first proxy, falls back to next
+	versions, err := u.Versions("example.com/B")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"v1.0.0", "v1.1.0"}, versions)
+	info, err := u.Latest("example.com/B")
+	assert.Nil(t, err)
+	assert.Equal(t, "v1.1.0", info.Version)
+
+	mod, err := u.Download(&Module{Path: "example.com/!b", DecodedPath: "example.com/B", Version: "main", Action: "zip"})
+	assert.Nil(t, err)
+	assert.Equal(t, "v1.1.0", mod.Version)
+	b, _ := ioutil.ReadFile(filepath.Join(Settings.ModCachePath, "example.com/!b/@v/v1.1.0.info"))
+	assert.Equal(t, `{"Version":"v1.1.0","Time":"2019-06-01T10:00:00Z"}`, string(b))
+	b, _ = ioutil.ReadFile(mod.GoMod)
+	assert.Equal(t, "module example.com/B\n", string(b))
+	_, err = modzip.CheckZip(module.Version{Path: "example.com/B", Version: "v1.1.0"}, mod.Zip)
+	assert.Nil(t, err)
+
+	// zip of other version is rejected
+	_, err = u.Download(&Module{Path: "example.com/!b", DecodedPath: "example.com/B", Version: "v1.0.0"})
+	assert.NotNil(t, err)
+	assert.False(t, ess.IsFileExists(filepath.Join(Settings.ModCachePath, "example.com/!b/@v/v1.0.0.zip")))
+
+	_, err = u.Versions("example.com/unknown")
+	assert.Equal(t, http.StatusNotFound, ErrorStatus(err))
+
+	// routing rules
+	versions, err = u.Versions("corp.example.com/x")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"v0.1.0"}, versions)
+	assert.Equal(t, 1, d.calls)
+
+	_, err = u.Versions("failing.example.com/B")
+	assert.Equal(t, http.StatusInternalServerError, ErrorStatus(err))
+	_, err = u.Versions("fallback.example.com/B")
+	assert.Equal(t, http.StatusNotFound, ErrorStatus(err))
+	_, err = u.Versions("corp.internal/x")
+	assert.Equal(t, http.StatusNotFound, ErrorStatus(err))
+	assert.Equal(t, "not found: module corp.internal/x: module lookup disabled by GOPROXY=off", err.Error())
+}
@@ -0,0 +1,357 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gomod
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"thumbai/app/vanity"
+
+	"aahframe.work"
+	"aahframe.work/essentials"
+)
+
+// repoFetchTTL is the duration of git repository mirror is used without
+// fetching the origin again.
+const repoFetchTTL = time.Minute
+
+var errRevNotExist = errors.New("gomod: unknown revision")
+
+// lookupRepoRoot resolves the repository of the module path, it's a variable
+// to use local repositories in the tests.
+var lookupRepoRoot = resolveRepoRoot
+
+// gitAllowProtocol is the transports git command is allowed to use, it's a
+// variable to use local repositories in the tests.
+var gitAllowProtocol = "https:ssh"
+
+var goGetClient = &http.Client{Timeout: 30 * time.Second}
+
+// repoRoot represents the version control repository of the import path
+// prefix.
+type repoRoot struct {
+	Root string
+	VCS  string
+	Repo string
+}
+
+// resolveRepoRoot method resolves the repository of the module path from the
+// THUMBAI vanity packages, well-known code hosting sites, otherwise from the
+// `go-import` meta tag served by the module path.
+func resolveRepoRoot(modPath string) (*repoRoot, error) {
+	host, p := modPath, "/"
+	if i := strings.IndexByte(modPath, '/'); i > 0 {
+		host, p = modPath[:i], modPath[i:]
+	}
+	if vanity.Thumbai != nil {
+		if vp := vanity.Lookup(host, p); vp != nil {
+			rr := &repoRoot{Root: host + vp.Path, VCS: vp.VCS, Repo: vp.Repo}
+			if vp.Path == "@" {
+				rr.Root = host
+			}
+			return rr, nil
+		}
+	}
+
+	switch host {
+	case "github.com", "bitbucket.org":
+		parts := strings.SplitN(modPath, "/", 4)
+		if len(parts) < 3 {
+			return nil, &ModuleError{Status: http.StatusNotFound, Msg: "malformed module path: " + modPath}
+		}
+		root := strings.Join(parts[:3], "/")
+		return &repoRoot{Root: root, VCS: "git", Repo: "https://" + root}, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "https://"+modPath+"?go-get=1", nil)
+	if err != nil {
+		return nil, &ModuleError{Status: http.StatusNotFound, Msg: "malformed module path: " + modPath}
+	}
+	setBasicAuth(req)
+	res, err := goGetClient.Do(req)
+	if err != nil {
+		return nil, &ModuleError{Status: http.StatusNotFound, Msg: fmt.Sprintf("unrecognized import path %q: %v", modPath, err)}
+	}
+	defer ess.CloseQuietly(res.Body)
+	if res.StatusCode != http.StatusOK {
+		return nil, &ModuleError{Status: http.StatusNotFound, Msg: fmt.Sprintf("unrecognized import path %q: %s", modPath, res.Status)}
+	}
+	imports, err := parseMetaGoImports(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	return matchGoImport(imports, modPath)
+}
+
+// parseMetaGoImports method returns the `go-import` meta tags from the
+// given HTML document head.
+func parseMetaGoImports(r io.Reader) ([]*repoRoot, error) {
+	d := xml.NewDecoder(r)
+	d.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		if strings.EqualFold(charset, "utf-8") || strings.EqualFold(charset, "ascii") {
+			return input, nil
+		}
+		return nil, fmt.Errorf("can't decode XML document using charset %q", charset)
+	}
+	d.Strict = false
+	var imports []*repoRoot
+	for {
+		t, err := d.RawToken()
+		if err != nil {
+			if err == io.EOF || len(imports) > 0 {
+				break
+			}
+			return nil, err
+		}
+		if e, ok := t.(xml.StartElement); ok && strings.EqualFold(e.Name.Local, "body") {
+			break
+		}
+		if e, ok := t.(xml.EndElement); ok && strings.EqualFold(e.Name.Local, "head") {
+			break
+		}
+		e, ok := t.(xml.StartElement)
+		if !ok || !strings.EqualFold(e.Name.Local, "meta") || attrValue(e.Attr, "name") != "go-import" {
+			continue
+		}
+		if f := strings.Fields(attrValue(e.Attr, "content")); len(f) == 3 {
+			imports = append(imports, &repoRoot{Root: f[0], VCS: f[1], Repo: f[2]})
+		}
+	}
+	return imports, nil
+}
+
+// matchGoImport method returns the repository of the `go-import` meta tag
+// whose prefix matches the module path.
+func matchGoImport(imports []*repoRoot, modPath string) (*repoRoot, error) {
+	var match *repoRoot
+	for _, rr := range imports {
+		if rr.VCS == "mod" || (modPath != rr.Root && !strings.HasPrefix(modPath, rr.Root+"/")) {
+			continue
+		}
+		if match != nil && match.Root != rr.Root {
+			return nil, &ModuleError{Status: http.StatusNotFound,
+				Msg: fmt.Sprintf("multiple meta tags match import path %q", modPath)}
+		}
+		match = rr
+	}
+	if match == nil {
+		return nil, &ModuleError{Status: http.StatusNotFound,
+			Msg: fmt.Sprintf("unrecognized import path %q: no go-import meta tags", modPath)}
+	}
+	if err := validateRepoRoot(match.Repo); err != nil {
+		return nil, &ModuleError{Status: http.StatusNotFound,
+			Msg: fmt.Sprintf("unrecognized import path %q: %v", modPath, err)}
+	}
+	return match, nil
+}
+
+// validateRepoRoot method validates the repository URL of untrusted
+// `go-import` meta tag. Only https is accepted, ssh and git+ssh for the
+// hosts with configured SSH key.
+func validateRepoRoot(repo string) error {
+	u, err := url.Parse(repo)
+	if err != nil {
+		return err
+	}
+	if len(u.Host) == 0 {
+		return fmt.Errorf("invalid repo root %q: host is required", repo)
+	}
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "ssh", "git+ssh":
+		if c := credentialOf(u.Hostname()); c != nil && len(c.SSHKey) > 0 {
+			return nil
+		}
+		return fmt.Errorf("invalid repo root %q: %s requires SSH key credential of host %s", repo, u.Scheme, u.Hostname())
+	}
+	return fmt.Errorf("invalid repo root %q: scheme must be https", repo)
+}
+
+func attrValue(attrs []xml.Attr, name string) string {
+	for _, a := range attrs {
+		if strings.EqualFold(a.Name.Local, name) {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// gitRepo type and its methods
+//______________________________________________________________________________
+
+var gitRepos = struct {
+	sync.Mutex
+	m map[string]*gitRepo
+}{m: make(map[string]*gitRepo)}
+
+// gitRepo is the bare mirror of remote git repository in the VCS cache.
+type gitRepo struct {
+	sync.Mutex
+	url     string
+	dir     string
+	fetched time.Time
+}
+
+func openGitRepo(url string) *gitRepo {
+	gitRepos.Lock()
+	defer gitRepos.Unlock()
+	if r, found := gitRepos.m[url]; found {
+		return r
+	}
+	sum := sha256.Sum256([]byte("git:" + url))
+	r := &gitRepo{url: url, dir: filepath.Join(Settings.VCSCachePath, hex.EncodeToString(sum[:]))}
+	gitRepos.m[url] = r
+	return r
+}
+
+// fetch method fetches the branches and tags from remote repository into the
+// mirror, unless it's fetched within `repoFetchTTL` and not forced. It
+// reports whether the fetch happened.
+func (r *gitRepo) fetch(force bool) (bool, error) {
+	r.Lock()
+	defer r.Unlock()
+	if !force && time.Since(r.fetched) < repoFetchTTL {
+		return false, nil
+	}
+	if !ess.IsFileExists(filepath.Join(r.dir, "HEAD")) {
+		if err := ess.MkDirAll(r.dir, 0755); err != nil {
+			return false, err
+		}
+		if _, err := r.run("init", "--bare"); err != nil {
+			return false, err
+		}
+		if _, err := r.run("remote", "add", "origin", r.url); err != nil {
+			return false, err
+		}
+	}
+	credEnv, cleanup, err := credentialEnv()
+	if err != nil {
+		return false, err
+	}
+	defer cleanup()
+	aah.App().Log().Info("Fetching git repository ", r.url)
+	if _, err = r.runEnv(credEnv, "fetch", "-f", "--prune", "origin",
+		"refs/heads/*:refs/heads/*", "refs/tags/*:refs/tags/*"); err != nil {
+		return false, err
+	}
+	// point HEAD to the default branch of remote
+	if out, err := r.runEnv(credEnv, "ls-remote", "--symref", "origin", "HEAD"); err == nil {
+		if f := strings.Fields(string(out)); len(f) >= 3 && f[0] == "ref:" {
+			_, _ = r.run("symbolic-ref", "HEAD", f[1])
+		}
+	}
+	r.fetched = time.Now()
+	return true, nil
+}
+
+// stat method resolves the revision into commit hash and time.
+func (r *gitRepo) stat(rev string) (string, time.Time, error) {
+	if strings.HasPrefix(rev, "-") {
+		return "", time.Time{}, errRevNotExist
+	}
+	out, err := r.run("log", "-1", "--format=%H %ct", rev+"^{commit}", "--")
+	if err != nil {
+		return "", time.Time{}, errRevNotExist
+	}
+	f := strings.Fields(string(out))
+	if len(f) != 2 {
+		return "", time.Time{}, errRevNotExist
+	}
+	sec, err := strconv.ParseInt(f[1], 10, 64)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return f[0], time.Unix(sec, 0).UTC(), nil
+}
+
+// tags method returns the tags with given prefix, if commit is not empty
+// only the tags reachable from the commit.
+func (r *gitRepo) tags(prefix, commit string) ([]string, error) {
+	args := []string{"tag", "--list", prefix + "v*"}
+	if len(commit) > 0 {
+		args = append(args, "--merged", commit)
+	}
+	out, err := r.run(args...)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(out)), nil
+}
+
+// pointsAt method returns the tags with given prefix of the commit.
+func (r *gitRepo) pointsAt(prefix, commit string) ([]string, error) {
+	out, err := r.run("tag", "--list", prefix+"v*", "--points-at", commit)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(out)), nil
+}
+
+// readFile method returns the content of the file at the commit, nil if the
+// file does not exist.
+func (r *gitRepo) readFile(commit, name string) []byte {
+	out, err := r.run("cat-file", "blob", commit+":"+name)
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+// archive method returns the zip archive of the directory at the commit.
+func (r *gitRepo) archive(commit, dir string) ([]byte, error) {
+	args := []string{"-c", "core.autocrlf=input", "-c", "core.eol=lf", "archive", "--format=zip", commit}
+	if len(dir) > 0 {
+		args = append(args, dir)
+	}
+	return r.run(args...)
+}
+
+func (r *gitRepo) run(args ...string) ([]byte, error) {
+	return r.runEnv(nil, args...)
+}
+
+func (r *gitRepo) runEnv(env []string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = r.dir
+	cmd.Env = append(append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GCM_INTERACTIVE=never",
+		"GIT_ALLOW_PROTOCOL="+gitAllowProtocol), env...)
+	stdOut, stdErr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd.Stdout, cmd.Stderr = stdOut, stdErr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stdErr.String())
+		if me := originError(msg); me != nil && args[0] != "cat-file" && args[0] != "log" {
+			return nil, me
+		}
+		return nil, fmt.Errorf("git %s: %v: %s", args[0], err, msg)
+	}
+	return stdOut.Bytes(), nil
+}
@@ -22,11 +22,13 @@ import (
 	"strings"
 
 	"thumbai/app/access"
+	"thumbai/app/accesslog"
 	"thumbai/app/commands"
 	"thumbai/app/datastore"
 	"thumbai/app/gomod"
 	"thumbai/app/proxy"
 	"thumbai/app/settings"
+	"thumbai/app/tracing"
 	"thumbai/app/util"
 	"thumbai/app/vanity"
 
@@ -49,8 +51,12 @@ func init() {
 	app.OnStart(gomod.Infer)
 	app.OnStart(access.Load)
 	app.OnStart(settings.Load)
+	app.OnStart(accesslog.Load)
+	app.OnStart(tracing.Load)
 
 	app.OnPostShutdown(datastore.Disconnect)
+	app.OnPostShutdown(accesslog.Close)
+	app.OnPostShutdown(tracing.Close)
 
 	//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
 	// Middleware's
@@ -60,6 +66,8 @@ func init() {
 	// the order of pre-defined aah framework middleware's.
 	//__________________________________________________________________________
 	app.HTTPEngine().Middlewares(
+		accesslog.Middleware,
+		tracing.Middleware,
 		aah.RouteMiddleware,
 		// aah.CORSMiddleware,
 		aah.BindMiddleware,
@@ -74,8 +82,12 @@ func init() {
 	//__________________________________________________________________________
 	app.AddTemplateFunc(template.FuncMap{
 		"redirect2line":            util.ProxyRedirects2Lines,
+		"rewrite2line":             util.ProxyRewrites2Lines,
 		"mapstr2str":               util.MapString2String,
 		"static2line":              util.ProxyStatics2Lines,
+		"target2line":              util.ProxyTargets2Lines,
+		"split2line":               util.ProxySplitVariants2Lines,
+		"ints2str":                 util.Ints2String,
 		"proxyconditionexists":     util.IsProxyConditionsExists,
 		"proxyrestrictfilesexists": util.IsProxyRestrictFilesExists,
 		"proxyrequesthdrexists":    util.IsProxyRequestHeadersExists,
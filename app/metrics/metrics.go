@@ -0,0 +1,330 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics implements the counters, histograms and gauges of
+// THUMBAI and writes them in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ContentType is the Prometheus text exposition format content type.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefBuckets are the default latency histogram buckets in seconds.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+var registry = struct {
+	sync.Mutex
+	metrics map[string]metric
+}{metrics: make(map[string]metric)}
+
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// Package methods
+//______________________________________________________________________________
+
+// NewCounter method creates and registers the counter with given label
+// names. It panics if the metric name is already registered.
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{desc: desc{name: name, help: help, labels: labels}, series: make(map[string]*counterSeries)}
+	register(name, c)
+	return c
+}
+
+// NewHistogram method creates and registers the histogram with given
+// buckets and label names, nil buckets uses `DefBuckets`. It panics if the
+// metric name is already registered.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefBuckets
+	}
+	h := &Histogram{desc: desc{name: name, help: help, labels: labels}, buckets: buckets, series: make(map[string]*histogramSeries)}
+	register(name, h)
+	return h
+}
+
+// NewGaugeFunc method creates and registers the gauge, its value is
+// obtained from given func on write. It panics if the metric name is
+// already registered.
+func NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	g := &GaugeFunc{desc: desc{name: name, help: help}, fn: fn}
+	register(name, g)
+	return g
+}
+
+// Write method writes all the registered metrics in the Prometheus text
+// exposition format, metrics are ordered by name.
+func Write(w io.Writer) error {
+	registry.Lock()
+	names := make([]string, 0, len(registry.metrics))
+	for name := range registry.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	metrics := make([]metric, 0, len(names))
+	for _, name := range names {
+		metrics = append(metrics, registry.metrics[name])
+	}
+	registry.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	return bw.Flush()
+}
+
+func register(name string, m metric) {
+	registry.Lock()
+	defer registry.Unlock()
+	if _, found := registry.metrics[name]; found {
+		panic(fmt.Sprintf("metrics: '%s' is already registered", name))
+	}
+	registry.metrics[name] = m
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// Counter type and its methods
+//______________________________________________________________________________
+
+// Counter is the monotonically increasing value per label values.
+type Counter struct {
+	desc
+	sync.Mutex
+	series map[string]*counterSeries
+}
+
+type counterSeries struct {
+	labels []string
+	value  float64
+}
+
+// Inc method increments the counter of given label values by 1.
+func (c *Counter) Inc(labels ...string) {
+	c.Add(1, labels...)
+}
+
+// Add method adds the given value to the counter of given label values.
+func (c *Counter) Add(v float64, labels ...string) {
+	key := c.key(labels)
+	c.Lock()
+	s, found := c.series[key]
+	if !found {
+		s = &counterSeries{labels: append([]string(nil), labels...)}
+		c.series[key] = s
+	}
+	s.value += v
+	c.Unlock()
+}
+
+// Value method returns the counter value of given label values.
+func (c *Counter) Value(labels ...string) float64 {
+	key := c.key(labels)
+	c.Lock()
+	defer c.Unlock()
+	if s, found := c.series[key]; found {
+		return s.value
+	}
+	return 0
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.Lock()
+	defer c.Unlock()
+	c.writeHeader(w, "counter")
+	for _, key := range sortedKeys(c.series) {
+		s := c.series[key]
+		c.writeSample(w, "", s.labels, "", "", s.value)
+	}
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// Histogram type and its methods
+//______________________________________________________________________________
+
+// Histogram counts the observed values in the cumulative buckets per label
+// values.
+type Histogram struct {
+	desc
+	sync.Mutex
+	buckets []float64
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labels []string
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Observe method adds the given value to the histogram of given label
+// values.
+func (h *Histogram) Observe(v float64, labels ...string) {
+	key := h.key(labels)
+	h.Lock()
+	s, found := h.series[key]
+	if !found {
+		s = &histogramSeries{labels: append([]string(nil), labels...), counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, b := range h.buckets {
+		if v <= b {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += v
+	h.Unlock()
+}
+
+// ObserveSince method adds the elapsed seconds since given time to the
+// histogram of given label values.
+func (h *Histogram) ObserveSince(start time.Time, labels ...string) {
+	h.Observe(time.Since(start).Seconds(), labels...)
+}
+
+// Count method returns the observations count of given label values.
+func (h *Histogram) Count(labels ...string) uint64 {
+	key := h.key(labels)
+	h.Lock()
+	defer h.Unlock()
+	if s, found := h.series[key]; found {
+		return s.count
+	}
+	return 0
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.Lock()
+	defer h.Unlock()
+	h.writeHeader(w, "histogram")
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		for i, b := range h.buckets {
+			h.writeSample(w, "_bucket", s.labels, "le", formatFloat(b), float64(s.counts[i]))
+		}
+		h.writeSample(w, "_bucket", s.labels, "le", "+Inf", float64(s.count))
+		h.writeSample(w, "_sum", s.labels, "", "", s.sum)
+		h.writeSample(w, "_count", s.labels, "", "", float64(s.count))
+	}
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// Gauge func type and its methods
+//______________________________________________________________________________
+
+// GaugeFunc is the gauge which value is obtained on write.
+type GaugeFunc struct {
+	desc
+	fn func() float64
+}
+
+func (g *GaugeFunc) write(w *bufio.Writer) {
+	g.writeHeader(w, "gauge")
+	g.writeSample(w, "", nil, "", "", g.fn())
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// Metric description and unexported methods
+//______________________________________________________________________________
+
+type desc struct {
+	name   string
+	help   string
+	labels []string
+}
+
+func (d *desc) key(labels []string) string {
+	if len(labels) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: '%s' expects %d label values, got %d", d.name, len(d.labels), len(labels)))
+	}
+	return strings.Join(labels, "\xff")
+}
+
+func (d *desc) writeHeader(w *bufio.Writer, typ string) {
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, escape(d.help, false), d.name, typ)
+}
+
+func (d *desc) writeSample(w *bufio.Writer, suffix string, labels []string, extraName, extraValue string, v float64) {
+	_, _ = w.WriteString(d.name + suffix)
+	if len(labels) > 0 || len(extraName) > 0 {
+		_ = w.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				_ = w.WriteByte(',')
+			}
+			_, _ = w.WriteString(d.labels[i] + `="` + escape(l, true) + `"`)
+		}
+		if len(extraName) > 0 {
+			if len(labels) > 0 {
+				_ = w.WriteByte(',')
+			}
+			_, _ = w.WriteString(extraName + `="` + extraValue + `"`)
+		}
+		_ = w.WriteByte('}')
+	}
+	_, _ = w.WriteString(" " + formatFloat(v) + "\n")
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch series := m.(type) {
+	case map[string]*counterSeries:
+		for k := range series {
+			keys = append(keys, k)
+		}
+	case map[string]*histogramSeries:
+		for k := range series {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escape(s string, label bool) string {
+	if label {
+		return labelEscaper.Replace(s)
+	}
+	return helpEscaper.Replace(s)
+}
@@ -0,0 +1,60 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsWrite(t *testing.T) {
+	requests := NewCounter("test_requests_total", "Total requests.", "host", "code")
+	requests.Inc("example.com", "200")
+	requests.Inc("example.com", "200")
+	requests.Add(3, "a\"b.com", "502")
+	assert.Equal(t, float64(2), requests.Value("example.com", "200"))
+	assert.Equal(t, float64(0), requests.Value("example.com", "404"))
+
+	duration := NewHistogram("test_duration_seconds", "Request duration\nin seconds.", []float64{0.1, 1}, "host")
+	duration.Observe(0.05, "example.com")
+	duration.Observe(0.5, "example.com")
+	duration.Observe(2, "example.com")
+	assert.Equal(t, uint64(3), duration.Count("example.com"))
+
+	NewGaugeFunc("test_modules", "Modules count.", func() float64 { return 42 })
+
+	buf := new(bytes.Buffer)
+	assert.Nil(t, Write(buf))
+	assert.Equal(t, `# HELP test_duration_seconds Request duration\nin seconds.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{host="example.com",le="0.1"} 1
+test_duration_seconds_bucket{host="example.com",le="1"} 2
+test_duration_seconds_bucket{host="example.com",le="+Inf"} 3
+test_duration_seconds_sum{host="example.com"} 2.55
+test_duration_seconds_count{host="example.com"} 3
+# HELP test_modules Modules count.
+# TYPE test_modules gauge
+test_modules 42
+# HELP test_requests_total Total requests.
+# TYPE test_requests_total counter
+test_requests_total{host="a\"b.com",code="502"} 3
+test_requests_total{host="example.com",code="200"} 2
+`, buf.String())
+
+	assert.Panics(t, func() { NewCounter("test_requests_total", "Duplicate.") })
+	assert.Panics(t, func() { requests.Inc("example.com") })
+}
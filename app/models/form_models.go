@@ -21,6 +21,9 @@ type FormTargetURL struct {
 	Host          string `bind:"hostName" json:"host,omitempty"`
 	TargetURL     string `bind:"targetURL" json:"target_url,omitempty"`
 	OldTargetURL  string `bind:"oldTargetURL" json:"old_target_url,omitempty"`
+	Targets       string `bind:"targets" json:"targets,omitempty"`
+	LBStrategy    string `bind:"lbStrategy" json:"lb_strategy,omitempty"`
+	LBHashOn      string `bind:"lbHashOn" json:"lb_hash_on,omitempty"`
 }
 
 // FormConditions represents fields of `formConditions` on page `/admin/proxy/edit.html`.
@@ -28,8 +31,11 @@ type FormConditions struct {
 	Host        string `bind:"hostName" json:"host,omitempty"`
 	TargetURL   string `bind:"targetURL" json:"target_url,omitempty"`
 	Path        string `bind:"path" json:"path,omitempty"`
+	Methods     string `bind:"methods" json:"methods,omitempty"`
 	QueryParams string `bind:"queryParams" json:"query_params,omitempty"`
 	Headers     string `bind:"headers" json:"headers,omitempty"`
+	Cookies     string `bind:"cookies" json:"cookies,omitempty"`
+	Priority    int    `bind:"priority" json:"priority,omitempty"`
 }
 
 // FormRedirects represents fields of `formRedirects` on page `/admin/proxy/edit.html`.
@@ -39,6 +45,13 @@ type FormRedirects struct {
 	Redirects string `bind:"redirects" json:"redirects,omitempty"`
 }
 
+// FormRewrites represents fields of `formRewrites` on page `/admin/proxy/edit.html`.
+type FormRewrites struct {
+	Host      string `bind:"hostName" json:"host,omitempty"`
+	TargetURL string `bind:"targetURL" json:"target_url,omitempty"`
+	Rewrites  string `bind:"rewrites" json:"rewrites,omitempty"`
+}
+
 // FormRestricts represents fields of `formRestricts` on page `/admin/proxy/edit.html`.
 type FormRestricts struct {
 	Host      string `bind:"hostName" json:"host,omitempty"`
@@ -69,3 +82,208 @@ type FormResponseHeaders struct {
 	Add       string `bind:"responseHeadersAdd" json:"add_headers,omitempty"`
 	Remove    string `bind:"responseHeadersRemove" json:"remove_headers,omitempty"`
 }
+
+// FormHealthCheck represents fields of `formHealthCheck` on page `/admin/proxy/edit.html`.
+type FormHealthCheck struct {
+	Host               string `bind:"hostName" json:"host,omitempty"`
+	TargetURL          string `bind:"targetURL" json:"target_url,omitempty"`
+	Path               string `bind:"hcPath" json:"path,omitempty"`
+	Interval           string `bind:"hcInterval" json:"interval,omitempty"`
+	Timeout            string `bind:"hcTimeout" json:"timeout,omitempty"`
+	ExpectedStatus     string `bind:"hcExpectedStatus" json:"expected_status,omitempty"`
+	HealthyThreshold   int    `bind:"hcHealthyThreshold" json:"healthy_threshold,omitempty"`
+	UnhealthyThreshold int    `bind:"hcUnhealthyThreshold" json:"unhealthy_threshold,omitempty"`
+}
+
+// FormCircuitBreaker represents fields of `formCircuitBreaker` on page `/admin/proxy/edit.html`.
+type FormCircuitBreaker struct {
+	Host                string `bind:"hostName" json:"host,omitempty"`
+	TargetURL           string `bind:"targetURL" json:"target_url,omitempty"`
+	ConsecutiveFailures int    `bind:"cbConsecutiveFailures" json:"consecutive_failures,omitempty"`
+	ErrorRate           int    `bind:"cbErrorRate" json:"error_rate,omitempty"`
+	Window              string `bind:"cbWindow" json:"window,omitempty"`
+	MinRequests         int    `bind:"cbMinRequests" json:"min_requests,omitempty"`
+	OpenTimeout         string `bind:"cbOpenTimeout" json:"open_timeout,omitempty"`
+	HalfOpenRequests    int    `bind:"cbHalfOpenRequests" json:"half_open_requests,omitempty"`
+	ResponseStatus      int    `bind:"cbResponseStatus" json:"response_status,omitempty"`
+	ResponseBody        string `bind:"cbResponseBody" json:"response_body,omitempty"`
+}
+
+// FormRetry represents fields of `formRetry` on page `/admin/proxy/edit.html`.
+type FormRetry struct {
+	Host               string `bind:"hostName" json:"host,omitempty"`
+	TargetURL          string `bind:"targetURL" json:"target_url,omitempty"`
+	MaxAttempts        int    `bind:"retryMaxAttempts" json:"max_attempts,omitempty"`
+	OnConnectError     bool   `bind:"retryOnConnectError" json:"on_connect_error,omitempty"`
+	Statuses           string `bind:"retryStatuses" json:"statuses,omitempty"`
+	AllowNonIdempotent bool   `bind:"retryNonIdempotent" json:"allow_non_idempotent,omitempty"`
+	Backoff            string `bind:"retryBackoff" json:"backoff,omitempty"`
+	MaxBodySize        int64  `bind:"retryMaxBodySize" json:"max_body_size,omitempty"`
+}
+
+// FormTransport represents fields of `formTransport` on page `/admin/proxy/edit.html`.
+type FormTransport struct {
+	Host                  string `bind:"hostName" json:"host,omitempty"`
+	TargetURL             string `bind:"targetURL" json:"target_url,omitempty"`
+	DialTimeout           string `bind:"tDialTimeout" json:"dial_timeout,omitempty"`
+	TLSHandshakeTimeout   string `bind:"tTLSHandshakeTimeout" json:"tls_handshake_timeout,omitempty"`
+	ResponseHeaderTimeout string `bind:"tResponseHeaderTimeout" json:"response_header_timeout,omitempty"`
+	IdleConnTimeout       string `bind:"tIdleConnTimeout" json:"idle_conn_timeout,omitempty"`
+	MaxIdleConnsPerHost   int    `bind:"tMaxIdleConnsPerHost" json:"max_idle_conns_per_host,omitempty"`
+	DisableHTTP2          bool   `bind:"tDisableHTTP2" json:"disable_http2,omitempty"`
+	DisableKeepAlives     bool   `bind:"tDisableKeepAlives" json:"disable_keep_alives,omitempty"`
+	CAFile                string `bind:"tCAFile" json:"ca_file,omitempty"`
+	CertFile              string `bind:"tCertFile" json:"cert_file,omitempty"`
+	KeyFile               string `bind:"tKeyFile" json:"key_file,omitempty"`
+	ServerName            string `bind:"tServerName" json:"server_name,omitempty"`
+}
+
+// FormUpgrade represents fields of `formUpgrade` on page `/admin/proxy/edit.html`.
+type FormUpgrade struct {
+	Host        string `bind:"hostName" json:"host,omitempty"`
+	TargetURL   string `bind:"targetURL" json:"target_url,omitempty"`
+	Disabled    bool   `bind:"upgradeDisabled" json:"disabled,omitempty"`
+	Protocols   string `bind:"upgradeProtocols" json:"protocols,omitempty"`
+	IdleTimeout string `bind:"upgradeIdleTimeout" json:"idle_timeout,omitempty"`
+	MaxConns    int    `bind:"upgradeMaxConns" json:"max_conns,omitempty"`
+}
+
+// FormCache represents fields of `formCache` on page `/admin/proxy/edit.html`.
+type FormCache struct {
+	Host                 string `bind:"hostName" json:"host,omitempty"`
+	TargetURL            string `bind:"targetURL" json:"target_url,omitempty"`
+	Enabled              bool   `bind:"cacheEnabled" json:"enabled,omitempty"`
+	Storage              string `bind:"cacheStorage" json:"storage,omitempty"`
+	Dir                  string `bind:"cacheDir" json:"dir,omitempty"`
+	MaxSize              int64  `bind:"cacheMaxSize" json:"max_size,omitempty"`
+	MaxEntrySize         int64  `bind:"cacheMaxEntrySize" json:"max_entry_size,omitempty"`
+	StaleWhileRevalidate string `bind:"cacheStaleWhileRevalidate" json:"stale_while_revalidate,omitempty"`
+	StaleIfError         string `bind:"cacheStaleIfError" json:"stale_if_error,omitempty"`
+}
+
+// FormCompress represents fields of `formCompress` on page `/admin/proxy/edit.html`.
+type FormCompress struct {
+	Host      string `bind:"hostName" json:"host,omitempty"`
+	TargetURL string `bind:"targetURL" json:"target_url,omitempty"`
+	Enabled   bool   `bind:"compressEnabled" json:"enabled,omitempty"`
+	Encodings string `bind:"compressEncodings" json:"encodings,omitempty"`
+	Types     string `bind:"compressTypes" json:"types,omitempty"`
+	MinSize   int    `bind:"compressMinSize" json:"min_size,omitempty"`
+}
+
+// FormRateLimit represents fields of `formRateLimit` on pages
+// `/admin/proxy/edit.html`, `/admin/proxy/show.html` and
+// `/admin/gomod/index.html`. Max in-flight is applicable to proxy rule only.
+type FormRateLimit struct {
+	Host        string `bind:"hostName" json:"host,omitempty"`
+	TargetURL   string `bind:"targetURL" json:"target_url,omitempty"`
+	Enabled     bool   `bind:"rlEnabled" json:"enabled,omitempty"`
+	Rate        int    `bind:"rlRate" json:"rate,omitempty"`
+	Per         string `bind:"rlPer" json:"per,omitempty"`
+	Burst       int    `bind:"rlBurst" json:"burst,omitempty"`
+	Key         string `bind:"rlKey" json:"key,omitempty"`
+	MaxInFlight int    `bind:"rlMaxInFlight" json:"max_in_flight,omitempty"`
+}
+
+// FormAccess represents fields of `formAccess` on pages
+// `/admin/proxy/edit.html` and `/admin/proxy/show.html`. Allow and deny
+// values are separated by comma or new line.
+type FormAccess struct {
+	Host          string `bind:"hostName" json:"host,omitempty"`
+	TargetURL     string `bind:"targetURL" json:"target_url,omitempty"`
+	Allow         string `bind:"aclAllow" json:"allow,omitempty"`
+	Deny          string `bind:"aclDeny" json:"deny,omitempty"`
+	ForbiddenBody string `bind:"aclForbiddenBody" json:"forbidden_body,omitempty"`
+}
+
+// FormAuth represents fields of `formAuth` on page `/admin/proxy/edit.html`.
+// Empty mode disables the authentication. Users are `name:password` and
+// API keys are `name=key` per line, name without secret keeps the existing
+// one.
+type FormAuth struct {
+	Host           string `bind:"hostName" json:"host,omitempty"`
+	TargetURL      string `bind:"targetURL" json:"target_url,omitempty"`
+	Mode           string `bind:"authMode" json:"mode,omitempty"`
+	Realm          string `bind:"authRealm" json:"realm,omitempty"`
+	Users          string `bind:"authUsers" json:"users,omitempty"`
+	APIKeyHeader   string `bind:"authAPIKeyHeader" json:"api_key_header,omitempty"`
+	APIKeys        string `bind:"authAPIKeys" json:"api_keys,omitempty"`
+	ForwardURL     string `bind:"authForwardURL" json:"forward_url,omitempty"`
+	ForwardTimeout string `bind:"authForwardTimeout" json:"forward_timeout,omitempty"`
+	ForwardHeaders string `bind:"authForwardHeaders" json:"forward_headers,omitempty"`
+	UserHeader     string `bind:"authUserHeader" json:"user_header,omitempty"`
+}
+
+// FormSplit represents fields of `formSplit` on page `/admin/proxy/edit.html`.
+// Variants are `name, target-url, weight` per line.
+type FormSplit struct {
+	Host         string `bind:"hostName" json:"host,omitempty"`
+	TargetURL    string `bind:"targetURL" json:"target_url,omitempty"`
+	Enabled      bool   `bind:"splitEnabled" json:"enabled,omitempty"`
+	Variants     string `bind:"splitVariants" json:"variants,omitempty"`
+	StickyOn     string `bind:"splitStickyOn" json:"sticky_on,omitempty"`
+	AssignCookie string `bind:"splitAssignCookie" json:"assign_cookie,omitempty"`
+}
+
+// FormMirror represents fields of `formMirror` on page `/admin/proxy/edit.html`.
+type FormMirror struct {
+	Host        string `bind:"hostName" json:"host,omitempty"`
+	TargetURL   string `bind:"targetURL" json:"target_url,omitempty"`
+	Enabled     bool   `bind:"mirrorEnabled" json:"enabled,omitempty"`
+	ShadowURL   string `bind:"mirrorTargetURL" json:"shadow_url,omitempty"`
+	Percent     string `bind:"mirrorPercent" json:"percent,omitempty"`
+	MaxBodySize int64  `bind:"mirrorMaxBodySize" json:"max_body_size,omitempty"`
+	Headers     string `bind:"mirrorHeaders" json:"headers,omitempty"`
+	Timeout     string `bind:"mirrorTimeout" json:"timeout,omitempty"`
+}
+
+// FormErrorPages represents fields of `formHostErrorPages` on page
+// `/admin/proxy/show.html`. Empty page uses the default plain text.
+type FormErrorPages struct {
+	Host    string `bind:"hostName" json:"host,omitempty"`
+	Page403 string `bind:"errorPage403" json:"page_403,omitempty"`
+	Page404 string `bind:"errorPage404" json:"page_404,omitempty"`
+	Page429 string `bind:"errorPage429" json:"page_429,omitempty"`
+	Page502 string `bind:"errorPage502" json:"page_502,omitempty"`
+	Page503 string `bind:"errorPage503" json:"page_503,omitempty"`
+	Page504 string `bind:"errorPage504" json:"page_504,omitempty"`
+}
+
+// FormMaintenance represents fields of `formHostMaintenance` on page
+// `/admin/proxy/show.html`.
+type FormMaintenance struct {
+	Host       string `bind:"hostName" json:"host,omitempty"`
+	Enabled    bool   `bind:"maintenanceEnabled" json:"enabled,omitempty"`
+	Allow      string `bind:"maintenanceAllow" json:"allow,omitempty"`
+	Page       string `bind:"maintenancePage" json:"page,omitempty"`
+	RetryAfter int    `bind:"maintenanceRetryAfter" json:"retry_after,omitempty"`
+}
+
+// FormAccessLog represents fields of `formHostAccessLog` on page
+// `/admin/proxy/show.html`.
+type FormAccessLog struct {
+	Host    string `bind:"hostName" json:"host,omitempty"`
+	Enabled bool   `bind:"accessLogEnabled" json:"enabled,omitempty"`
+	Sample  int    `bind:"accessLogSample" json:"sample,omitempty"`
+}
+
+// FormGoModUpstreams represents fields of `formUpstreams` on page
+// `/admin/gomod/index.html`. Routes are `pattern goproxy-list` per line.
+type FormGoModUpstreams struct {
+	GoProxy string `bind:"goProxy" json:"go_proxy,omitempty"`
+	GoSumDB string `bind:"goSumDB" json:"go_sumdb,omitempty"`
+	Routes  string `bind:"upstreamRoutes" json:"routes,omitempty"`
+}
+
+// FormGoModPrivate represents fields of `formPrivate` on page
+// `/admin/gomod/index.html`, comma separated module path patterns.
+type FormGoModPrivate struct {
+	Private string `bind:"private" json:"private,omitempty"`
+	NoSumDB string `bind:"noSumDB" json:"no_sumdb,omitempty"`
+}
+
+// FormGoModPolicies represents fields of `formPolicies` on page
+// `/admin/gomod/policies.html`, a policy rule per line.
+type FormGoModPolicies struct {
+	Policies string `bind:"policies" json:"policies,omitempty"`
+}
@@ -14,11 +14,15 @@
 
 package models
 
+import "time"
+
 // Configuration struct holds the THUMBAI configurations. Currently its
 // used for vanities and proxies.
 type Configuration struct {
-	Vanities map[string][]*VanityPackage `json:"vanities,omitempty"`
-	Proxies  map[string][]*ProxyRule     `json:"proxies,omitempty"`
+	Vanities       map[string][]*VanityPackage   `json:"vanities,omitempty"`
+	Proxies        map[string][]*ProxyRule       `json:"proxies,omitempty"`
+	ProxyHosts     map[string]*ProxyHostSettings `json:"proxy_hosts,omitempty"`
+	GoModRateLimit *RateLimit                    `json:"gomod_rate_limit,omitempty"`
 }
 
 // PublishRequest struct used to accept the module publish request.
@@ -32,6 +36,17 @@ type FieldError struct {
 	Message string `json:"message"`
 }
 
+// RateLimit holds the token bucket rate limit configuration. `Rate` requests
+// are allowed per `Per` duration (default `1s`) with `Burst` capacity
+// (default rate), counted per key `client-ip`, `user` or
+// `header:<Header-Name>`.
+type RateLimit struct {
+	Rate  int    `json:"rate,omitempty"`
+	Per   string `json:"per,omitempty"`
+	Burst int    `json:"burst,omitempty"`
+	Key   string `json:"key,omitempty"`
+}
+
 //‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
 // Module types
 //______________________________________________________________________________
@@ -41,6 +56,59 @@ type ModuleSettings struct {
 	GoPath   string `bind:"goPath" json:"go_path,omitempty"`
 	GoBinary string `bind:"goBinary" json:"go_binary,omitempty"`
 	GoProxy  string `bind:"goProxy" json:"go_proxy,omitempty"`
+	GoSumDB  string `bind:"goSumDB" json:"go_sumdb,omitempty"`
+	Fetcher  string `bind:"fetcher" json:"fetcher,omitempty"`
+
+	Upstreams   []*ModuleUpstream   `json:"upstreams,omitempty"`
+	Private     string              `json:"private,omitempty"`
+	NoSumDB     string              `json:"no_sumdb,omitempty"`
+	Credentials []*ModuleCredential `json:"-"`
+	Policies    []*ModulePolicy     `json:"policies,omitempty"`
+	RateLimit   *RateLimit          `json:"rate_limit,omitempty"`
+}
+
+// ModuleUpstream routes the modules matching the path pattern to the
+// GOPROXY list, such as `corp.example.com/*` to `direct`.
+type ModuleUpstream struct {
+	Pattern string `json:"pattern"`
+	Proxy   string `json:"proxy"`
+}
+
+// ModuleCredential is the credential of VCS or proxy host used to fetch
+// the private modules, either username/token or SSH private key. Secrets are
+// stored encrypted in the data store.
+type ModuleCredential struct {
+	Host     string `bind:"host" json:"host"`
+	Username string `bind:"username" json:"username,omitempty"`
+	Token    string `bind:"token" json:"-"`
+	SSHKey   string `bind:"sshKey" json:"-"`
+}
+
+// ModulePolicy is the allow or block rule of go mod repository by module
+// path pattern. Block rule with version constraints blocks only the matching
+// versions, otherwise the module.
+type ModulePolicy struct {
+	Action       string `json:"action"`
+	Pattern      string `json:"pattern"`
+	BelowVersion string `json:"below_version,omitempty"`
+	Pseudo       bool   `json:"pseudo,omitempty"`
+	Retracted    bool   `json:"retracted,omitempty"`
+	Reason       string `json:"reason,omitempty"`
+}
+
+// PolicyAudit is the audit entry of the request blocked by module policy.
+// Count is the repeated requests of the module from the client coalesced
+// into the entry, time is of the last one.
+type PolicyAudit struct {
+	Time     time.Time `json:"time"`
+	Source   string    `json:"source"`
+	Module   string    `json:"module"`
+	Version  string    `json:"version,omitempty"`
+	Status   int       `json:"status"`
+	Message  string    `json:"message"`
+	ClientIP string    `json:"client_ip,omitempty"`
+	User     string    `json:"user,omitempty"`
+	Count    int       `json:"count"`
 }
 
 // ModuleStats represents the go modules statics on the server.
@@ -66,20 +134,232 @@ type VanityPackage struct {
 // Proxy Rule, related types
 //______________________________________________________________________________
 
-// ProxyRule represents one proxy pass rule.
+// ProxyRule represents one proxy pass rule. Values of query params, headers
+// and cookies conditions could be exact value, `{regex}`, `*` for presence
+// and prefix `!` negates it. Rules are evaluated by priority, higher first,
+// and then in the configured order.
 type ProxyRule struct {
-	Last            bool               `json:"last,omitempty"`
-	SkipTLSVerify   bool               `json:"skip_tls_verify,omitempty"`
-	Host            string             `json:"host,omitempty"`
-	Path            string             `json:"path,omitempty"`
-	TargetURL       string             `json:"target_url,omitempty"`
-	QueryParams     map[string]string  `json:"query_params,omitempty"`
-	Headers         map[string]string  `json:"headers,omitempty"`
-	RequestHeaders  *ProxyHeader       `json:"request_headers,omitempty"`
-	ResponseHeaders *ProxyHeader       `json:"response_headers,omitempty"`
-	RestrictFiles   *ProxyRestrictFile `json:"restrict_files,omitempty"`
-	Redirects       []*ProxyRedirect   `json:"redirects,omitempty"`
-	Statics         []*ProxyStatic     `json:"statics,omitempty"`
+	Last            bool                 `json:"last,omitempty"`
+	SkipTLSVerify   bool                 `json:"skip_tls_verify,omitempty"`
+	Host            string               `json:"host,omitempty"`
+	Path            string               `json:"path,omitempty"`
+	TargetURL       string               `json:"target_url,omitempty"`
+	Priority        int                  `json:"priority,omitempty"`
+	Methods         []string             `json:"methods,omitempty"`
+	QueryParams     map[string]string    `json:"query_params,omitempty"`
+	Headers         map[string]string    `json:"headers,omitempty"`
+	Cookies         map[string]string    `json:"cookies,omitempty"`
+	ConditionSyntax int                  `json:"condition_syntax,omitempty"`
+	RequestHeaders  *ProxyHeader         `json:"request_headers,omitempty"`
+	ResponseHeaders *ProxyHeader         `json:"response_headers,omitempty"`
+	RestrictFiles   *ProxyRestrictFile   `json:"restrict_files,omitempty"`
+	Redirects       []*ProxyRedirect     `json:"redirects,omitempty"`
+	Rewrites        []*ProxyRewrite      `json:"rewrites,omitempty"`
+	Statics         []*ProxyStatic       `json:"statics,omitempty"`
+	Targets         []*ProxyTarget       `json:"targets,omitempty"`
+	LoadBalancer    *ProxyLoadBalancer   `json:"load_balancer,omitempty"`
+	HealthCheck     *ProxyHealthCheck    `json:"health_check,omitempty"`
+	CircuitBreaker  *ProxyCircuitBreaker `json:"circuit_breaker,omitempty"`
+	Retry           *ProxyRetry          `json:"retry,omitempty"`
+	Transport       *ProxyTransport      `json:"transport,omitempty"`
+	Upgrade         *ProxyUpgrade        `json:"upgrade,omitempty"`
+	Cache           *ProxyCache          `json:"cache,omitempty"`
+	Compress        *ProxyCompress       `json:"compress,omitempty"`
+	RateLimit       *RateLimit           `json:"rate_limit,omitempty"`
+	MaxInFlight     int                  `json:"max_in_flight,omitempty"`
+	Access          *ProxyAccess         `json:"access,omitempty"`
+	Auth            *ProxyAuth           `json:"auth,omitempty"`
+	Split           *ProxySplit          `json:"split,omitempty"`
+	Mirror          *ProxyMirror         `json:"mirror,omitempty"`
+}
+
+// ProxyHostSettings holds the proxy host level settings, applied before
+// the proxy rules.
+type ProxyHostSettings struct {
+	RateLimit   *RateLimit        `json:"rate_limit,omitempty"`
+	Access      *ProxyAccess      `json:"access,omitempty"`
+	ErrorPages  map[string]string `json:"error_pages,omitempty"`
+	Maintenance *ProxyMaintenance `json:"maintenance,omitempty"`
+	AccessLog   *ProxyAccessLog   `json:"access_log,omitempty"`
+}
+
+// ProxyAccessLog holds the access log config of the proxy host. Sample is
+// the percentage of requests to be logged, zero logs all; `5xx` responses
+// are always logged unless it's disabled.
+type ProxyAccessLog struct {
+	Disabled bool `json:"disabled,omitempty"`
+	Sample   int  `json:"sample,omitempty"`
+}
+
+// ProxyMaintenance holds the maintenance mode config of the proxy host.
+// Config is kept when it's disabled. Allowed client IPs bypass the
+// maintenance page, retry after is in seconds.
+type ProxyMaintenance struct {
+	Enabled    bool     `json:"enabled,omitempty"`
+	Allow      []string `json:"allow,omitempty"`
+	Page       string   `json:"page,omitempty"`
+	RetryAfter int      `json:"retry_after,omitempty"`
+}
+
+// ProxyAccess holds the client IP allow and deny lists, values are IP
+// address or CIDR such as `10.0.0.0/8`. Deny list takes precedence, empty
+// allow list allows all. Forbidden body is the custom `403` response of
+// denied requests.
+type ProxyAccess struct {
+	Allow         []string `json:"allow,omitempty"`
+	Deny          []string `json:"deny,omitempty"`
+	ForbiddenBody string   `json:"forbidden_body,omitempty"`
+}
+
+// ProxyAuth holds the authentication config of the proxy rule. Mode is one
+// of `basic`, `api-key` or `forward`. User passwords are stored as bcrypt
+// hash and API keys as SHA-256 hex, keyed by name. Forward mode sends a
+// subrequest to the auth service, on `2xx` response forward headers are
+// passed upstream. User header carries the authenticated user to upstream.
+type ProxyAuth struct {
+	Mode           string            `json:"mode,omitempty"`
+	Realm          string            `json:"realm,omitempty"`
+	Users          map[string]string `json:"users,omitempty"`
+	APIKeyHeader   string            `json:"api_key_header,omitempty"`
+	APIKeys        map[string]string `json:"api_keys,omitempty"`
+	ForwardURL     string            `json:"forward_url,omitempty"`
+	ForwardTimeout string            `json:"forward_timeout,omitempty"`
+	ForwardHeaders []string          `json:"forward_headers,omitempty"`
+	UserHeader     string            `json:"user_header,omitempty"`
+}
+
+// ProxySplit holds the traffic split of the proxy rule. Variants get the
+// weighted percentage of traffic and rest goes to the rule targets. Sticky
+// on is `header:<Header-Name>` or `cookie:<cookie-name>`, assign cookie
+// keeps the assigned variant name for the client.
+type ProxySplit struct {
+	Variants     []*ProxySplitVariant `json:"variants,omitempty"`
+	StickyOn     string               `json:"sticky_on,omitempty"`
+	AssignCookie string               `json:"assign_cookie,omitempty"`
+}
+
+// ProxySplitVariant holds single traffic split variant, weight is in
+// percentage.
+type ProxySplitVariant struct {
+	Name      string `json:"name,omitempty"`
+	TargetURL string `json:"target_url,omitempty"`
+	Weight    int    `json:"weight,omitempty"`
+}
+
+// ProxyMirror holds the traffic mirror config of the proxy rule. Percent of
+// requests are copied to the shadow upstream, zero disables it; request with
+// body larger than max body size (bytes) is not mirrored. Headers are added to the shadow
+// requests to tag them.
+type ProxyMirror struct {
+	TargetURL   string            `json:"target_url,omitempty"`
+	Percent     int               `json:"percent,omitempty"`
+	MaxBodySize int64             `json:"max_body_size,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	Timeout     string            `json:"timeout,omitempty"`
+}
+
+// ProxyTarget holds single upstream target of the proxy rule and its weight
+// for load balancing.
+type ProxyTarget struct {
+	URL    string `json:"url,omitempty"`
+	Weight int    `json:"weight,omitempty"`
+}
+
+// ProxyHealthCheck holds the active health check configuration of the proxy
+// rule targets. Interval and timeout are duration values such as `10s`,
+// expected status is a range such as `200-399`.
+type ProxyHealthCheck struct {
+	Path               string `json:"path,omitempty"`
+	Interval           string `json:"interval,omitempty"`
+	Timeout            string `json:"timeout,omitempty"`
+	ExpectedStatus     string `json:"expected_status,omitempty"`
+	HealthyThreshold   int    `json:"healthy_threshold,omitempty"`
+	UnhealthyThreshold int    `json:"unhealthy_threshold,omitempty"`
+}
+
+// ProxyCircuitBreaker holds the passive outlier detection configuration of
+// the proxy rule targets. Target is ejected on consecutive failures or on
+// error rate (percentage) within the window, it's retried after open timeout.
+type ProxyCircuitBreaker struct {
+	ConsecutiveFailures int    `json:"consecutive_failures,omitempty"`
+	ErrorRate           int    `json:"error_rate,omitempty"`
+	Window              string `json:"window,omitempty"`
+	MinRequests         int    `json:"min_requests,omitempty"`
+	OpenTimeout         string `json:"open_timeout,omitempty"`
+	HalfOpenRequests    int    `json:"half_open_requests,omitempty"`
+	ResponseStatus      int    `json:"response_status,omitempty"`
+	ResponseBody        string `json:"response_body,omitempty"`
+}
+
+// ProxyRetry holds the retry policy of the proxy rule. Only idempotent
+// methods are retried unless `AllowNonIdempotent` is set, request body is
+// buffered up to `MaxBodySize` bytes for replay. `OnConnectError` retries
+// only the failures to connect to upstream, request is not sent yet.
+type ProxyRetry struct {
+	MaxAttempts        int    `json:"max_attempts,omitempty"`
+	OnConnectError     bool   `json:"on_connect_error,omitempty"`
+	Statuses           []int  `json:"statuses,omitempty"`
+	AllowNonIdempotent bool   `json:"allow_non_idempotent,omitempty"`
+	Backoff            string `json:"backoff,omitempty"`
+	MaxBodySize        int64  `json:"max_body_size,omitempty"`
+}
+
+// ProxyTransport holds the upstream connection settings of the proxy rule.
+// Timeouts are duration values such as `30s`, CA, client certificate and key
+// are PEM file paths on the THUMBAI server.
+type ProxyTransport struct {
+	DialTimeout           string `json:"dial_timeout,omitempty"`
+	TLSHandshakeTimeout   string `json:"tls_handshake_timeout,omitempty"`
+	ResponseHeaderTimeout string `json:"response_header_timeout,omitempty"`
+	IdleConnTimeout       string `json:"idle_conn_timeout,omitempty"`
+	MaxIdleConnsPerHost   int    `json:"max_idle_conns_per_host,omitempty"`
+	DisableHTTP2          bool   `json:"disable_http2,omitempty"`
+	DisableKeepAlives     bool   `json:"disable_keep_alives,omitempty"`
+	CAFile                string `json:"ca_file,omitempty"`
+	CertFile              string `json:"cert_file,omitempty"`
+	KeyFile               string `json:"key_file,omitempty"`
+	ServerName            string `json:"server_name,omitempty"`
+}
+
+// ProxyUpgrade holds the `Connection: Upgrade` (WebSocket, h2c) handling
+// config of the proxy rule. Empty protocols allows all, idle timeout closes
+// the upgraded connection without traffic and max conns limits the active
+// upgraded connections on the rule.
+type ProxyUpgrade struct {
+	Disabled    bool     `json:"disabled,omitempty"`
+	Protocols   []string `json:"protocols,omitempty"`
+	IdleTimeout string   `json:"idle_timeout,omitempty"`
+	MaxConns    int      `json:"max_conns,omitempty"`
+}
+
+// ProxyCache holds the response cache configuration of the proxy rule.
+// Storage is `memory` or `disk`, sizes are in bytes and stale durations
+// are used when upstream response does not specify them. Rules with
+// authentication are never cached.
+type ProxyCache struct {
+	Storage              string `json:"storage,omitempty"`
+	Dir                  string `json:"dir,omitempty"`
+	MaxSize              int64  `json:"max_size,omitempty"`
+	MaxEntrySize         int64  `json:"max_entry_size,omitempty"`
+	StaleWhileRevalidate string `json:"stale_while_revalidate,omitempty"`
+	StaleIfError         string `json:"stale_if_error,omitempty"`
+}
+
+// ProxyCompress holds the on-the-fly response compression configuration of
+// the proxy rule, it's applied to the static files too. Encodings are in
+// the order of preference, types is MIME type allowlist such as `text/*`.
+type ProxyCompress struct {
+	Encodings []string `json:"encodings,omitempty"`
+	Types     []string `json:"types,omitempty"`
+	MinSize   int      `json:"min_size,omitempty"`
+}
+
+// ProxyLoadBalancer holds the load balancing strategy across the proxy rule
+// targets. `HashOn` is applicable only for strategy `hash`, its value could be
+// `client-ip`, `header:<Header-Name>` or `cookie:<cookie-name>`.
+type ProxyLoadBalancer struct {
+	Strategy string `json:"strategy,omitempty"`
+	HashOn   string `json:"hash_on,omitempty"`
 }
 
 // ProxyRedirect holds single redirect for proxy server.
@@ -90,6 +370,16 @@ type ProxyRedirect struct {
 	IsAbs  bool   `json:"is_abs,omitempty"`
 }
 
+// ProxyRewrite holds single rewrite of the upstream request URL. Type is one
+// of `strip-prefix`, `add-prefix`, `replace` or `query-replace`. Match of
+// replace could be exact value or regex `{regex}`, target refers the regex
+// capture groups as `{1}`.
+type ProxyRewrite struct {
+	Type   string `json:"type,omitempty"`
+	Match  string `json:"match,omitempty"`
+	Target string `json:"target,omitempty"`
+}
+
 // ProxyHeader struct holds the headers request and
 // response that needs to be added or removed.
 type ProxyHeader struct {
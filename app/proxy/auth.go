@@ -0,0 +1,323 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"thumbai/app/access"
+	"thumbai/app/models"
+
+	"aahframe.work/ahttp"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Authentication modes
+const (
+	AuthModeBasic   = "basic"
+	AuthModeAPIKey  = "api-key"
+	AuthModeForward = "forward"
+)
+
+// Authentication default values
+const (
+	defaultAuthRealm      = "Restricted"
+	defaultAPIKeyHeader   = "X-Api-Key"
+	defaultForwardTimeout = 5 * time.Second
+	maxForwardAuthBody    = 64 << 10
+)
+
+// ValidateAuth method validates the given authentication configuration and
+// returns the field errors if any.
+func ValidateAuth(a *models.ProxyAuth) map[string]string {
+	errs := map[string]string{}
+	switch a.Mode {
+	case AuthModeBasic:
+		if len(a.Users) == 0 {
+			errs["authUsers"] = "At least one user is required"
+		}
+		for u, h := range a.Users {
+			if _, err := bcrypt.Cost([]byte(h)); err != nil {
+				errs["authUsers"] = "Invalid password hash for user: " + u
+			}
+		}
+	case AuthModeAPIKey:
+		if len(a.APIKeys) == 0 {
+			errs["authAPIKeys"] = "At least one API key is required"
+		}
+	case AuthModeForward:
+		if u, err := url.Parse(a.ForwardURL); err != nil || !u.IsAbs() {
+			errs["authForwardURL"] = "Absolute auth service URL is required"
+		}
+		if _, err := parseDuration(a.ForwardTimeout, 0); err != nil {
+			errs["authForwardTimeout"] = "Invalid duration value, e.g.: 5s"
+		}
+	default:
+		errs["authMode"] = "Supported modes are basic, api-key and forward"
+	}
+	return errs
+}
+
+// HashPassword method returns the bcrypt hash of the given password, value
+// is returned as-is if it's already a bcrypt hash.
+func HashPassword(password string) (string, error) {
+	if _, err := bcrypt.Cost([]byte(password)); err == nil {
+		return password, nil
+	}
+	b, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(b), err
+}
+
+// HashAPIKey method returns the SHA-256 hex value of the API key, API keys
+// are stored as hash.
+func HashAPIKey(key string) string {
+	h := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(h[:])
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// Authenticator type and its methods
+//______________________________________________________________________________
+
+// authenticator authenticates the requests of the proxy rule before it's
+// proxied to upstream.
+type authenticator struct {
+	Mode           string
+	Realm          string
+	APIKeyHeader   string
+	UserHeader     string
+	ForwardURL     string
+	ForwardHeaders []string
+	users          map[string][]byte
+	apiKeys        map[string]string // key hash -> name
+	client         *http.Client
+
+	// verified basic auth credentials, avoids bcrypt on every request
+	mu       sync.RWMutex
+	verified map[string][32]byte
+}
+
+// authResult is the response of failed authentication.
+type authResult struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+func newAuthenticator(a *models.ProxyAuth) (*authenticator, error) {
+	if errs := ValidateAuth(a); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid auth config: %v", errs)
+	}
+	au := &authenticator{
+		Mode:           a.Mode,
+		Realm:          a.Realm,
+		APIKeyHeader:   a.APIKeyHeader,
+		UserHeader:     http.CanonicalHeaderKey(a.UserHeader),
+		ForwardURL:     a.ForwardURL,
+		ForwardHeaders: a.ForwardHeaders,
+		users:          make(map[string][]byte),
+		apiKeys:        make(map[string]string),
+		verified:       make(map[string][32]byte),
+	}
+	if len(au.Realm) == 0 {
+		au.Realm = defaultAuthRealm
+	}
+	if len(au.APIKeyHeader) == 0 {
+		au.APIKeyHeader = defaultAPIKeyHeader
+	}
+	for u, h := range a.Users {
+		au.users[u] = []byte(h)
+	}
+	for name, h := range a.APIKeys {
+		au.apiKeys[h] = name
+	}
+	if au.Mode == AuthModeForward {
+		timeout, _ := parseDuration(a.ForwardTimeout, defaultForwardTimeout)
+		au.client = &http.Client{
+			Timeout: timeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+	}
+	return au, nil
+}
+
+// Authenticate method authenticates the request, on success it returns the
+// user name (could be empty for forward auth) and prepares the request
+// headers for upstream. On failure it returns the response for the client.
+func (a *authenticator) Authenticate(req *http.Request) (string, *authResult) {
+	if len(a.UserHeader) > 0 {
+		req.Header.Del(a.UserHeader) // not trusted from client
+	}
+	var user string
+	var res *authResult
+	switch a.Mode {
+	case AuthModeBasic:
+		user, res = a.basic(req)
+	case AuthModeAPIKey:
+		user, res = a.apiKey(req)
+	case AuthModeForward:
+		user, res = a.forward(req)
+	}
+	if res == nil && len(user) > 0 && len(a.UserHeader) > 0 {
+		req.Header.Set(a.UserHeader, user)
+	}
+	return user, res
+}
+
+func (a *authenticator) basic(req *http.Request) (string, *authResult) {
+	username, password, ok := req.BasicAuth()
+	if !ok || !a.verify(username, password) {
+		hdr := http.Header{}
+		hdr.Set(ahttp.HeaderWWWAuthenticate, `Basic realm="`+a.Realm+`"`)
+		return "", &authResult{Status: http.StatusUnauthorized, Header: hdr, Body: []byte("401 Unauthorized")}
+	}
+	req.Header.Del(ahttp.HeaderAuthorization)
+	return username, nil
+}
+
+func (a *authenticator) verify(username, password string) bool {
+	hash, found := a.users[username]
+	if !found {
+		return false
+	}
+	sum := sha256.Sum256([]byte(username + ":" + password))
+	a.mu.RLock()
+	v, cached := a.verified[username]
+	a.mu.RUnlock()
+	if cached && subtle.ConstantTimeCompare(v[:], sum[:]) == 1 {
+		return true
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil {
+		return false
+	}
+	a.mu.Lock()
+	a.verified[username] = sum
+	a.mu.Unlock()
+	return true
+}
+
+func (a *authenticator) apiKey(req *http.Request) (string, *authResult) {
+	key := req.Header.Get(a.APIKeyHeader)
+	if len(key) > 0 {
+		h := HashAPIKey(key)
+		for kh, name := range a.apiKeys {
+			if subtle.ConstantTimeCompare([]byte(kh), []byte(h)) == 1 {
+				req.Header.Del(a.APIKeyHeader)
+				return name, nil
+			}
+		}
+	}
+	return "", &authResult{Status: http.StatusUnauthorized, Body: []byte("401 Unauthorized")}
+}
+
+// forward method sends the subrequest with the request headers to the auth
+// service, 2xx response allows the request and configured headers of auth
+// response are passed upstream. Otherwise auth response is sent to the
+// client, such as login redirect.
+func (a *authenticator) forward(req *http.Request) (string, *authResult) {
+	for _, h := range a.ForwardHeaders {
+		req.Header.Del(h) // not trusted from client
+	}
+	authReq, err := http.NewRequest(http.MethodGet, a.ForwardURL, nil)
+	if err != nil {
+		return "", forwardAuthError()
+	}
+	authReq = authReq.WithContext(req.Context())
+	for k, vv := range req.Header {
+		if isHopHeader(k) {
+			continue
+		}
+		authReq.Header[k] = vv
+	}
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	authReq.Header.Set("X-Forwarded-Method", req.Method)
+	authReq.Header.Set("X-Forwarded-Proto", scheme)
+	authReq.Header.Set("X-Forwarded-Host", req.Host)
+	authReq.Header.Set("X-Forwarded-Uri", req.URL.RequestURI())
+	authReq.Header.Set(ahttp.HeaderXForwardedFor, access.ClientIP(req))
+
+	res, err := a.client.Do(authReq)
+	if err != nil {
+		return "", forwardAuthError()
+	}
+	defer func() {
+		_, _ = io.Copy(ioutil.Discard, io.LimitReader(res.Body, maxForwardAuthBody))
+		_ = res.Body.Close()
+	}()
+
+	if res.StatusCode >= http.StatusOK && res.StatusCode < http.StatusMultipleChoices {
+		for _, h := range a.ForwardHeaders {
+			if vv := res.Header[http.CanonicalHeaderKey(h)]; len(vv) > 0 {
+				req.Header[http.CanonicalHeaderKey(h)] = vv
+			}
+		}
+		user := ""
+		if len(a.UserHeader) > 0 {
+			user = res.Header.Get(a.UserHeader)
+		}
+		return user, nil
+	}
+
+	body, _ := ioutil.ReadAll(io.LimitReader(res.Body, maxForwardAuthBody))
+	hdr := http.Header{}
+	for k, vv := range res.Header {
+		if isHopHeader(k) || k == ahttp.HeaderContentLength {
+			continue
+		}
+		hdr[k] = vv
+	}
+	return "", &authResult{Status: res.StatusCode, Header: hdr, Body: body}
+}
+
+// write method writes the failed authentication response.
+func (r *authResult) write(w http.ResponseWriter) {
+	for k, vv := range r.Header {
+		w.Header()[k] = vv
+	}
+	if len(w.Header().Get(ahttp.HeaderContentType)) == 0 {
+		w.Header().Set(ahttp.HeaderContentType, "text/plain; charset=utf-8")
+	}
+	w.WriteHeader(r.Status)
+	_, _ = w.Write(r.Body)
+}
+
+func forwardAuthError() *authResult {
+	return &authResult{Status: http.StatusBadGateway, Body: []byte("502 Bad Gateway")}
+}
+
+// isHopHeader method returns true for hop-by-hop headers, they are not sent
+// to the auth service.
+func isHopHeader(name string) bool {
+	switch http.CanonicalHeaderKey(name) {
+	case "Connection", "Proxy-Connection", "Keep-Alive", "Proxy-Authenticate",
+		"Proxy-Authorization", "Te", "Trailer", "Transfer-Encoding", "Upgrade":
+		return true
+	}
+	return false
+}
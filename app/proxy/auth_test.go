@@ -0,0 +1,124 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"thumbai/app/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthBasic(t *testing.T) {
+	hash, err := HashPassword("s3cret")
+	assert.Nil(t, err)
+	a, err := newAuthenticator(&models.ProxyAuth{
+		Mode:       AuthModeBasic,
+		Users:      map[string]string{"jeeva": hash},
+		UserHeader: "X-Auth-User",
+	})
+	assert.Nil(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	_, res := a.Authenticate(req)
+	assert.Equal(t, http.StatusUnauthorized, res.Status)
+	assert.Equal(t, `Basic realm="Restricted"`, res.Header.Get("WWW-Authenticate"))
+
+	req.SetBasicAuth("jeeva", "wrong")
+	_, res = a.Authenticate(req)
+	assert.NotNil(t, res)
+
+	// twice, second one from verified cache
+	for i := 0; i < 2; i++ {
+		req = httptest.NewRequest(http.MethodGet, "/", nil)
+		req.SetBasicAuth("jeeva", "s3cret")
+		req.Header.Set("X-Auth-User", "admin")
+		user, res := a.Authenticate(req)
+		assert.Nil(t, res)
+		assert.Equal(t, "jeeva", user)
+		assert.Equal(t, "jeeva", req.Header.Get("X-Auth-User"))
+		assert.Equal(t, "", req.Header.Get("Authorization"))
+	}
+}
+
+func TestAuthAPIKey(t *testing.T) {
+	a, err := newAuthenticator(&models.ProxyAuth{
+		Mode:    AuthModeAPIKey,
+		APIKeys: map[string]string{"ci": HashAPIKey("key-123")},
+	})
+	assert.Nil(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Api-Key", "key-000")
+	_, res := a.Authenticate(req)
+	assert.Equal(t, http.StatusUnauthorized, res.Status)
+
+	req.Header.Set("X-Api-Key", "key-123")
+	user, res := a.Authenticate(req)
+	assert.Nil(t, res)
+	assert.Equal(t, "ci", user)
+	assert.Equal(t, "", req.Header.Get("X-Api-Key"))
+}
+
+func TestAuthForward(t *testing.T) {
+	authSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Cookie") != "session=valid" {
+			w.Header().Set("Location", "https://login.example.com/?rd="+r.Header.Get("X-Forwarded-Uri"))
+			w.WriteHeader(http.StatusFound)
+			return
+		}
+		w.Header().Set("X-Auth-User", "jeeva")
+		w.Header().Set("X-Auth-Roles", "admin")
+		w.Header().Set("X-Internal", "secret")
+	}))
+	defer authSrv.Close()
+
+	a, err := newAuthenticator(&models.ProxyAuth{
+		Mode:           AuthModeForward,
+		ForwardURL:     authSrv.URL,
+		ForwardHeaders: []string{"X-Auth-User", "X-Auth-Roles"},
+		UserHeader:     "X-Auth-User",
+	})
+	assert.Nil(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/app?x=1", nil)
+	_, res := a.Authenticate(req)
+	assert.Equal(t, http.StatusFound, res.Status)
+	assert.Equal(t, "https://login.example.com/?rd=/app?x=1", res.Header.Get("Location"))
+
+	req = httptest.NewRequest(http.MethodGet, "/app", nil)
+	req.Header.Set("Cookie", "session=valid")
+	req.Header.Set("X-Auth-Roles", "spoofed")
+	user, res := a.Authenticate(req)
+	assert.Nil(t, res)
+	assert.Equal(t, "jeeva", user)
+	assert.Equal(t, "admin", req.Header.Get("X-Auth-Roles"))
+	assert.Equal(t, "", req.Header.Get("X-Internal"))
+
+	// auth service is down
+	authSrv.Close()
+	_, res = a.Authenticate(req)
+	assert.Equal(t, http.StatusBadGateway, res.Status)
+}
+
+func TestValidateAuth(t *testing.T) {
+	assert.Equal(t, 1, len(ValidateAuth(&models.ProxyAuth{Mode: "digest"})))
+	assert.Equal(t, 1, len(ValidateAuth(&models.ProxyAuth{Mode: AuthModeBasic, Users: map[string]string{"a": "plain"}})))
+	assert.Equal(t, 2, len(ValidateAuth(&models.ProxyAuth{Mode: AuthModeForward, ForwardURL: "/auth", ForwardTimeout: "x"})))
+	assert.Equal(t, 0, len(ValidateAuth(&models.ProxyAuth{Mode: AuthModeAPIKey, APIKeys: map[string]string{"a": HashAPIKey("k")}})))
+}
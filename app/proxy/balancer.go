@@ -0,0 +1,274 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"hash/crc32"
+	"math/rand"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"thumbai/app/access"
+
+	"aahframe.work/ahttp"
+)
+
+// Load balancer strategies
+const (
+	StrategyRoundRobin     = "round-robin"
+	StrategyWeightedRandom = "weighted-random"
+	StrategyLeastConn      = "least-conn"
+	StrategyHash           = "hash"
+)
+
+// hash ring virtual nodes per weight unit
+const hashReplicas = 40
+
+// IsSupportedStrategy method returns true if given load balancer strategy is
+// supported otherwise false. Empty value is treated as round-robin.
+func IsSupportedStrategy(strategy string) bool {
+	switch strategy {
+	case "", StrategyRoundRobin, StrategyWeightedRandom, StrategyLeastConn, StrategyHash:
+		return true
+	}
+	return false
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// Upstream type and its methods
+//______________________________________________________________________________
+
+// upstream struct represents the single target of proxy rule.
+type upstream struct {
+	Target   string
+	URL      *url.URL
+	Weight   int
+	Proxy    *httputil.ReverseProxy
+	health   *healthState
+	breaker  *circuitBreaker
+	active   int64
+	upgraded int64
+
+	// max in-flight requests, zero means unlimited
+	maxInFlight int64
+
+	// traffic split variant of the upstream, if any
+	variant *splitVariant
+
+	// metrics label values host, rule and upstream
+	labels []string
+}
+
+// Available method returns true if upstream could receive the requests
+// otherwise false.
+func (u *upstream) Available() bool {
+	return u.health.Healthy() && u.breaker.Ready() && !u.Saturated()
+}
+
+// Saturated method returns true if upstream reached the max in-flight
+// requests.
+func (u *upstream) Saturated() bool {
+	return u.maxInFlight > 0 && u.Active() >= u.maxInFlight
+}
+
+func (u *upstream) Active() int64 {
+	return atomic.LoadInt64(&u.active)
+}
+
+// Upgraded method returns the no. of active upgraded connections such as
+// WebSocket.
+func (u *upstream) Upgraded() int64 {
+	return atomic.LoadInt64(&u.upgraded)
+}
+
+func (u *upstream) acquire() {
+	atomic.AddInt64(&u.active, 1)
+}
+
+func (u *upstream) release() {
+	atomic.AddInt64(&u.active, -1)
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// Balancer types and its methods
+//______________________________________________________________________________
+
+// balancer interface picks the available upstream for the request. Value
+// `key` is used by hash strategy only.
+type balancer interface {
+	Next(key string) *upstream
+}
+
+func newBalancer(strategy string, upstreams []*upstream) balancer {
+	switch strategy {
+	case StrategyWeightedRandom:
+		return newWeightedRandom(upstreams)
+	case StrategyLeastConn:
+		return &leastConn{upstreams: upstreams}
+	case StrategyHash:
+		return newHashRing(upstreams)
+	}
+	return newRoundRobin(upstreams)
+}
+
+// roundRobin implements smooth weighted round-robin, same as nginx.
+type roundRobin struct {
+	sync.Mutex
+	upstreams []*upstream
+	current   []int
+}
+
+func newRoundRobin(upstreams []*upstream) *roundRobin {
+	return &roundRobin{upstreams: upstreams, current: make([]int, len(upstreams))}
+}
+
+func (rr *roundRobin) Next(_ string) *upstream {
+	rr.Lock()
+	defer rr.Unlock()
+	best, total := -1, 0
+	for i, u := range rr.upstreams {
+		if !u.Available() {
+			continue
+		}
+		rr.current[i] += u.Weight
+		total += u.Weight
+		if best == -1 || rr.current[i] > rr.current[best] {
+			best = i
+		}
+	}
+	if best == -1 {
+		return nil
+	}
+	rr.current[best] -= total
+	return rr.upstreams[best]
+}
+
+type weightedRandom struct {
+	sync.Mutex
+	upstreams []*upstream
+	rnd       *rand.Rand
+}
+
+func newWeightedRandom(upstreams []*upstream) *weightedRandom {
+	return &weightedRandom{upstreams: upstreams, rnd: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+func (wr *weightedRandom) Next(_ string) *upstream {
+	total := 0
+	for _, u := range wr.upstreams {
+		if u.Available() {
+			total += u.Weight
+		}
+	}
+	if total == 0 {
+		return nil
+	}
+	wr.Lock()
+	n := wr.rnd.Intn(total)
+	wr.Unlock()
+	var last *upstream
+	for _, u := range wr.upstreams {
+		if !u.Available() {
+			continue
+		}
+		if n < u.Weight {
+			return u
+		}
+		n -= u.Weight
+		last = u
+	}
+	return last
+}
+
+// leastConn picks the upstream with least active requests relative
+// to its weight.
+type leastConn struct {
+	upstreams []*upstream
+}
+
+func (lc *leastConn) Next(_ string) *upstream {
+	var best *upstream
+	for _, u := range lc.upstreams {
+		if !u.Available() {
+			continue
+		}
+		if best == nil || u.Active()*int64(best.Weight) < best.Active()*int64(u.Weight) {
+			best = u
+		}
+	}
+	return best
+}
+
+// hashRing implements the consistent hash, weight decides the no. of
+// virtual nodes on the ring.
+type hashRing struct {
+	keys  []uint32
+	nodes map[uint32]*upstream
+}
+
+func newHashRing(upstreams []*upstream) *hashRing {
+	hr := &hashRing{nodes: make(map[uint32]*upstream)}
+	for _, u := range upstreams {
+		for i := 0; i < hashReplicas*u.Weight; i++ {
+			k := crc32.ChecksumIEEE([]byte(strconv.Itoa(i) + u.Target))
+			if _, found := hr.nodes[k]; found {
+				continue
+			}
+			hr.nodes[k] = u
+			hr.keys = append(hr.keys, k)
+		}
+	}
+	sort.Slice(hr.keys, func(i, j int) bool { return hr.keys[i] < hr.keys[j] })
+	return hr
+}
+
+func (hr *hashRing) Next(key string) *upstream {
+	if len(hr.keys) == 0 {
+		return nil
+	}
+	h := crc32.ChecksumIEEE([]byte(key))
+	i := sort.Search(len(hr.keys), func(i int) bool { return hr.keys[i] >= h })
+	for j := 0; j < len(hr.keys); j++ {
+		if u := hr.nodes[hr.keys[(i+j)%len(hr.keys)]]; u.Available() {
+			return u
+		}
+	}
+	return nil
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// Unexported methods
+//______________________________________________________________________________
+
+// hashKey method returns the value from request for the given `hashOn`
+// config, defaults to client IP.
+func hashKey(req *ahttp.Request, hashOn string) string {
+	switch {
+	case strings.HasPrefix(hashOn, "header:"):
+		return req.Header.Get(strings.TrimSpace(hashOn[7:]))
+	case strings.HasPrefix(hashOn, "cookie:"):
+		if c, err := req.Cookie(strings.TrimSpace(hashOn[7:])); err == nil {
+			return c.Value
+		}
+		return ""
+	}
+	return access.ClientIP(req.Unwrap())
+}
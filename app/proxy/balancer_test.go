@@ -0,0 +1,116 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"testing"
+
+	"thumbai/app/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testUpstreams() []*upstream {
+	return []*upstream{
+		{Target: "http://127.0.0.1:8081", Weight: 3},
+		{Target: "http://127.0.0.1:8082", Weight: 1},
+	}
+}
+
+func TestBalancerRoundRobin(t *testing.T) {
+	ups := testUpstreams()
+	b := newBalancer(StrategyRoundRobin, ups)
+	counts := map[string]int{}
+	for i := 0; i < 8; i++ {
+		counts[b.Next("").Target]++
+	}
+	assert.Equal(t, 6, counts["http://127.0.0.1:8081"])
+	assert.Equal(t, 2, counts["http://127.0.0.1:8082"])
+}
+
+func TestBalancerWeightedRandom(t *testing.T) {
+	b := newBalancer(StrategyWeightedRandom, testUpstreams())
+	for i := 0; i < 20; i++ {
+		assert.NotNil(t, b.Next(""))
+	}
+}
+
+func TestBalancerLeastConn(t *testing.T) {
+	ups := testUpstreams()
+	b := newBalancer(StrategyLeastConn, ups)
+	ups[0].acquire()
+	ups[0].acquire()
+	ups[0].acquire()
+	ups[0].acquire()
+	assert.Equal(t, ups[1], b.Next(""))
+	ups[0].release()
+	ups[0].release()
+	ups[1].acquire()
+	assert.Equal(t, ups[0], b.Next(""))
+}
+
+func TestBalancerHash(t *testing.T) {
+	b := newBalancer(StrategyHash, testUpstreams())
+	for _, key := range []string{"10.0.0.1", "10.0.0.2", "user-1", "user-2"} {
+		first := b.Next(key)
+		for i := 0; i < 5; i++ {
+			assert.Equal(t, first, b.Next(key))
+		}
+	}
+}
+
+func TestRuleTargets(t *testing.T) {
+	targets := ruleTargets(&models.ProxyRule{TargetURL: "http://127.0.0.1:8081"})
+	assert.Equal(t, 1, len(targets))
+	assert.Equal(t, 1, targets[0].Weight)
+
+	targets = ruleTargets(&models.ProxyRule{
+		TargetURL: "http://127.0.0.1:8081",
+		Targets:   []*models.ProxyTarget{{URL: "http://127.0.0.1:8082", Weight: 2}},
+	})
+	assert.Equal(t, 2, len(targets))
+	assert.Equal(t, "http://127.0.0.1:8081", targets[0].URL)
+	assert.Equal(t, 2, targets[1].Weight)
+
+	targets = ruleTargets(&models.ProxyRule{
+		TargetURL: "http://127.0.0.1:8081",
+		Targets: []*models.ProxyTarget{
+			{URL: "http://127.0.0.1:8082"},
+			{URL: "http://127.0.0.1:8081", Weight: 5},
+		},
+	})
+	assert.Equal(t, 2, len(targets))
+	assert.Equal(t, 1, targets[0].Weight)
+	assert.Equal(t, 5, targets[1].Weight)
+}
+
+func TestBalancerMaxInFlight(t *testing.T) {
+	ups := testUpstreams()
+	for _, u := range ups {
+		u.maxInFlight = 1
+	}
+	r := &rule{Upstreams: ups, Balancer: newBalancer(StrategyRoundRobin, ups)}
+	ups[0].acquire()
+	assert.Equal(t, ups[1], r.Balancer.Next(""))
+	ups[1].acquire()
+	assert.Nil(t, r.Balancer.Next(""))
+
+	code, _, retryAfter := r.unavailable()
+	assert.Equal(t, 503, code)
+	assert.Equal(t, "1", retryAfter)
+
+	ups[0].release()
+	assert.Equal(t, ups[0], r.Balancer.Next(""))
+}
@@ -0,0 +1,259 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"thumbai/app/models"
+)
+
+// Circuit breaker states
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// Circuit breaker default values
+const (
+	defaultBreakerWindow      = 30 * time.Second
+	defaultBreakerOpenTimeout = 30 * time.Second
+	defaultBreakerMinRequests = 20
+	defaultBreakerProbes      = 1
+)
+
+// ValidateCircuitBreaker method validates the given circuit breaker
+// configuration and returns the field errors if any.
+func ValidateCircuitBreaker(cb *models.ProxyCircuitBreaker) map[string]string {
+	errs := map[string]string{}
+	if cb.ConsecutiveFailures < 0 {
+		errs["cbConsecutiveFailures"] = "Must be a positive number"
+	}
+	if cb.ErrorRate < 0 || cb.ErrorRate > 100 {
+		errs["cbErrorRate"] = "Must be a percentage between 1 and 100"
+	}
+	if cb.ConsecutiveFailures == 0 && cb.ErrorRate == 0 {
+		errs["cbConsecutiveFailures"] = "Either consecutive failures or error rate is required"
+	}
+	if _, err := parseDuration(cb.Window, defaultBreakerWindow); err != nil {
+		errs["cbWindow"] = "Invalid duration value, e.g.: 30s"
+	}
+	if _, err := parseDuration(cb.OpenTimeout, defaultBreakerOpenTimeout); err != nil {
+		errs["cbOpenTimeout"] = "Invalid duration value, e.g.: 30s"
+	}
+	if cb.MinRequests < 0 {
+		errs["cbMinRequests"] = "Must be a positive number"
+	}
+	if cb.HalfOpenRequests < 0 {
+		errs["cbHalfOpenRequests"] = "Must be a positive number"
+	}
+	if cb.ResponseStatus != 0 && (cb.ResponseStatus < 400 || cb.ResponseStatus > 599) {
+		errs["cbResponseStatus"] = "Must be a 4xx or 5xx status code"
+	}
+	return errs
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// Circuit breaker type and its methods
+//______________________________________________________________________________
+
+// circuitBreaker implements per upstream passive outlier detection. Failures
+// are connection errors and 5xx responses from the upstream.
+//
+//	closed    -> open      : consecutive failures or error rate in window reached
+//	open      -> half-open : open timeout elapsed, allows limited probe requests
+//	half-open -> closed    : probe requests succeeded
+//	half-open -> open      : any probe request failed
+type circuitBreaker struct {
+	sync.Mutex
+	ConsecutiveFailures int
+	ErrorRate           int
+	Window              time.Duration
+	MinRequests         int
+	OpenTimeout         time.Duration
+	Probes              int
+	ResponseStatus      int
+	ResponseBody        string
+
+	state         string
+	consecutive   int
+	windowStart   time.Time
+	total         int
+	failures      int
+	openedAt      time.Time
+	probeInflight int
+	probeSuccess  int
+	now           func() time.Time
+}
+
+func newCircuitBreaker(cb *models.ProxyCircuitBreaker) (*circuitBreaker, error) {
+	window, err := parseDuration(cb.Window, defaultBreakerWindow)
+	if err != nil {
+		return nil, err
+	}
+	openTimeout, err := parseDuration(cb.OpenTimeout, defaultBreakerOpenTimeout)
+	if err != nil {
+		return nil, err
+	}
+	b := &circuitBreaker{
+		ConsecutiveFailures: cb.ConsecutiveFailures,
+		ErrorRate:           cb.ErrorRate,
+		Window:              window,
+		MinRequests:         cb.MinRequests,
+		OpenTimeout:         openTimeout,
+		Probes:              cb.HalfOpenRequests,
+		ResponseStatus:      cb.ResponseStatus,
+		ResponseBody:        cb.ResponseBody,
+		state:               BreakerClosed,
+		now:                 time.Now,
+	}
+	if b.MinRequests <= 0 {
+		b.MinRequests = defaultBreakerMinRequests
+	}
+	if b.Probes <= 0 {
+		b.Probes = defaultBreakerProbes
+	}
+	if b.ResponseStatus == 0 {
+		b.ResponseStatus = http.StatusServiceUnavailable
+	}
+	b.windowStart = b.now()
+	return b, nil
+}
+
+// Ready method reports whether breaker could allow the request without
+// changing its state. Nil breaker is always ready.
+func (b *circuitBreaker) Ready() bool {
+	if b == nil {
+		return true
+	}
+	b.Lock()
+	defer b.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		return b.now().Sub(b.openedAt) >= b.OpenTimeout
+	case BreakerHalfOpen:
+		return b.probeInflight < b.Probes
+	}
+	return true
+}
+
+// Allow method reports whether the request could pass through, in the
+// half-open state it accounts the probe request.
+func (b *circuitBreaker) Allow() bool {
+	if b == nil {
+		return true
+	}
+	b.Lock()
+	defer b.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.OpenTimeout {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.probeInflight, b.probeSuccess = 0, 0
+		fallthrough
+	case BreakerHalfOpen:
+		if b.probeInflight >= b.Probes {
+			return false
+		}
+		b.probeInflight++
+	}
+	return true
+}
+
+// Record method records the upstream request result. It returns true if
+// the breaker state got changed.
+func (b *circuitBreaker) Record(success bool) bool {
+	if b == nil {
+		return false
+	}
+	b.Lock()
+	defer b.Unlock()
+	prev := b.state
+	switch b.state {
+	case BreakerHalfOpen:
+		if b.probeInflight > 0 {
+			b.probeInflight--
+		}
+		if !success {
+			b.trip()
+			break
+		}
+		b.probeSuccess++
+		if b.probeSuccess >= b.Probes {
+			b.reset()
+		}
+	case BreakerClosed:
+		now := b.now()
+		if now.Sub(b.windowStart) > b.Window {
+			b.windowStart, b.total, b.failures = now, 0, 0
+		}
+		b.total++
+		if success {
+			b.consecutive = 0
+			break
+		}
+		b.failures++
+		b.consecutive++
+		if (b.ConsecutiveFailures > 0 && b.consecutive >= b.ConsecutiveFailures) ||
+			(b.ErrorRate > 0 && b.total >= b.MinRequests && b.failures*100 >= b.ErrorRate*b.total) {
+			b.trip()
+		}
+	}
+	return prev != b.state
+}
+
+// Cancel method releases the half-open probe slot of the request which
+// didn't produce the result, e.g. client went away.
+func (b *circuitBreaker) Cancel() {
+	if b == nil {
+		return
+	}
+	b.Lock()
+	defer b.Unlock()
+	if b.state == BreakerHalfOpen && b.probeInflight > 0 {
+		b.probeInflight--
+	}
+}
+
+// State method returns the current breaker state, open breaker reports
+// half-open once the open timeout elapsed.
+func (b *circuitBreaker) State() string {
+	if b == nil {
+		return ""
+	}
+	b.Lock()
+	defer b.Unlock()
+	if b.state == BreakerOpen && b.now().Sub(b.openedAt) >= b.OpenTimeout {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+func (b *circuitBreaker) trip() {
+	b.state = BreakerOpen
+	b.openedAt = b.now()
+	b.probeInflight, b.probeSuccess = 0, 0
+}
+
+func (b *circuitBreaker) reset() {
+	b.state = BreakerClosed
+	b.consecutive, b.total, b.failures = 0, 0, 0
+	b.windowStart = b.now()
+}
@@ -0,0 +1,103 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"thumbai/app/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreakerConsecutiveFailures(t *testing.T) {
+	b, err := newCircuitBreaker(&models.ProxyCircuitBreaker{ConsecutiveFailures: 3, OpenTimeout: "10s"})
+	assert.Nil(t, err)
+	now := time.Now()
+	b.now = func() time.Time { return now }
+	assert.Equal(t, http.StatusServiceUnavailable, b.ResponseStatus)
+
+	assert.False(t, b.Record(false))
+	assert.False(t, b.Record(false))
+	assert.False(t, b.Record(true))
+	assert.False(t, b.Record(false))
+	assert.False(t, b.Record(false))
+	assert.True(t, b.Record(false))
+	assert.Equal(t, BreakerOpen, b.State())
+	assert.False(t, b.Ready())
+	assert.False(t, b.Allow())
+
+	// half-open allows one probe at a time
+	now = now.Add(11 * time.Second)
+	assert.Equal(t, BreakerHalfOpen, b.State())
+	assert.True(t, b.Allow())
+	assert.False(t, b.Allow())
+	assert.True(t, b.Record(false))
+	assert.Equal(t, BreakerOpen, b.State())
+
+	now = now.Add(11 * time.Second)
+	assert.True(t, b.Allow())
+	assert.True(t, b.Record(true))
+	assert.Equal(t, BreakerClosed, b.State())
+	assert.True(t, b.Ready())
+}
+
+func TestCircuitBreakerErrorRate(t *testing.T) {
+	b, err := newCircuitBreaker(&models.ProxyCircuitBreaker{ErrorRate: 50, MinRequests: 4, Window: "1m"})
+	assert.Nil(t, err)
+	now := time.Now()
+	b.now = func() time.Time { return now }
+
+	b.Record(true)
+	b.Record(false)
+	b.Record(true)
+	assert.Equal(t, BreakerClosed, b.State())
+	assert.True(t, b.Record(false))
+	assert.Equal(t, BreakerOpen, b.State())
+
+	// window resets the counts
+	b.reset()
+	b.Record(false)
+	b.Record(false)
+	now = now.Add(2 * time.Minute)
+	b.Record(false)
+	b.Record(true)
+	assert.Equal(t, BreakerClosed, b.State())
+}
+
+func TestCircuitBreakerCancel(t *testing.T) {
+	b, _ := newCircuitBreaker(&models.ProxyCircuitBreaker{ConsecutiveFailures: 1, OpenTimeout: "1s"})
+	now := time.Now()
+	b.now = func() time.Time { return now }
+	b.Record(false)
+	now = now.Add(2 * time.Second)
+	assert.True(t, b.Allow())
+	assert.False(t, b.Ready())
+	b.Cancel()
+	assert.True(t, b.Ready())
+}
+
+func TestValidateCircuitBreaker(t *testing.T) {
+	errs := ValidateCircuitBreaker(&models.ProxyCircuitBreaker{})
+	assert.NotEqual(t, "", errs["cbConsecutiveFailures"])
+
+	errs = ValidateCircuitBreaker(&models.ProxyCircuitBreaker{ErrorRate: 120, Window: "abc", ResponseStatus: 200})
+	assert.Equal(t, 3, len(errs))
+
+	errs = ValidateCircuitBreaker(&models.ProxyCircuitBreaker{ConsecutiveFailures: 5, OpenTimeout: "30s"})
+	assert.Equal(t, 0, len(errs))
+}
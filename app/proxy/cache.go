@@ -0,0 +1,567 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"thumbai/app/models"
+)
+
+// Cache storage types
+const (
+	CacheStorageMemory = "memory"
+	CacheStorageDisk   = "disk"
+)
+
+// Cache default values
+const (
+	defaultCacheMaxSize      = 64 << 20 // 64MB
+	defaultCacheMaxEntrySize = 8 << 20  // 8MB
+	headerXCache             = "X-Cache"
+)
+
+type revalidateCtxKey struct{}
+
+// ValidateCache method validates the given cache configuration and returns
+// the field errors if any.
+func ValidateCache(c *models.ProxyCache) map[string]string {
+	errs := map[string]string{}
+	switch c.Storage {
+	case "", CacheStorageMemory:
+	case CacheStorageDisk:
+		if len(c.Dir) == 0 || !filepath.IsAbs(c.Dir) {
+			errs["cacheDir"] = "Absolute directory path is required for disk storage"
+		}
+	default:
+		errs["cacheStorage"] = "Unsupported storage"
+	}
+	if c.MaxSize < 0 {
+		errs["cacheMaxSize"] = "Must be a positive number"
+	}
+	if c.MaxEntrySize < 0 {
+		errs["cacheMaxEntrySize"] = "Must be a positive number"
+	}
+	if _, err := parseDuration(c.StaleWhileRevalidate, 0); err != nil {
+		errs["cacheStaleWhileRevalidate"] = "Invalid duration value, e.g.: 30s"
+	}
+	if _, err := parseDuration(c.StaleIfError, 0); err != nil {
+		errs["cacheStaleIfError"] = "Invalid duration value, e.g.: 5m"
+	}
+	return errs
+}
+
+// PurgeCache method purges the cached responses of all the proxy rules on
+// the host. Path value `{regex}` is treated as regex otherwise path prefix,
+// empty path purges all. It returns the count of purged entries.
+func PurgeCache(hostName, path string) (int, error) {
+	match := func(string) bool { return true }
+	pl := len(path)
+	if pl > 1 && path[0] == '{' && path[pl-1] == '}' {
+		regex, err := regexp.Compile(path[1 : pl-1])
+		if err != nil {
+			return 0, err
+		}
+		match = regex.MatchString
+	} else if pl > 0 {
+		match = func(p string) bool { return strings.HasPrefix(p, path) }
+	}
+
+	h := Thumbai.Lookup(hostName)
+	if h == nil {
+		return 0, errors.New("proxy host not found")
+	}
+	h.RLock()
+	defer h.RUnlock()
+	rules := h.ProxyRules
+	if h.LastRule != nil {
+		rules = append(append([]*rule{}, rules...), h.LastRule)
+	}
+	cnt := 0
+	for _, r := range rules {
+		if r.Cache != nil {
+			cnt += r.Cache.Purge(match)
+		}
+	}
+	return cnt, nil
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// Response cache type and its methods
+//______________________________________________________________________________
+
+// responseCache is the HTTP cache of the proxy rule, it honors the
+// `Cache-Control`, `Expires` and `Vary` headers and revalidates the stale
+// responses with `ETag` and `Last-Modified`.
+type responseCache struct {
+	sync.Mutex
+	store                *cacheStore
+	MaxEntrySize         int64
+	StaleWhileRevalidate time.Duration
+	StaleIfError         time.Duration
+	vary                 map[string][]string
+	revalidating         map[string]bool
+	now                  func() time.Time
+}
+
+func newResponseCache(hostName, targetURL string, c *models.ProxyCache) (*responseCache, error) {
+	swr, err := parseDuration(c.StaleWhileRevalidate, 0)
+	if err != nil {
+		return nil, err
+	}
+	sie, err := parseDuration(c.StaleIfError, 0)
+	if err != nil {
+		return nil, err
+	}
+	maxSize := c.MaxSize
+	if maxSize <= 0 {
+		maxSize = defaultCacheMaxSize
+	}
+
+	var dir string
+	if c.Storage == CacheStorageDisk {
+		// every rule gets its own sub directory
+		dir = filepath.Join(c.Dir, fmt.Sprintf("%08x", crc32.ChecksumIEEE([]byte(hostName+"|"+targetURL))))
+	}
+	store, err := newCacheStore(dir, maxSize)
+	if err != nil {
+		return nil, err
+	}
+
+	rc := &responseCache{
+		store:                store,
+		MaxEntrySize:         c.MaxEntrySize,
+		StaleWhileRevalidate: swr,
+		StaleIfError:         sie,
+		vary:                 make(map[string][]string),
+		revalidating:         make(map[string]bool),
+		now:                  time.Now,
+	}
+	if rc.MaxEntrySize <= 0 {
+		rc.MaxEntrySize = defaultCacheMaxEntrySize
+	}
+	for _, item := range store.Items() {
+		if len(item.vary) > 0 {
+			rc.vary[item.base] = item.vary
+		}
+	}
+	return rc, nil
+}
+
+// Cacheable method returns true if request could be served from cache.
+func (rc *responseCache) Cacheable(req *http.Request) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	if len(upgradeType(req.Header)) > 0 {
+		return false
+	}
+	_, noStore := parseCacheControl(req.Header.Get("Cache-Control"))["no-store"]
+	return !noStore
+}
+
+// Purge method deletes the cached responses matching the request path.
+func (rc *responseCache) Purge(match func(path string) bool) int {
+	return rc.store.Purge(match)
+}
+
+// Serve method serves the request from cache if it's fresh, otherwise
+// fetches it via `next` and caches the response.
+func (rc *responseCache) Serve(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	base := cacheKey(req)
+	entry := rc.lookup(base, req)
+	if entry != nil && !noCacheRequest(req) {
+		now := rc.now()
+		if now.Before(entry.Expires) {
+			rc.write(w, req, entry, "HIT")
+			return
+		}
+		if now.Before(entry.Expires.Add(entry.StaleWhileRevalidate)) {
+			rc.write(w, req, entry, "STALE")
+			rc.revalidate(base, req, entry, next)
+			return
+		}
+	}
+	rc.fetch(w, req, base, entry, next)
+}
+
+func (rc *responseCache) fetch(w http.ResponseWriter, req *http.Request, base string, entry *cacheEntry, next http.HandlerFunc) {
+	cw := &cacheWriter{w: w, header: make(http.Header), maxSize: rc.MaxEntrySize, now: rc.now}
+	outreq := req
+	if entry != nil {
+		cw.stale = entry
+		if len(req.Header.Get("If-None-Match")) == 0 && len(req.Header.Get("If-Modified-Since")) == 0 {
+			etag, lastModified := entry.Header.Get("ETag"), entry.Header.Get("Last-Modified")
+			if len(etag) > 0 || len(lastModified) > 0 {
+				outreq = req.WithContext(req.Context())
+				outreq.Header = req.Header.Clone()
+				if len(etag) > 0 {
+					outreq.Header.Set("If-None-Match", etag)
+				}
+				if len(lastModified) > 0 {
+					outreq.Header.Set("If-Modified-Since", lastModified)
+				}
+				cw.validating = true
+			}
+		}
+	}
+
+	next(cw, outreq)
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	switch {
+	case cw.absorbed && cw.status == http.StatusNotModified:
+		refreshed := *entry
+		refreshed.Header = entry.Header.Clone()
+		for _, k := range []string{"Cache-Control", "Date", "Expires", "ETag", "Last-Modified", "Vary"} {
+			if v := cw.header.Get(k); len(v) > 0 {
+				refreshed.Header.Set(k, v)
+			}
+		}
+		if ttl, swr, sie, ok := rc.policy(req, refreshed.Status, refreshed.Header); ok {
+			refreshed.Stored, refreshed.Expires = rc.now(), rc.now().Add(ttl)
+			refreshed.StaleWhileRevalidate, refreshed.StaleIfError = swr, sie
+			rc.store.Set(&refreshed)
+		} else {
+			rc.store.Del(refreshed.Key)
+		}
+		rc.write(w, req, &refreshed, "REVALIDATED")
+	case cw.absorbed:
+		rc.write(w, req, entry, "STALE")
+	case cw.capture && req.Method == http.MethodGet:
+		rc.set(base, req, cw)
+	}
+}
+
+func (rc *responseCache) set(base string, req *http.Request, cw *cacheWriter) {
+	ttl, swr, sie, ok := rc.policy(req, cw.status, cw.header)
+	if !ok {
+		return
+	}
+	var vary []string
+	for _, v := range cw.header[http.CanonicalHeaderKey("Vary")] {
+		for _, h := range strings.Split(v, ",") {
+			if h = http.CanonicalHeaderKey(strings.TrimSpace(h)); len(h) > 0 {
+				vary = append(vary, h)
+			}
+		}
+	}
+	sort.Strings(vary)
+
+	rc.Lock()
+	if len(vary) > 0 {
+		rc.vary[base] = vary
+	} else {
+		delete(rc.vary, base)
+	}
+	rc.Unlock()
+
+	now := rc.now()
+	hdr := cw.header.Clone()
+	hdr.Del(headerXCache)
+	rc.store.Set(&cacheEntry{
+		Key:                  base + varySuffix(vary, req),
+		Base:                 base,
+		Path:                 req.URL.Path,
+		Vary:                 vary,
+		Status:               cw.status,
+		Header:               hdr,
+		Body:                 cw.body.Bytes(),
+		Stored:               now,
+		Expires:              now.Add(ttl),
+		StaleWhileRevalidate: swr,
+		StaleIfError:         sie,
+	})
+}
+
+func (rc *responseCache) lookup(base string, req *http.Request) *cacheEntry {
+	rc.Lock()
+	vary := rc.vary[base]
+	rc.Unlock()
+	return rc.store.Get(base + varySuffix(vary, req))
+}
+
+// revalidate method refreshes the stale entry in the background, once at
+// a time per entry.
+func (rc *responseCache) revalidate(base string, req *http.Request, entry *cacheEntry, next http.HandlerFunc) {
+	rc.Lock()
+	if rc.revalidating[entry.Key] {
+		rc.Unlock()
+		return
+	}
+	rc.revalidating[entry.Key] = true
+	rc.Unlock()
+
+	bgreq := req.WithContext(context.WithValue(context.Background(), revalidateCtxKey{}, true))
+	bgreq.Header = req.Header.Clone()
+	go func() {
+		defer func() {
+			rc.Lock()
+			delete(rc.revalidating, entry.Key)
+			rc.Unlock()
+		}()
+		rc.fetch(httptest.NewRecorder(), bgreq, base, entry, next)
+	}()
+}
+
+// revalidation method reports whether the request is the background
+// revalidation of stale entry, it's fetched after the client request is
+// served.
+func revalidation(req *http.Request) bool {
+	v, _ := req.Context().Value(revalidateCtxKey{}).(bool)
+	return v
+}
+
+func (rc *responseCache) write(w http.ResponseWriter, req *http.Request, entry *cacheEntry, status string) {
+	hdr := w.Header()
+	for k, v := range entry.Header {
+		hdr[k] = v
+	}
+	hdr.Set(headerXCache, status)
+	hdr.Set("Age", strconv.Itoa(int(rc.now().Sub(entry.Stored).Seconds())))
+	if notModified(req, entry) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(entry.Status)
+	if req.Method != http.MethodHead {
+		_, _ = w.Write(entry.Body)
+	}
+}
+
+// policy method returns the freshness lifetime, stale-while-revalidate and
+// stale-if-error duration of the response if it's cacheable.
+func (rc *responseCache) policy(req *http.Request, status int, hdr http.Header) (time.Duration, time.Duration, time.Duration, bool) {
+	switch status {
+	case http.StatusOK, http.StatusNonAuthoritativeInfo, http.StatusNoContent,
+		http.StatusMovedPermanently, http.StatusNotFound, http.StatusGone:
+	default:
+		return 0, 0, 0, false
+	}
+	if len(hdr.Get("Set-Cookie")) > 0 || strings.Contains(hdr.Get("Vary"), "*") {
+		return 0, 0, 0, false
+	}
+	cc := parseCacheControl(hdr.Get("Cache-Control"))
+	if _, found := cc["no-store"]; found {
+		return 0, 0, 0, false
+	}
+	if _, found := cc["private"]; found {
+		return 0, 0, 0, false
+	}
+	_, public := cc["public"]
+	sMaxAge, hasSMaxAge := cc["s-maxage"]
+	if len(req.Header.Get("Authorization")) > 0 && !public && !hasSMaxAge {
+		return 0, 0, 0, false
+	}
+
+	var ttl time.Duration
+	explicit := true
+	if _, found := cc["no-cache"]; found {
+		ttl = 0
+	} else if hasSMaxAge {
+		ttl = parseSeconds(sMaxAge)
+	} else if maxAge, found := cc["max-age"]; found {
+		ttl = parseSeconds(maxAge)
+	} else if expires := hdr.Get("Expires"); len(expires) > 0 {
+		date := rc.now()
+		if d, err := http.ParseTime(hdr.Get("Date")); err == nil {
+			date = d
+		}
+		if t, err := http.ParseTime(expires); err == nil && t.After(date) {
+			ttl = t.Sub(date)
+		}
+	} else {
+		explicit = false
+	}
+	hasValidator := len(hdr.Get("ETag")) > 0 || len(hdr.Get("Last-Modified")) > 0
+	if !explicit || (ttl == 0 && !hasValidator) {
+		return 0, 0, 0, false
+	}
+
+	swr, sie := rc.StaleWhileRevalidate, rc.StaleIfError
+	if v, found := cc["stale-while-revalidate"]; found {
+		swr = parseSeconds(v)
+	}
+	if v, found := cc["stale-if-error"]; found {
+		sie = parseSeconds(v)
+	}
+	if _, found := cc["must-revalidate"]; found {
+		swr, sie = 0, 0
+	}
+	return ttl, swr, sie, true
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// Cache writer type and its methods
+//______________________________________________________________________________
+
+// cacheWriter passes through the upstream response to the client while
+// capturing it for cache. It absorbs the response of conditional revalidate
+// request and the error response when stale entry could be served instead.
+type cacheWriter struct {
+	w           http.ResponseWriter
+	header      http.Header
+	status      int
+	wroteHeader bool
+	validating  bool
+	absorbed    bool
+	capture     bool
+	stale       *cacheEntry
+	body        bytes.Buffer
+	maxSize     int64
+	now         func() time.Time
+}
+
+func (cw *cacheWriter) Header() http.Header {
+	return cw.header
+}
+
+func (cw *cacheWriter) WriteHeader(code int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader, cw.status = true, code
+	if code == http.StatusNotModified && cw.validating {
+		cw.absorbed = true
+		return
+	}
+	if code >= http.StatusInternalServerError && cw.stale != nil &&
+		cw.now().Before(cw.stale.Expires.Add(cw.stale.StaleIfError)) {
+		cw.absorbed = true
+		return
+	}
+	hdr := cw.w.Header()
+	for k, v := range cw.header {
+		hdr[k] = v
+	}
+	hdr.Set(headerXCache, "MISS")
+	cw.w.WriteHeader(code)
+	cw.capture = true
+}
+
+func (cw *cacheWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.absorbed {
+		return len(b), nil
+	}
+	if cw.capture {
+		if int64(cw.body.Len()+len(b)) > cw.maxSize {
+			cw.capture = false
+			cw.body = bytes.Buffer{}
+		} else {
+			cw.body.Write(b)
+		}
+	}
+	return cw.w.Write(b)
+}
+
+func (cw *cacheWriter) Flush() {
+	if f, ok := cw.w.(http.Flusher); ok && !cw.absorbed {
+		f.Flush()
+	}
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// Unexported methods
+//______________________________________________________________________________
+
+func cacheKey(req *http.Request) string {
+	return strings.ToLower(req.Host) + req.URL.RequestURI()
+}
+
+func varySuffix(vary []string, req *http.Request) string {
+	if len(vary) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	for _, h := range vary {
+		sb.WriteString("\x00" + h + "=" + strings.Join(req.Header[h], ","))
+	}
+	return sb.String()
+}
+
+func noCacheRequest(req *http.Request) bool {
+	if _, found := parseCacheControl(req.Header.Get("Cache-Control"))["no-cache"]; found {
+		return true
+	}
+	return strings.Contains(strings.ToLower(req.Header.Get("Pragma")), "no-cache")
+}
+
+// notModified method reports whether client's conditional request matches
+// the cached entry.
+func notModified(req *http.Request, entry *cacheEntry) bool {
+	if entry.Status != http.StatusOK {
+		return false
+	}
+	if inm := req.Header.Get("If-None-Match"); len(inm) > 0 {
+		etag := entry.Header.Get("ETag")
+		if len(etag) == 0 {
+			return false
+		}
+		for _, t := range strings.Split(inm, ",") {
+			if t = strings.TrimSpace(t); t == "*" || strings.TrimPrefix(t, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+	if ims, err := http.ParseTime(req.Header.Get("If-Modified-Since")); err == nil {
+		if lm, err := http.ParseTime(entry.Header.Get("Last-Modified")); err == nil {
+			return !lm.After(ims)
+		}
+	}
+	return false
+}
+
+func parseCacheControl(v string) map[string]string {
+	cc := make(map[string]string)
+	for _, d := range strings.Split(v, ",") {
+		d = strings.TrimSpace(d)
+		if len(d) == 0 {
+			continue
+		}
+		if i := strings.IndexByte(d, '='); i > -1 {
+			cc[strings.ToLower(strings.TrimSpace(d[:i]))] = strings.Trim(strings.TrimSpace(d[i+1:]), `"`)
+		} else {
+			cc[strings.ToLower(d)] = ""
+		}
+	}
+	return cc
+}
+
+func parseSeconds(v string) time.Duration {
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return time.Duration(n) * time.Second
+}
@@ -0,0 +1,269 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha1"
+	"encoding/gob"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const cacheFileExt = ".cache"
+
+// cacheEntry is the stored upstream response.
+type cacheEntry struct {
+	Key                  string
+	Base                 string
+	Path                 string
+	Vary                 []string
+	Status               int
+	Header               http.Header
+	Body                 []byte
+	Stored               time.Time
+	Expires              time.Time
+	StaleWhileRevalidate time.Duration
+	StaleIfError         time.Duration
+}
+
+func (e *cacheEntry) size() int64 {
+	n := int64(len(e.Body) + len(e.Key) + len(e.Path))
+	for k, vv := range e.Header {
+		n += int64(len(k))
+		for _, v := range vv {
+			n += int64(len(v))
+		}
+	}
+	return n
+}
+
+// cacheItem is the LRU index item, entry is nil for disk storage.
+type cacheItem struct {
+	key   string
+	base  string
+	path  string
+	vary  []string
+	size  int64
+	entry *cacheEntry
+}
+
+// cacheStore is the size bounded LRU store of cache entries. Entries are
+// kept in memory, or on disk when `dir` is set and only the index is kept
+// in memory.
+type cacheStore struct {
+	sync.Mutex
+	dir     string
+	maxSize int64
+	size    int64
+	ll      *list.List
+	items   map[string]*list.Element
+}
+
+func newCacheStore(dir string, maxSize int64) (*cacheStore, error) {
+	s := &cacheStore{
+		dir:     dir,
+		maxSize: maxSize,
+		ll:      list.New(),
+		items:   make(map[string]*list.Element),
+	}
+	if len(dir) == 0 {
+		return s, nil
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return s, s.load()
+}
+
+// Get method returns the cache entry for the key otherwise nil.
+func (s *cacheStore) Get(key string) *cacheEntry {
+	s.Lock()
+	el, found := s.items[key]
+	if !found {
+		s.Unlock()
+		return nil
+	}
+	s.ll.MoveToFront(el)
+	item := el.Value.(*cacheItem)
+	s.Unlock()
+	if item.entry != nil {
+		return item.entry
+	}
+	e, err := s.readFile(key)
+	if err != nil {
+		s.Del(key)
+		return nil
+	}
+	return e
+}
+
+// Set method stores the entry and evicts the least recently used entries
+// beyond max size.
+func (s *cacheStore) Set(e *cacheEntry) {
+	item := &cacheItem{key: e.Key, base: e.Base, path: e.Path, vary: e.Vary, size: e.size()}
+	if item.size > s.maxSize {
+		return
+	}
+	if len(s.dir) == 0 {
+		item.entry = e
+	} else if err := s.writeFile(e); err != nil {
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	if el, found := s.items[e.Key]; found {
+		s.size -= el.Value.(*cacheItem).size
+		s.ll.Remove(el)
+	}
+	s.items[e.Key] = s.ll.PushFront(item)
+	s.size += item.size
+	for s.size > s.maxSize {
+		s.remove(s.ll.Back())
+	}
+}
+
+// Del method deletes the cache entry for the key.
+func (s *cacheStore) Del(key string) {
+	s.Lock()
+	defer s.Unlock()
+	if el, found := s.items[key]; found {
+		s.remove(el)
+	}
+}
+
+// Purge method deletes the cache entries whose request path matches and
+// returns the count of purged entries.
+func (s *cacheStore) Purge(match func(path string) bool) int {
+	s.Lock()
+	defer s.Unlock()
+	cnt := 0
+	for _, el := range s.items {
+		if match(el.Value.(*cacheItem).path) {
+			s.remove(el)
+			cnt++
+		}
+	}
+	return cnt
+}
+
+// Stats method returns the count and total size of cache entries.
+func (s *cacheStore) Stats() (int, int64) {
+	s.Lock()
+	defer s.Unlock()
+	return len(s.items), s.size
+}
+
+// Items method returns the index items of the store, used to rebuild the
+// vary index.
+func (s *cacheStore) Items() []*cacheItem {
+	s.Lock()
+	defer s.Unlock()
+	items := make([]*cacheItem, 0, len(s.items))
+	for _, el := range s.items {
+		items = append(items, el.Value.(*cacheItem))
+	}
+	return items
+}
+
+func (s *cacheStore) remove(el *list.Element) {
+	item := el.Value.(*cacheItem)
+	s.ll.Remove(el)
+	delete(s.items, item.key)
+	s.size -= item.size
+	if len(s.dir) > 0 {
+		_ = os.Remove(s.filename(item.key))
+	}
+}
+
+func (s *cacheStore) filename(key string) string {
+	h := sha1.Sum([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(h[:])+cacheFileExt)
+}
+
+func (s *cacheStore) readFile(key string) (*cacheEntry, error) {
+	b, err := ioutil.ReadFile(s.filename(key))
+	if err != nil {
+		return nil, err
+	}
+	e := &cacheEntry{}
+	if err = gob.NewDecoder(bytes.NewReader(b)).Decode(e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (s *cacheStore) writeFile(e *cacheEntry) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(e); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(s.dir, "tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(buf.Bytes()); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.filename(e.Key))
+}
+
+// load method rebuilds the index from the cache files on disk, most
+// recently modified files are kept when it exceeds max size.
+func (s *cacheStore) load() error {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime().After(files[j].ModTime()) })
+	for _, f := range files {
+		fpath := filepath.Join(s.dir, f.Name())
+		if f.IsDir() {
+			continue
+		}
+		if !strings.HasSuffix(f.Name(), cacheFileExt) {
+			_ = os.Remove(fpath) // leftover temp files
+			continue
+		}
+		b, err := ioutil.ReadFile(fpath)
+		if err != nil {
+			continue
+		}
+		e := &cacheEntry{}
+		if err = gob.NewDecoder(bytes.NewReader(b)).Decode(e); err != nil || s.size+e.size() > s.maxSize {
+			_ = os.Remove(fpath)
+			continue
+		}
+		item := &cacheItem{key: e.Key, base: e.Base, path: e.Path, vary: e.Vary, size: e.size()}
+		s.items[e.Key] = s.ll.PushBack(item)
+		s.size += item.size
+	}
+	return nil
+}
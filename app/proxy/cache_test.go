@@ -0,0 +1,194 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"thumbai/app/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func cacheGet(rc *responseCache, path string, hdr map[string]string, next http.HandlerFunc) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "http://example.com"+path, nil)
+	for k, v := range hdr {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	rc.Serve(w, req, next)
+	return w
+}
+
+func TestResponseCacheHitAndMiss(t *testing.T) {
+	rc, err := newResponseCache("example.com", "http://127.0.0.1:8080", &models.ProxyCache{})
+	assert.Nil(t, err)
+	calls := 0
+	next := func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = w.Write([]byte("hello"))
+	}
+
+	w := cacheGet(rc, "/a", nil, next)
+	assert.Equal(t, "MISS", w.Header().Get(headerXCache))
+	assert.Equal(t, "hello", w.Body.String())
+
+	w = cacheGet(rc, "/a", nil, next)
+	assert.Equal(t, "HIT", w.Header().Get(headerXCache))
+	assert.Equal(t, "hello", w.Body.String())
+	assert.Equal(t, 1, calls)
+
+	// request no-cache bypasses fresh entry
+	cacheGet(rc, "/a", map[string]string{"Cache-Control": "no-cache"}, next)
+	assert.Equal(t, 2, calls)
+
+	// purge by prefix
+	assert.Equal(t, 0, rc.Purge(func(p string) bool { return strings.HasPrefix(p, "/b") }))
+	assert.Equal(t, 1, rc.Purge(func(p string) bool { return strings.HasPrefix(p, "/a") }))
+	cacheGet(rc, "/a", nil, next)
+	assert.Equal(t, 3, calls)
+}
+
+func TestResponseCacheNotCacheable(t *testing.T) {
+	rc, _ := newResponseCache("example.com", "http://127.0.0.1:8080", &models.ProxyCache{})
+	calls := 0
+	for _, cc := range []string{"no-store", "private, max-age=60", ""} {
+		next := func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if len(cc) > 0 {
+				w.Header().Set("Cache-Control", cc)
+			}
+			_, _ = w.Write([]byte("hello"))
+		}
+		cacheGet(rc, "/", nil, next)
+		w := cacheGet(rc, "/", nil, next)
+		assert.Equal(t, "MISS", w.Header().Get(headerXCache))
+	}
+	assert.Equal(t, 6, calls)
+}
+
+func TestResponseCacheRevalidateAndStale(t *testing.T) {
+	rc, _ := newResponseCache("example.com", "http://127.0.0.1:8080", &models.ProxyCache{StaleIfError: "1m"})
+	now := time.Now()
+	rc.now = func() time.Time { return now }
+
+	status := http.StatusOK
+	next := func(w http.ResponseWriter, r *http.Request) {
+		if status == http.StatusOK && r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Cache-Control", "max-age=10")
+		w.Header().Set("ETag", `"v1"`)
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("body"))
+	}
+
+	cacheGet(rc, "/r", nil, next)
+	now = now.Add(20 * time.Second)
+	w := cacheGet(rc, "/r", nil, next)
+	assert.Equal(t, "REVALIDATED", w.Header().Get(headerXCache))
+	assert.Equal(t, "body", w.Body.String())
+
+	w = cacheGet(rc, "/r", map[string]string{"If-None-Match": `"v1"`}, next)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	now = now.Add(20 * time.Second)
+	status = http.StatusBadGateway
+	w = cacheGet(rc, "/r", nil, next)
+	assert.Equal(t, "STALE", w.Header().Get(headerXCache))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "body", w.Body.String())
+
+	now = now.Add(2 * time.Minute)
+	w = cacheGet(rc, "/r", nil, next)
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+}
+
+func TestResponseCacheBackgroundRevalidation(t *testing.T) {
+	rc, _ := newResponseCache("example.com", "http://127.0.0.1:8080", &models.ProxyCache{StaleWhileRevalidate: "1m"})
+	now := time.Now()
+	rc.now = func() time.Time { return now }
+
+	fetched := make(chan bool, 1)
+	next := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=10")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("body"))
+		fetched <- revalidation(r)
+	}
+
+	cacheGet(rc, "/r", nil, next)
+	assert.False(t, <-fetched)
+	now = now.Add(20 * time.Second)
+	w := cacheGet(rc, "/r", nil, next)
+	assert.Equal(t, "STALE", w.Header().Get(headerXCache))
+	assert.True(t, <-fetched)
+}
+
+func TestResponseCacheVary(t *testing.T) {
+	rc, _ := newResponseCache("example.com", "http://127.0.0.1:8080", &models.ProxyCache{})
+	next := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Language")
+		_, _ = w.Write([]byte(r.Header.Get("Accept-Language")))
+	}
+
+	cacheGet(rc, "/v", map[string]string{"Accept-Language": "en"}, next)
+	cacheGet(rc, "/v", map[string]string{"Accept-Language": "fr"}, next)
+	w := cacheGet(rc, "/v", map[string]string{"Accept-Language": "en"}, next)
+	assert.Equal(t, "HIT", w.Header().Get(headerXCache))
+	assert.Equal(t, "en", w.Body.String())
+	w = cacheGet(rc, "/v", map[string]string{"Accept-Language": "fr"}, next)
+	assert.Equal(t, "HIT", w.Header().Get(headerXCache))
+	assert.Equal(t, "fr", w.Body.String())
+}
+
+func TestCacheStoreDiskAndEviction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "thumbai-cache")
+	assert.Nil(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	s, err := newCacheStore(dir, 1024)
+	assert.Nil(t, err)
+	s.Set(&cacheEntry{Key: "a", Path: "/a", Status: http.StatusOK, Body: make([]byte, 500)})
+	s.Set(&cacheEntry{Key: "b", Path: "/b", Status: http.StatusOK, Body: make([]byte, 500)})
+	assert.NotNil(t, s.Get("a"))
+	s.Set(&cacheEntry{Key: "c", Path: "/c", Status: http.StatusOK, Body: make([]byte, 500)})
+	assert.Nil(t, s.Get("b")) // least recently used
+	cnt, _ := s.Stats()
+	assert.Equal(t, 2, cnt)
+
+	// index is rebuilt from disk
+	s, err = newCacheStore(dir, 1024)
+	assert.Nil(t, err)
+	cnt, _ = s.Stats()
+	assert.Equal(t, 2, cnt)
+	assert.Equal(t, 500, len(s.Get("c").Body))
+}
+
+func TestValidateCache(t *testing.T) {
+	errs := ValidateCache(&models.ProxyCache{Storage: "disk", StaleIfError: "abc"})
+	assert.Equal(t, 2, len(errs))
+	errs = ValidateCache(&models.ProxyCache{Storage: "memory", StaleWhileRevalidate: "30s"})
+	assert.Equal(t, 0, len(errs))
+}
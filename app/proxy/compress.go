@@ -0,0 +1,280 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"thumbai/app/models"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Compression encodings
+const (
+	EncodingBrotli = "br"
+	EncodingGzip   = "gzip"
+)
+
+// Compression default values
+const (
+	defaultCompressMinSize = 1024
+	brotliLevel            = 4
+)
+
+var defaultCompressTypes = []string{
+	"text/*",
+	"application/javascript",
+	"application/json",
+	"application/xml",
+	"application/rss+xml",
+	"application/atom+xml",
+	"image/svg+xml",
+}
+
+// ValidateCompress method validates the given compression configuration and
+// returns the field errors if any.
+func ValidateCompress(c *models.ProxyCompress) map[string]string {
+	errs := map[string]string{}
+	for _, e := range c.Encodings {
+		if e != EncodingBrotli && e != EncodingGzip {
+			errs["compressEncodings"] = "Supported encodings are br and gzip"
+		}
+	}
+	for _, t := range c.Types {
+		if strings.Count(t, "/") != 1 {
+			errs["compressTypes"] = "Invalid MIME type: " + t
+		}
+	}
+	if c.MinSize < 0 {
+		errs["compressMinSize"] = "Must be a positive number"
+	}
+	return errs
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// Compress policy type and its methods
+//______________________________________________________________________________
+
+// compressPolicy holds the response compression config of the proxy rule.
+type compressPolicy struct {
+	Encodings []string
+	Types     []string
+	MinSize   int
+}
+
+func newCompressPolicy(c *models.ProxyCompress) *compressPolicy {
+	p := &compressPolicy{Encodings: c.Encodings, Types: c.Types, MinSize: c.MinSize}
+	if len(p.Encodings) == 0 {
+		p.Encodings = []string{EncodingBrotli, EncodingGzip}
+	}
+	if len(p.Types) == 0 {
+		p.Types = defaultCompressTypes
+	}
+	if p.MinSize <= 0 {
+		p.MinSize = defaultCompressMinSize
+	}
+	return p
+}
+
+// Negotiate method returns the encoding for the request based on header
+// `Accept-Encoding`, empty string means no compression.
+func (p *compressPolicy) Negotiate(req *http.Request) string {
+	if req.Method == http.MethodHead || len(upgradeType(req.Header)) > 0 {
+		return ""
+	}
+	accepted := make(map[string]float64)
+	for _, v := range strings.Split(req.Header.Get("Accept-Encoding"), ",") {
+		parts := strings.Split(strings.TrimSpace(v), ";")
+		q := 1.0
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if f, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = f
+				}
+			}
+		}
+		accepted[strings.ToLower(strings.TrimSpace(parts[0]))] = q
+	}
+	best, bestQ := "", 0.0
+	for _, e := range p.Encodings {
+		q, found := accepted[e]
+		if !found {
+			q, found = accepted["*"]
+		}
+		if found && q > bestQ {
+			best, bestQ = e, q
+		}
+	}
+	return best
+}
+
+// Compressible method returns true if given content type is in the
+// allowlist.
+func (p *compressPolicy) Compressible(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range p.Types {
+		if t == mt || (strings.HasSuffix(t, "/*") && strings.HasPrefix(mt, t[:len(t)-1])) {
+			return true
+		}
+	}
+	return false
+}
+
+// Wrap method returns the compress writer if the request accepts the
+// configured encoding otherwise nil.
+func (p *compressPolicy) Wrap(w http.ResponseWriter, req *http.Request) *compressWriter {
+	encoding := p.Negotiate(req)
+	if len(encoding) == 0 {
+		return nil
+	}
+	return &compressWriter{ResponseWriter: w, policy: p, encoding: encoding}
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// Compress writer type and its methods
+//______________________________________________________________________________
+
+// compressWriter compresses the response on the fly. Response with unknown
+// length is buffered up to min size to decide, already encoded, partial and
+// non-allowlisted responses are passed through as-is.
+type compressWriter struct {
+	http.ResponseWriter
+	policy      *compressPolicy
+	encoding    string
+	status      int
+	wroteHeader bool
+	pending     bool
+	buf         bytes.Buffer
+	encoder     io.WriteCloser
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader, cw.status = true, code
+	hdr := cw.Header()
+	if !cw.candidate(code, hdr) {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	hdr.Add("Vary", "Accept-Encoding")
+	if cl, err := strconv.Atoi(hdr.Get("Content-Length")); err == nil {
+		if cl < cw.policy.MinSize {
+			cw.ResponseWriter.WriteHeader(code)
+			return
+		}
+		cw.start()
+		return
+	}
+	cw.pending = true
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		if len(cw.Header().Get("Content-Type")) == 0 {
+			cw.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.pending {
+		cw.buf.Write(b)
+		if cw.buf.Len() < cw.policy.MinSize {
+			return len(b), nil
+		}
+		cw.start()
+		return len(b), cw.flushBuf()
+	}
+	if cw.encoder != nil {
+		return cw.encoder.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+func (cw *compressWriter) Flush() {
+	if cw.pending {
+		cw.start()
+		_ = cw.flushBuf()
+	}
+	if f, ok := cw.encoder.(interface{ Flush() error }); ok {
+		_ = f.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close method writes the pending response and finishes the compression.
+func (cw *compressWriter) Close() error {
+	if cw.pending {
+		// smaller than min size, send it as-is
+		cw.pending = false
+		cw.ResponseWriter.WriteHeader(cw.status)
+		_, err := cw.ResponseWriter.Write(cw.buf.Bytes())
+		return err
+	}
+	if cw.encoder != nil {
+		return cw.encoder.Close()
+	}
+	return nil
+}
+
+func (cw *compressWriter) candidate(code int, hdr http.Header) bool {
+	switch {
+	case code < http.StatusOK, code == http.StatusNoContent, code == http.StatusNotModified,
+		code == http.StatusPartialContent:
+		return false
+	case len(hdr.Get("Content-Encoding")) > 0, len(hdr.Get("Content-Range")) > 0:
+		return false
+	case strings.Contains(hdr.Get("Cache-Control"), "no-transform"):
+		return false
+	}
+	return cw.policy.Compressible(hdr.Get("Content-Type"))
+}
+
+func (cw *compressWriter) start() {
+	cw.pending = false
+	hdr := cw.Header()
+	hdr.Del("Content-Length")
+	hdr.Del("Accept-Ranges")
+	hdr.Set("Content-Encoding", cw.encoding)
+	if etag := hdr.Get("ETag"); len(etag) > 0 && !strings.HasPrefix(etag, "W/") {
+		hdr.Set("ETag", "W/"+etag)
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+	switch cw.encoding {
+	case EncodingBrotli:
+		cw.encoder = brotli.NewWriterLevel(cw.ResponseWriter, brotliLevel)
+	default:
+		cw.encoder = gzip.NewWriter(cw.ResponseWriter)
+	}
+}
+
+func (cw *compressWriter) flushBuf() error {
+	_, err := cw.encoder.Write(cw.buf.Bytes())
+	cw.buf.Reset()
+	return err
+}
@@ -0,0 +1,111 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"thumbai/app/models"
+
+	"github.com/andybalholm/brotli"
+	"github.com/stretchr/testify/assert"
+)
+
+func compressReq(acceptEncoding string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+	return req
+}
+
+func TestCompressNegotiate(t *testing.T) {
+	p := newCompressPolicy(&models.ProxyCompress{})
+	assert.Equal(t, EncodingBrotli, p.Negotiate(compressReq("gzip, deflate, br")))
+	assert.Equal(t, EncodingGzip, p.Negotiate(compressReq("gzip, br;q=0.5")))
+	assert.Equal(t, EncodingGzip, p.Negotiate(compressReq("gzip")))
+	assert.Equal(t, "", p.Negotiate(compressReq("identity")))
+	assert.Equal(t, "", p.Negotiate(compressReq("br;q=0, gzip;q=0")))
+
+	assert.True(t, p.Compressible("text/html; charset=utf-8"))
+	assert.True(t, p.Compressible("application/json"))
+	assert.False(t, p.Compressible("image/png"))
+}
+
+func TestCompressWriter(t *testing.T) {
+	p := newCompressPolicy(&models.ProxyCompress{MinSize: 16})
+	body := strings.Repeat("thumbai ", 64)
+
+	// gzip
+	rec := httptest.NewRecorder()
+	cw := p.Wrap(rec, compressReq("gzip"))
+	cw.Header().Set("Content-Type", "text/plain")
+	cw.Header().Set("ETag", `"abc"`)
+	_, _ = cw.Write([]byte(body))
+	assert.Nil(t, cw.Close())
+	assert.Equal(t, EncodingGzip, rec.Header().Get("Content-Encoding"))
+	assert.Equal(t, `W/"abc"`, rec.Header().Get("ETag"))
+	assert.Equal(t, "Accept-Encoding", rec.Header().Get("Vary"))
+	gr, err := gzip.NewReader(rec.Body)
+	assert.Nil(t, err)
+	b, _ := ioutil.ReadAll(gr)
+	assert.Equal(t, body, string(b))
+
+	// brotli
+	rec = httptest.NewRecorder()
+	cw = p.Wrap(rec, compressReq("br"))
+	cw.Header().Set("Content-Type", "application/json")
+	_, _ = cw.Write([]byte(body))
+	assert.Nil(t, cw.Close())
+	assert.Equal(t, EncodingBrotli, rec.Header().Get("Content-Encoding"))
+	b, _ = ioutil.ReadAll(brotli.NewReader(rec.Body))
+	assert.Equal(t, body, string(b))
+
+	// below min size
+	rec = httptest.NewRecorder()
+	cw = p.Wrap(rec, compressReq("gzip"))
+	cw.Header().Set("Content-Type", "text/plain")
+	_, _ = cw.Write([]byte("tiny"))
+	assert.Nil(t, cw.Close())
+	assert.Equal(t, "", rec.Header().Get("Content-Encoding"))
+	assert.Equal(t, "tiny", rec.Body.String())
+
+	// already encoded and not allowlisted
+	for _, hdr := range []map[string]string{
+		{"Content-Type": "text/plain", "Content-Encoding": "gzip"},
+		{"Content-Type": "image/png"},
+	} {
+		rec = httptest.NewRecorder()
+		cw = p.Wrap(rec, compressReq("gzip"))
+		for k, v := range hdr {
+			cw.Header().Set(k, v)
+		}
+		_, _ = cw.Write([]byte(body))
+		assert.Nil(t, cw.Close())
+		assert.Equal(t, body, rec.Body.String())
+	}
+
+	assert.Nil(t, p.Wrap(httptest.NewRecorder(), compressReq("")))
+}
+
+func TestValidateCompress(t *testing.T) {
+	errs := ValidateCompress(&models.ProxyCompress{Encodings: []string{"deflate"}, Types: []string{"text"}, MinSize: -1})
+	assert.Equal(t, 3, len(errs))
+	errs = ValidateCompress(&models.ProxyCompress{Encodings: []string{"gzip"}, Types: []string{"text/*"}})
+	assert.Equal(t, 0, len(errs))
+}
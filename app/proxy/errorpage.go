@@ -0,0 +1,282 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"strconv"
+
+	"thumbai/app/access"
+	"thumbai/app/models"
+	"thumbai/app/settings"
+
+	"aahframe.work"
+	"aahframe.work/ahttp"
+)
+
+// ErrorPageCodes are the response status codes supported by the host error
+// pages, applied on the responses generated by thumbai, upstream responses
+// are passed as-is.
+var ErrorPageCodes = []int{
+	http.StatusForbidden,
+	http.StatusNotFound,
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// ValidateErrorPages method validates the given error page templates and
+// returns the field errors if any.
+func ValidateErrorPages(pages map[string]string) map[string]string {
+	errs := map[string]string{}
+	for code, page := range pages {
+		if !isErrorPageCode(code) {
+			errs["errorPage"+code] = "Unsupported status code: " + code
+			continue
+		}
+		if _, err := newPageTemplate(code, page); err != nil {
+			errs["errorPage"+code] = fmt.Sprintf("Invalid template: %v", err)
+		}
+	}
+	return errs
+}
+
+// ValidateMaintenance method validates the given maintenance configuration
+// and returns the field errors if any.
+func ValidateMaintenance(m *models.ProxyMaintenance) map[string]string {
+	errs := map[string]string{}
+	if _, err := access.ParseIPList(m.Allow); err != nil {
+		errs["maintenanceAllow"] = err.Error()
+	}
+	if _, err := newPageTemplate("maintenance", m.Page); err != nil {
+		errs["maintenancePage"] = fmt.Sprintf("Invalid template: %v", err)
+	}
+	if m.RetryAfter < 0 {
+		errs["maintenanceRetryAfter"] = "Must be a positive number"
+	}
+	return errs
+}
+
+// ValidateAccessLog method validates the given access log configuration and
+// returns the field errors if any.
+func ValidateAccessLog(l *models.ProxyAccessLog) map[string]string {
+	errs := map[string]string{}
+	if l.Sample < 0 || l.Sample > 100 {
+		errs["accessLogSample"] = "Must be in the range of 0-100"
+	}
+	return errs
+}
+
+func isErrorPageCode(code string) bool {
+	for _, c := range ErrorPageCodes {
+		if strconv.Itoa(c) == code {
+			return true
+		}
+	}
+	return false
+}
+
+// upstreamErrorStatus method returns `504 Gateway Timeout` for the upstream
+// timeout errors, otherwise `502 Bad Gateway`.
+func upstreamErrorStatus(err error) int {
+	if err == context.DeadlineExceeded {
+		return http.StatusGatewayTimeout
+	}
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadGateway
+}
+
+func newPageTemplate(name, page string) (*template.Template, error) {
+	if len(page) == 0 {
+		return nil, nil
+	}
+	return template.New(name).Parse(page)
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// Error pages type and its methods
+//______________________________________________________________________________
+
+// errorPages holds the compiled HTML templates of the host keyed by status
+// code. Template data is `errorPageData`, e.g. `{{ .Status }} {{ .Path }}`.
+type errorPages map[int]*template.Template
+
+type errorPageData struct {
+	Status     int
+	StatusText string
+	Host       string
+	Path       string
+	RetryAfter string
+}
+
+func newErrorPages(pages map[string]string) (errorPages, error) {
+	if len(pages) == 0 {
+		return nil, nil
+	}
+	if errs := ValidateErrorPages(pages); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid error pages: %v", errs)
+	}
+	ep := make(errorPages)
+	for code, page := range pages {
+		tmpl, _ := newPageTemplate(code, page)
+		if tmpl != nil {
+			c, _ := strconv.Atoi(code)
+			ep[c] = tmpl
+		}
+	}
+	return ep, nil
+}
+
+// write method writes the error response with configured page, it falls back
+// to plain text status if the page is not configured or fails to render.
+func (ep errorPages) write(w http.ResponseWriter, req *http.Request, code int) {
+	writePage(w, req, code, ep[code])
+}
+
+func writePage(w http.ResponseWriter, req *http.Request, code int, tmpl *template.Template) {
+	if tmpl != nil {
+		buf := new(bytes.Buffer)
+		err := tmpl.Execute(buf, &errorPageData{
+			Status:     code,
+			StatusText: http.StatusText(code),
+			Host:       req.Host,
+			Path:       req.URL.Path,
+			RetryAfter: w.Header().Get(ahttp.HeaderRetryAfter),
+		})
+		if err == nil {
+			w.Header().Set(ahttp.HeaderContentType, "text/html; charset=utf-8")
+			w.WriteHeader(code)
+			_, _ = w.Write(buf.Bytes())
+			return
+		}
+		aah.App().Log().Errorf("Unable to render error page %d of host '%s': %v", code, req.Host, err)
+	}
+	w.Header().Set(ahttp.HeaderContentType, "text/plain; charset=utf-8")
+	w.WriteHeader(code)
+	_, _ = fmt.Fprintf(w, "%d %s", code, http.StatusText(code))
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// Maintenance type and its methods
+//______________________________________________________________________________
+
+// maintenance replies `503 Service Unavailable` with maintenance page for
+// all the requests of the host except allowed client IPs. Host `503` error
+// page is used if maintenance page is not configured.
+type maintenance struct {
+	Allow      access.IPList
+	RetryAfter int
+	page       *template.Template
+}
+
+func newMaintenance(m *models.ProxyMaintenance) (*maintenance, error) {
+	if !m.Enabled {
+		return nil, nil
+	}
+	if errs := ValidateMaintenance(m); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid maintenance config: %v", errs)
+	}
+	allow, _ := access.ParseIPList(m.Allow)
+	page, _ := newPageTemplate("maintenance", m.Page)
+	return &maintenance{Allow: allow, RetryAfter: m.RetryAfter, page: page}, nil
+}
+
+// Active method returns true if the request has to be served with the
+// maintenance page.
+func (m *maintenance) Active(req *http.Request) bool {
+	return m != nil && !m.Allow.Contains(access.ClientIP(req))
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// Host error reply methods
+//______________________________________________________________________________
+
+// writeError method writes the error response of given status code using
+// host error pages.
+func (h *host) writeError(w http.ResponseWriter, req *http.Request, code int) {
+	var ep errorPages
+	if h != nil {
+		h.pagesMu.RLock()
+		ep = h.ErrorPages
+		h.pagesMu.RUnlock()
+	}
+	ep.write(w, req, code)
+}
+
+// replyError method writes the error response of given status code on aah
+// context using host error pages.
+func (h *host) replyError(ctx *aah.Context, code int) {
+	ctx.Reply().Done()
+	if len(settings.ServerHeader) > 0 {
+		ctx.Res.Header().Set(ahttp.HeaderServer, settings.ServerHeader)
+	}
+	h.writeError(ctx.Res, ctx.Req.Unwrap(), code)
+}
+
+// replyMaintenance method writes the maintenance response.
+func (h *host) replyMaintenance(ctx *aah.Context) {
+	if h.Maintenance.RetryAfter > 0 {
+		ctx.Res.Header().Set(ahttp.HeaderRetryAfter, strconv.Itoa(h.Maintenance.RetryAfter))
+	}
+	if h.Maintenance.page == nil {
+		h.replyError(ctx, http.StatusServiceUnavailable)
+		return
+	}
+	ctx.Reply().Done()
+	if len(settings.ServerHeader) > 0 {
+		ctx.Res.Header().Set(ahttp.HeaderServer, settings.ServerHeader)
+	}
+	writePage(ctx.Res, ctx.Req.Unwrap(), http.StatusServiceUnavailable, h.Maintenance.page)
+}
+
+// checkAccess method replies `403 Forbidden` and returns false if request
+// client IP is not allowed by given filter.
+func (h *host) checkAccess(ctx *aah.Context, f *access.IPFilter) bool {
+	if f == nil || f.Allowed(access.ClientIP(ctx.Req.Unwrap())) {
+		return true
+	}
+	h.forbidden(ctx, f.ForbiddenBody)
+	return false
+}
+
+// forbidden method replies `403 Forbidden`, given body takes precedence
+// over host error page and then global forbidden page.
+func (h *host) forbidden(ctx *aah.Context, body string) {
+	if len(body) == 0 && h.ErrorPages[http.StatusForbidden] != nil {
+		h.replyError(ctx, http.StatusForbidden)
+		return
+	}
+	access.Forbidden(ctx, body)
+}
+
+// limit method replies `429 Too Many Requests` with header `Retry-After`
+// and returns true if limit is exceeded.
+func (h *host) limit(ctx *aah.Context, l *access.RateLimiter) bool {
+	exceeded, wait := access.Exceeded(ctx, l)
+	if !exceeded {
+		return false
+	}
+	ctx.Res.Header().Set(ahttp.HeaderRetryAfter, access.RetryAfter(wait))
+	h.replyError(ctx, http.StatusTooManyRequests)
+	return true
+}
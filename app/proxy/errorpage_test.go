@@ -0,0 +1,104 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"thumbai/app/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorPages(t *testing.T) {
+	errs := ValidateErrorPages(map[string]string{"500": "<p>oops</p>", "502": "{{ .Status"})
+	assert.Equal(t, 2, len(errs))
+	assert.Contains(t, errs["errorPage500"], "Unsupported")
+	assert.Contains(t, errs["errorPage502"], "Invalid template")
+
+	ep, err := newErrorPages(map[string]string{
+		"502": "<h1>{{ .Status }} {{ .StatusText }}</h1><p>{{ .Path }}</p>",
+	})
+	assert.Nil(t, err)
+	h := &host{Name: "example.com", ErrorPages: ep}
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/<script>", nil)
+	w := httptest.NewRecorder()
+	h.writeError(w, req, http.StatusBadGateway)
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "<h1>502 Bad Gateway</h1><p>/&lt;script&gt;</p>", w.Body.String())
+
+	// not configured, plain text
+	w = httptest.NewRecorder()
+	h.writeError(w, req, http.StatusGatewayTimeout)
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.Equal(t, "504 Gateway Timeout", w.Body.String())
+
+	// rule without host
+	w = httptest.NewRecorder()
+	(*host)(nil).writeError(w, req, http.StatusBadGateway)
+	assert.Equal(t, "502 Bad Gateway", w.Body.String())
+}
+
+func TestWriteUnavailable(t *testing.T) {
+	ep, _ := newErrorPages(map[string]string{"503": "busy, retry after {{ .RetryAfter }}s"})
+	ups := testUpstreams()
+	for _, u := range ups {
+		u.maxInFlight = 1
+		u.acquire()
+	}
+	r := &rule{host: &host{ErrorPages: ep}, Upstreams: ups, Balancer: newBalancer(StrategyRoundRobin, ups)}
+
+	w := httptest.NewRecorder()
+	r.writeUnavailable(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	assert.Equal(t, "busy, retry after 1s", w.Body.String())
+}
+
+func TestMaintenance(t *testing.T) {
+	m, err := newMaintenance(&models.ProxyMaintenance{Allow: []string{"10.0.0.0/8"}})
+	assert.Nil(t, err)
+	assert.Nil(t, m)
+	assert.False(t, m.Active(httptest.NewRequest(http.MethodGet, "/", nil)))
+
+	errs := ValidateMaintenance(&models.ProxyMaintenance{Allow: []string{"10.0.0"}, Page: "{{", RetryAfter: -1})
+	assert.Equal(t, 3, len(errs))
+
+	m, err = newMaintenance(&models.ProxyMaintenance{Enabled: true, Allow: []string{"10.0.0.0/8"}, RetryAfter: 120})
+	assert.Nil(t, err)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.1.2.3:4567"
+	assert.False(t, m.Active(req))
+	req.RemoteAddr = "192.0.2.1:4567"
+	assert.True(t, m.Active(req))
+}
+
+func TestUpstreamErrorStatus(t *testing.T) {
+	assert.Equal(t, http.StatusGatewayTimeout, upstreamErrorStatus(context.DeadlineExceeded))
+	assert.Equal(t, http.StatusGatewayTimeout, upstreamErrorStatus(timeoutError{}))
+	assert.Equal(t, http.StatusBadGateway, upstreamErrorStatus(errors.New("connection refused")))
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
@@ -15,54 +15,363 @@
 package proxy
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
-	"net/http/httptest"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
+
+	"thumbai/app/models"
 
 	"aahframe.work"
 	"aahframe.work/ahttp"
 )
 
+// Health check default values
+const (
+	defaultHealthCheckPath     = "/"
+	defaultHealthCheckInterval = 10 * time.Second
+	defaultHealthCheckTimeout  = 2 * time.Second
+	defaultHealthyThreshold    = 2
+	defaultUnhealthyThreshold  = 3
+	defaultStatusMin           = http.StatusOK
+	defaultStatusMax           = http.StatusBadRequest - 1
+)
+
+// UpstreamStatus struct represents the current state of the proxy
+// rule upstream target.
+type UpstreamStatus struct {
+	Target      string    `json:"target"`
+	Status      string    `json:"status"`
+	Checked     bool      `json:"checked"`
+	StatusCode  int       `json:"status_code,omitempty"`
+	LastError   string    `json:"last_error,omitempty"`
+	LastChecked time.Time `json:"last_checked,omitempty"`
+	Breaker     string    `json:"breaker,omitempty"`
+	Upgraded    int64     `json:"upgraded_conns"`
+	InFlight    int64     `json:"in_flight"`
+}
+
+// Health method returns the health of the proxy hosts and its upstream targets.
 func Health(ctx *aah.Context) []aah.Data {
 	Thumbai.RLock()
 	defer Thumbai.RUnlock()
-	hosts := make([]aah.Data, 0)
-	wg := sync.WaitGroup{}
-	wg.Add(len(Thumbai.Hosts))
+	hosts := make([]aah.Data, 0, len(Thumbai.Hosts))
 	for _, h := range Thumbai.Hosts {
-		go func(host *host) {
-			defer wg.Done()
-			data := checkHealth(host)
-			hosts = append(hosts, data)
-		}(h)
+		upstreams := h.UpstreamsStatus()
+		data := checkHealth(h.Name, upstreams)
+		data["upstreams"] = upstreams
+		hosts = append(hosts, data)
 	}
-	wg.Wait()
 	return hosts
 }
 
-func checkHealth(h *host) aah.Data {
-	reqPath := h.HealthCheckPath
-	if len(reqPath) == 0 {
-		reqPath = "/"
+// UpstreamsStatus method returns the upstream targets status of the given
+// host, it is keyed by proxy rule target URL.
+func UpstreamsStatus(hostName string) map[string][]*UpstreamStatus {
+	h := Thumbai.Lookup(hostName)
+	if h == nil {
+		return map[string][]*UpstreamStatus{}
 	}
-	r, _ := http.NewRequest(http.MethodGet, reqPath, nil)
-	r.Header.Set(ahttp.HeaderHost, h.Name)
-	r.Host = h.Name
+	return h.UpstreamsStatus()
+}
 
-	w := httptest.NewRecorder()
-	h.LastRule.Proxy.ServeHTTP(w, r)
-	code := w.Result().StatusCode
-	if code >= http.StatusOK && code < http.StatusBadRequest {
-		return aah.Data{
-			"status":      "available",
-			"host":        h.Name,
-			"status_code": code,
-		}
+// ValidateHealthCheck method validates the given health check configuration
+// and returns the field errors if any.
+func ValidateHealthCheck(hc *models.ProxyHealthCheck) map[string]string {
+	errs := map[string]string{}
+	if len(hc.Path) > 0 && hc.Path[0] != '/' {
+		errs["hcPath"] = "Path must start with '/'"
+	}
+	if _, err := parseDuration(hc.Interval, defaultHealthCheckInterval); err != nil {
+		errs["hcInterval"] = "Invalid duration value, e.g.: 10s"
+	}
+	if _, err := parseDuration(hc.Timeout, defaultHealthCheckTimeout); err != nil {
+		errs["hcTimeout"] = "Invalid duration value, e.g.: 2s"
+	}
+	if _, _, err := parseStatusRange(hc.ExpectedStatus); err != nil {
+		errs["hcExpectedStatus"] = "Invalid status range, e.g.: 200-399"
 	}
+	if hc.HealthyThreshold < 0 {
+		errs["hcHealthyThreshold"] = "Must be a positive number"
+	}
+	if hc.UnhealthyThreshold < 0 {
+		errs["hcUnhealthyThreshold"] = "Must be a positive number"
+	}
+	return errs
+}
 
-	return aah.Data{
+// checkHealth method reports the host health from the state of all the
+// proxy rule upstreams, it never sends a request to upstream. Host is
+// `available` if all the checked upstreams are healthy, `degraded` if some
+// of them and `unavailable` if none. Upstreams not checked by background
+// health checker are not considered, host is `unchecked` if none is checked.
+func checkHealth(hostName string, upstreams map[string][]*UpstreamStatus) aah.Data {
+	data := aah.Data{
 		"status":      "unavailable",
-		"host":        h.Name,
-		"status_code": code,
+		"host":        hostName,
+		"status_code": http.StatusBadGateway,
+	}
+	var total, checked, healthy int
+	for _, statuses := range upstreams {
+		for _, us := range statuses {
+			total++
+			if !us.Checked {
+				continue
+			}
+			checked++
+			if us.Status == "healthy" && us.Breaker != BreakerOpen {
+				healthy++
+			}
+		}
+	}
+	switch {
+	case total == 0 || (checked > 0 && healthy == 0):
+	case checked == 0:
+		data["status"] = "unchecked"
+		delete(data, "status_code")
+	case healthy < checked:
+		data["status"] = "degraded"
+		data["status_code"] = http.StatusOK
+	default:
+		data["status"] = "available"
+		data["status_code"] = http.StatusOK
+	}
+	return data
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// Health state type and its methods
+//______________________________________________________________________________
+
+// healthState holds the active health check result of the upstream.
+// Upstream is considered healthy until the checker says otherwise.
+type healthState struct {
+	sync.RWMutex
+	checked     bool
+	unhealthy   bool
+	successes   int
+	failures    int
+	statusCode  int
+	lastError   string
+	lastChecked time.Time
+}
+
+func (hs *healthState) Healthy() bool {
+	if hs == nil {
+		return true
+	}
+	hs.RLock()
+	defer hs.RUnlock()
+	return !hs.unhealthy
+}
+
+// record method records the check result and flips the state based on
+// the thresholds. It returns true if the state got changed.
+func (hs *healthState) record(hc *healthChecker, code int, err error) bool {
+	hs.Lock()
+	defer hs.Unlock()
+	hs.checked = true
+	hs.lastChecked = time.Now()
+	hs.statusCode = code
+	hs.lastError = ""
+	if err != nil {
+		hs.lastError = err.Error()
+	}
+
+	if err == nil && code >= hc.StatusMin && code <= hc.StatusMax {
+		hs.successes++
+		hs.failures = 0
+		if hs.unhealthy && hs.successes >= hc.HealthyThreshold {
+			hs.unhealthy = false
+			return true
+		}
+		return false
+	}
+
+	hs.failures++
+	hs.successes = 0
+	if !hs.unhealthy && hs.failures >= hc.UnhealthyThreshold {
+		hs.unhealthy = true
+		return true
+	}
+	return false
+}
+
+func (hs *healthState) Status(target string) *UpstreamStatus {
+	us := &UpstreamStatus{Target: target, Status: "healthy"}
+	if hs == nil {
+		return us
+	}
+	hs.RLock()
+	defer hs.RUnlock()
+	if hs.unhealthy {
+		us.Status = "unhealthy"
+	}
+	us.Checked = hs.checked
+	us.StatusCode = hs.statusCode
+	us.LastError = hs.lastError
+	us.LastChecked = hs.lastChecked
+	return us
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// Health checker type and its methods
+//______________________________________________________________________________
+
+// healthChecker performs the periodic health check of proxy rule upstreams
+// in the background until it's stopped.
+type healthChecker struct {
+	Path               string
+	Interval           time.Duration
+	StatusMin          int
+	StatusMax          int
+	HealthyThreshold   int
+	UnhealthyThreshold int
+	client             *http.Client
+	stopCh             chan struct{}
+	stopOnce           sync.Once
+}
+
+func newHealthChecker(hc *models.ProxyHealthCheck, transport http.RoundTripper) (*healthChecker, error) {
+	interval, err := parseDuration(hc.Interval, defaultHealthCheckInterval)
+	if err != nil {
+		return nil, err
+	}
+	timeout, err := parseDuration(hc.Timeout, defaultHealthCheckTimeout)
+	if err != nil {
+		return nil, err
+	}
+	min, max, err := parseStatusRange(hc.ExpectedStatus)
+	if err != nil {
+		return nil, err
+	}
+	checker := &healthChecker{
+		Path:               hc.Path,
+		Interval:           interval,
+		StatusMin:          min,
+		StatusMax:          max,
+		HealthyThreshold:   hc.HealthyThreshold,
+		UnhealthyThreshold: hc.UnhealthyThreshold,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   timeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		stopCh: make(chan struct{}),
+	}
+	if len(checker.Path) == 0 {
+		checker.Path = defaultHealthCheckPath
+	}
+	if checker.HealthyThreshold <= 0 {
+		checker.HealthyThreshold = defaultHealthyThreshold
+	}
+	if checker.UnhealthyThreshold <= 0 {
+		checker.UnhealthyThreshold = defaultUnhealthyThreshold
+	}
+	return checker, nil
+}
+
+func (hc *healthChecker) Start(hostName string, u *upstream) {
+	go func() {
+		ticker := time.NewTicker(hc.Interval)
+		defer ticker.Stop()
+		hc.check(hostName, u)
+		for {
+			select {
+			case <-hc.stopCh:
+				return
+			case <-ticker.C:
+				hc.check(hostName, u)
+			}
+		}
+	}()
+}
+
+func (hc *healthChecker) Stop() {
+	hc.stopOnce.Do(func() { close(hc.stopCh) })
+}
+
+func (hc *healthChecker) check(hostName string, u *upstream) {
+	code, err := hc.probe(u)
+	if u.health.record(hc, code, err) {
+		if u.health.Healthy() {
+			aah.App().Log().Infof("Proxy upstream '%s' of host '%s' is healthy again, restored into rotation", u.Target, hostName)
+		} else {
+			aah.App().Log().Warnf("Proxy upstream '%s' of host '%s' is unhealthy, taken out of rotation (status: %d, error: %v)",
+				u.Target, hostName, code, err)
+		}
+	}
+}
+
+func (hc *healthChecker) probe(u *upstream) (int, error) {
+	target := *u.URL
+	target.Path = singleJoiningSlash(u.URL.Path, hc.Path)
+	if i := strings.IndexByte(hc.Path, '?'); i > -1 {
+		target.Path = singleJoiningSlash(u.URL.Path, hc.Path[:i])
+		target.RawQuery = hc.Path[i+1:]
+	}
+	req, err := http.NewRequest(http.MethodGet, target.String(), nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set(ahttp.HeaderUserAgent, "thumbai-health-check")
+	res, err := hc.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	_, _ = io.Copy(ioutil.Discard, res.Body)
+	_ = res.Body.Close()
+	return res.StatusCode, nil
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// Unexported methods
+//______________________________________________________________________________
+
+func parseDuration(v string, def time.Duration) (time.Duration, error) {
+	v = strings.TrimSpace(v)
+	if len(v) == 0 {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("duration must be positive: %s", v)
+	}
+	return d, nil
+}
+
+// parseStatusRange method parses the status range such as `200-399` or `200`.
+func parseStatusRange(v string) (int, int, error) {
+	v = strings.TrimSpace(v)
+	if len(v) == 0 {
+		return defaultStatusMin, defaultStatusMax, nil
+	}
+	parts := strings.Split(v, "-")
+	if len(parts) > 2 {
+		return 0, 0, errors.New("invalid status range: " + v)
+	}
+	min, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return 0, 0, errors.New("invalid status range: " + v)
+	}
+	max := min
+	if len(parts) == 2 {
+		if max, err = strconv.Atoi(strings.TrimSpace(parts[1])); err != nil {
+			return 0, 0, errors.New("invalid status range: " + v)
+		}
+	}
+	if min < 100 || max > 599 || min > max {
+		return 0, 0, errors.New("invalid status range: " + v)
 	}
+	return min, max, nil
 }
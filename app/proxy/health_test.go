@@ -0,0 +1,111 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"thumbai/app/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseStatusRange(t *testing.T) {
+	min, max, err := parseStatusRange("")
+	assert.Nil(t, err)
+	assert.Equal(t, 200, min)
+	assert.Equal(t, 399, max)
+
+	min, max, err = parseStatusRange("204")
+	assert.Nil(t, err)
+	assert.Equal(t, 204, min)
+	assert.Equal(t, 204, max)
+
+	for _, v := range []string{"abc", "399-200", "200-300-400", "99"} {
+		_, _, err = parseStatusRange(v)
+		assert.NotNil(t, err, v)
+	}
+}
+
+func TestHealthStateEjectAndRestore(t *testing.T) {
+	hc, err := newHealthChecker(&models.ProxyHealthCheck{HealthyThreshold: 2, UnhealthyThreshold: 2}, http.DefaultTransport)
+	assert.Nil(t, err)
+
+	hs := &healthState{}
+	assert.True(t, hs.Healthy())
+	assert.False(t, hs.record(hc, 0, errors.New("connection refused")))
+	assert.True(t, hs.record(hc, http.StatusInternalServerError, nil))
+	assert.False(t, hs.Healthy())
+
+	assert.False(t, hs.record(hc, http.StatusOK, nil))
+	assert.False(t, hs.Healthy())
+	assert.True(t, hs.record(hc, http.StatusOK, nil))
+	assert.True(t, hs.Healthy())
+}
+
+func TestHealthCheckerProbe(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/app/healthz" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	hc, err := newHealthChecker(&models.ProxyHealthCheck{Path: "/healthz"}, http.DefaultTransport)
+	assert.Nil(t, err)
+	target, _ := url.Parse(ts.URL + "/app")
+	code, err := hc.probe(&upstream{Target: ts.URL, URL: target})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusNoContent, code)
+}
+
+func TestCheckHealth(t *testing.T) {
+	assert.Equal(t, "unavailable", checkHealth("example.com", nil)["status"])
+
+	hc, _ := newHealthChecker(&models.ProxyHealthCheck{UnhealthyThreshold: 1}, http.DefaultTransport)
+	healthy, unhealthy := &healthState{}, &healthState{}
+	healthy.record(hc, http.StatusOK, nil)
+	unhealthy.record(hc, http.StatusInternalServerError, nil)
+
+	// upstreams not checked are never probed
+	unchecked := map[string][]*UpstreamStatus{"/": {(*healthState)(nil).Status("http://127.0.0.1:1")}}
+	data := checkHealth("example.com", unchecked)
+	assert.Equal(t, "unchecked", data["status"])
+	assert.Nil(t, data["status_code"])
+
+	// state of all the rules upstreams
+	upstreams := map[string][]*UpstreamStatus{
+		"/":    {healthy.Status("http://127.0.0.1:8081"), (*healthState)(nil).Status("http://127.0.0.1:1")},
+		"/api": {healthy.Status("http://127.0.0.1:8082")},
+	}
+	data = checkHealth("example.com", upstreams)
+	assert.Equal(t, "available", data["status"])
+	assert.Equal(t, http.StatusOK, data["status_code"])
+
+	upstreams["/api"] = append(upstreams["/api"], unhealthy.Status("http://127.0.0.1:8083"))
+	assert.Equal(t, "degraded", checkHealth("example.com", upstreams)["status"])
+
+	open := healthy.Status("http://127.0.0.1:8084")
+	open.Breaker = BreakerOpen
+	data = checkHealth("example.com", map[string][]*UpstreamStatus{"/": {unhealthy.Status("http://127.0.0.1:8083"), open}})
+	assert.Equal(t, "unavailable", data["status"])
+	assert.Equal(t, http.StatusBadGateway, data["status_code"])
+}
@@ -0,0 +1,309 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"thumbai/app/models"
+)
+
+// conditionSyntax is the version of the condition value syntax, query param
+// and header values of the rules saved before it are matched exactly.
+const conditionSyntax = 1
+
+// ValidateHostName method validates the proxy host name, it could be exact
+// host, wildcard `*.example.com` or regex `{regex}`.
+func ValidateHostName(name string) error {
+	switch {
+	case len(name) == 0:
+		return errors.New("host name is required")
+	case isRegexValue(name):
+		if name != strings.ToLower(name) {
+			return errors.New("host regex must be in lowercase, host names are matched in lowercase")
+		}
+		if _, err := regexp.Compile(name[1 : len(name)-1]); err != nil {
+			return fmt.Errorf("invalid host regex: %v", err)
+		}
+	case strings.Contains(name, "*"):
+		if !strings.HasPrefix(name, "*.") || strings.Count(name, "*") > 1 || len(name) < 3 {
+			return errors.New("wildcard host must be in the form *.example.com")
+		}
+	}
+	return nil
+}
+
+// ValidateMatchValues method validates the regex of condition values and
+// returns the invalid entries.
+func ValidateMatchValues(values map[string]string) []string {
+	var errs []string
+	for k, v := range values {
+		if _, err := newValueMatcher(k, v); err != nil {
+			errs = append(errs, k+"="+v)
+		}
+	}
+	sort.Strings(errs)
+	return errs
+}
+
+// migrateConditions method rewrites the query param and header condition
+// values of the rule saved before the value syntax into regex, so the values
+// which now have special meaning keep matching exactly. It reports whether
+// the rule is changed.
+func migrateConditions(pr *models.ProxyRule) bool {
+	if pr.ConditionSyntax >= conditionSyntax {
+		return false
+	}
+	literalValues(pr.QueryParams)
+	literalValues(pr.Headers)
+	pr.ConditionSyntax = conditionSyntax
+	return true
+}
+
+func literalValues(values map[string]string) {
+	for k, v := range values {
+		if v == "*" || strings.HasPrefix(v, "!") || isRegexValue(v) {
+			values[k] = "{^" + regexp.QuoteMeta(v) + "$}"
+		}
+	}
+}
+
+func isRegexValue(v string) bool {
+	return len(v) > 1 && v[0] == '{' && v[len(v)-1] == '}'
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// Host pattern type and its methods
+//______________________________________________________________________________
+
+// hostPattern is the wildcard or regex proxy host entry. Requests are
+// matched in the order of exact host, wildcard (longest suffix first) and
+// regex (by name).
+type hostPattern struct {
+	host   *host
+	suffix string
+	regex  *regexp.Regexp
+}
+
+func newHostPattern(h *host) *hostPattern {
+	name := h.Name
+	switch {
+	case isRegexValue(name):
+		regex, err := regexp.Compile(name[1 : len(name)-1])
+		if err != nil {
+			return nil
+		}
+		return &hostPattern{host: h, regex: regex}
+	case strings.HasPrefix(name, "*."):
+		return &hostPattern{host: h, suffix: strings.ToLower(name[1:])}
+	}
+	return nil
+}
+
+func (hp *hostPattern) Match(hostname string) bool {
+	if hp.regex != nil {
+		return hp.regex.MatchString(hostname)
+	}
+	return len(hostname) > len(hp.suffix) && strings.HasSuffix(hostname, hp.suffix)
+}
+
+func sortHostPatterns(patterns []*hostPattern) {
+	sort.SliceStable(patterns, func(i, j int) bool {
+		a, b := patterns[i], patterns[j]
+		if (a.regex == nil) != (b.regex == nil) {
+			return a.regex == nil
+		}
+		if a.regex == nil && len(a.suffix) != len(b.suffix) {
+			return len(a.suffix) > len(b.suffix)
+		}
+		return a.host.Name < b.host.Name
+	})
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// Value matcher type and its methods
+//______________________________________________________________________________
+
+// valueMatcher matches the header, query param or cookie value. Value
+// syntax is exact value, `{regex}`, `*` for presence and prefix `!` negates
+// the match, e.g. `!*` means absence.
+type valueMatcher struct {
+	Name     string
+	Value    string
+	Regex    *regexp.Regexp
+	Presence bool
+	Negate   bool
+}
+
+func newValueMatcher(name, value string) (*valueMatcher, error) {
+	m := &valueMatcher{Name: name}
+	if strings.HasPrefix(value, "!") {
+		m.Negate, value = true, value[1:]
+	}
+	switch {
+	case value == "*":
+		m.Presence = true
+	case isRegexValue(value):
+		regex, err := regexp.Compile(value[1 : len(value)-1])
+		if err != nil {
+			return nil, err
+		}
+		m.Regex = regex
+	default:
+		m.Value = value
+	}
+	return m, nil
+}
+
+func newValueMatchers(values map[string]string) ([]*valueMatcher, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	matchers := make([]*valueMatcher, 0, len(values))
+	for k, v := range values {
+		m, err := newValueMatcher(k, v)
+		if err != nil {
+			return nil, fmt.Errorf("condition '%s=%s': %v", k, v, err)
+		}
+		matchers = append(matchers, m)
+	}
+	sort.Slice(matchers, func(i, j int) bool { return matchers[i].Name < matchers[j].Name })
+	return matchers, nil
+}
+
+// Match method returns true if given values satisfy the matcher, found
+// reports the presence of the value.
+func (m *valueMatcher) Match(value string, found bool) bool {
+	var result bool
+	switch {
+	case m.Presence:
+		result = found
+	case m.Regex != nil:
+		result = found && m.Regex.MatchString(value)
+	default:
+		result = value == m.Value
+	}
+	return result != m.Negate
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// Rule conditions
+//______________________________________________________________________________
+
+// conditions holds the compiled request match conditions of the proxy rule.
+type conditions struct {
+	Path        string
+	PathRegex   *regexp.Regexp
+	Methods     []string
+	QueryParams []*valueMatcher
+	Headers     []*valueMatcher
+	Cookies     []*valueMatcher
+}
+
+func newConditions(pr *models.ProxyRule) (*conditions, error) {
+	c := &conditions{}
+	pl := len(pr.Path)
+	if pl > 0 && pr.Path[0] == '{' && pr.Path[pl-1] == '}' {
+		regex, err := regexp.Compile(pr.Path[1 : pl-1])
+		if err != nil {
+			return nil, fmt.Errorf("path '%s': %v", pr.Path, err)
+		}
+		c.PathRegex = regex
+	} else {
+		c.Path = pr.Path
+	}
+	for _, m := range pr.Methods {
+		c.Methods = append(c.Methods, strings.ToUpper(m))
+	}
+	var err error
+	if c.QueryParams, err = newValueMatchers(pr.QueryParams); err != nil {
+		return nil, err
+	}
+	if c.Headers, err = newValueMatchers(pr.Headers); err != nil {
+		return nil, err
+	}
+	if c.Cookies, err = newValueMatchers(pr.Cookies); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Match method returns true if the request satisfies all the conditions.
+func (c *conditions) Match(req *http.Request) bool {
+	if len(c.Path) > 0 && req.URL.Path != c.Path {
+		return false
+	}
+	if c.PathRegex != nil && !c.PathRegex.MatchString(req.URL.Path) {
+		return false
+	}
+	if len(c.Methods) > 0 {
+		found := false
+		for _, m := range c.Methods {
+			if m == req.Method || (m == http.MethodGet && req.Method == http.MethodHead) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(c.QueryParams) > 0 {
+		query := req.URL.Query()
+		for _, m := range c.QueryParams {
+			vv, found := query[m.Name]
+			value := ""
+			if found && len(vv) > 0 {
+				value = vv[0]
+			}
+			if !m.Match(value, found) {
+				return false
+			}
+		}
+	}
+	for _, m := range c.Headers {
+		vv, found := req.Header[http.CanonicalHeaderKey(m.Name)]
+		value := ""
+		if found && len(vv) > 0 {
+			value = vv[0]
+		}
+		if !m.Match(value, found) {
+			return false
+		}
+	}
+	for _, m := range c.Cookies {
+		value, found := "", false
+		if cookie, err := req.Cookie(m.Name); err == nil {
+			value, found = cookie.Value, true
+		}
+		if !m.Match(value, found) {
+			return false
+		}
+	}
+	return true
+}
+
+// sortRules method orders the proxy rules by priority, higher first. Rules
+// with same priority keep the configured order.
+func sortRules(rules []*rule) {
+	sort.SliceStable(rules, func(i, j int) bool {
+		return rules[i].Priority > rules[j].Priority
+	})
+}
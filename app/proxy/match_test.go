@@ -0,0 +1,150 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"thumbai/app/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConditionsMatch(t *testing.T) {
+	c, err := newConditions(&models.ProxyRule{
+		Path:        `{^/api/}`,
+		Methods:     []string{"get", "POST"},
+		QueryParams: map[string]string{"v": "{^[12]$}", "debug": "!*"},
+		Headers:     map[string]string{"X-Tenant": "*", "X-Env": "!staging"},
+		Cookies:     map[string]string{"beta": "on"},
+	})
+	assert.Nil(t, err)
+
+	newReq := func(method, target string) *http.Request {
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set("X-Tenant", "acme")
+		req.AddCookie(&http.Cookie{Name: "beta", Value: "on"})
+		return req
+	}
+
+	assert.True(t, c.Match(newReq(http.MethodGet, "/api/users?v=1")))
+	assert.True(t, c.Match(newReq(http.MethodHead, "/api/users?v=2")))
+	assert.False(t, c.Match(newReq(http.MethodDelete, "/api/users?v=1")))
+	assert.False(t, c.Match(newReq(http.MethodGet, "/web?v=1")))
+	assert.False(t, c.Match(newReq(http.MethodGet, "/api/users?v=3")))
+	assert.False(t, c.Match(newReq(http.MethodGet, "/api/users?v=1&debug")))
+
+	req := newReq(http.MethodGet, "/api/users?v=1")
+	req.Header.Set("X-Env", "staging")
+	assert.False(t, c.Match(req))
+
+	req = newReq(http.MethodGet, "/api/users?v=1")
+	req.Header.Del("X-Tenant")
+	assert.False(t, c.Match(req))
+
+	req = httptest.NewRequest(http.MethodGet, "/api/users?v=1", nil)
+	req.Header.Set("X-Tenant", "acme")
+	assert.False(t, c.Match(req))
+
+	// exact value compat, missing value is empty
+	c, err = newConditions(&models.ProxyRule{Path: "/", Headers: map[string]string{"X-Empty": ""}})
+	assert.Nil(t, err)
+	assert.True(t, c.Match(httptest.NewRequest(http.MethodGet, "/", nil)))
+
+	_, err = newConditions(&models.ProxyRule{Cookies: map[string]string{"a": "{(}"}})
+	assert.NotNil(t, err)
+	assert.Equal(t, []string{"a={(}"}, ValidateMatchValues(map[string]string{"a": "{(}", "b": "!{^x}"}))
+}
+
+func TestMigrateConditions(t *testing.T) {
+	pr := &models.ProxyRule{
+		Path:        "/",
+		QueryParams: map[string]string{"q": "*", "v": "1"},
+		Headers:     map[string]string{"X-Flag": "!on", "X-Tmpl": "{name}", "X-Env": "prod"},
+	}
+	assert.True(t, migrateConditions(pr))
+	assert.False(t, migrateConditions(pr))
+	assert.Equal(t, conditionSyntax, pr.ConditionSyntax)
+	assert.Equal(t, "1", pr.QueryParams["v"])
+	assert.Equal(t, "prod", pr.Headers["X-Env"])
+
+	// values saved before the syntax keep matching exactly
+	c, err := newConditions(pr)
+	assert.Nil(t, err)
+	req := httptest.NewRequest(http.MethodGet, "/?q=*&v=1", nil)
+	req.Header.Set("X-Flag", "!on")
+	req.Header.Set("X-Tmpl", "{name}")
+	req.Header.Set("X-Env", "prod")
+	assert.True(t, c.Match(req))
+
+	req = httptest.NewRequest(http.MethodGet, "/?q=any&v=1", nil)
+	req.Header.Set("X-Flag", "!on")
+	req.Header.Set("X-Tmpl", "{name}")
+	req.Header.Set("X-Env", "prod")
+	assert.False(t, c.Match(req))
+}
+
+func TestProxiesMatch(t *testing.T) {
+	p := &proxies{RWMutex: sync.RWMutex{}, Hosts: make(map[string]*host)}
+	exact := p.AddHost("api.example.com")
+	wildcard := p.AddHost("*.example.com")
+	deeper := p.AddHost("*.eu.example.com")
+	regex := p.AddHost(`{^app\d+\.example\.org$}`)
+
+	assert.Equal(t, exact, p.Match("API.example.com"))
+	assert.Equal(t, exact, p.Match("api.example.com:8080"))
+	assert.Equal(t, wildcard, p.Match("www.example.com"))
+	assert.Equal(t, deeper, p.Match("shop.eu.example.com"))
+	assert.Equal(t, regex, p.Match("app12.example.org"))
+	assert.Nil(t, p.Match("example.com"))
+	assert.Nil(t, p.Match("app.example.org"))
+
+	p.DelHost("*.eu.example.com")
+	assert.Equal(t, wildcard, p.Match("shop.eu.example.com"))
+
+	assert.Nil(t, ValidateHostName("*.example.com"))
+	assert.Nil(t, ValidateHostName(`{^a\d+\.example\.com$}`))
+	assert.NotNil(t, ValidateHostName("www.*.example.com"))
+	assert.NotNil(t, ValidateHostName(`{^\D+$}`))
+	assert.NotNil(t, ValidateHostName("{(}"))
+}
+
+func TestRulesOrder(t *testing.T) {
+	h := &host{Name: "example.com"}
+	for _, r := range []*rule{
+		{TargetURL: "http://a"},
+		{TargetURL: "http://b", Priority: 10},
+		{TargetURL: "http://c"},
+		{TargetURL: "http://d", Priority: 10},
+	} {
+		h.ProxyRules = append(h.ProxyRules, r)
+	}
+	sortRules(h.ProxyRules)
+	assert.Equal(t, []string{"http://b", "http://d", "http://a", "http://c"}, ruleTargetURLs(h.ProxyRules))
+
+	h.ReorderRules([]string{"http://c", "http://d", "http://b", "http://a"})
+	assert.Equal(t, []string{"http://d", "http://b", "http://c", "http://a"}, ruleTargetURLs(h.ProxyRules))
+}
+
+func ruleTargetURLs(rules []*rule) []string {
+	var result []string
+	for _, r := range rules {
+		result = append(result, r.TargetURL)
+	}
+	return result
+}
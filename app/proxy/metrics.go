@@ -0,0 +1,78 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"thumbai/app/metrics"
+
+	"aahframe.work"
+)
+
+// Proxy metrics, rule label is the proxy rule target URL and upstream label
+// is the upstream target URL.
+var (
+	requestsTotal = metrics.NewCounter("thumbai_proxy_requests_total",
+		"Total proxy requests by host, rule and response status code.", "host", "rule", "code")
+	requestDuration = metrics.NewHistogram("thumbai_proxy_request_duration_seconds",
+		"Proxy request duration in seconds by host and rule.", nil, "host", "rule")
+	responseBytes = metrics.NewCounter("thumbai_proxy_response_bytes_total",
+		"Total proxy response body bytes written by host and rule.", "host", "rule")
+	upstreamRequestsTotal = metrics.NewCounter("thumbai_proxy_upstream_requests_total",
+		"Total upstream requests by host, rule, upstream and response status code, code is 'error' on transport failure and 'canceled' if client is gone.",
+		"host", "rule", "upstream", "code")
+	upstreamDuration = metrics.NewHistogram("thumbai_proxy_upstream_duration_seconds",
+		"Upstream request duration in seconds by host, rule and upstream.", nil, "host", "rule", "upstream")
+	upstreamBytes = metrics.NewCounter("thumbai_proxy_upstream_response_bytes_total",
+		"Total upstream response body bytes read by host, rule and upstream.", "host", "rule", "upstream")
+)
+
+// observeRequest method records the proxy request metrics. Response status
+// is taken from the writer if the response is written directly, otherwise
+// from the aah reply.
+func observeRequest(ctx *aah.Context, h *host, r *rule, start time.Time) {
+	var ruleName string
+	if r != nil {
+		ruleName = r.TargetURL
+	}
+	code := ctx.Res.Status()
+	if code == 0 {
+		code = ctx.Reply().Code
+	}
+	if code == 0 {
+		code = http.StatusOK
+	}
+	requestsTotal.Inc(h.Name, ruleName, strconv.Itoa(code))
+	requestDuration.ObserveSince(start, h.Name, ruleName)
+	responseBytes.Add(float64(ctx.Res.BytesWritten()), h.Name, ruleName)
+}
+
+// countingBody counts the bytes read from upstream response body.
+type countingBody struct {
+	io.ReadCloser
+	labels []string
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		upstreamBytes.Add(float64(n), b.labels...)
+	}
+	return n, err
+}
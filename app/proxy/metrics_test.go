@@ -0,0 +1,48 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpstreamMetrics(t *testing.T) {
+	labels := []string{"metrics.example.com", "http://127.0.0.1:8080", "http://127.0.0.1:8081"}
+	body := &countingBody{ReadCloser: ioutil.NopCloser(strings.NewReader("thumbai proxy")), labels: labels}
+	b, err := ioutil.ReadAll(body)
+	assert.Nil(t, err)
+	assert.Equal(t, "thumbai proxy", string(b))
+	assert.Equal(t, float64(13), upstreamBytes.Value(labels...))
+
+	// upstream created without rule does not record duration
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	u := testUpstreams()[0]
+	u.Proxy = &httputil.ReverseProxy{Director: func(req *http.Request) {
+		req.URL.Scheme, req.URL.Host = "http", strings.TrimPrefix(ts.URL, "http://")
+	}}
+	u.serve(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	u.labels = labels
+	u.serve(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, uint64(1), upstreamDuration.Count(labels...))
+}
@@ -0,0 +1,312 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"thumbai/app/access"
+	"thumbai/app/models"
+)
+
+// Mirror default values
+const (
+	defaultMirrorMaxBodySize = 64 << 10
+	defaultMirrorTimeout     = 10 * time.Second
+	defaultMirrorTagHeader   = "X-Thumbai-Mirror"
+	maxMirrorInFlight        = 100
+)
+
+// ValidateMirror method validates the given mirror configuration and returns
+// the field errors if any.
+func ValidateMirror(m *models.ProxyMirror) map[string]string {
+	errs := map[string]string{}
+	if u, err := url.Parse(m.TargetURL); err != nil || !u.IsAbs() {
+		errs["mirrorTargetURL"] = "Absolute shadow upstream URL is required"
+	}
+	if m.Percent < 0 || m.Percent > 100 {
+		errs["mirrorPercent"] = "Must be in the range of 0-100"
+	}
+	if m.MaxBodySize < 0 {
+		errs["mirrorMaxBodySize"] = "Must be a positive number"
+	}
+	if _, err := parseDuration(m.Timeout, defaultMirrorTimeout); err != nil {
+		errs["mirrorTimeout"] = "Invalid duration value, e.g.: 10s"
+	}
+	return errs
+}
+
+// MirrorStatus method returns the traffic mirror status of the given host,
+// it is keyed by proxy rule target URL.
+func MirrorStatus(hostName string) map[string]*MirrorStats {
+	h := Thumbai.Lookup(hostName)
+	if h == nil {
+		return map[string]*MirrorStats{}
+	}
+	return h.MirrorStatus()
+}
+
+// MirrorStats holds the shadow requests counts of the proxy rule since the
+// rule is applied. Skipped are sampled requests not mirrored due to body
+// size, body not read completely by the primary upstream or max in-flight
+// shadow requests.
+type MirrorStats struct {
+	TargetURL string `json:"target_url"`
+	Sent      int64  `json:"sent"`
+	Errors    int64  `json:"errors"`
+	Skipped   int64  `json:"skipped"`
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// Mirror type and its methods
+//______________________________________________________________________________
+
+// trafficMirror copies the sample of proxy rule requests to the shadow
+// upstream, fire-and-forget. Shadow response is discarded and it never
+// blocks the primary request, requests are skipped when max in-flight
+// shadow requests is reached. Zero percent disables the mirror.
+type trafficMirror struct {
+	Target      *url.URL
+	Percent     int
+	MaxBodySize int64
+	Headers     map[string]string
+	client      *http.Client
+	transport   *http.Transport
+	rewrites    []*rewriteRule
+	inflight    chan struct{}
+	sent        int64
+	errors      int64
+	skipped     int64
+	rnd         *rand.Rand
+	rndMu       sync.Mutex
+}
+
+func newTrafficMirror(m *models.ProxyMirror, rewrites []*rewriteRule) (*trafficMirror, error) {
+	if errs := ValidateMirror(m); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid mirror config: %v", errs)
+	}
+	target, _ := url.Parse(m.TargetURL)
+	timeout, _ := parseDuration(m.Timeout, defaultMirrorTimeout)
+	// shadow upstream has its own transport, TLS settings of the primary
+	// upstreams does not apply to it
+	transport, err := newTransport(&models.ProxyRule{})
+	if err != nil {
+		return nil, err
+	}
+	tm := &trafficMirror{
+		Target:      target,
+		Percent:     m.Percent,
+		MaxBodySize: m.MaxBodySize,
+		Headers:     m.Headers,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   timeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		transport: transport,
+		rewrites:  rewrites,
+		inflight:  make(chan struct{}, maxMirrorInFlight),
+		rnd:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	if tm.MaxBodySize == 0 {
+		tm.MaxBodySize = defaultMirrorMaxBodySize
+	}
+	if len(tm.Headers) == 0 {
+		tm.Headers = map[string]string{defaultMirrorTagHeader: "1"}
+	}
+	return tm, nil
+}
+
+// Tee method returns the shadow copy of the request if it's sampled, nil
+// otherwise. Request body is copied up to max body size while the primary
+// upstream reads it, so mirror never reads the body ahead of primary.
+func (tm *trafficMirror) Tee(req *http.Request) *mirrorCopy {
+	if !tm.sampled() || len(upgradeType(req.Header)) > 0 {
+		return nil
+	}
+	mc := &mirrorCopy{tm: tm, shadow: tm.shadowRequest(req)}
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.ContentLength > tm.MaxBodySize {
+			atomic.AddInt64(&tm.skipped, 1)
+			return nil
+		}
+		mc.body = &teeBody{ReadCloser: req.Body, max: tm.MaxBodySize}
+		req.Body = mc.body
+	}
+	return mc
+}
+
+// Close method closes the idle connections of the shadow upstream.
+func (tm *trafficMirror) Close() {
+	tm.transport.CloseIdleConnections()
+}
+
+// Stats method returns the shadow request counts.
+func (tm *trafficMirror) Stats() *MirrorStats {
+	return &MirrorStats{
+		TargetURL: tm.Target.String(),
+		Sent:      atomic.LoadInt64(&tm.sent),
+		Errors:    atomic.LoadInt64(&tm.errors),
+		Skipped:   atomic.LoadInt64(&tm.skipped),
+	}
+}
+
+func (tm *trafficMirror) shadowRequest(req *http.Request) *http.Request {
+	u := *req.URL
+	rewriteURL(tm.rewrites, &u)
+	u.Scheme, u.Host = tm.Target.Scheme, tm.Target.Host
+	u.Path, u.RawPath = singleJoiningSlash(tm.Target.Path, u.Path), ""
+	u.RawQuery = joinQuery(tm.Target.RawQuery, u.RawQuery)
+
+	// detached from client request, so client cancel does not abort it
+	shadow := (&http.Request{
+		Method:     req.Method,
+		URL:        &u,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header, len(req.Header)+2),
+		Host:       req.Host,
+	}).WithContext(context.Background())
+	for k, vv := range req.Header {
+		if isHopHeader(k) {
+			continue
+		}
+		shadow.Header[k] = append([]string(nil), vv...)
+	}
+	shadow.Header.Set("X-Forwarded-For", access.ClientIP(req))
+	for k, v := range tm.Headers {
+		shadow.Header.Set(k, v)
+	}
+	return shadow
+}
+
+func (tm *trafficMirror) sampled() bool {
+	if tm.Percent <= 0 {
+		return false
+	}
+	if tm.Percent >= 100 {
+		return true
+	}
+	tm.rndMu.Lock()
+	defer tm.rndMu.Unlock()
+	return tm.rnd.Intn(100) < tm.Percent
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// mirrorCopy type and its methods
+//______________________________________________________________________________
+
+// mirrorCopy is the shadow request of the sampled request, it's sent once
+// the primary request is served.
+type mirrorCopy struct {
+	tm     *trafficMirror
+	shadow *http.Request
+	body   *teeBody
+}
+
+// Send method sends the shadow request in the background. Request with body
+// is skipped if the primary upstream has not read it completely.
+func (mc *mirrorCopy) Send() {
+	if mc == nil {
+		return
+	}
+	tm := mc.tm
+	if mc.body != nil {
+		body, ok := mc.body.Bytes()
+		if !ok {
+			atomic.AddInt64(&tm.skipped, 1)
+			return
+		}
+		mc.shadow.Body = ioutil.NopCloser(bytes.NewReader(body))
+		mc.shadow.ContentLength = int64(len(body))
+		mc.shadow.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+
+	select {
+	case tm.inflight <- struct{}{}:
+	default:
+		atomic.AddInt64(&tm.skipped, 1)
+		return
+	}
+	go func() {
+		defer func() { <-tm.inflight }()
+		atomic.AddInt64(&tm.sent, 1)
+		res, err := tm.client.Do(mc.shadow)
+		if err != nil {
+			atomic.AddInt64(&tm.errors, 1)
+			return
+		}
+		_, _ = io.Copy(ioutil.Discard, res.Body)
+		_ = res.Body.Close()
+		if res.StatusCode >= http.StatusInternalServerError {
+			atomic.AddInt64(&tm.errors, 1)
+		}
+	}()
+}
+
+// teeBody copies the request body up to max size as it's read by the
+// primary upstream, transport reads it from its own goroutine.
+type teeBody struct {
+	io.ReadCloser
+	max      int64
+	mu       sync.Mutex
+	buf      bytes.Buffer
+	eof      bool
+	overflow bool
+}
+
+func (t *teeBody) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	t.mu.Lock()
+	if !t.overflow {
+		if int64(t.buf.Len()+n) > t.max {
+			t.overflow = true
+			t.buf = bytes.Buffer{}
+		} else {
+			t.buf.Write(p[:n])
+		}
+	}
+	if err == io.EOF {
+		t.eof = true
+	}
+	t.mu.Unlock()
+	return n, err
+}
+
+// Bytes method returns the copied body, false if it's not read completely
+// or it exceeds max size.
+func (t *teeBody) Bytes() ([]byte, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.eof || t.overflow {
+		return nil, false
+	}
+	return t.buf.Bytes(), true
+}
@@ -0,0 +1,141 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"thumbai/app/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrafficMirror(t *testing.T) {
+	received := make(chan *http.Request, 10)
+	bodies := make(chan string, 10)
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		received <- r
+		bodies <- string(b)
+		if r.URL.Path == "/v2/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer shadow.Close()
+
+	assert.Equal(t, 1, len(ValidateMirror(&models.ProxyMirror{TargetURL: "/relative"})))
+	assert.Equal(t, 2, len(ValidateMirror(&models.ProxyMirror{TargetURL: shadow.URL, Percent: 101, Timeout: "x"})))
+
+	rewrites, _ := newRewriteRules([]*models.ProxyRewrite{{Type: RewriteAddPrefix, Target: "/v2"}})
+	tm, err := newTrafficMirror(&models.ProxyMirror{
+		TargetURL:   shadow.URL,
+		Percent:     100,
+		MaxBodySize: 8,
+		Headers:     map[string]string{"X-Shadow": "yes"},
+	}, rewrites)
+	assert.Nil(t, err)
+	defer tm.Close()
+
+	// zero percent disables the mirror
+	tm.Percent = 0
+	assert.Nil(t, tm.Tee(httptest.NewRequest(http.MethodGet, "http://example.com/", nil)))
+	tm.Percent = 100
+
+	// body is copied while primary reads it, sent once primary is served
+	req := httptest.NewRequest(http.MethodPost, "http://example.com/orders?id=1", strings.NewReader("payload"))
+	req.Header.Set("Connection", "keep-alive")
+	mc := tm.Tee(req)
+	assert.NotNil(t, mc)
+	assert.Equal(t, 0, len(received))
+	b, _ := ioutil.ReadAll(req.Body)
+	assert.Equal(t, "payload", string(b))
+	mc.Send()
+	select {
+	case r := <-received:
+		assert.Equal(t, "/v2/orders", r.URL.Path)
+		assert.Equal(t, "id=1", r.URL.RawQuery)
+		assert.Equal(t, "example.com", r.Host)
+		assert.Equal(t, "yes", r.Header.Get("X-Shadow"))
+		assert.Equal(t, "", r.Header.Get("X-Thumbai-Mirror"))
+		assert.Equal(t, "payload", <-bodies)
+	case <-time.After(2 * time.Second):
+		t.Fatal("shadow request not received")
+	}
+
+	// body larger than max is skipped, primary body intact
+	req = httptest.NewRequest(http.MethodPost, "http://example.com/orders", strings.NewReader("large payload"))
+	req.ContentLength = -1
+	mc = tm.Tee(req)
+	b, _ = ioutil.ReadAll(req.Body)
+	assert.Equal(t, "large payload", string(b))
+	mc.Send()
+
+	// body not read by primary is skipped
+	tm.Tee(httptest.NewRequest(http.MethodPost, "http://example.com/orders", strings.NewReader("unread"))).Send()
+
+	// shadow 5xx is counted as error
+	tm.Tee(httptest.NewRequest(http.MethodGet, "http://example.com/fail", nil)).Send()
+	<-received
+	<-bodies
+	assert.True(t, waitFor(func() bool { return tm.Stats().Errors == 1 }))
+	stats := tm.Stats()
+	assert.Equal(t, int64(2), stats.Sent)
+	assert.Equal(t, int64(2), stats.Skipped)
+
+	// sampling
+	tm.Percent = 1
+	for i := 0; i < 100; i++ {
+		tm.Tee(httptest.NewRequest(http.MethodGet, "http://example.com/", nil)).Send()
+	}
+	assert.True(t, tm.Stats().Sent < 2+20)
+}
+
+func TestTrafficMirrorNonBlocking(t *testing.T) {
+	release := make(chan struct{})
+	var count int64
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&count, 1)
+		<-release
+	}))
+	defer shadow.Close()
+	defer close(release)
+
+	tm, err := newTrafficMirror(&models.ProxyMirror{TargetURL: shadow.URL, Percent: 100}, nil)
+	assert.Nil(t, err)
+	defer tm.Close()
+
+	start := time.Now()
+	for i := 0; i < maxMirrorInFlight+5; i++ {
+		tm.Tee(httptest.NewRequest(http.MethodGet, "http://example.com/", nil)).Send()
+	}
+	assert.True(t, time.Since(start) < time.Second)
+	assert.Equal(t, int64(5), tm.Stats().Skipped)
+}
+
+func waitFor(fn func() bool) bool {
+	for i := 0; i < 200; i++ {
+		if fn() {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
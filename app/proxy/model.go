@@ -61,13 +61,30 @@ func Import(configs map[string][]*models.ProxyRule) {
 	Load(nil)
 }
 
+// migrateRules method migrates the stored proxy rules of the host to the
+// current condition value syntax, once.
+func migrateRules(hostName string, rules []*models.ProxyRule) {
+	migrated := false
+	for _, r := range rules {
+		migrated = migrateConditions(r) || migrated
+	}
+	if !migrated {
+		return
+	}
+	if err := datastore.Put(datastore.BucketProxies, hostName, rules); err != nil {
+		aah.App().Log().Errorf("Unable to save migrated proxy rules for host: %s, error: %v", hostName, err)
+		return
+	}
+	aah.App().Log().Infof("Proxy rule conditions of host->%s are migrated to the value syntax", hostName)
+}
+
 // AddHost method adds the given host into proxies data store.
 func AddHost(proxyInfo *models.FormTargetURL) error {
 	proxyInfo.Host = strings.ToLower(proxyInfo.Host)
 	if datastore.IsKeyExists(datastore.BucketProxies, proxyInfo.Host) {
 		return datastore.ErrRecordAlreadyExists
 	}
-	proxyRule := &models.ProxyRule{Host: proxyInfo.Host, TargetURL: proxyInfo.TargetURL}
+	proxyRule := &models.ProxyRule{Host: proxyInfo.Host, TargetURL: proxyInfo.TargetURL, ConditionSyntax: conditionSyntax}
 	if err := datastore.Put(datastore.BucketProxies, proxyRule.Host, append([]*models.ProxyRule{}, proxyRule)); err != nil {
 		return err
 	}
@@ -80,6 +97,52 @@ func DelHost(hostName string) error {
 	return datastore.Del(datastore.BucketProxies, strings.ToLower(hostName))
 }
 
+// AllHostSettings method returns all the proxy host settings from the data store.
+func AllHostSettings() map[string]*models.ProxyHostSettings {
+	keys := datastore.BucketKeys(datastore.BucketProxyHosts)
+	settings := map[string]*models.ProxyHostSettings{}
+	for _, k := range keys {
+		settings[k] = GetHostSettings(k)
+	}
+	return settings
+}
+
+// GetHostSettings method returns the settings of the given host, empty
+// settings if not exists.
+func GetHostSettings(hostName string) *models.ProxyHostSettings {
+	settings := &models.ProxyHostSettings{}
+	_ = datastore.Get(datastore.BucketProxyHosts, strings.ToLower(hostName), settings)
+	return settings
+}
+
+// SaveHostSettings method saves the given host settings into data store
+// and applies it on the proxy engine.
+func SaveHostSettings(hostName string, settings *models.ProxyHostSettings) error {
+	hostName = strings.ToLower(hostName)
+	if err := datastore.Put(datastore.BucketProxyHosts, hostName, settings); err != nil {
+		return err
+	}
+	if h := Thumbai.Lookup(hostName); h != nil {
+		return h.ApplySettings(settings)
+	}
+	return nil
+}
+
+// DelHostSettings method deletes the settings of the given host.
+func DelHostSettings(hostName string) error {
+	return datastore.Del(datastore.BucketProxyHosts, strings.ToLower(hostName))
+}
+
+// ImportHostSettings method saves the given host settings, existing
+// settings of the host is overwritten.
+func ImportHostSettings(configs map[string]*models.ProxyHostSettings) {
+	for k, s := range configs {
+		if err := SaveHostSettings(k, s); err != nil {
+			aah.App().Log().Errorf("Unable to import proxy host settings for host: %s, error: %v", k, err)
+		}
+	}
+}
+
 // Get method returns configured proxy rules for the given host.
 func Get(host string) []*models.ProxyRule {
 	host = strings.ToLower(host)
@@ -101,6 +164,7 @@ func GetRule(host, targetURL string) *models.ProxyRule {
 
 // AddRule methods adds new proxy rule for the host.
 func AddRule(rule *models.ProxyRule) error {
+	rule.ConditionSyntax = conditionSyntax
 	rules := Get(rule.Host)
 	return datastore.Put(datastore.BucketProxies, rule.Host, append(rules, rule))
 }
@@ -122,6 +186,27 @@ func UpdateRule(oldTargetURL string, rule *models.ProxyRule) error {
 	return nil
 }
 
+// MoveRule method moves the proxy rule one position up or down in the
+// configured order of the host and returns the updated rules.
+func MoveRule(host, targetURL string, up bool) ([]*models.ProxyRule, error) {
+	rules := Get(host)
+	for i, r := range rules {
+		if r.TargetURL != targetURL {
+			continue
+		}
+		j := i + 1
+		if up {
+			j = i - 1
+		}
+		if j < 0 || j >= len(rules) {
+			return rules, nil
+		}
+		rules[i], rules[j] = rules[j], rules[i]
+		return rules, datastore.Put(datastore.BucketProxies, strings.ToLower(host), rules)
+	}
+	return nil, datastore.ErrRecordNotFound
+}
+
 // DelRule method deletes configured proxy rule for the given host.
 func DelRule(host, targetURL string) error {
 	rules := Get(host)
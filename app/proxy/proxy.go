@@ -15,21 +15,27 @@
 package proxy
 
 import (
-	"crypto/tls"
 	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
-	"thumbai/app/settings"
+	"time"
 
+	"thumbai/app/access"
+	"thumbai/app/accesslog"
 	"thumbai/app/models"
+	"thumbai/app/settings"
+	"thumbai/app/tracing"
 
 	"aahframe.work"
 	"aahframe.work/ahttp"
@@ -47,6 +53,9 @@ var Thumbai *proxies
 // engine.
 func Load(_ *aah.Event) {
 	log := aah.App().Log()
+	if Thumbai != nil {
+		Thumbai.Close()
+	}
 	Thumbai = &proxies{RWMutex: sync.RWMutex{}, Hosts: make(map[string]*host)}
 	allProxies := All()
 	if len(allProxies) == 0 {
@@ -55,7 +64,11 @@ func Load(_ *aah.Event) {
 	}
 
 	for h, rules := range allProxies {
+		migrateRules(h, rules)
 		host := Thumbai.AddHost(h)
+		if err := host.ApplySettings(GetHostSettings(h)); err != nil {
+			log.Error(err)
+		}
 		for _, r := range rules {
 			if err := host.AddProxyRule(r); err != nil {
 				log.Error(err)
@@ -78,68 +91,91 @@ func Load(_ *aah.Event) {
 
 // Do method performs the reverse proxy based on the header `Host` and proxy rules.
 func Do(ctx *aah.Context) {
-	host := Thumbai.Lookup(ctx.Req.Host)
+	host := Thumbai.Match(ctx.Req.Host)
 	if host == nil {
 		ctx.Reply().Status(http.StatusBadGateway).Text("502 Bad Gateway")
 		return
 	}
+	// Host and rule read locks are released during authentication and
+	// before the request is proxied, upgraded connections are streamed until
+	// the socket closes.
 	host.RLock()
-	defer host.RUnlock()
-
-	var tr *rule
-	for _, r := range host.ProxyRules {
-		if len(r.Path) > 0 || r.PathRegex != nil {
-			var rpath bool
-			if r.PathRegex == nil {
-				rpath = ctx.Req.Path == r.Path
-			} else {
-				rpath = r.PathRegex.MatchString(ctx.Req.Path)
-			}
-			if !rpath {
-				continue
-			}
+	locks := []sync.Locker{host.RLocker()}
+	unlock := func() {
+		for i := len(locks) - 1; i >= 0; i-- {
+			locks[i].Unlock()
 		}
+		locks = nil
+	}
+	defer unlock()
 
-		if len(r.QueryParams) > 0 {
-			query := true
-			for k, v := range r.QueryParams {
-				if ctx.Req.QueryValue(k) != v {
-					query = false
-					break
-				}
-			}
-			if !query {
-				continue
-			}
+	info := host.accessLogInfo()
+	ctx.Set(accesslog.KeyInfo, info)
+	span := tracing.FromContext(ctx)
+	span.SetName("proxy")
+	var tr *rule
+	start := time.Now()
+	defer func() {
+		if tr != nil {
+			info.Rule = tr.TargetURL
 		}
+		span.SetAttribute("thumbai.proxy.host", host.Name)
+		span.SetAttribute("thumbai.proxy.rule", info.Rule)
+		span.SetAttribute("thumbai.proxy.upstream", info.Upstream)
+		observeRequest(ctx, host, tr, start)
+	}()
+	if !host.checkAccess(ctx, host.Access) {
+		return
+	}
+	if host.Maintenance.Active(ctx.Req.Unwrap()) {
+		host.replyMaintenance(ctx)
+		return
+	}
+	if host.limit(ctx, host.RateLimit) {
+		return
+	}
 
-		if len(r.Headers) > 0 {
-			hdr := true
-			for k, v := range r.Headers {
-				if ctx.Req.Header.Get(k) != v {
-					hdr = false
-					break
-				}
-			}
-			if !hdr {
-				continue
-			}
+	req := ctx.Req.Unwrap()
+	for _, r := range host.ProxyRules {
+		if r.Conditions.Match(req) {
+			tr = r
+			break
 		}
-
-		tr = r
-		break
 	}
 
 	if tr == nil {
 		tr = host.LastRule
 	}
 	if tr == nil {
-		ctx.Reply().Status(http.StatusBadGateway).Text("502 Bad Gateway")
+		host.replyError(ctx, http.StatusBadGateway)
 		return
 	}
 
 	tr.RLock()
-	defer tr.RUnlock()
+	locks = append(locks, tr.RLocker())
+	if !host.checkAccess(ctx, tr.Access) {
+		return
+	}
+	if auth := tr.Auth; auth != nil {
+		// authentication could be a forward auth subrequest, it's done
+		// without host and rule locks so admin edits don't wait for it
+		unlock()
+		user, res := auth.Authenticate(ctx.Req.Unwrap())
+		if res != nil {
+			ctx.Reply().Done()
+			res.write(ctx.Res)
+			return
+		}
+		if len(user) > 0 {
+			ctx.Set(access.KeyAuthUser, user)
+		}
+		host.RLock()
+		tr.RLock()
+		locks = []sync.Locker{host.RLocker(), tr.RLocker()}
+	}
+	if host.limit(ctx, tr.RateLimit) {
+		return
+	}
 
 	// Restrict by file extensions and regex
 	if tr.RestrictFile != nil {
@@ -147,13 +183,13 @@ func Do(ctx *aah.Context) {
 		ext := strings.ToLower(path.Ext(file))
 		for _, e := range tr.RestrictFile.Extensions {
 			if ext == e {
-				ctx.Reply().Forbidden().Text("403 Forbidden")
+				host.forbidden(ctx, "")
 				return
 			}
 		}
 		for _, re := range tr.RestrictFile.Regexs {
 			if re.MatchString(file) {
-				ctx.Reply().Forbidden().Text("403 Forbidden")
+				host.forbidden(ctx, "")
 				return
 			}
 		}
@@ -174,17 +210,107 @@ func Do(ctx *aah.Context) {
 
 			tp = filepath.Join(sf.TargetPath, tp)
 			if ess.IsFileExists(tp) {
-				ctx.Reply().File(tp)
+				if tr.Compress == nil {
+					ctx.Reply().File(tp)
+					return
+				}
+				ctx.Reply().Done()
+				tr.serveFile(ctx.Res, ctx.Req.Unwrap(), tp)
 				return
 			}
 		}
 	}
 
+	if tr.Mirror != nil {
+		// shadow request is sent after the primary is served, its body is
+		// copied while the primary upstream reads it
+		defer tr.Mirror.Tee(ctx.Req.Unwrap()).Send()
+	}
+
+	var variant *splitVariant
+	if tr.Split != nil {
+		if v := tr.Split.Choose(ctx.Res, ctx.Req.Unwrap()); v != tr.Split.Stable {
+			variant = v
+		}
+	}
+
+	key := hashKey(ctx.Req, tr.HashOn)
+	// Responses of authenticated rules are per user, credential is already
+	// removed from the request so the cache can't tell them apart.
+	if variant == nil && tr.Cache != nil && tr.Auth == nil && tr.Cache.Cacheable(ctx.Req.Unwrap()) {
+		ctx.Reply().Done()
+		if len(settings.ServerHeader) > 0 {
+			ctx.Res.Header().Set(ahttp.HeaderServer, settings.ServerHeader)
+		}
+		w := tr.compressWriter(ctx.Res, ctx.Req.Unwrap())
+		defer closeWriter(w)
+		unlock()
+		tr.Cache.Serve(w, ctx.Req.Unwrap(), func(w http.ResponseWriter, r *http.Request) {
+			upStart := time.Now()
+			up := tr.proxy(w, r, key)
+			if revalidation(r) { // access log is written by now
+				return
+			}
+			if up != nil {
+				info.Upstream = up.Target
+			}
+			info.UpstreamLatency = time.Since(upStart)
+		})
+		return
+	}
+
+	var up *upstream
+	if variant != nil {
+		if up = variant.upstream; up.Saturated() {
+			up = nil
+		}
+	} else {
+		up = tr.Balancer.Next(key)
+	}
+	if up != nil && !up.breaker.Allow() {
+		up = nil
+	}
+	if up == nil {
+		tr.replyUnavailable(ctx)
+		return
+	}
+
+	var w http.ResponseWriter = ctx.Res
+	if proto := upgradeType(ctx.Req.Header); len(proto) > 0 {
+		if !tr.Upgrade.Allowed(proto) {
+			up.breaker.Cancel()
+			ctx.Reply().BadRequest().Text("400 Bad Request")
+			return
+		}
+		if !tr.Upgrade.acquire() {
+			up.breaker.Cancel()
+			host.replyError(ctx, http.StatusServiceUnavailable)
+			return
+		}
+		uw := &upgradeWriter{ResponseWriter: ctx.Res, policy: tr.Upgrade, upstream: up}
+		defer func() {
+			if !uw.hijacked {
+				tr.Upgrade.release()
+			}
+		}()
+		w = uw
+	}
+
 	ctx.Reply().Done()
 	if len(settings.ServerHeader) > 0 {
 		ctx.Res.Header().Set(ahttp.HeaderServer, settings.ServerHeader)
 	}
-	tr.Proxy.ServeHTTP(ctx.Res, ctx.Req.Unwrap())
+	w = tr.compressWriter(w, ctx.Req.Unwrap())
+	defer closeWriter(w)
+	info.Upstream = up.Target
+	unlock()
+	upStart := time.Now()
+	if variant != nil {
+		up.serve(w, ctx.Req.Unwrap())
+	} else {
+		tr.serve(w, ctx.Req.Unwrap(), up, key)
+	}
+	info.UpstreamLatency = time.Since(upStart)
 }
 
 //‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
@@ -193,7 +319,8 @@ func Do(ctx *aah.Context) {
 
 type proxies struct {
 	sync.RWMutex
-	Hosts map[string]*host
+	Hosts    map[string]*host
+	Patterns []*hostPattern
 }
 
 func (p *proxies) Lookup(hostname string) *host {
@@ -205,6 +332,29 @@ func (p *proxies) Lookup(hostname string) *host {
 	return nil
 }
 
+// Match method returns the proxy host for the request host, exact host
+// takes precedence over wildcard and regex hosts.
+func (p *proxies) Match(hostname string) *host {
+	hostname = strings.ToLower(hostname)
+	p.RLock()
+	defer p.RUnlock()
+	if h, f := p.Hosts[hostname]; f {
+		return h
+	}
+	if name, _, err := net.SplitHostPort(hostname); err == nil {
+		if h, f := p.Hosts[name]; f {
+			return h
+		}
+		hostname = name
+	}
+	for _, hp := range p.Patterns {
+		if hp.Match(hostname) {
+			return hp.host
+		}
+	}
+	return nil
+}
+
 func (p *proxies) AddHost(hostname string) *host {
 	h := p.Lookup(hostname)
 	if h == nil {
@@ -215,6 +365,10 @@ func (p *proxies) AddHost(hostname string) *host {
 		}
 		p.Lock()
 		p.Hosts[strings.ToLower(hostname)] = h
+		if hp := newHostPattern(h); hp != nil {
+			p.Patterns = append(p.Patterns, hp)
+			sortHostPatterns(p.Patterns)
+		}
 		p.Unlock()
 	}
 	return h
@@ -222,17 +376,52 @@ func (p *proxies) AddHost(hostname string) *host {
 
 func (p *proxies) DelHost(hostname string) {
 	p.Lock()
-	delete(p.Hosts, hostname)
+	if h, found := p.Hosts[strings.ToLower(hostname)]; found {
+		h.Close()
+		clearSplitStats(h.Name, "")
+		for i, hp := range p.Patterns {
+			if hp.host == h {
+				p.Patterns = append(p.Patterns[:i], p.Patterns[i+1:]...)
+				break
+			}
+		}
+	}
+	delete(p.Hosts, strings.ToLower(hostname))
 	p.Unlock()
 }
 
+// Close method stops the background activities of all the hosts.
+func (p *proxies) Close() {
+	p.RLock()
+	defer p.RUnlock()
+	for _, h := range p.Hosts {
+		h.Close()
+	}
+}
+
+// UpdateRule method builds and applies the updated proxy rule of the host,
+// rule which is skipped on load due to config error is added.
 func (p *proxies) UpdateRule(targetURL string, pr *models.ProxyRule) error {
 	if h := p.Lookup(pr.Host); h != nil {
+		if r, _ := h.LookupRule(targetURL); r == nil {
+			return h.AddProxyRule(pr)
+		}
 		return h.UpdateProxyRule(targetURL, pr)
 	}
 	return nil
 }
 
+// ReorderRules method applies the configured order of the proxy rules.
+func (p *proxies) ReorderRules(hostname string, rules []*models.ProxyRule) {
+	if h := p.Lookup(hostname); h != nil {
+		targetURLs := make([]string, 0, len(rules))
+		for _, r := range rules {
+			targetURLs = append(targetURLs, r.TargetURL)
+		}
+		h.ReorderRules(targetURLs)
+	}
+}
+
 func (p *proxies) DeleteRule(hostname, targetURL string) {
 	if h := p.Lookup(hostname); h != nil {
 		h.DelProxyRule(targetURL)
@@ -250,6 +439,15 @@ type host struct {
 	LastRule        *rule
 	ProxyRules      []*rule
 	HealthCheckPath string
+	RateLimit       *access.RateLimiter
+	Access          *access.IPFilter
+	ErrorPages      errorPages
+	Maintenance     *maintenance
+	AccessLog       models.ProxyAccessLog
+
+	// pagesMu guards ErrorPages for the requests being proxied, those are
+	// served without host lock.
+	pagesMu sync.RWMutex
 }
 
 type restrictFile struct {
@@ -267,12 +465,58 @@ func (h *host) AddProxyRule(pr *models.ProxyRule) error {
 		h.LastRule = r
 	} else {
 		h.ProxyRules = append(h.ProxyRules, r)
+		sortRules(h.ProxyRules)
 	}
 	h.Unlock()
 
 	return nil
 }
 
+// ApplySettings method applies the given host level settings.
+func (h *host) ApplySettings(settings *models.ProxyHostSettings) error {
+	var limiter *access.RateLimiter
+	var filter *access.IPFilter
+	var err error
+	if settings.RateLimit != nil {
+		if limiter, err = access.NewRateLimiter(settings.RateLimit); err != nil {
+			return fmt.Errorf("proxy rate limit config error on host->'%s': %v", h.Name, err)
+		}
+	}
+	if settings.Access != nil {
+		if filter, err = access.NewIPFilter(settings.Access); err != nil {
+			return fmt.Errorf("proxy access config error on host->'%s': %v", h.Name, err)
+		}
+	}
+	pages, err := newErrorPages(settings.ErrorPages)
+	if err != nil {
+		return fmt.Errorf("proxy error pages config error on host->'%s': %v", h.Name, err)
+	}
+	var m *maintenance
+	if settings.Maintenance != nil {
+		if m, err = newMaintenance(settings.Maintenance); err != nil {
+			return fmt.Errorf("proxy maintenance config error on host->'%s': %v", h.Name, err)
+		}
+	}
+	h.Lock()
+	h.RateLimit = limiter
+	h.Access = filter
+	h.pagesMu.Lock()
+	h.ErrorPages = pages
+	h.pagesMu.Unlock()
+	h.Maintenance = m
+	h.AccessLog = models.ProxyAccessLog{}
+	if settings.AccessLog != nil {
+		h.AccessLog = *settings.AccessLog
+	}
+	h.Unlock()
+	return nil
+}
+
+// accessLogInfo method returns the access log info with host settings.
+func (h *host) accessLogInfo() *accesslog.Info {
+	return &accesslog.Info{Disabled: h.AccessLog.Disabled, Sample: h.AccessLog.Sample}
+}
+
 func (h *host) UpdateProxyRule(targetURL string, pr *models.ProxyRule) error {
 	existingRule, i := h.LookupRule(targetURL)
 	if existingRule == nil { // no rule found
@@ -287,17 +531,110 @@ func (h *host) UpdateProxyRule(targetURL string, pr *models.ProxyRule) error {
 		h.LastRule = newRule
 	} else {
 		h.ProxyRules[i] = newRule
+		sortRules(h.ProxyRules)
 	}
 	h.Unlock()
+	existingRule.Close()
 	return nil
 }
 
+// ReorderRules method orders the proxy rules as per given target URLs and
+// then by priority.
+func (h *host) ReorderRules(targetURLs []string) {
+	h.Lock()
+	defer h.Unlock()
+	pos := make(map[string]int, len(targetURLs))
+	for i, t := range targetURLs {
+		pos[t] = i
+	}
+	sort.SliceStable(h.ProxyRules, func(i, j int) bool {
+		return pos[h.ProxyRules[i].TargetURL] < pos[h.ProxyRules[j].TargetURL]
+	})
+	sortRules(h.ProxyRules)
+}
+
 func (h *host) DelProxyRule(targetURL string) {
 	existingRule, i := h.LookupRule(targetURL)
 	if existingRule != nil {
 		h.Lock()
-		h.ProxyRules = append(h.ProxyRules[:i], h.ProxyRules[i+1:]...)
+		if i == -1 {
+			h.LastRule = nil
+		} else {
+			h.ProxyRules = append(h.ProxyRules[:i], h.ProxyRules[i+1:]...)
+		}
 		h.Unlock()
+		existingRule.Close()
+		clearSplitStats(h.Name, targetURL)
+	}
+}
+
+// UpstreamsStatus method returns the upstream targets status of all the
+// proxy rules, keyed by rule target URL.
+func (h *host) UpstreamsStatus() map[string][]*UpstreamStatus {
+	h.RLock()
+	defer h.RUnlock()
+	result := make(map[string][]*UpstreamStatus)
+	rules := h.ProxyRules
+	if h.LastRule != nil {
+		rules = append(append([]*rule{}, rules...), h.LastRule)
+	}
+	for _, r := range rules {
+		for _, u := range r.Upstreams {
+			us := u.health.Status(u.Target)
+			us.Breaker = u.breaker.State()
+			us.Upgraded = u.Upgraded()
+			us.InFlight = u.Active()
+			result[r.TargetURL] = append(result[r.TargetURL], us)
+		}
+	}
+	return result
+}
+
+// SplitStatus method returns the traffic split status of the proxy rules,
+// keyed by rule target URL.
+func (h *host) SplitStatus() map[string][]*VariantStatus {
+	h.RLock()
+	defer h.RUnlock()
+	result := make(map[string][]*VariantStatus)
+	rules := h.ProxyRules
+	if h.LastRule != nil {
+		rules = append(append([]*rule{}, rules...), h.LastRule)
+	}
+	for _, r := range rules {
+		if r.Split != nil {
+			result[r.TargetURL] = r.Split.Status()
+		}
+	}
+	return result
+}
+
+// MirrorStatus method returns the traffic mirror stats of the proxy rules,
+// keyed by rule target URL.
+func (h *host) MirrorStatus() map[string]*MirrorStats {
+	h.RLock()
+	defer h.RUnlock()
+	result := make(map[string]*MirrorStats)
+	rules := h.ProxyRules
+	if h.LastRule != nil {
+		rules = append(append([]*rule{}, rules...), h.LastRule)
+	}
+	for _, r := range rules {
+		if r.Mirror != nil {
+			result[r.TargetURL] = r.Mirror.Stats()
+		}
+	}
+	return result
+}
+
+// Close method stops the background activities of the host proxy rules.
+func (h *host) Close() {
+	h.RLock()
+	defer h.RUnlock()
+	for _, r := range h.ProxyRules {
+		r.Close()
+	}
+	if h.LastRule != nil {
+		h.LastRule.Close()
 	}
 }
 
@@ -316,20 +653,12 @@ func (h *host) LookupRule(targetURL string) (*rule, int) {
 }
 
 func (h *host) createProxyRule(pr *models.ProxyRule) (*rule, error) {
-	r := &rule{RWMutex: sync.RWMutex{}, TargetURL: pr.TargetURL, host: h}
-	r.QueryParams = pr.QueryParams
-	r.Headers = pr.Headers
-
-	pl := len(pr.Path)
-	if pl > 0 && pr.Path[0] == '{' && pr.Path[pl-1] == '}' {
-		regex, err := regexp.Compile(pr.Path[1 : pl-1])
-		if err != nil {
-			return nil, fmt.Errorf("proxy path config error on host->'%s' match->'%s': %v", h.Name, pr.Path, err)
-		}
-		r.PathRegex = regex
-	} else {
-		r.Path = pr.Path
+	r := &rule{RWMutex: sync.RWMutex{}, TargetURL: pr.TargetURL, Priority: pr.Priority, host: h}
+	conds, err := newConditions(pr)
+	if err != nil {
+		return nil, fmt.Errorf("proxy conditions config error on host->'%s' target->'%s': %v", h.Name, pr.TargetURL, err)
 	}
+	r.Conditions = conds
 
 	if len(pr.Redirects) > 0 {
 		r.ExactRedirect = make(map[string]*redirectRule)
@@ -341,6 +670,14 @@ func (h *host) createProxyRule(pr *models.ProxyRule) (*rule, error) {
 		}
 	}
 
+	if len(pr.Rewrites) > 0 {
+		rewrites, err := newRewriteRules(pr.Rewrites)
+		if err != nil {
+			return nil, fmt.Errorf("proxy rewrite config error on host->'%s' target->'%s': %v", h.Name, pr.TargetURL, err)
+		}
+		r.Rewrites = rewrites
+	}
+
 	r.ReqHdr = pr.RequestHeaders
 	r.ResHdr = pr.ResponseHeaders
 
@@ -362,7 +699,23 @@ func (h *host) createProxyRule(pr *models.ProxyRule) (*rule, error) {
 
 	r.Statics = pr.Statics
 
-	if err := r.createReverseProxy(pr.TargetURL, pr.SkipTLSVerify); err != nil {
+	if pr.Access != nil {
+		filter, err := access.NewIPFilter(pr.Access)
+		if err != nil {
+			return nil, fmt.Errorf("proxy access config error on host->'%s' target->'%s': %v", h.Name, pr.TargetURL, err)
+		}
+		r.Access = filter
+	}
+
+	if pr.Auth != nil {
+		auth, err := newAuthenticator(pr.Auth)
+		if err != nil {
+			return nil, fmt.Errorf("proxy auth config error on host->'%s' target->'%s': %v", h.Name, pr.TargetURL, err)
+		}
+		r.Auth = auth
+	}
+
+	if err := r.createUpstreams(pr); err != nil {
 		return nil, err
 	}
 	return r, nil
@@ -375,35 +728,55 @@ func (h *host) createProxyRule(pr *models.ProxyRule) (*rule, error) {
 type rule struct {
 	sync.RWMutex
 	TargetURL     string
-	Path          string
-	PathRegex     *regexp.Regexp
-	QueryParams   map[string]string
-	Headers       map[string]string
+	Priority      int
+	Conditions    *conditions
 	ExactRedirect map[string]*redirectRule
 	RegexRedirect []*redirectRule
+	Rewrites      []*rewriteRule
 	RestrictFile  *restrictFile
 	Statics       []*models.ProxyStatic
 	ReqHdr        *models.ProxyHeader
 	ResHdr        *models.ProxyHeader
-	Proxy         *httputil.ReverseProxy
+	Upstreams     []*upstream
+	Balancer      balancer
+	HashOn        string
+	Retry         *retryPolicy
+	Upgrade       *upgradePolicy
+	Cache         *responseCache
+	Compress      *compressPolicy
+	RateLimit     *access.RateLimiter
+	Access        *access.IPFilter
+	Auth          *authenticator
+	Split         *trafficSplit
+	Mirror        *trafficMirror
 	host          *host
+	transport     http.RoundTripper
+	checker       *healthChecker
+}
+
+// Close method stops the background health checks of the rule and closes
+// the idle upstream connections.
+func (r *rule) Close() {
+	if r.checker != nil {
+		r.checker.Stop()
+	}
+	if t, ok := r.transport.(*http.Transport); ok {
+		t.CloseIdleConnections()
+	}
+	if r.Mirror != nil {
+		r.Mirror.Close()
+	}
 }
 
 func (r *rule) EditConditions(pr *models.ProxyRule) error {
-	r.Lock()
-	defer r.Unlock()
-	r.QueryParams = pr.QueryParams
-	r.Headers = pr.Headers
-	pl := len(pr.Path)
-	if pl > 0 && pr.Path[0] == '{' && pr.Path[pl-1] == '}' {
-		regex, err := regexp.Compile(pr.Path[1 : pl-1])
-		if err != nil {
-			return fmt.Errorf("proxy path config error on host->'%s' match->'%s': %v", r.host.Name, pr.Path, err)
-		}
-		r.PathRegex = regex
-	} else {
-		r.Path = pr.Path
+	conds, err := newConditions(pr)
+	if err != nil {
+		return fmt.Errorf("proxy conditions config error on host->'%s' target->'%s': %v", r.host.Name, pr.TargetURL, err)
 	}
+	r.Lock()
+	r.Conditions = conds
+	r.Priority = pr.Priority
+	r.Unlock()
 	return nil
 }
 
@@ -469,16 +842,224 @@ func (r *rule) checkRedirects(ctx *aah.Context) bool {
 	return false
 }
 
-func (r *rule) createReverseProxy(targetURL string, skipTLSVerify bool) error {
-	target, err := url.Parse(targetURL)
+// replyUnavailable method writes the response when no upstream could serve
+// the request.
+func (r *rule) replyUnavailable(ctx *aah.Context) {
+	ctx.Reply().Done()
+	if len(settings.ServerHeader) > 0 {
+		ctx.Res.Header().Set(ahttp.HeaderServer, settings.ServerHeader)
+	}
+	r.writeUnavailable(ctx.Res, ctx.Req.Unwrap())
+}
+
+// writeUnavailable method writes the response when no upstream could serve
+// the request, circuit breaker response body takes precedence over host
+// error page.
+func (r *rule) writeUnavailable(w http.ResponseWriter, req *http.Request) {
+	code, body, retryAfter := r.unavailable()
+	if len(retryAfter) > 0 {
+		w.Header().Set(ahttp.HeaderRetryAfter, retryAfter)
+	}
+	if len(body) == 0 {
+		r.host.writeError(w, req, code)
+		return
+	}
+	w.Header().Set(ahttp.HeaderContentType, http.DetectContentType([]byte(body)))
+	w.WriteHeader(code)
+	_, _ = w.Write([]byte(body))
+}
+
+// unavailable method returns the response status, body and `Retry-After`
+// value when no upstream could serve the request. Circuit breaker response
+// is used if any breaker is open, 503 if upstreams are at max in-flight.
+// Body is empty unless circuit breaker has the custom response body.
+func (r *rule) unavailable() (int, string, string) {
+	saturated := false
+	for _, u := range r.Upstreams {
+		if u.breaker != nil && u.breaker.State() != BreakerClosed {
+			return u.breaker.ResponseStatus, u.breaker.ResponseBody, ""
+		}
+		if u.Saturated() {
+			saturated = true
+		}
+	}
+	if saturated {
+		return http.StatusServiceUnavailable, "", "1"
+	}
+	return http.StatusBadGateway, "", ""
+}
+
+// compressWriter method returns the compress writer if the rule has
+// compression and the request accepts it, otherwise given writer as-is.
+func (r *rule) compressWriter(w http.ResponseWriter, req *http.Request) http.ResponseWriter {
+	if r.Compress == nil {
+		return w
+	}
+	if cw := r.Compress.Wrap(w, req); cw != nil {
+		return cw
+	}
+	return w
+}
+
+// serveFile method serves the static file with compression.
+func (r *rule) serveFile(w http.ResponseWriter, req *http.Request, file string) {
+	if len(settings.ServerHeader) > 0 {
+		w.Header().Set(ahttp.HeaderServer, settings.ServerHeader)
+	}
+	w = r.compressWriter(w, req)
+	defer closeWriter(w)
+	http.ServeFile(w, req, file)
+}
+
+// proxy method picks the upstream and proxies the request, it's used
+// where aah reply is not applicable such as cache fetch. It returns the
+// picked upstream, nil if none is available.
+func (r *rule) proxy(w http.ResponseWriter, req *http.Request, key string) *upstream {
+	up := r.Balancer.Next(key)
+	if up != nil && !up.breaker.Allow() {
+		up = nil
+	}
+	if up == nil {
+		r.writeUnavailable(w, req)
+		return nil
+	}
+	r.serve(w, req, up, key)
+	return up
+}
+
+// recordResult method records the upstream request result into circuit
+// breaker and logs the state changes.
+func (r *rule) recordResult(u *upstream, success bool) {
+	if !success && u.variant != nil {
+		u.variant.recordError()
+	}
+	if !u.breaker.Record(success) {
+		return
+	}
+	switch u.breaker.State() {
+	case BreakerOpen:
+		aah.App().Log().Warnf("Proxy upstream '%s' of host '%s' circuit breaker is open, taken out of rotation for %s",
+			u.Target, r.host.Name, u.breaker.OpenTimeout)
+	case BreakerClosed:
+		aah.App().Log().Infof("Proxy upstream '%s' of host '%s' circuit breaker is closed, restored into rotation",
+			u.Target, r.host.Name)
+	}
+}
+
+func (r *rule) createUpstreams(pr *models.ProxyRule) error {
+	transport, err := newTransport(pr)
 	if err != nil {
-		return fmt.Errorf("proxy target URL error on host->'%s' match->'%s': %v", r.host.Name, targetURL, err)
+		return fmt.Errorf("proxy transport config error on host->'%s' target->'%s': %v", r.host.Name, pr.TargetURL, err)
+	}
+	r.transport = transport
+
+	for _, t := range ruleTargets(pr) {
+		target, err := url.Parse(t.URL)
+		if err != nil {
+			return fmt.Errorf("proxy target URL error on host->'%s' match->'%s': %v", r.host.Name, t.URL, err)
+		}
+		u := &upstream{Target: t.URL, URL: target, Weight: t.Weight, maxInFlight: int64(pr.MaxInFlight)}
+		if pr.CircuitBreaker != nil {
+			if u.breaker, err = newCircuitBreaker(pr.CircuitBreaker); err != nil {
+				return fmt.Errorf("proxy circuit breaker config error on host->'%s' target->'%s': %v", r.host.Name, pr.TargetURL, err)
+			}
+		}
+		u.Proxy = r.createReverseProxy(u, transport)
+		r.Upstreams = append(r.Upstreams, u)
+	}
+
+	if pr.Mirror != nil {
+		if r.Mirror, err = newTrafficMirror(pr.Mirror, r.Rewrites); err != nil {
+			return fmt.Errorf("proxy mirror config error on host->'%s' target->'%s': %v", r.host.Name, pr.TargetURL, err)
+		}
+	}
+
+	if pr.Split != nil {
+		if r.Split, err = newTrafficSplit(r.host.Name, pr.TargetURL, pr.Split); err != nil {
+			return fmt.Errorf("proxy traffic split config error on host->'%s' target->'%s': %v", r.host.Name, pr.TargetURL, err)
+		}
+		for _, u := range r.Upstreams {
+			u.variant = r.Split.Stable
+		}
+		for _, v := range r.Split.Variants {
+			target, err := url.Parse(v.TargetURL)
+			if err != nil {
+				return fmt.Errorf("proxy traffic split target URL error on host->'%s' variant->'%s': %v", r.host.Name, v.Name, err)
+			}
+			u := &upstream{Target: v.TargetURL, URL: target, Weight: 1, maxInFlight: int64(pr.MaxInFlight), variant: v}
+			if pr.CircuitBreaker != nil {
+				if u.breaker, err = newCircuitBreaker(pr.CircuitBreaker); err != nil {
+					return fmt.Errorf("proxy circuit breaker config error on host->'%s' target->'%s': %v", r.host.Name, pr.TargetURL, err)
+				}
+			}
+			u.Proxy = r.createReverseProxy(u, transport)
+			v.upstream = u
+		}
+	}
+
+	strategy := StrategyRoundRobin
+	if pr.LoadBalancer != nil {
+		if !IsSupportedStrategy(pr.LoadBalancer.Strategy) {
+			return fmt.Errorf("proxy load balancer config error on host->'%s' target->'%s': unsupported strategy '%s'",
+				r.host.Name, pr.TargetURL, pr.LoadBalancer.Strategy)
+		}
+		if len(pr.LoadBalancer.Strategy) > 0 {
+			strategy = pr.LoadBalancer.Strategy
+		}
+		r.HashOn = pr.LoadBalancer.HashOn
+	}
+	r.Balancer = newBalancer(strategy, r.Upstreams)
+
+	if r.Upgrade, err = newUpgradePolicy(pr.Upgrade); err != nil {
+		return fmt.Errorf("proxy upgrade config error on host->'%s' target->'%s': %v", r.host.Name, pr.TargetURL, err)
+	}
+
+	if pr.RateLimit != nil {
+		if r.RateLimit, err = access.NewRateLimiter(pr.RateLimit); err != nil {
+			return fmt.Errorf("proxy rate limit config error on host->'%s' target->'%s': %v", r.host.Name, pr.TargetURL, err)
+		}
+	}
+
+	if pr.Compress != nil {
+		r.Compress = newCompressPolicy(pr.Compress)
 	}
 
+	if pr.Cache != nil {
+		if r.Cache, err = newResponseCache(r.host.Name, pr.TargetURL, pr.Cache); err != nil {
+			return fmt.Errorf("proxy cache config error on host->'%s' target->'%s': %v", r.host.Name, pr.TargetURL, err)
+		}
+	}
+
+	if pr.Retry != nil {
+		policy, err := newRetryPolicy(pr.Retry)
+		if err != nil {
+			return fmt.Errorf("proxy retry config error on host->'%s' target->'%s': %v", r.host.Name, pr.TargetURL, err)
+		}
+		r.Retry = policy
+	}
+
+	if pr.HealthCheck != nil {
+		checker, err := newHealthChecker(pr.HealthCheck, r.transport)
+		if err != nil {
+			return fmt.Errorf("proxy health check config error on host->'%s' target->'%s': %v", r.host.Name, pr.TargetURL, err)
+		}
+		r.checker = checker
+		for _, u := range r.Upstreams {
+			u.health = &healthState{}
+			checker.Start(r.host.Name, u)
+		}
+	}
+	return nil
+}
+
+func (r *rule) createReverseProxy(u *upstream, transport http.RoundTripper) *httputil.ReverseProxy {
+	target := u.URL
 	targetQuery := target.RawQuery
+	u.labels = []string{r.host.Name, r.TargetURL, u.Target}
 	director := func(req *http.Request) {
 		req.URL.Scheme = target.Scheme
 		req.URL.Host = target.Host
+		rewriteURL(r.Rewrites, req.URL)
 		req.URL.Path = singleJoiningSlash(target.Path, req.URL.Path)
 
 		if targetQuery == "" || req.URL.RawQuery == "" {
@@ -518,29 +1099,42 @@ func (r *rule) createReverseProxy(targetURL string, skipTLSVerify bool) error {
 		if len(settings.ServerHeader) > 0 {
 			w.Header.Del(ahttp.HeaderServer)
 		}
+		// thumbai writes its own request ID and trace context
+		w.Header.Del(ahttp.HeaderXRequestID)
+		w.Header.Del(tracing.HeaderTraceparent)
+		r.recordResult(u, w.StatusCode < http.StatusInternalServerError)
+		upstreamRequestsTotal.Inc(r.host.Name, r.TargetURL, u.Target, strconv.Itoa(w.StatusCode))
+		if w.StatusCode != http.StatusSwitchingProtocols {
+			w.Body = &countingBody{ReadCloser: w.Body, labels: u.labels}
+		}
+		if r.retryableStatus(w) {
+			return errRetryStatus
+		}
 		return nil
 	}
 
-	// for now use default transport
-	// later we can enhance it more options
-	transport := http.DefaultTransport.(*http.Transport)
-	if skipTLSVerify {
-		// #nosec
-		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
-	}
-
-	r.Proxy = &httputil.ReverseProxy{
+	return &httputil.ReverseProxy{
 		Director:       director,
 		Transport:      transport,
 		ModifyResponse: modifyResponse,
 		ErrorLog:       aah.App().Log().ToGoLogger(),
 		ErrorHandler: func(rw http.ResponseWriter, req *http.Request, err error) {
-			aah.App().Log().Errorf("thumbai: proxy error: %v", err)
-			rw.WriteHeader(http.StatusBadGateway)
+			switch {
+			case err == errRetryStatus: // already recorded on response
+			case req.Context().Err() != nil: // client gone, not an upstream failure
+				u.breaker.Cancel()
+				upstreamRequestsTotal.Inc(r.host.Name, r.TargetURL, u.Target, "canceled")
+			default:
+				aah.App().Log().Errorf("thumbai: proxy error (request id: %s): %v", req.Header.Get(ahttp.HeaderXRequestID), err)
+				r.recordResult(u, false)
+				upstreamRequestsTotal.Inc(r.host.Name, r.TargetURL, u.Target, "error")
+			}
+			if r.retryable(req, err) {
+				return
+			}
+			r.host.writeError(rw, req, upstreamErrorStatus(err))
 		},
 	}
-
-	return nil
 }
 
 //‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
@@ -577,6 +1171,34 @@ func (r *redirectRule) ProcessVars(req *ahttp.Request) string {
 // Unexported methods
 //______________________________________________________________________________
 
+// ruleTargets method returns the upstream targets of the proxy rule. Rule
+// `TargetURL` is always part of the targets, weight defaults to 1.
+func ruleTargets(pr *models.ProxyRule) []*models.ProxyTarget {
+	targets := make([]*models.ProxyTarget, 0, len(pr.Targets)+1)
+	found := false
+	for _, t := range pr.Targets {
+		if t.URL == pr.TargetURL {
+			found = true
+		}
+		targets = append(targets, &models.ProxyTarget{URL: t.URL, Weight: t.Weight})
+	}
+	if !found {
+		targets = append([]*models.ProxyTarget{{URL: pr.TargetURL}}, targets...)
+	}
+	for _, t := range targets {
+		if t.Weight <= 0 {
+			t.Weight = 1
+		}
+	}
+	return targets
+}
+
+func closeWriter(w http.ResponseWriter) {
+	if c, ok := w.(io.Closer); ok {
+		_ = c.Close()
+	}
+}
+
 func singleJoiningSlash(a, b string) string {
 	aslash := strings.HasSuffix(a, "/")
 	bslash := strings.HasPrefix(b, "/")
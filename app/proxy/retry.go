@@ -0,0 +1,276 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"thumbai/app/models"
+
+	"aahframe.work"
+	"aahframe.work/ahttp"
+)
+
+// Retry default values
+const (
+	defaultRetryBackoff     = 100 * time.Millisecond
+	defaultRetryMaxBackoff  = 2 * time.Second
+	defaultRetryMaxBodySize = 1 << 20 // 1MB
+)
+
+type retryCtxKey struct{}
+
+// errRetryStatus is returned from `ModifyResponse` to signal the retryable
+// response status to the `ErrorHandler`.
+var errRetryStatus = errors.New("thumbai: retryable upstream response status")
+
+// ValidateRetry method validates the given retry configuration and returns
+// the field errors if any.
+func ValidateRetry(rp *models.ProxyRetry) map[string]string {
+	errs := map[string]string{}
+	if rp.MaxAttempts < 2 {
+		errs["retryMaxAttempts"] = "Must be 2 or more, including the first attempt"
+	}
+	if !rp.OnConnectError && len(rp.Statuses) == 0 {
+		errs["retryStatuses"] = "Either connect error or status codes is required"
+	}
+	for _, code := range rp.Statuses {
+		if code < 400 || code > 599 {
+			errs["retryStatuses"] = "Status codes must be 4xx or 5xx"
+			break
+		}
+	}
+	if _, err := parseDuration(rp.Backoff, defaultRetryBackoff); err != nil {
+		errs["retryBackoff"] = "Invalid duration value, e.g.: 100ms"
+	}
+	if rp.MaxBodySize < 0 {
+		errs["retryMaxBodySize"] = "Must be a positive number"
+	}
+	return errs
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// Retry policy type and its methods
+//______________________________________________________________________________
+
+// retryPolicy holds the parsed retry configuration of the proxy rule.
+type retryPolicy struct {
+	MaxAttempts        int
+	OnConnectError     bool
+	Statuses           map[int]bool
+	AllowNonIdempotent bool
+	Backoff            time.Duration
+	MaxBodySize        int64
+}
+
+// retryAttempt holds the state of current attempt, it's passed to reverse
+// proxy via request context.
+type retryAttempt struct {
+	last bool
+	err  error
+}
+
+func newRetryPolicy(rp *models.ProxyRetry) (*retryPolicy, error) {
+	backoff, err := parseDuration(rp.Backoff, defaultRetryBackoff)
+	if err != nil {
+		return nil, err
+	}
+	p := &retryPolicy{
+		MaxAttempts:        rp.MaxAttempts,
+		OnConnectError:     rp.OnConnectError,
+		Statuses:           make(map[int]bool),
+		AllowNonIdempotent: rp.AllowNonIdempotent,
+		Backoff:            backoff,
+		MaxBodySize:        rp.MaxBodySize,
+	}
+	for _, code := range rp.Statuses {
+		p.Statuses[code] = true
+	}
+	if p.MaxBodySize <= 0 {
+		p.MaxBodySize = defaultRetryMaxBodySize
+	}
+	return p, nil
+}
+
+// Eligible method returns true if request method could be retried, upgrade
+// requests are never retried.
+func (p *retryPolicy) Eligible(req *http.Request) bool {
+	if len(upgradeType(req.Header)) > 0 {
+		return false
+	}
+	if p.AllowNonIdempotent {
+		return true
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace,
+		http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// BackoffFor method returns the exponential backoff duration for the
+// given retry number, starts from 1.
+func (p *retryPolicy) BackoffFor(retry int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < retry && d < defaultRetryMaxBackoff; i++ {
+		d *= 2
+	}
+	if d > defaultRetryMaxBackoff {
+		d = defaultRetryMaxBackoff
+	}
+	return d
+}
+
+// bufferBody method reads the request body into memory up to the max body
+// size so it could be replayed. It returns false if body is too large, in
+// that case request body is left intact.
+func (p *retryPolicy) bufferBody(req *http.Request) ([]byte, bool) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, true
+	}
+	if req.ContentLength > p.MaxBodySize {
+		return nil, false
+	}
+	buf, err := ioutil.ReadAll(io.LimitReader(req.Body, p.MaxBodySize+1))
+	if err != nil || int64(len(buf)) > p.MaxBodySize {
+		req.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(buf), req.Body), req.Body}
+		return nil, false
+	}
+	_ = req.Body.Close()
+	return buf, true
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// Rule unexported methods
+//______________________________________________________________________________
+
+// serve method proxies the request to the upstream, on retryable failure it
+// retries with backoff preferably on a different upstream.
+func (r *rule) serve(w http.ResponseWriter, req *http.Request, up *upstream, key string) {
+	if r.Retry == nil || !r.Retry.Eligible(req) {
+		up.serve(w, req)
+		return
+	}
+	body, ok := r.Retry.bufferBody(req)
+	if !ok {
+		up.serve(w, req)
+		return
+	}
+
+	ra := &retryAttempt{}
+	req = req.WithContext(context.WithValue(req.Context(), retryCtxKey{}, ra))
+	tried := make(map[*upstream]bool)
+	for attempt := 1; ; attempt++ {
+		ra.last, ra.err = attempt >= r.Retry.MaxAttempts, nil
+		if body != nil {
+			req.Body = ioutil.NopCloser(bytes.NewReader(body))
+			req.ContentLength = int64(len(body))
+		}
+		tried[up] = true
+		up.serve(w, req)
+		if ra.err == nil {
+			return
+		}
+
+		aah.App().Log().Warnf("Proxy upstream '%s' of host '%s' attempt %d failed, retrying (request id: %s): %v",
+			up.Target, r.host.Name, attempt, req.Header.Get(ahttp.HeaderXRequestID), ra.err)
+		select {
+		case <-req.Context().Done():
+			return
+		case <-time.After(r.Retry.BackoffFor(attempt)):
+		}
+
+		if up = r.nextUpstream(key, tried); up == nil {
+			r.host.writeError(w, req, upstreamErrorStatus(ra.err))
+			return
+		}
+	}
+}
+
+// nextUpstream method picks the upstream for retry, untried one is preferred.
+func (r *rule) nextUpstream(key string, tried map[*upstream]bool) *upstream {
+	var next *upstream
+	for i := 0; i < len(r.Upstreams); i++ {
+		u := r.Balancer.Next(key)
+		if u == nil {
+			break
+		}
+		if next == nil || !tried[u] {
+			next = u
+		}
+		if !tried[u] {
+			break
+		}
+	}
+	if next != nil && !next.breaker.Allow() {
+		return nil
+	}
+	return next
+}
+
+// retryable method reports whether the failed attempt could be retried. It
+// records the failure on the attempt.
+func (r *rule) retryable(req *http.Request, err error) bool {
+	ra, ok := req.Context().Value(retryCtxKey{}).(*retryAttempt)
+	if !ok || ra.last || req.Context().Err() != nil {
+		return false
+	}
+	if err == errRetryStatus || (r.Retry.OnConnectError && connectError(err)) {
+		ra.err = err
+		return true
+	}
+	return false
+}
+
+// connectError method reports whether the error occurred while connecting
+// to the upstream, the request is not sent yet so it's safe to retry.
+func connectError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// retryableStatus method reports whether the upstream response status could
+// be retried for the request.
+func (r *rule) retryableStatus(res *http.Response) bool {
+	if r.Retry == nil || !r.Retry.Statuses[res.StatusCode] {
+		return false
+	}
+	ra, ok := res.Request.Context().Value(retryCtxKey{}).(*retryAttempt)
+	return ok && !ra.last
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// Upstream unexported methods
+//______________________________________________________________________________
+
+func (u *upstream) serve(w http.ResponseWriter, req *http.Request) {
+	u.acquire()
+	defer u.release()
+	if len(u.labels) > 0 {
+		defer upstreamDuration.ObserveSince(time.Now(), u.labels...)
+	}
+	u.Proxy.ServeHTTP(w, req)
+}
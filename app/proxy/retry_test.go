@@ -0,0 +1,95 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"thumbai/app/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	p, err := newRetryPolicy(&models.ProxyRetry{MaxAttempts: 3, Statuses: []int{502, 503}})
+	assert.Nil(t, err)
+	assert.True(t, p.Statuses[503])
+	assert.False(t, p.Statuses[500])
+
+	assert.True(t, p.Eligible(httptest.NewRequest(http.MethodGet, "/", nil)))
+	assert.True(t, p.Eligible(httptest.NewRequest(http.MethodPut, "/", nil)))
+	assert.False(t, p.Eligible(httptest.NewRequest(http.MethodPost, "/", nil)))
+	p.AllowNonIdempotent = true
+	assert.True(t, p.Eligible(httptest.NewRequest(http.MethodPost, "/", nil)))
+
+	assert.Equal(t, 100*time.Millisecond, p.BackoffFor(1))
+	assert.Equal(t, 400*time.Millisecond, p.BackoffFor(3))
+	assert.Equal(t, defaultRetryMaxBackoff, p.BackoffFor(10))
+}
+
+func TestRetryBufferBody(t *testing.T) {
+	p, _ := newRetryPolicy(&models.ProxyRetry{MaxAttempts: 2, OnConnectError: true, MaxBodySize: 8})
+
+	req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader("thumbai"))
+	buf, ok := p.bufferBody(req)
+	assert.True(t, ok)
+	assert.Equal(t, "thumbai", string(buf))
+
+	// too large, body must be intact
+	req = httptest.NewRequest(http.MethodPut, "/", strings.NewReader("thumbai proxy"))
+	req.ContentLength = -1
+	buf, ok = p.bufferBody(req)
+	assert.False(t, ok)
+	assert.Nil(t, buf)
+	body, _ := ioutil.ReadAll(req.Body)
+	assert.Equal(t, "thumbai proxy", string(body))
+
+	_, ok = p.bufferBody(httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.True(t, ok)
+}
+
+func TestValidateRetry(t *testing.T) {
+	errs := ValidateRetry(&models.ProxyRetry{MaxAttempts: 1})
+	assert.Equal(t, 2, len(errs))
+
+	errs = ValidateRetry(&models.ProxyRetry{MaxAttempts: 3, Statuses: []int{200}, Backoff: "abc"})
+	assert.Equal(t, 2, len(errs))
+
+	errs = ValidateRetry(&models.ProxyRetry{MaxAttempts: 3, OnConnectError: true, Statuses: []int{503}})
+	assert.Equal(t, 0, len(errs))
+}
+
+func TestRetryableConnectError(t *testing.T) {
+	p, _ := newRetryPolicy(&models.ProxyRetry{MaxAttempts: 2, OnConnectError: true})
+	r := &rule{Retry: p}
+	newReq := func() *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		return req.WithContext(context.WithValue(req.Context(), retryCtxKey{}, &retryAttempt{}))
+	}
+
+	dialErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	assert.True(t, r.retryable(newReq(), dialErr))
+	assert.False(t, r.retryable(newReq(), &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}))
+	assert.False(t, r.retryable(newReq(), errors.New("net/http: timeout awaiting response headers")))
+	assert.True(t, r.retryable(newReq(), errRetryStatus))
+}
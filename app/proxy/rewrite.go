@@ -0,0 +1,128 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"thumbai/app/models"
+)
+
+// Rewrite types
+const (
+	RewriteStripPrefix  = "strip-prefix"
+	RewriteAddPrefix    = "add-prefix"
+	RewriteReplace      = "replace"
+	RewriteQueryReplace = "query-replace"
+)
+
+var rewriteGroupRegex = regexp.MustCompile(`\{(\d+)\}`)
+
+// rewriteRule is the compiled form of proxy rewrite. Regex match uses the
+// syntax `{regex}` same as path condition and redirects, capture groups are
+// referenced as `{1}` in the target.
+type rewriteRule struct {
+	Type   string
+	Match  string
+	Regex  *regexp.Regexp
+	Target string
+}
+
+func newRewriteRules(rewrites []*models.ProxyRewrite) ([]*rewriteRule, error) {
+	var rules []*rewriteRule
+	for _, rw := range rewrites {
+		rr := &rewriteRule{Type: rw.Type, Match: rw.Match, Target: rw.Target}
+		switch rw.Type {
+		case RewriteStripPrefix, RewriteAddPrefix:
+		case RewriteReplace, RewriteQueryReplace:
+			ml := len(rw.Match)
+			if ml > 1 && rw.Match[0] == '{' && rw.Match[ml-1] == '}' {
+				regex, err := regexp.Compile(rw.Match[1 : ml-1])
+				if err != nil {
+					return nil, fmt.Errorf("rewrite regex '%s': %v", rw.Match, err)
+				}
+				rr.Regex = regex
+				rr.Target = rewriteGroupRegex.ReplaceAllString(strings.Replace(rw.Target, "$", "$$", -1), "$${$1}")
+			}
+		default:
+			return nil, fmt.Errorf("unsupported rewrite type '%s'", rw.Type)
+		}
+		rules = append(rules, rr)
+	}
+	return rules, nil
+}
+
+// rewriteURL method applies the rewrite rules in the order on the request URL
+// path and query. Target of path replace could have query string, it's
+// prepended to the request query.
+func rewriteURL(rules []*rewriteRule, u *url.URL) {
+	if len(rules) == 0 {
+		return
+	}
+	p, q := u.Path, u.RawQuery
+	for _, rr := range rules {
+		switch rr.Type {
+		case RewriteStripPrefix:
+			if strings.HasPrefix(p, rr.Match) {
+				p = p[len(rr.Match):]
+				if !strings.HasPrefix(p, "/") {
+					p = "/" + p
+				}
+			}
+		case RewriteAddPrefix:
+			p = singleJoiningSlash(rr.Target, p)
+		case RewriteReplace:
+			np, matched := rr.replace(p)
+			if !matched {
+				continue
+			}
+			if idx := strings.IndexByte(np, '?'); idx > -1 {
+				np, q = np[:idx], joinQuery(np[idx+1:], q)
+			}
+			p = np
+		case RewriteQueryReplace:
+			if nq, matched := rr.replace(q); matched {
+				q = strings.Trim(strings.Replace(nq, "&&", "&", -1), "&")
+			}
+		}
+	}
+	if p != u.Path {
+		u.Path, u.RawPath = p, ""
+	}
+	u.RawQuery = q
+}
+
+func (rr *rewriteRule) replace(s string) (string, bool) {
+	if rr.Regex == nil {
+		if s == rr.Match {
+			return rr.Target, true
+		}
+		return s, false
+	}
+	if !rr.Regex.MatchString(s) {
+		return s, false
+	}
+	return rr.Regex.ReplaceAllString(s, rr.Target), true
+}
+
+func joinQuery(a, b string) string {
+	if len(a) == 0 || len(b) == 0 {
+		return a + b
+	}
+	return a + "&" + b
+}
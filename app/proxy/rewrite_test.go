@@ -0,0 +1,106 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"net/url"
+	"testing"
+
+	"thumbai/app/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRewriteURL(t *testing.T) {
+	testcases := []struct {
+		label    string
+		rewrites []*models.ProxyRewrite
+		input    string
+		expected string
+	}{
+		{
+			label:    "strip prefix",
+			rewrites: []*models.ProxyRewrite{{Type: RewriteStripPrefix, Match: "/api"}},
+			input:    "/api/users?page=2",
+			expected: "/users?page=2",
+		},
+		{
+			label:    "strip prefix to root",
+			rewrites: []*models.ProxyRewrite{{Type: RewriteStripPrefix, Match: "/api"}},
+			input:    "/api",
+			expected: "/",
+		},
+		{
+			label: "strip and add prefix",
+			rewrites: []*models.ProxyRewrite{
+				{Type: RewriteStripPrefix, Match: "/api/"},
+				{Type: RewriteAddPrefix, Target: "/v2"},
+			},
+			input:    "/api/users",
+			expected: "/v2/users",
+		},
+		{
+			label:    "regex replace",
+			rewrites: []*models.ProxyRewrite{{Type: RewriteReplace, Match: `{^/v1/(.*)$}`, Target: "/legacy/{1}"}},
+			input:    "/v1/orders/10?x=1",
+			expected: "/legacy/orders/10?x=1",
+		},
+		{
+			label:    "regex replace not matched",
+			rewrites: []*models.ProxyRewrite{{Type: RewriteReplace, Match: `{^/v1/(.*)$}`, Target: "/legacy/{1}"}},
+			input:    "/v2/orders",
+			expected: "/v2/orders",
+		},
+		{
+			label:    "replace with query",
+			rewrites: []*models.ProxyRewrite{{Type: RewriteReplace, Match: `{^/item/(\d+)$}`, Target: "/item.php?id={1}"}},
+			input:    "/item/42?ref=home",
+			expected: "/item.php?id=42&ref=home",
+		},
+		{
+			label:    "exact replace",
+			rewrites: []*models.ProxyRewrite{{Type: RewriteReplace, Match: "/old", Target: "/new"}},
+			input:    "/old",
+			expected: "/new",
+		},
+		{
+			label:    "query replace",
+			rewrites: []*models.ProxyRewrite{{Type: RewriteQueryReplace, Match: `{(^|&)token=[^&]*}`, Target: ""}},
+			input:    "/search?token=abc&q=go",
+			expected: "/search?q=go",
+		},
+		{
+			label:    "query rename",
+			rewrites: []*models.ProxyRewrite{{Type: RewriteQueryReplace, Match: `{(^|&)q=}`, Target: "{1}query="}},
+			input:    "/search?lang=en&q=go",
+			expected: "/search?lang=en&query=go",
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.label, func(t *testing.T) {
+			rules, err := newRewriteRules(tc.rewrites)
+			assert.Nil(t, err)
+			u, _ := url.Parse(tc.input)
+			rewriteURL(rules, u)
+			assert.Equal(t, tc.expected, u.RequestURI())
+		})
+	}
+
+	_, err := newRewriteRules([]*models.ProxyRewrite{{Type: "rename"}})
+	assert.NotNil(t, err)
+	_, err = newRewriteRules([]*models.ProxyRewrite{{Type: RewriteReplace, Match: "{(}"}})
+	assert.NotNil(t, err)
+}
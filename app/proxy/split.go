@@ -0,0 +1,307 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"thumbai/app/models"
+)
+
+// SplitStable is the variant name of the proxy rule own targets, it gets
+// the remaining traffic of the split.
+const SplitStable = "stable"
+
+// Split sticky keys, `header:<Header-Name>` or `cookie:<cookie-name>`.
+const (
+	splitStickyHeader = "header:"
+	splitStickyCookie = "cookie:"
+)
+
+const splitAssignCookieMaxAge = 30 * 24 * 60 * 60 // 30 days
+
+// ValidateSplit method validates the given traffic split configuration and
+// returns the field errors if any.
+func ValidateSplit(s *models.ProxySplit) map[string]string {
+	errs := map[string]string{}
+	if len(s.Variants) == 0 {
+		errs["splitVariants"] = "At least one variant is required"
+	}
+	total := 0
+	names := map[string]bool{SplitStable: true}
+	for _, v := range s.Variants {
+		if names[v.Name] || len(v.Name) == 0 {
+			errs["splitVariants"] = "Variant name must be unique and not '" + SplitStable + "': " + v.Name
+		}
+		names[v.Name] = true
+		if u, err := url.Parse(v.TargetURL); err != nil || !u.IsAbs() {
+			errs["splitVariants"] = "Variant target URL must be absolute: " + v.TargetURL
+		}
+		if v.Weight < 0 {
+			errs["splitVariants"] = "Variant weight must be a positive number: " + v.Name
+		}
+		total += v.Weight
+	}
+	if total > 100 {
+		errs["splitVariants"] = "Sum of variant weights must not exceed 100"
+	}
+	if len(s.StickyOn) > 0 {
+		key := stickyName(s.StickyOn)
+		if (!strings.HasPrefix(s.StickyOn, splitStickyHeader) && !strings.HasPrefix(s.StickyOn, splitStickyCookie)) || len(key) == 0 {
+			errs["splitStickyOn"] = "Supported values are header:<Header-Name> and cookie:<cookie-name>"
+		}
+	}
+	return errs
+}
+
+// SplitStatus method returns the traffic split variants status of the given
+// host, it is keyed by proxy rule target URL.
+func SplitStatus(hostName string) map[string][]*VariantStatus {
+	h := Thumbai.Lookup(hostName)
+	if h == nil {
+		return map[string][]*VariantStatus{}
+	}
+	return h.SplitStatus()
+}
+
+// ResetSplitStats method resets the request and error counts of the proxy
+// rule split variants.
+func ResetSplitStats(hostName, targetURL string) {
+	prefix := strings.ToLower(hostName) + "|" + targetURL + "|"
+	splitStats.Lock()
+	defer splitStats.Unlock()
+	for k, c := range splitStats.counters {
+		if strings.HasPrefix(k, prefix) {
+			atomic.StoreInt64(&c.requests, 0)
+			atomic.StoreInt64(&c.errors, 0)
+		}
+	}
+}
+
+// clearSplitStats method removes the split variant counters of the deleted
+// proxy rule, all the rules of the host if target URL is empty.
+func clearSplitStats(hostName, targetURL string) {
+	prefix := strings.ToLower(hostName) + "|"
+	if len(targetURL) > 0 {
+		prefix += targetURL + "|"
+	}
+	splitStats.Lock()
+	defer splitStats.Unlock()
+	for k := range splitStats.counters {
+		if strings.HasPrefix(k, prefix) {
+			delete(splitStats.counters, k)
+		}
+	}
+}
+
+// VariantStatus holds the traffic split variant weight and its request
+// counts since the last reset.
+type VariantStatus struct {
+	Name      string `json:"name"`
+	TargetURL string `json:"target_url"`
+	Weight    int    `json:"weight"`
+	Requests  int64  `json:"requests"`
+	Errors    int64  `json:"errors"`
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// Traffic split type and its methods
+//______________________________________________________________________________
+
+// trafficSplit sends the weighted percentage of the proxy rule traffic to
+// the variant upstreams, rest of the traffic goes to the rule targets.
+// Sticky key keeps the cohort on same variant as long as weights are same,
+// assign cookie pins the variant to the client.
+type trafficSplit struct {
+	Variants     []*splitVariant
+	Stable       *splitVariant
+	StickyOn     string
+	AssignCookie string
+	salt         string
+}
+
+type splitVariant struct {
+	Name      string
+	TargetURL string
+	Weight    int
+	upstream  *upstream
+	counter   *variantCounter
+}
+
+// variantCounter survives the proxy rule updates, so the weight adjustments
+// do not reset the counts. It's removed when the rule or host is deleted.
+type variantCounter struct {
+	requests int64
+	errors   int64
+}
+
+var splitStats = struct {
+	sync.Mutex
+	counters map[string]*variantCounter
+}{counters: make(map[string]*variantCounter)}
+
+var splitRand = struct {
+	sync.Mutex
+	*rand.Rand
+}{Rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+func splitCounter(hostName, targetURL, name string) *variantCounter {
+	key := strings.ToLower(hostName) + "|" + targetURL + "|" + name
+	splitStats.Lock()
+	defer splitStats.Unlock()
+	c, found := splitStats.counters[key]
+	if !found {
+		c = &variantCounter{}
+		splitStats.counters[key] = c
+	}
+	return c
+}
+
+func newTrafficSplit(hostName, targetURL string, s *models.ProxySplit) (*trafficSplit, error) {
+	if errs := ValidateSplit(s); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid traffic split config: %v", errs)
+	}
+	ts := &trafficSplit{
+		StickyOn:     s.StickyOn,
+		AssignCookie: s.AssignCookie,
+		salt:         strings.ToLower(hostName) + targetURL,
+	}
+	stable := 100
+	for _, v := range s.Variants {
+		ts.Variants = append(ts.Variants, &splitVariant{
+			Name:      v.Name,
+			TargetURL: v.TargetURL,
+			Weight:    v.Weight,
+			counter:   splitCounter(hostName, targetURL, v.Name),
+		})
+		stable -= v.Weight
+	}
+	ts.Stable = &splitVariant{
+		Name:      SplitStable,
+		TargetURL: targetURL,
+		Weight:    stable,
+		counter:   splitCounter(hostName, targetURL, SplitStable),
+	}
+	return ts, nil
+}
+
+// Choose method returns the variant for the request and counts it. Assign
+// cookie is set on the response for new assignments.
+func (ts *trafficSplit) Choose(w http.ResponseWriter, req *http.Request) *splitVariant {
+	var v *splitVariant
+	if len(ts.AssignCookie) > 0 {
+		if c, err := req.Cookie(ts.AssignCookie); err == nil {
+			// variant with zero weight is rolled back or promoted
+			if v = ts.variant(c.Value); v != nil && v.Weight == 0 {
+				v = nil
+			}
+		}
+	}
+	if v == nil {
+		v = ts.pick(ts.bucket(req))
+		if len(ts.AssignCookie) > 0 {
+			http.SetCookie(w, &http.Cookie{
+				Name:     ts.AssignCookie,
+				Value:    v.Name,
+				Path:     "/",
+				MaxAge:   splitAssignCookieMaxAge,
+				HttpOnly: true,
+			})
+		}
+	}
+	atomic.AddInt64(&v.counter.requests, 1)
+	return v
+}
+
+// Status method returns the variants status, stable variant is first.
+func (ts *trafficSplit) Status() []*VariantStatus {
+	var result []*VariantStatus
+	for _, v := range append([]*splitVariant{ts.Stable}, ts.Variants...) {
+		result = append(result, &VariantStatus{
+			Name:      v.Name,
+			TargetURL: v.TargetURL,
+			Weight:    v.Weight,
+			Requests:  atomic.LoadInt64(&v.counter.requests),
+			Errors:    atomic.LoadInt64(&v.counter.errors),
+		})
+	}
+	return result
+}
+
+// bucket method returns the request bucket in the range of 0-99, sticky
+// key value is hashed otherwise it's random.
+func (ts *trafficSplit) bucket(req *http.Request) int {
+	var value string
+	name := stickyName(ts.StickyOn)
+	switch {
+	case strings.HasPrefix(ts.StickyOn, splitStickyHeader):
+		value = req.Header.Get(name)
+	case strings.HasPrefix(ts.StickyOn, splitStickyCookie):
+		if c, err := req.Cookie(name); err == nil {
+			value = c.Value
+		}
+	}
+	if len(value) == 0 {
+		splitRand.Lock()
+		defer splitRand.Unlock()
+		return splitRand.Intn(100)
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(ts.salt))
+	_, _ = h.Write([]byte(value))
+	return int(h.Sum32() % 100)
+}
+
+func (ts *trafficSplit) pick(bucket int) *splitVariant {
+	cumulative := 0
+	for _, v := range ts.Variants {
+		cumulative += v.Weight
+		if bucket < cumulative {
+			return v
+		}
+	}
+	return ts.Stable
+}
+
+func (ts *trafficSplit) variant(name string) *splitVariant {
+	if name == SplitStable {
+		return ts.Stable
+	}
+	for _, v := range ts.Variants {
+		if v.Name == name {
+			return v
+		}
+	}
+	return nil
+}
+
+func (v *splitVariant) recordError() {
+	atomic.AddInt64(&v.counter.errors, 1)
+}
+
+func stickyName(stickyOn string) string {
+	if idx := strings.IndexByte(stickyOn, ':'); idx > -1 {
+		return strings.TrimSpace(stickyOn[idx+1:])
+	}
+	return ""
+}
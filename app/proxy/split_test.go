@@ -0,0 +1,126 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"thumbai/app/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrafficSplitWeights(t *testing.T) {
+	ts, err := newTrafficSplit("split.example.com", "http://stable", &models.ProxySplit{
+		Variants: []*models.ProxySplitVariant{{Name: "canary", TargetURL: "http://canary", Weight: 20}},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 80, ts.Stable.Weight)
+
+	assert.Equal(t, "canary", ts.pick(0).Name)
+	assert.Equal(t, "canary", ts.pick(19).Name)
+	assert.Equal(t, SplitStable, ts.pick(20).Name)
+	assert.Equal(t, SplitStable, ts.pick(99).Name)
+
+	for i := 0; i < 1000; i++ {
+		ts.Choose(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+	status := ts.Status()
+	assert.Equal(t, SplitStable, status[0].Name)
+	assert.Equal(t, int64(1000), status[0].Requests+status[1].Requests)
+	assert.InDelta(t, 200, status[1].Requests, 80)
+
+	// counts are kept across the rule updates
+	ts, _ = newTrafficSplit("split.example.com", "http://stable", &models.ProxySplit{
+		Variants: []*models.ProxySplitVariant{{Name: "canary", TargetURL: "http://canary", Weight: 50}},
+	})
+	assert.Equal(t, int64(1000), ts.Status()[0].Requests+ts.Status()[1].Requests)
+	ResetSplitStats("split.example.com", "http://stable")
+	assert.Equal(t, int64(0), ts.Status()[0].Requests+ts.Status()[1].Requests)
+
+	// counts are removed on rule delete, re-created rule starts afresh
+	ts.Choose(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	h := &host{Name: "split.example.com"}
+	h.LastRule = &rule{TargetURL: "http://stable", host: h}
+	h.DelProxyRule("http://stable")
+	ts, _ = newTrafficSplit("split.example.com", "http://stable", &models.ProxySplit{
+		Variants: []*models.ProxySplitVariant{{Name: "canary", TargetURL: "http://canary", Weight: 50}},
+	})
+	assert.Equal(t, int64(0), ts.Status()[0].Requests+ts.Status()[1].Requests)
+}
+
+func TestTrafficSplitSticky(t *testing.T) {
+	ts, err := newTrafficSplit("sticky.example.com", "http://stable", &models.ProxySplit{
+		Variants: []*models.ProxySplitVariant{{Name: "canary", TargetURL: "http://canary", Weight: 50}},
+		StickyOn: "header:X-User-Id",
+	})
+	assert.Nil(t, err)
+	for i := 0; i < 20; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-User-Id", fmt.Sprintf("user-%d", i))
+		first := ts.Choose(httptest.NewRecorder(), req)
+		for j := 0; j < 5; j++ {
+			assert.Equal(t, first, ts.Choose(httptest.NewRecorder(), req))
+		}
+	}
+
+	// assign cookie
+	ts, _ = newTrafficSplit("assign.example.com", "http://stable", &models.ProxySplit{
+		Variants:     []*models.ProxySplitVariant{{Name: "canary", TargetURL: "http://canary", Weight: 100}},
+		AssignCookie: "thumbai_variant",
+	})
+	rec := httptest.NewRecorder()
+	assert.Equal(t, "canary", ts.Choose(rec, httptest.NewRequest(http.MethodGet, "/", nil)).Name)
+	assert.Contains(t, rec.Header().Get("Set-Cookie"), "thumbai_variant=canary")
+
+	ts, _ = newTrafficSplit("assign.example.com", "http://stable", &models.ProxySplit{
+		Variants:     []*models.ProxySplitVariant{{Name: "canary", TargetURL: "http://canary", Weight: 50}},
+		AssignCookie: "thumbai_variant",
+	})
+	for i := 0; i < 10; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(&http.Cookie{Name: "thumbai_variant", Value: SplitStable})
+		rec = httptest.NewRecorder()
+		assert.Equal(t, SplitStable, ts.Choose(rec, req).Name)
+		assert.Equal(t, "", rec.Header().Get("Set-Cookie"))
+	}
+
+	// rolled back variant is reassigned
+	ts, _ = newTrafficSplit("assign.example.com", "http://stable", &models.ProxySplit{
+		Variants:     []*models.ProxySplitVariant{{Name: "canary", TargetURL: "http://canary", Weight: 0}},
+		AssignCookie: "thumbai_variant",
+	})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: "thumbai_variant", Value: "canary"})
+	assert.Equal(t, SplitStable, ts.Choose(httptest.NewRecorder(), req).Name)
+}
+
+func TestValidateSplit(t *testing.T) {
+	errs := ValidateSplit(&models.ProxySplit{
+		Variants: []*models.ProxySplitVariant{
+			{Name: "a", TargetURL: "http://a", Weight: 60},
+			{Name: "b", TargetURL: "http://b", Weight: 60},
+		},
+		StickyOn: "query:id",
+	})
+	assert.Equal(t, 2, len(errs))
+	assert.Equal(t, 1, len(ValidateSplit(&models.ProxySplit{
+		Variants: []*models.ProxySplitVariant{{Name: SplitStable, TargetURL: "http://a", Weight: 10}},
+	})))
+	assert.Equal(t, 1, len(ValidateSplit(&models.ProxySplit{})))
+}
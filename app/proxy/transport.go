@@ -0,0 +1,158 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"thumbai/app/models"
+)
+
+// Transport default values, same as `http.DefaultTransport`
+const (
+	defaultDialTimeout         = 30 * time.Second
+	defaultKeepAlive           = 30 * time.Second
+	defaultTLSHandshakeTimeout = 10 * time.Second
+	defaultIdleConnTimeout     = 90 * time.Second
+	defaultMaxIdleConns        = 100
+)
+
+// ValidateTransport method validates the given upstream transport
+// configuration and returns the field errors if any.
+func ValidateTransport(t *models.ProxyTransport) map[string]string {
+	errs := map[string]string{}
+	durations := map[string]string{
+		"tDialTimeout":           t.DialTimeout,
+		"tTLSHandshakeTimeout":   t.TLSHandshakeTimeout,
+		"tResponseHeaderTimeout": t.ResponseHeaderTimeout,
+		"tIdleConnTimeout":       t.IdleConnTimeout,
+	}
+	for name, v := range durations {
+		if _, err := parseDuration(v, 0); err != nil {
+			errs[name] = "Invalid duration value, e.g.: 30s"
+		}
+	}
+	if t.MaxIdleConnsPerHost < 0 {
+		errs["tMaxIdleConnsPerHost"] = "Must be a positive number"
+	}
+	if len(t.CAFile) > 0 {
+		if _, err := loadCAPool(t.CAFile); err != nil {
+			errs["tCAFile"] = "Unable to load CA certificates: " + err.Error()
+		}
+	}
+	if len(t.CertFile) > 0 || len(t.KeyFile) > 0 {
+		if _, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile); err != nil {
+			errs["tCertFile"] = "Unable to load client certificate and key: " + err.Error()
+		}
+	}
+	return errs
+}
+
+// newTransport method creates the upstream transport for the proxy rule,
+// every rule owns its transport so the TLS and timeout settings of one rule
+// does not leak into another.
+func newTransport(pr *models.ProxyRule) (*http.Transport, error) {
+	t := pr.Transport
+	if t == nil {
+		t = &models.ProxyTransport{}
+	}
+	dialTimeout, err := parseDuration(t.DialTimeout, defaultDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	tlsHandshakeTimeout, err := parseDuration(t.TLSHandshakeTimeout, defaultTLSHandshakeTimeout)
+	if err != nil {
+		return nil, err
+	}
+	responseHeaderTimeout, err := parseDuration(t.ResponseHeaderTimeout, 0)
+	if err != nil {
+		return nil, err
+	}
+	idleConnTimeout, err := parseDuration(t.IdleConnTimeout, defaultIdleConnTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := newTLSConfig(pr.SkipTLSVerify, t)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   dialTimeout,
+			KeepAlive: defaultKeepAlive,
+		}).DialContext,
+		ForceAttemptHTTP2:     !t.DisableHTTP2,
+		MaxIdleConns:          defaultMaxIdleConns,
+		MaxIdleConnsPerHost:   t.MaxIdleConnsPerHost,
+		IdleConnTimeout:       idleConnTimeout,
+		TLSHandshakeTimeout:   tlsHandshakeTimeout,
+		ResponseHeaderTimeout: responseHeaderTimeout,
+		ExpectContinueTimeout: 1 * time.Second,
+		DisableKeepAlives:     t.DisableKeepAlives,
+		TLSClientConfig:       tlsConfig,
+	}
+	if t.DisableHTTP2 {
+		// non-nil empty map disables the HTTP/2 upgrade
+		transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+	return transport, nil
+}
+
+func newTLSConfig(skipVerify bool, t *models.ProxyTransport) (*tls.Config, error) {
+	// #nosec
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: skipVerify,
+		ServerName:         t.ServerName,
+	}
+	if len(t.CAFile) > 0 {
+		pool, err := loadCAPool(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load CA file: %v", err)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if len(t.CertFile) > 0 || len(t.KeyFile) > 0 {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// loadCAPool method returns the cert pool of PEM encoded certificates in the
+// given CA file.
+func loadCAPool(caFile string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("no PEM certificates found in " + caFile)
+	}
+	return pool, nil
+}
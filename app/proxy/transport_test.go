@@ -0,0 +1,75 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"thumbai/app/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewTransport(t *testing.T) {
+	t1, err := newTransport(&models.ProxyRule{SkipTLSVerify: true})
+	assert.Nil(t, err)
+	assert.True(t, t1.TLSClientConfig.InsecureSkipVerify)
+	assert.True(t, t1.ForceAttemptHTTP2)
+	assert.Equal(t, defaultIdleConnTimeout, t1.IdleConnTimeout)
+
+	// skip TLS verify of one rule must not leak into another
+	t2, err := newTransport(&models.ProxyRule{Transport: &models.ProxyTransport{
+		ResponseHeaderTimeout: "5s",
+		MaxIdleConnsPerHost:   20,
+		DisableHTTP2:          true,
+		ServerName:            "backend.example.com",
+	}})
+	assert.Nil(t, err)
+	assert.False(t, t2.TLSClientConfig.InsecureSkipVerify)
+	assert.Equal(t, "backend.example.com", t2.TLSClientConfig.ServerName)
+	assert.Equal(t, 5*time.Second, t2.ResponseHeaderTimeout)
+	assert.Equal(t, 20, t2.MaxIdleConnsPerHost)
+	assert.False(t, t2.ForceAttemptHTTP2)
+	assert.NotNil(t, t2.TLSNextProto)
+
+	_, err = newTransport(&models.ProxyRule{Transport: &models.ProxyTransport{CAFile: "/not/exists/ca.pem"}})
+	assert.NotNil(t, err)
+}
+
+func TestValidateTransport(t *testing.T) {
+	errs := ValidateTransport(&models.ProxyTransport{
+		DialTimeout: "abc",
+		CAFile:      "/not/exists/ca.pem",
+		CertFile:    "/not/exists/cert.pem",
+	})
+	assert.Equal(t, 3, len(errs))
+
+	errs = ValidateTransport(&models.ProxyTransport{DialTimeout: "5s", IdleConnTimeout: "1m"})
+	assert.Equal(t, 0, len(errs))
+
+	// existing CA file without PEM certificates
+	f, err := ioutil.TempFile("", "ca")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	_, _ = f.WriteString("not a certificate")
+	_ = f.Close()
+	errs = ValidateTransport(&models.ProxyTransport{CAFile: f.Name()})
+	assert.Contains(t, errs["tCAFile"], "no PEM certificates found")
+	_, err = newTransport(&models.ProxyRule{Transport: &models.ProxyTransport{CAFile: f.Name()}})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,220 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"thumbai/app/models"
+)
+
+// Upgrade protocols
+const (
+	UpgradeWebSocket = "websocket"
+	UpgradeH2C       = "h2c"
+)
+
+// ValidateUpgrade method validates the given upgrade configuration and
+// returns the field errors if any.
+func ValidateUpgrade(u *models.ProxyUpgrade) map[string]string {
+	errs := map[string]string{}
+	for _, p := range u.Protocols {
+		if len(strings.TrimSpace(p)) == 0 {
+			errs["upgradeProtocols"] = "Protocol name must not be empty"
+		}
+	}
+	if _, err := parseDuration(u.IdleTimeout, 0); err != nil {
+		errs["upgradeIdleTimeout"] = "Invalid duration value, e.g.: 5m"
+	}
+	if u.MaxConns < 0 {
+		errs["upgradeMaxConns"] = "Must be a positive number"
+	}
+	return errs
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// Upgrade policy type and its methods
+//______________________________________________________________________________
+
+// upgradePolicy holds the `Connection: Upgrade` handling config of the
+// proxy rule. Rule without config allows all the upgrade protocols.
+type upgradePolicy struct {
+	Disabled    bool
+	Protocols   map[string]bool
+	IdleTimeout time.Duration
+	MaxConns    int64
+	active      int64
+}
+
+func newUpgradePolicy(u *models.ProxyUpgrade) (*upgradePolicy, error) {
+	p := &upgradePolicy{Protocols: make(map[string]bool)}
+	if u == nil {
+		return p, nil
+	}
+	idleTimeout, err := parseDuration(u.IdleTimeout, 0)
+	if err != nil {
+		return nil, err
+	}
+	p.Disabled = u.Disabled
+	p.IdleTimeout = idleTimeout
+	p.MaxConns = int64(u.MaxConns)
+	for _, proto := range u.Protocols {
+		p.Protocols[strings.ToLower(strings.TrimSpace(proto))] = true
+	}
+	return p, nil
+}
+
+// Allowed method returns true if upgrade protocol is permitted on the rule.
+func (p *upgradePolicy) Allowed(proto string) bool {
+	if p.Disabled {
+		return false
+	}
+	return len(p.Protocols) == 0 || p.Protocols[proto]
+}
+
+// Active method returns the no. of active upgraded connections.
+func (p *upgradePolicy) Active() int64 {
+	return atomic.LoadInt64(&p.active)
+}
+
+// acquire method reserves the upgraded connection slot, it returns false
+// if max connections reached.
+func (p *upgradePolicy) acquire() bool {
+	if n := atomic.AddInt64(&p.active, 1); p.MaxConns > 0 && n > p.MaxConns {
+		atomic.AddInt64(&p.active, -1)
+		return false
+	}
+	return true
+}
+
+func (p *upgradePolicy) release() {
+	atomic.AddInt64(&p.active, -1)
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// Upgrade response writer and connection
+//______________________________________________________________________________
+
+var _ http.Hijacker = (*upgradeWriter)(nil)
+
+// upgradeWriter exposes the `http.Hijacker` of underlying response writer
+// to the reverse proxy and tracks the hijacked connection.
+type upgradeWriter struct {
+	http.ResponseWriter
+	policy   *upgradePolicy
+	upstream *upstream
+	hijacked bool
+}
+
+func (w *upgradeWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := hijacker(w.ResponseWriter)
+	if !ok {
+		return nil, nil, errors.New("thumbai: response writer does not support hijack")
+	}
+	conn, brw, err := hj.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	w.hijacked = true
+	atomic.AddInt64(&w.upstream.upgraded, 1)
+	return &upgradedConn{
+		Conn:        conn,
+		idleTimeout: w.policy.IdleTimeout,
+		lastActive:  time.Now().UnixNano(),
+		onClose: func() {
+			atomic.AddInt64(&w.upstream.upgraded, -1)
+			w.policy.release()
+		},
+	}, brw, nil
+}
+
+// upgradedConn closes the connection once it's idle for the idle timeout
+// in both directions.
+type upgradedConn struct {
+	net.Conn
+	idleTimeout time.Duration
+	lastActive  int64
+	closeOnce   sync.Once
+	onClose     func()
+}
+
+func (c *upgradedConn) Read(b []byte) (int, error) {
+	for {
+		if c.idleTimeout > 0 {
+			_ = c.Conn.SetReadDeadline(time.Now().Add(c.idleTimeout))
+		}
+		n, err := c.Conn.Read(b)
+		if n > 0 {
+			atomic.StoreInt64(&c.lastActive, time.Now().UnixNano())
+		}
+		if ne, ok := err.(net.Error); ok && ne.Timeout() && n == 0 {
+			// other direction is active, keep waiting
+			if time.Since(time.Unix(0, atomic.LoadInt64(&c.lastActive))) < c.idleTimeout {
+				continue
+			}
+		}
+		return n, err
+	}
+}
+
+func (c *upgradedConn) Write(b []byte) (int, error) {
+	if c.idleTimeout > 0 {
+		_ = c.Conn.SetWriteDeadline(time.Now().Add(c.idleTimeout))
+	}
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		atomic.StoreInt64(&c.lastActive, time.Now().UnixNano())
+	}
+	return n, err
+}
+
+func (c *upgradedConn) Close() error {
+	c.closeOnce.Do(c.onClose)
+	return c.Conn.Close()
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// Unexported methods
+//______________________________________________________________________________
+
+// upgradeType method returns the lower case upgrade protocol of the request
+// if it's `Connection: Upgrade` request otherwise empty string.
+func upgradeType(h http.Header) string {
+	for _, v := range h["Connection"] {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), "upgrade") {
+				return strings.ToLower(h.Get("Upgrade"))
+			}
+		}
+	}
+	return ""
+}
+
+func hijacker(w http.ResponseWriter) (http.Hijacker, bool) {
+	if hj, ok := w.(http.Hijacker); ok {
+		return hj, true
+	}
+	if uw, ok := w.(interface{ Unwrap() http.ResponseWriter }); ok {
+		return hijacker(uw.Unwrap())
+	}
+	return nil, false
+}
@@ -0,0 +1,86 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"thumbai/app/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpgradeType(t *testing.T) {
+	hdr := http.Header{}
+	assert.Equal(t, "", upgradeType(hdr))
+
+	hdr.Set("Connection", "keep-alive, Upgrade")
+	hdr.Set("Upgrade", "WebSocket")
+	assert.Equal(t, UpgradeWebSocket, upgradeType(hdr))
+
+	hdr.Set("Connection", "keep-alive")
+	assert.Equal(t, "", upgradeType(hdr))
+}
+
+func TestUpgradePolicy(t *testing.T) {
+	p, err := newUpgradePolicy(nil)
+	assert.Nil(t, err)
+	assert.True(t, p.Allowed(UpgradeWebSocket))
+	assert.True(t, p.Allowed(UpgradeH2C))
+
+	p, err = newUpgradePolicy(&models.ProxyUpgrade{Protocols: []string{"WebSocket"}, MaxConns: 1})
+	assert.Nil(t, err)
+	assert.True(t, p.Allowed(UpgradeWebSocket))
+	assert.False(t, p.Allowed(UpgradeH2C))
+	assert.True(t, p.acquire())
+	assert.False(t, p.acquire())
+	assert.Equal(t, int64(1), p.Active())
+	p.release()
+	assert.True(t, p.acquire())
+
+	p, _ = newUpgradePolicy(&models.ProxyUpgrade{Disabled: true})
+	assert.False(t, p.Allowed(UpgradeWebSocket))
+
+	_, err = newUpgradePolicy(&models.ProxyUpgrade{IdleTimeout: "abc"})
+	assert.NotNil(t, err)
+}
+
+func TestUpgradedConnIdleTimeout(t *testing.T) {
+	client, server := net.Pipe()
+	defer func() { _ = server.Close() }()
+	closed := 0
+	conn := &upgradedConn{
+		Conn:        client,
+		idleTimeout: 50 * time.Millisecond,
+		lastActive:  time.Now().UnixNano(),
+		onClose:     func() { closed++ },
+	}
+
+	go func() { _, _ = server.Write([]byte("ping")) }()
+	b := make([]byte, 4)
+	n, err := conn.Read(b)
+	assert.Nil(t, err)
+	assert.Equal(t, "ping", string(b[:n]))
+
+	_, err = conn.Read(b)
+	assert.NotNil(t, err)
+
+	_ = conn.Close()
+	_ = conn.Close()
+	assert.Equal(t, 1, closed)
+}
@@ -62,6 +62,7 @@ func CheckConfig(e *aah.Event) {
 		app.Log().Warn("'thumbai.admin.contact_email' value is not yet configured. Highly recommended to configure it.")
 	}
 
+	// thumbai writes its own access log, see `thumbai.access_log`
 	cfg.SetBool("server.access_log.enable", false)
 
 	readSectionAndSet("thumbai.server", "env."+appProfile+".server")
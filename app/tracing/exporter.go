@@ -0,0 +1,296 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"aahframe.work"
+	"aahframe.work/ahttp"
+)
+
+// Exporter default values
+const (
+	defaultEndpoint      = "http://localhost:4318/v1/traces"
+	defaultServiceName   = "thumbai"
+	defaultBatchSize     = 100
+	defaultTimeout       = 10 * time.Second
+	defaultFlushInterval = 5 * time.Second
+	maxQueuedSpans       = 2048
+)
+
+// OTLP span kind and status code values
+const (
+	spanKindServer  = 2
+	statusCodeError = 2
+)
+
+type exporterConfig struct {
+	Endpoint      string
+	Headers       []string
+	Timeout       string
+	ServiceName   string
+	BatchSize     int
+	FlushInterval string
+}
+
+// exporter sends the spans to OTLP/HTTP endpoint in JSON encoding, in
+// batches. Spans are dropped when the queue is full, it never blocks the
+// request.
+type exporter struct {
+	endpoint    string
+	headers     http.Header
+	serviceName string
+	batchSize   int
+	interval    time.Duration
+	client      *http.Client
+	queue       chan *Span
+	done        chan struct{}
+	wg          sync.WaitGroup
+	dropped     int64
+}
+
+func newExporter(cfg *exporterConfig) (*exporter, error) {
+	if u, err := url.Parse(cfg.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return nil, fmt.Errorf("otlp endpoint '%s' is not an absolute http(s) URL", cfg.Endpoint)
+	}
+	timeout, err := parseDuration(cfg.Timeout, defaultTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("otlp timeout: %v", err)
+	}
+	interval, err := parseDuration(cfg.FlushInterval, defaultFlushInterval)
+	if err != nil {
+		return nil, fmt.Errorf("flush interval: %v", err)
+	}
+	hdr := make(http.Header)
+	for _, h := range cfg.Headers {
+		idx := strings.IndexByte(h, ':')
+		if idx <= 0 {
+			return nil, fmt.Errorf("otlp header '%s' is not in the format 'Name: value'", h)
+		}
+		hdr.Set(strings.TrimSpace(h[:idx]), strings.TrimSpace(h[idx+1:]))
+	}
+	e := &exporter{
+		endpoint:    cfg.Endpoint,
+		headers:     hdr,
+		serviceName: cfg.ServiceName,
+		batchSize:   cfg.BatchSize,
+		interval:    interval,
+		client:      &http.Client{Timeout: timeout},
+		queue:       make(chan *Span, maxQueuedSpans),
+		done:        make(chan struct{}),
+	}
+	if len(e.serviceName) == 0 {
+		e.serviceName = defaultServiceName
+	}
+	if e.batchSize <= 0 {
+		e.batchSize = defaultBatchSize
+	}
+	e.wg.Add(1)
+	go e.run()
+	return e, nil
+}
+
+// Export method queues the span to be sent in the next batch.
+func (e *exporter) Export(s *Span) {
+	select {
+	case e.queue <- s:
+	default:
+		atomic.AddInt64(&e.dropped, 1)
+	}
+}
+
+// Close method sends the queued spans and stops the exporter.
+func (e *exporter) Close() {
+	close(e.done)
+	e.wg.Wait()
+}
+
+func (e *exporter) run() {
+	defer e.wg.Done()
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	batch := make([]*Span, 0, e.batchSize)
+	send := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.send(batch); err != nil {
+			aah.App().Log().Errorf("tracing: unable to export %d spans: %v", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case s := <-e.queue:
+			if batch = append(batch, s); len(batch) >= e.batchSize {
+				send()
+			}
+		case <-ticker.C:
+			send()
+			if n := atomic.SwapInt64(&e.dropped, 0); n > 0 {
+				aah.App().Log().Warnf("tracing: %d spans dropped, export queue is full", n)
+			}
+		case <-e.done:
+			for {
+				select {
+				case s := <-e.queue:
+					if batch = append(batch, s); len(batch) >= e.batchSize {
+						send()
+					}
+				default:
+					send()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (e *exporter) send(spans []*Span) error {
+	body, err := json.Marshal(e.request(spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range e.headers {
+		req.Header[k] = v
+	}
+	req.Header.Set(ahttp.HeaderContentType, "application/json")
+	res, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(ioutil.Discard, res.Body)
+	_ = res.Body.Close()
+	if res.StatusCode < http.StatusOK || res.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("otlp endpoint responded with status %d", res.StatusCode)
+	}
+	return nil
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// OTLP JSON types
+//______________________________________________________________________________
+
+type otlpRequest struct {
+	ResourceSpans []*otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource      `json:"resource"`
+	ScopeSpans []*otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []*otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope   `json:"scope"`
+	Spans []*otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []*otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpStatus struct {
+	Code int `json:"code,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+func (e *exporter) request(spans []*Span) *otlpRequest {
+	ss := &otlpScopeSpans{Scope: otlpScope{Name: "thumbai"}}
+	for _, s := range spans {
+		sp := &otlpSpan{
+			TraceID:           s.TraceID,
+			SpanID:            s.SpanID,
+			ParentSpanID:      s.ParentID,
+			Name:              s.Name,
+			Kind:              spanKindServer,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes:        keyValues(s.Attributes),
+		}
+		if s.Status >= http.StatusInternalServerError {
+			sp.Status.Code = statusCodeError
+		}
+		ss.Spans = append(ss.Spans, sp)
+	}
+	return &otlpRequest{ResourceSpans: []*otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: keyValues(map[string]string{"service.name": e.serviceName})},
+		ScopeSpans: []*otlpScopeSpans{ss},
+	}}}
+}
+
+func keyValues(m map[string]string) []*otlpKeyValue {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	kvs := make([]*otlpKeyValue, 0, len(keys))
+	for _, k := range keys {
+		kvs = append(kvs, &otlpKeyValue{Key: k, Value: otlpValue{StringValue: m[k]}})
+	}
+	return kvs
+}
+
+func parseDuration(v string, def time.Duration) (time.Duration, error) {
+	if len(v) == 0 {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err == nil && d <= 0 {
+		err = fmt.Errorf("'%s' must be a positive duration", v)
+	}
+	return d, err
+}
@@ -0,0 +1,94 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExporter(t *testing.T) {
+	var mu sync.Mutex
+	var requests []map[string]interface{}
+	var authz []string
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		var body map[string]interface{}
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&body))
+		mu.Lock()
+		requests = append(requests, body)
+		authz = append(authz, r.Header.Get("Authorization"))
+		mu.Unlock()
+	}))
+	defer collector.Close()
+
+	e, err := newExporter(&exporterConfig{
+		Endpoint:      collector.URL + "/v1/traces",
+		Headers:       []string{"Authorization: Bearer token"},
+		BatchSize:     2,
+		FlushInterval: "1h",
+	})
+	assert.Nil(t, err)
+
+	start := time.Unix(1700000000, 0)
+	for i, status := range []int{200, 502, 404} {
+		s := newSpan("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false)
+		s.Name, s.Status = "proxy", status
+		s.Start, s.End = start, start.Add(time.Duration(i+1)*time.Millisecond)
+		s.SetAttribute("http.method", "GET")
+		e.Export(s)
+	}
+	// batch of 2 is sent immediately, remaining on close
+	e.Close()
+
+	assert.Len(t, requests, 2)
+	assert.Equal(t, []string{"Bearer token", "Bearer token"}, authz)
+
+	rs := requests[0]["resourceSpans"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, []interface{}{map[string]interface{}{
+		"key": "service.name", "value": map[string]interface{}{"stringValue": "thumbai"},
+	}}, rs["resource"].(map[string]interface{})["attributes"])
+	spans := rs["scopeSpans"].([]interface{})[0].(map[string]interface{})["spans"].([]interface{})
+	assert.Len(t, spans, 2)
+
+	span := spans[0].(map[string]interface{})
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span["traceId"])
+	assert.Equal(t, "00f067aa0ba902b7", span["parentSpanId"])
+	assert.Equal(t, "proxy", span["name"])
+	assert.Equal(t, float64(spanKindServer), span["kind"])
+	assert.Equal(t, "1700000000000000000", span["startTimeUnixNano"])
+	assert.Equal(t, "1700000000001000000", span["endTimeUnixNano"])
+	assert.Equal(t, map[string]interface{}{}, span["status"])
+	assert.Equal(t, map[string]interface{}{"code": float64(statusCodeError)}, spans[1].(map[string]interface{})["status"])
+
+	spans = requests[1]["resourceSpans"].([]interface{})[0].(map[string]interface{})["scopeSpans"].([]interface{})[0].(map[string]interface{})["spans"].([]interface{})
+	assert.Len(t, spans, 1)
+}
+
+func TestExporterConfig(t *testing.T) {
+	_, err := newExporter(&exporterConfig{Endpoint: "localhost:4318"})
+	assert.NotNil(t, err)
+	_, err = newExporter(&exporterConfig{Endpoint: defaultEndpoint, Timeout: "-1s"})
+	assert.NotNil(t, err)
+	_, err = newExporter(&exporterConfig{Endpoint: defaultEndpoint, Headers: []string{"invalid"}})
+	assert.NotNil(t, err)
+}
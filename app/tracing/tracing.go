@@ -0,0 +1,254 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tracing implements the request ID and W3C trace context
+// propagation of THUMBAI and exports the request spans to OTLP endpoint.
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"thumbai/app/access"
+
+	"aahframe.work"
+	"aahframe.work/ahttp"
+)
+
+// HeaderTraceparent is the W3C trace context header.
+const HeaderTraceparent = "Traceparent"
+
+// KeySpan is the context key of the request span.
+const KeySpan = "thumbai.tracing.span"
+
+const maxRequestIDLen = 128
+
+var std struct {
+	sync.RWMutex
+	exporter *exporter
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// Package methods
+//______________________________________________________________________________
+
+// Load method configures the span exporter on app startup using config
+// `thumbai.tracing`. Request ID and trace context are propagated regardless
+// of it.
+func Load(_ *aah.Event) {
+	app := aah.App()
+	cfg := app.Config()
+	if !cfg.BoolDefault("thumbai.tracing.enable", false) {
+		return
+	}
+	headers, _ := cfg.StringList("thumbai.tracing.otlp.headers")
+	e, err := newExporter(&exporterConfig{
+		Endpoint:      cfg.StringDefault("thumbai.tracing.otlp.endpoint", defaultEndpoint),
+		Headers:       headers,
+		Timeout:       cfg.StringDefault("thumbai.tracing.otlp.timeout", ""),
+		ServiceName:   cfg.StringDefault("thumbai.tracing.service_name", defaultServiceName),
+		BatchSize:     cfg.IntDefault("thumbai.tracing.batch_size", defaultBatchSize),
+		FlushInterval: cfg.StringDefault("thumbai.tracing.flush_interval", ""),
+	})
+	if err != nil {
+		app.Log().Errorf("'thumbai.tracing' configuration: %v", err)
+		return
+	}
+	std.Lock()
+	std.exporter = e
+	std.Unlock()
+	app.Log().Infof("Tracing is enabled, spans are exported to %s", e.endpoint)
+}
+
+// Close method flushes the pending spans and stops the exporter.
+func Close(_ *aah.Event) {
+	std.Lock()
+	defer std.Unlock()
+	if std.exporter != nil {
+		std.exporter.Close()
+		std.exporter = nil
+	}
+}
+
+// Middleware method generates or propagates the request headers
+// `X-Request-Id` and `traceparent`, they are written on the response too.
+// The request span is exported once the request is processed.
+func Middleware(ctx *aah.Context, m *aah.Middleware) {
+	req := ctx.Req.Unwrap()
+	requestID := req.Header.Get(ahttp.HeaderXRequestID)
+	if !validRequestID(requestID) {
+		requestID = newID(16)
+		req.Header.Set(ahttp.HeaderXRequestID, requestID)
+	}
+
+	std.RLock()
+	e := std.exporter
+	std.RUnlock()
+	span := newSpan(req.Header.Get(HeaderTraceparent), e != nil)
+	span.Name = "HTTP " + req.Method
+	req.Header.Set(HeaderTraceparent, span.Traceparent())
+	ctx.Res.Header().Set(ahttp.HeaderXRequestID, requestID)
+	ctx.Res.Header().Set(HeaderTraceparent, span.Traceparent())
+	ctx.Set(KeySpan, span)
+
+	m.Next(ctx)
+	if e == nil || !span.Sampled {
+		return
+	}
+	status := ctx.Res.Status()
+	if status == 0 {
+		status = ctx.Reply().Code
+	}
+	if status == 0 {
+		status = http.StatusOK
+	}
+	span.End = time.Now()
+	span.Status = status
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("http.host", req.Host)
+	span.SetAttribute("http.target", req.RequestURI)
+	span.SetAttribute("http.status_code", strconv.Itoa(status))
+	span.SetAttribute("http.user_agent", req.UserAgent())
+	span.SetAttribute("net.peer.ip", access.ClientIP(req))
+	span.SetAttribute("thumbai.request_id", requestID)
+	e.Export(span)
+}
+
+// FromContext method returns the request span, nil if not exists.
+func FromContext(ctx *aah.Context) *Span {
+	s, _ := ctx.Get(KeySpan).(*Span)
+	return s
+}
+
+// ParseTraceparent method parses the W3C `traceparent` header value of
+// version `00` and returns trace ID, parent span ID and sampled flag.
+func ParseTraceparent(v string) (traceID, parentID string, sampled, ok bool) {
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" ||
+		(parts[0] == "00" && len(parts) != 4) {
+		return
+	}
+	if !isHex(parts[0]) || !isHex(parts[1]) || !isHex(parts[2]) || !isHex(parts[3]) ||
+		len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 ||
+		isZero(parts[1]) || isZero(parts[2]) {
+		return
+	}
+	flags, _ := strconv.ParseUint(parts[3], 16, 8)
+	return parts[1], parts[2], flags&0x01 == 0x01, true
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// Span type and its methods
+//______________________________________________________________________________
+
+// Span represents the THUMBAI server span of the request. It continues
+// the incoming trace context, otherwise starts a new trace which is sampled
+// only if the exporter is enabled.
+type Span struct {
+	TraceID    string
+	SpanID     string
+	ParentID   string
+	Sampled    bool
+	Name       string
+	Start      time.Time
+	End        time.Time
+	Status     int
+	Attributes map[string]string
+}
+
+func newSpan(traceparent string, sample bool) *Span {
+	s := &Span{SpanID: newID(8), Start: time.Now()}
+	if traceID, parentID, sampled, ok := ParseTraceparent(traceparent); ok {
+		s.TraceID, s.ParentID, s.Sampled = traceID, parentID, sampled
+	} else {
+		s.TraceID, s.Sampled = newID(16), sample
+	}
+	return s
+}
+
+// Traceparent method returns the W3C `traceparent` header value with span
+// as parent.
+func (s *Span) Traceparent() string {
+	flags := "00"
+	if s.Sampled {
+		flags = "01"
+	}
+	return "00-" + s.TraceID + "-" + s.SpanID + "-" + flags
+}
+
+// SetName method sets the span name, it's nil safe.
+func (s *Span) SetName(name string) {
+	if s != nil {
+		s.Name = name
+	}
+}
+
+// SetAttribute method sets the span attribute, empty value is ignored and
+// it's nil safe.
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil || len(value) == 0 {
+		return
+	}
+	if s.Attributes == nil {
+		s.Attributes = make(map[string]string)
+	}
+	s.Attributes[key] = value
+}
+
+//‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
+// Unexported methods
+//______________________________________________________________________________
+
+func newID(n int) string {
+	b := make([]byte, n)
+	for {
+		_, _ = rand.Read(b)
+		if id := hex.EncodeToString(b); !isZero(id) {
+			return id
+		}
+	}
+}
+
+// validRequestID method reports whether the incoming request ID could be
+// propagated, it has to be printable ASCII up to 128 chars.
+func validRequestID(id string) bool {
+	if len(id) == 0 || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func isHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func isZero(s string) bool {
+	return strings.Trim(s, "0") == ""
+}
@@ -0,0 +1,89 @@
+// Copyright Jeevanandam M. (https://github.com/jeevatkm, jeeva@myjeeva.com)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	traceID, parentID, sampled, ok := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	assert.True(t, ok)
+	assert.True(t, sampled)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", traceID)
+	assert.Equal(t, "00f067aa0ba902b7", parentID)
+
+	_, _, sampled, ok = ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	assert.True(t, ok)
+	assert.False(t, sampled)
+
+	// future version with additional fields
+	_, _, _, ok = ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra")
+	assert.True(t, ok)
+
+	for _, v := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-1",
+	} {
+		_, _, _, ok = ParseTraceparent(v)
+		assert.False(t, ok, v)
+	}
+}
+
+func TestNewSpan(t *testing.T) {
+	s := newSpan("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", s.TraceID)
+	assert.Equal(t, "00f067aa0ba902b7", s.ParentID)
+	assert.True(t, s.Sampled)
+	assert.Len(t, s.SpanID, 16)
+	assert.NotEqual(t, s.ParentID, s.SpanID)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+s.SpanID+"-01", s.Traceparent())
+
+	// new trace is sampled only if exporter is enabled
+	s = newSpan("invalid", false)
+	assert.Len(t, s.TraceID, 32)
+	assert.Empty(t, s.ParentID)
+	assert.False(t, s.Sampled)
+	assert.True(t, strings.HasSuffix(s.Traceparent(), "-00"))
+	_, _, _, ok := ParseTraceparent(s.Traceparent())
+	assert.True(t, ok)
+	assert.True(t, newSpan("", true).Sampled)
+
+	var ns *Span
+	ns.SetName("proxy")
+	ns.SetAttribute("k", "v")
+	s.SetAttribute("empty", "")
+	s.SetAttribute("k", "v")
+	assert.Equal(t, map[string]string{"k": "v"}, s.Attributes)
+}
+
+func TestValidRequestID(t *testing.T) {
+	assert.True(t, validRequestID("5c1b2f3e-9a7d-4b8e-8f0a-1234567890ab"))
+	assert.False(t, validRequestID(""))
+	assert.False(t, validRequestID("has space"))
+	assert.False(t, validRequestID("new\nline"))
+	assert.False(t, validRequestID(strings.Repeat("a", 129)))
+	assert.Len(t, newID(16), 32)
+}
@@ -39,6 +39,58 @@ func ProxyRedirects2Lines(redirectRules []*models.ProxyRedirect) string {
 	return strings.Join(redirects, "\n")
 }
 
+// ProxyRewrites2Lines method transforms the proxy rewrites into display line text.
+func ProxyRewrites2Lines(rewrites []*models.ProxyRewrite) string {
+	if len(rewrites) == 0 {
+		return ""
+	}
+	var lines []string
+	for _, rw := range rewrites {
+		switch rw.Type {
+		case "strip-prefix":
+			lines = append(lines, rw.Type+", "+rw.Match)
+		case "add-prefix":
+			lines = append(lines, rw.Type+", "+rw.Target)
+		default:
+			lines = append(lines, rw.Type+", "+rw.Match+", "+rw.Target)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ProxySplitVariants2Lines method transforms the traffic split variants into display line text.
+func ProxySplitVariants2Lines(split *models.ProxySplit) string {
+	if split == nil {
+		return ""
+	}
+	var lines []string
+	for _, v := range split.Variants {
+		lines = append(lines, v.Name+", "+v.TargetURL+", "+strconv.Itoa(v.Weight))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ProxyTargets2Lines method transforms the proxy upstream targets into display line text.
+func ProxyTargets2Lines(targets []*models.ProxyTarget) string {
+	if len(targets) == 0 {
+		return ""
+	}
+	var lines []string
+	for _, t := range targets {
+		lines = append(lines, t.URL+", "+strconv.Itoa(t.Weight))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Ints2String method transforms the int slice into comma separated values.
+func Ints2String(values []int) string {
+	var result []string
+	for _, v := range values {
+		result = append(result, strconv.Itoa(v))
+	}
+	return strings.Join(result, ", ")
+}
+
 // MapString2String method transforms the map into multi-line wiyth given delimiter.
 func MapString2String(values map[string]string, delimiter, joinstr string) string {
 	if len(values) == 0 {
@@ -73,7 +125,8 @@ func IsProxyConditionsExists(rule *models.ProxyRule) bool {
 	if rule == nil {
 		return false
 	}
-	return len(rule.Path) > 0 || len(rule.QueryParams) > 0 || len(rule.Headers) > 0
+	return len(rule.Path) > 0 || len(rule.Methods) > 0 || len(rule.QueryParams) > 0 ||
+		len(rule.Headers) > 0 || len(rule.Cookies) > 0
 }
 
 // IsProxyRestrictFilesExists method returns true if rrestrict files config exists
@@ -18,6 +18,7 @@ import (
 	"bufio"
 	"errors"
 	"net/http"
+	"net/url"
 	"path/filepath"
 	"regexp"
 	"sort"
@@ -104,6 +105,83 @@ func Lines2Redirects(input string) ([]*models.ProxyRedirect, []string) {
 	return result, errResult
 }
 
+// Lines2Rewrites method transforms the multi-lines to slice of proxy
+// rewrites, syntax: `type, match, target`.
+func Lines2Rewrites(input string) ([]*models.ProxyRewrite, []string) {
+	if ess.IsStrEmpty(input) {
+		return nil, nil
+	}
+
+	result := make([]*models.ProxyRewrite, 0)
+	errResult := make([]string, 0)
+	scanner := bufio.NewScanner(strings.NewReader(input))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+		parts := strings.SplitN(line, ",", 3)
+		for i := range parts {
+			parts[i] = strings.TrimSpace(parts[i])
+		}
+		rw := &models.ProxyRewrite{Type: strings.ToLower(parts[0])}
+		switch {
+		case rw.Type == "strip-prefix" && len(parts) == 2 && strings.HasPrefix(parts[1], "/"):
+			rw.Match = parts[1]
+		case rw.Type == "add-prefix" && len(parts) == 2 && strings.HasPrefix(parts[1], "/"):
+			rw.Target = parts[1]
+		case (rw.Type == "replace" || rw.Type == "query-replace") && len(parts) == 3 && len(parts[1]) > 0:
+			rw.Match, rw.Target = parts[1], parts[2]
+			ml := len(rw.Match)
+			if ml > 1 && rw.Match[0] == '{' && rw.Match[ml-1] == '}' {
+				if _, err := regexp.Compile(rw.Match[1 : ml-1]); err != nil {
+					errResult = append(errResult, line+" - invalid regex")
+					continue
+				}
+			}
+		default:
+			errResult = append(errResult, line)
+			continue
+		}
+		result = append(result, rw)
+	}
+	return result, errResult
+}
+
+// Lines2SplitVariants method transforms the multi-lines to slice of proxy
+// traffic split variants, syntax: `name, target-url, weight`.
+func Lines2SplitVariants(input string) ([]*models.ProxySplitVariant, []string) {
+	if ess.IsStrEmpty(input) {
+		return nil, nil
+	}
+
+	result := make([]*models.ProxySplitVariant, 0)
+	errResult := make([]string, 0)
+	scanner := bufio.NewScanner(strings.NewReader(input))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+		parts := strings.Split(line, ",")
+		if len(parts) != 3 {
+			errResult = append(errResult, line)
+			continue
+		}
+		weight, err := strconv.Atoi(strings.TrimSpace(parts[2]))
+		if err != nil {
+			errResult = append(errResult, line+" - invalid weight")
+			continue
+		}
+		result = append(result, &models.ProxySplitVariant{
+			Name:      strings.TrimSpace(parts[0]),
+			TargetURL: strings.TrimSpace(parts[1]),
+			Weight:    weight,
+		})
+	}
+	return result, errResult
+}
+
 // Lines2RestrictFiles method transforms the lines into string slice.
 func Lines2RestrictFiles(input string) ([]string, []string) {
 	if ess.IsStrEmpty(input) {
@@ -190,6 +268,84 @@ func Lines2HeaderSlice(input, shouldNotExists, msg string) ([]string, []string)
 	return result, errResult
 }
 
+// Lines2Targets method transforms the lines into proxy upstream targets slice.
+func Lines2Targets(input string) ([]*models.ProxyTarget, []string) {
+	if ess.IsStrEmpty(input) {
+		return nil, nil
+	}
+	result := make([]*models.ProxyTarget, 0)
+	errResult := make([]string, 0)
+	scanner := bufio.NewScanner(strings.NewReader(input))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+		parts := strings.Split(line, ",")
+		if len(parts) > 2 {
+			errResult = append(errResult, line)
+			continue
+		}
+		parts[0] = strings.TrimSpace(parts[0])
+		if u, err := url.Parse(parts[0]); err != nil || !IsAbsURL(parts[0]) || len(u.Host) == 0 {
+			errResult = append(errResult, parts[0]+" - target URL must begin with http or https")
+			continue
+		}
+		target := &models.ProxyTarget{URL: parts[0], Weight: 1}
+		if len(parts) == 2 {
+			weight, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+			if err != nil || weight <= 0 {
+				errResult = append(errResult, line+" - weight must be a positive number")
+				continue
+			}
+			target.Weight = weight
+		}
+		result = append(result, target)
+	}
+	return result, errResult
+}
+
+// Str2Ints method transforms the comma separated values into int slice.
+func Str2Ints(input string) ([]int, []string) {
+	if ess.IsStrEmpty(input) {
+		return nil, nil
+	}
+	result := make([]int, 0)
+	errResult := make([]string, 0)
+	for _, v := range strings.Split(input, ",") {
+		v = strings.TrimSpace(v)
+		if len(v) == 0 {
+			continue
+		}
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			errResult = append(errResult, v+" - must be a number")
+			continue
+		}
+		result = append(result, i)
+	}
+	return result, errResult
+}
+
+// Str2Values method splits the comma, space or new line separated values,
+// empty values are skipped.
+func Str2Values(input string) []string {
+	return strings.FieldsFunc(input, func(r rune) bool {
+		return r == ',' || r == '\n' || r == '\r' || r == ' ' || r == '\t'
+	})
+}
+
+// IsHTTPMethod method returns true if given value is standard HTTP method.
+func IsHTTPMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodConnect,
+		http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
 // IsSupportedRedirectCode method returns if given code is supported by proxy.
 func IsSupportedRedirectCode(code int) bool {
 	switch code {
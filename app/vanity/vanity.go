@@ -22,6 +22,7 @@ import (
 	"strings"
 	"sync"
 
+	"thumbai/app/metrics"
 	"thumbai/app/models"
 
 	"aahframe.work"
@@ -33,6 +34,9 @@ var errNodeExists = errors.New("tree: node exists")
 // Thumbai vanities instance.
 var Thumbai *vanities
 
+var lookupsTotal = metrics.NewCounter("thumbai_vanity_lookups_total",
+	"Total vanity package lookups by host and result, result is 'found' or 'not_found'.", "host", "result")
+
 //‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾‾
 // Package methods
 //______________________________________________________________________________
@@ -44,14 +48,16 @@ func Lookup(host, p string) *models.VanityPackage {
 	if vh == nil {
 		return nil
 	}
-	if p == "/" || p == "" {
-		return vh.Root
+	vp := vh.Root
+	if p != "/" && p != "" {
+		if vp = vh.Lookup(p); vp == nil && vh.IsRootVanity(p) { // check root vanity
+			vp = vh.Root
+		}
 	}
-	vp := vh.Lookup(p)
 	if vp == nil {
-		if vh.IsRootVanity(p) { // check root vanity
-			return vh.Root
-		}
+		lookupsTotal.Inc(vh.Name, "not_found")
+	} else {
+		lookupsTotal.Inc(vh.Name, "found")
 	}
 	return vp
 }
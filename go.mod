@@ -3,11 +3,14 @@ module thumbai
 require (
 	aahframe.work v0.12.3
 	aahframe.work/minify/html v0.2.0
+	github.com/andybalholm/brotli v1.0.2
 	github.com/stretchr/testify v1.2.2
 	github.com/tdewolff/test v1.0.0 // indirect
 	go.etcd.io/bbolt v1.3.1-etcd.8
-	golang.org/x/sync v0.0.0-20181221193216-37e7f081c4d4 // indirect
-	golang.org/x/sys v0.0.0-20190222171317-cd391775e71e // indirect
+	golang.org/x/crypto v0.14.0
+	golang.org/x/mod v0.14.0
+	golang.org/x/sync v0.3.0 // indirect
+	golang.org/x/sys v0.13.0 // indirect
 	google.golang.org/appengine v1.4.0 // indirect
 	gopkg.in/go-playground/assert.v1 v1.2.1 // indirect
 )